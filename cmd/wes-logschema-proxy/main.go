@@ -0,0 +1,95 @@
+// Command wes-logschema-proxy is a reverse proxy that sits in front of a WES
+// server and validates the structured logs in its /runs/{run_id} and
+// /runs/{run_id}/tasks responses.
+//
+// Run: go run ./cmd/wes-logschema-proxy -upstream http://localhost:8000 -policy annotate
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+	"github.com/animeshs34/wes-logging-schema/internal/wes"
+	"github.com/animeshs34/wes-logging-schema/internal/wesproxy"
+)
+
+func main() {
+	listen := flag.String("listen", ":8080", "address to listen on")
+	upstreamURL := flag.String("upstream", "", "WES server to proxy to (scheme://host[:port])")
+	basePath := flag.String("base-path", wes.BasePath, "WES API prefix whose run and task routes are validated")
+	policyName := flag.String("policy", string(wesproxy.PolicyAnnotate), "pass, annotate, report or reject")
+	metricsPath := flag.String("metrics-path", "/_logschema/metrics", "path serving per-route validation metrics (empty disables)")
+	schemaDir := flag.String("schema-dir", "", "local directory of schema documents")
+	redactRules := flag.String("redact-rules", "", "JSON file of redaction rules applied before responses are served")
+	redactDefaults := flag.Bool("redact-defaults", false, "redact common credentials (tokens, signed URLs, access keys)")
+	redactKey := flag.String("redact-pseudonym-key", "", "file holding the secret key for @id pseudonyms (at least 16 bytes)")
+	flag.Parse()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+	if *upstreamURL == "" {
+		fmt.Fprintln(os.Stderr, "wes-logschema-proxy: -upstream is required")
+		os.Exit(2)
+	}
+	upstream, err := url.Parse(*upstreamURL)
+	if err != nil || upstream.Scheme == "" || upstream.Host == "" {
+		fmt.Fprintf(os.Stderr, "wes-logschema-proxy: invalid -upstream %q\n", *upstreamURL)
+		os.Exit(2)
+	}
+	policy, err := wesproxy.ParsePolicy(*policyName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "wes-logschema-proxy: %v\n", err)
+		os.Exit(2)
+	}
+
+	var rules []logschema.RedactionRule
+	if *redactDefaults {
+		rules = logschema.DefaultRedactionRules()
+	}
+	if *redactRules != "" {
+		extra, err := logschema.LoadRedactionRules(*redactRules)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wes-logschema-proxy: %v\n", err)
+			os.Exit(2)
+		}
+		rules = append(rules, extra...)
+	}
+
+	metrics := &wesproxy.Metrics{}
+	m := &wesproxy.Middleware{
+		BasePath:  *basePath,
+		Validator: &logschema.Validator{SchemaDir: *schemaDir},
+		Policy:    policy,
+		Logger:    logger,
+		Metrics:   metrics,
+	}
+	if len(rules) > 0 {
+		if m.Redactor, err = logschema.NewRedactor(rules); err != nil {
+			fmt.Fprintf(os.Stderr, "wes-logschema-proxy: %v\n", err)
+			os.Exit(2)
+		}
+		if *redactKey != "" {
+			if m.Redactor.PseudonymKey, err = logschema.LoadPseudonymKey(*redactKey); err != nil {
+				fmt.Fprintf(os.Stderr, "wes-logschema-proxy: %v\n", err)
+				os.Exit(2)
+			}
+		}
+	}
+
+	mux := http.NewServeMux()
+	if *metricsPath != "" {
+		mux.Handle(*metricsPath, metrics)
+	}
+	mux.Handle("/", wesproxy.NewReverseProxy(upstream, m))
+
+	logger.Info("proxy listening", "addr", *listen, "upstream", upstream.String(), "policy", policy)
+	if err := http.ListenAndServe(*listen, mux); err != nil {
+		logger.Error("proxy stopped", "error", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/animeshs34/wes-logging-schema/internal/conformance"
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+	"github.com/animeshs34/wes-logging-schema/internal/wes"
+)
+
+func runConformance(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("conformance", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: wes-logschema conformance -wes-url URL [flags]")
+		fmt.Fprintln(stderr, "\nExits 0 when no MUST requirement fails, 1 otherwise.")
+		fmt.Fprintln(stderr, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	wesURL := fs.String("wes-url", "", "WES API root of the server under test")
+	output := fs.String("o", "text", "output format: text or json")
+	resolve := fs.Bool("resolve", false, "check that schema_uri and structured_log URIs resolve")
+	fetchStreams := fs.Bool("fetch-streams", false, "dereference stdout/stderr URLs and inspect their content")
+	schemaDir := fs.String("schema-dir", "", "local directory of schema documents")
+	pageSize := fs.Int("page-size", 0, "page_size used when listing runs and tasks")
+	drs := drsFlags(fs, "validate drs:// structured logs through the GA4GH DRS API (bearer token from $DRS_BEARER_TOKEN)")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitValid
+		}
+		return exitError
+	}
+	if *wesURL == "" {
+		fmt.Fprintln(stderr, "wes-logschema: -wes-url is required")
+		return exitError
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(stderr, "wes-logschema: unknown output format %q\n", *output)
+		return exitError
+	}
+
+	runner := &conformance.Runner{
+		Client:       &wes.Client{BaseURL: *wesURL, PageSize: *pageSize},
+		Validator:    &logschema.Validator{SchemaDir: *schemaDir, DRS: drs()},
+		Resolve:      *resolve,
+		FetchStreams: *fetchStreams,
+	}
+	rep, err := runner.Run()
+	if err != nil {
+		fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+		return exitError
+	}
+
+	if *output == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(rep)
+	} else {
+		err = rep.WriteText(stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+		return exitError
+	}
+	if !rep.Conformant {
+		return exitInvalid
+	}
+	return exitValid
+}
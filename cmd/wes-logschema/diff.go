@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+func runDiff(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: wes-logschema diff [flags] OLD NEW")
+		fmt.Fprintln(stderr, "\nCompares the provenance of two runs: RO-Crate entities by @id, PROV records")
+		fmt.Fprintln(stderr, "by identifier, and the inputs, outputs and timings of the run and its tasks.")
+		fmt.Fprintln(stderr, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	kind := fs.String("kind", kindAuto, "document kind: auto, run, task, wes-run or tes")
+	output := fs.String("o", "text", "output format: text or json")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitValid
+		}
+		return exitError
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return exitError
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(stderr, "wes-logschema: unknown output format %q\n", *output)
+		return exitError
+	}
+
+	var runs [2]*logschema.Run
+	for i, name := range fs.Args() {
+		data, err := os.ReadFile(name)
+		if err == nil {
+			runs[i], err = decodeRun(data, *kind)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "wes-logschema: %s: %v\n", name, err)
+			return exitError
+		}
+	}
+	d, err := logschema.DiffRuns(runs[0], runs[1])
+	if err != nil {
+		fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+		return exitError
+	}
+
+	if *output == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(d)
+	} else {
+		err = d.WriteText(stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+		return exitError
+	}
+	if d.Empty() {
+		return exitValid
+	}
+	return exitInvalid
+}
+
+// decodeRun decodes any supported document kind into a WES run envelope.
+func decodeRun(data []byte, kind string) (*logschema.Run, error) {
+	kind, rl, tasks, err := decodeDocument(data, kind)
+	if err != nil {
+		return nil, err
+	}
+	if kind == kindWESRun {
+		var run logschema.Run
+		if err := json.Unmarshal(data, &run); err != nil {
+			return nil, err
+		}
+		return &run, nil
+	}
+	return &logschema.Run{RunLog: rl, TaskLogs: tasks}, nil
+}
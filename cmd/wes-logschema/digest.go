@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+func runDigest(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("digest", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: wes-logschema digest [flags] [file|glob|-]...")
+		fmt.Fprintln(stderr, "\nRecords a structured_log_digest for every structured_log that has none.")
+		fmt.Fprintln(stderr, "Writes the updated document to stdout, or in place with -w. Exits 1 if")
+		fmt.Fprintln(stderr, "some structured_log could not be hashed. Use validate to verify digests.")
+		fmt.Fprintln(stderr, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	kind := fs.String("kind", kindAuto, "document kind: auto, run, task or wes-run")
+	canon := fs.String("canonicalization", "", "none, jcs or urdna2015 (default: chosen from each log_schema)")
+	alg := fs.String("algorithm", string(logschema.DigestSHA256), "sha-256, sha-384 or sha-512")
+	fetch := fs.Bool("fetch", false, "fetch structured_log URIs and remote JSON-LD contexts to hash them")
+	schemaDir := fs.String("schema-dir", "", "local directory of JSON-LD contexts, consulted before the network")
+	write := fs.Bool("w", false, "write updated documents back to their files")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitValid
+		}
+		return exitError
+	}
+
+	inputs, err := expandInputs(fs.Args(), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+		return exitError
+	}
+	if len(inputs) > 1 && !*write {
+		fmt.Fprintln(stderr, "wes-logschema: hashing several inputs requires -w")
+		return exitError
+	}
+	var v *logschema.Validator
+	if *fetch || *schemaDir != "" {
+		v = &logschema.Validator{SchemaDir: *schemaDir, Offline: !*fetch}
+	}
+
+	code := exitValid
+	for _, in := range inputs {
+		data, err := in.read()
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", in.name, err)
+			code = exitError
+			continue
+		}
+		out, recorded, skipped, err := digestDocument(v, data, *kind, logschema.Canonicalization(*canon), logschema.DigestAlgorithm(*alg))
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", in.name, err)
+			code = exitError
+			continue
+		}
+		for _, loc := range recorded {
+			fmt.Fprintf(stderr, "%s: %s: recorded structured_log_digest\n", in.name, loc)
+		}
+		for _, s := range skipped {
+			fmt.Fprintf(stderr, "%s: %s\n", in.name, s)
+			if code == exitValid {
+				code = exitInvalid
+			}
+		}
+
+		if *write && in.name != "<stdin>" {
+			if err := os.WriteFile(in.name, out, 0o644); err != nil {
+				fmt.Fprintf(stderr, "%s: %v\n", in.name, err)
+				code = exitError
+			}
+			continue
+		}
+		stdout.Write(out)
+	}
+	return code
+}
+
+// digestDocument applies logschema.RecordDigests to a document and
+// re-encodes it.
+func digestDocument(v *logschema.Validator, data []byte, kind string, c logschema.Canonicalization, alg logschema.DigestAlgorithm) (out []byte, recorded, skipped []string, err error) {
+	out, err = updateDocument(data, kind, func(rl *logschema.RunLog, tasks []logschema.TaskLog) {
+		recorded, skipped = logschema.RecordDigests(v, rl, tasks, c, alg)
+	})
+	return out, recorded, skipped, err
+}
+
+// updateDocument decodes a RunLog, TaskLog or WES run document, lets fn
+// modify its structured logs and re-encodes it.
+func updateDocument(data []byte, kind string, fn func(rl *logschema.RunLog, tasks []logschema.TaskLog)) ([]byte, error) {
+	if kind == kindAuto {
+		var err error
+		if kind, err = detectKind(data); err != nil {
+			return nil, err
+		}
+	}
+	var doc interface{}
+	switch kind {
+	case kindRun:
+		var rl logschema.RunLog
+		if err := json.Unmarshal(data, &rl); err != nil {
+			return nil, fmt.Errorf("decoding RunLog: %w", err)
+		}
+		fn(&rl, nil)
+		doc = &rl
+	case kindTask:
+		tasks := make([]logschema.TaskLog, 1)
+		if err := json.Unmarshal(data, &tasks[0]); err != nil {
+			return nil, fmt.Errorf("decoding TaskLog: %w", err)
+		}
+		fn(nil, tasks)
+		doc = &tasks[0]
+	case kindWESRun:
+		var run logschema.Run
+		if err := json.Unmarshal(data, &run); err != nil {
+			return nil, fmt.Errorf("decoding WES run: %w", err)
+		}
+		fn(run.RunLog, run.TaskLogs)
+		doc = &run
+	default:
+		return nil, fmt.Errorf("unknown document kind %q", kind)
+	}
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
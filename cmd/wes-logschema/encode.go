@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+func runEncode(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("encode", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: wes-logschema encode [-encoding ENC | -d] [flags] [file|glob|-]...")
+		fmt.Fprintln(stderr, "\nCompresses inline structured logs and declares log_schema.content_encoding,")
+		fmt.Fprintln(stderr, "or with -d decodes them again. Digests and signatures cover the decoded")
+		fmt.Fprintln(stderr, "content and stay valid. Writes the updated document to stdout, or in place")
+		fmt.Fprintln(stderr, "with -w. Exits 1 if some structured_log could not be encoded or decoded.")
+		fmt.Fprintln(stderr, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	kind := fs.String("kind", kindAuto, "document kind: auto, run, task or wes-run")
+	encoding := fs.String("encoding", logschema.EncodingGzipBase64, "content encoding: base64 or gzip+base64")
+	minSize := fs.Int("min-size", 0, "leave structured logs smaller than this many bytes unencoded")
+	decode := fs.Bool("d", false, "decode encoded structured logs instead")
+	maxDecoded := fs.Int64("max-decoded-size", logschema.DefaultMaxDecodedSize, "maximum decoded size in bytes of a structured_log, with -d")
+	write := fs.Bool("w", false, "write updated documents back to their files")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitValid
+		}
+		return exitError
+	}
+	if !*decode {
+		if _, err := logschema.EncodeContent(nil, *encoding); err != nil {
+			fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+			return exitError
+		}
+	}
+
+	inputs, err := expandInputs(fs.Args(), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+		return exitError
+	}
+	if len(inputs) > 1 && !*write {
+		fmt.Fprintln(stderr, "wes-logschema: encoding several inputs requires -w")
+		return exitError
+	}
+	v := &logschema.Validator{MaxDecodedSize: *maxDecoded}
+
+	code := exitValid
+	for _, in := range inputs {
+		data, err := in.read()
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", in.name, err)
+			code = exitError
+			continue
+		}
+		var changed, skipped []string
+		out, err := updateDocument(data, *kind, func(rl *logschema.RunLog, tasks []logschema.TaskLog) {
+			if *decode {
+				changed, skipped = logschema.DecodeStructuredLogs(v, rl, tasks)
+			} else {
+				changed, skipped = logschema.EncodeStructuredLogs(rl, tasks, *encoding, *minSize)
+			}
+		})
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", in.name, err)
+			code = exitError
+			continue
+		}
+		verb := "encoded as " + *encoding
+		if *decode {
+			verb = "decoded"
+		}
+		for _, loc := range changed {
+			fmt.Fprintf(stderr, "%s: %s: %s\n", in.name, loc, verb)
+		}
+		for _, s := range skipped {
+			fmt.Fprintf(stderr, "%s: %s\n", in.name, s)
+			if code == exitValid {
+				code = exitInvalid
+			}
+		}
+
+		if *write && in.name != "<stdin>" {
+			if err := os.WriteFile(in.name, out, 0o644); err != nil {
+				fmt.Fprintf(stderr, "%s: %v\n", in.name, err)
+				code = exitError
+			}
+			continue
+		}
+		stdout.Write(out)
+	}
+	return code
+}
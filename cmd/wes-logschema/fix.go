@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+func runFix(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("fix", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: wes-logschema fix [flags] [file|glob|-]...")
+		fmt.Fprintln(stderr, "\nFills in missing log_schema declarations by detecting the structured_log")
+		fmt.Fprintln(stderr, "format. Writes the fixed document to stdout, or in place with -w.")
+		fmt.Fprintln(stderr, "Exits 1 if some structured_log still has no schema.")
+		fmt.Fprintln(stderr, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	kind := fs.String("kind", kindAuto, "document kind: auto, run, task or wes-run")
+	minConfidence := fs.Float64("min-confidence", 0.5, "minimum detection confidence to apply a schema")
+	write := fs.Bool("w", false, "write fixed documents back to their files")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitValid
+		}
+		return exitError
+	}
+
+	inputs, err := expandInputs(fs.Args(), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+		return exitError
+	}
+	if len(inputs) > 1 && !*write {
+		fmt.Fprintln(stderr, "wes-logschema: fixing several inputs requires -w")
+		return exitError
+	}
+
+	code := exitValid
+	for _, in := range inputs {
+		data, err := in.read()
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", in.name, err)
+			code = exitError
+			continue
+		}
+		fixed, fixes, unresolved, err := fixDocument(data, *kind, *minConfidence)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", in.name, err)
+			code = exitError
+			continue
+		}
+		for _, f := range fixes {
+			fmt.Fprintf(stderr, "%s: %s: set log_schema format=%q schema_uri=%q (confidence %.2f: %s)\n",
+				in.name, f.Location, f.Detection.Schema.Format, f.Detection.Schema.SchemaURI, f.Detection.Confidence, f.Detection.Reason)
+		}
+		for _, loc := range unresolved {
+			fmt.Fprintf(stderr, "%s: %s: could not infer a log_schema\n", in.name, loc)
+			if code == exitValid {
+				code = exitInvalid
+			}
+		}
+
+		if *write && in.name != "<stdin>" {
+			if err := os.WriteFile(in.name, fixed, 0o644); err != nil {
+				fmt.Fprintf(stderr, "%s: %v\n", in.name, err)
+				code = exitError
+			}
+			continue
+		}
+		stdout.Write(fixed)
+	}
+	return code
+}
+
+// fixDocument applies logschema.FixSchemas to a document and re-encodes it.
+func fixDocument(data []byte, kind string, minConfidence float64) ([]byte, []logschema.SchemaFix, []string, error) {
+	if kind == kindAuto {
+		var err error
+		if kind, err = detectKind(data); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	var (
+		doc        interface{}
+		fixes      []logschema.SchemaFix
+		unresolved []string
+	)
+	switch kind {
+	case kindRun:
+		var rl logschema.RunLog
+		if err := json.Unmarshal(data, &rl); err != nil {
+			return nil, nil, nil, fmt.Errorf("decoding RunLog: %w", err)
+		}
+		fixes, unresolved = logschema.FixSchemas(&rl, nil, minConfidence)
+		doc = &rl
+	case kindTask:
+		tasks := make([]logschema.TaskLog, 1)
+		if err := json.Unmarshal(data, &tasks[0]); err != nil {
+			return nil, nil, nil, fmt.Errorf("decoding TaskLog: %w", err)
+		}
+		fixes, unresolved = logschema.FixSchemas(nil, tasks, minConfidence)
+		doc = &tasks[0]
+	case kindWESRun:
+		var run logschema.Run
+		if err := json.Unmarshal(data, &run); err != nil {
+			return nil, nil, nil, fmt.Errorf("decoding WES run: %w", err)
+		}
+		fixes, unresolved = logschema.FixSchemas(run.RunLog, run.TaskLogs, minConfidence)
+		doc = &run
+	default:
+		return nil, nil, nil, fmt.Errorf("unknown document kind %q", kind)
+	}
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return append(out, '\n'), fixes, unresolved, nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+func runImport(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: wes-logschema import -from ENGINE [flags] PATH...")
+		fmt.Fprintln(stderr, "\nConverts a workflow engine's own run records into a WES run document with")
+		fmt.Fprintln(stderr, "structured logs, written to stdout. Engines and the paths they take:")
+		fmt.Fprintln(stderr, "  nextflow   trace.txt, report.html and/or an nf-prov ro-crate-metadata.json")
+		fmt.Fprintln(stderr, "  cromwell   a workflow metadata.json, fetched with expandSubWorkflows=true")
+		fmt.Fprintln(stderr, "  cwlprov    a research object directory written by cwltool --provenance")
+		fmt.Fprintln(stderr, "  snakemake  the working directory or its .snakemake/metadata, and/or report.html")
+		fmt.Fprintln(stderr, "\nExits 1 if the imported run does not validate.")
+		fmt.Fprintln(stderr, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	from := fs.String("from", "", "engine that wrote the records: nextflow, cromwell, cwlprov or snakemake")
+	runID := fs.String("run-id", "", "run_id of the imported run (default: taken from the records, if they have one)")
+	format := fs.String("format", "", "structured_log format: ro-crate or opm (PROV) (default ro-crate, or opm for cwlprov)")
+	script := fs.String("script", "", "workflow script or pipeline name, for nextflow and snakemake")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitValid
+		}
+		return exitError
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(stderr, "wes-logschema: import needs at least one path")
+		return exitError
+	}
+
+	var run *logschema.Run
+	var err error
+	switch *from {
+	case "nextflow":
+		run, err = importNextflow(fs.Args(), *runID, *script, logschema.Format(*format))
+	case "cromwell":
+		run, err = importCromwell(fs.Args(), *runID, logschema.Format(*format))
+	case "cwlprov":
+		run, err = importCWLProv(fs.Args(), *runID, logschema.Format(*format))
+	case "snakemake":
+		run, err = importSnakemake(fs.Args(), *runID, *script, logschema.Format(*format))
+	case "":
+		err = errors.New("-from is required")
+	default:
+		err = fmt.Errorf("unknown engine %q", *from)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+		return exitError
+	}
+
+	out, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+		return exitError
+	}
+	stdout.Write(append(out, '\n'))
+
+	res, err := (&logschema.Validator{Offline: true}).ValidateRun(run.RunLog, run.TaskLogs)
+	if err != nil {
+		fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+		return exitError
+	}
+	if !res.Valid() {
+		fmt.Fprintf(stderr, "wes-logschema: imported run has %d invalid structured logs\n", res.Failures())
+		return exitInvalid
+	}
+	return exitValid
+}
+
+// importNextflow sorts the given files into a trace, an execution report
+// and an nf-prov crate by their content.
+func importNextflow(paths []string, runID, script string, to logschema.Format) (*logschema.Run, error) {
+	rec := logschema.NextflowRecords{Script: script}
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		switch trimmed := bytes.TrimSpace(data); {
+		case bytes.Contains(data, []byte("window.data")):
+			rec.Report = data
+		case bytes.HasPrefix(trimmed, []byte("{")) && bytes.Contains(data, []byte(`"@graph"`)):
+			rec.Provenance = data
+		case bytes.HasPrefix(trimmed, []byte("{")):
+			rec.Report = data
+		default:
+			rec.Trace = data
+		}
+	}
+	if runID == "" {
+		return nil, errors.New("Nextflow records carry no run ID; set -run-id")
+	}
+	return logschema.ImportNextflow(runID, rec, to)
+}
+
+// importCromwell reads one Cromwell metadata document.
+func importCromwell(paths []string, runID string, to logschema.Format) (*logschema.Run, error) {
+	if len(paths) != 1 {
+		return nil, errors.New("cromwell imports exactly one metadata file")
+	}
+	data, err := os.ReadFile(paths[0])
+	if err != nil {
+		return nil, err
+	}
+	var md logschema.CromwellMetadata
+	if err := json.Unmarshal(data, &md); err != nil {
+		return nil, fmt.Errorf("decoding Cromwell metadata: %w", err)
+	}
+	if runID != "" {
+		md.ID = runID
+	}
+	return logschema.ImportCromwell(&md, to)
+}
+
+// importCWLProv reads one CWLProv research object, converting its PROV
+// structured logs if another format is asked for.
+func importCWLProv(paths []string, runID string, to logschema.Format) (*logschema.Run, error) {
+	if len(paths) != 1 {
+		return nil, errors.New("cwlprov imports exactly one research object directory")
+	}
+	run, err := logschema.ImportCWLProv(paths[0])
+	if err != nil {
+		return nil, err
+	}
+	if runID != "" {
+		run.RunID = runID
+	}
+	if to != "" && to != logschema.FormatOPM {
+		if _, err := logschema.ConvertRun(run.RunLog, run.TaskLogs, to); err != nil {
+			return nil, err
+		}
+	}
+	return run, nil
+}
+
+// importSnakemake reads a report file and the metadata records of a
+// Snakemake working directory, its .snakemake directory or the metadata
+// directory itself.
+func importSnakemake(paths []string, runID, snakefile string, to logschema.Format) (*logschema.Run, error) {
+	rec := logschema.SnakemakeRecords{Snakefile: snakefile}
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			if rec.Report, err = os.ReadFile(p); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for _, sub := range []string{filepath.Join(".snakemake", "metadata"), "metadata"} {
+			if info, err := os.Stat(filepath.Join(p, sub)); err == nil && info.IsDir() {
+				p = filepath.Join(p, sub)
+				break
+			}
+		}
+		if rec.Metadata, err = logschema.ReadSnakemakeMetadata(p); err != nil {
+			return nil, err
+		}
+	}
+	if runID == "" {
+		return nil, errors.New("Snakemake records carry no run ID; set -run-id")
+	}
+	return logschema.ImportSnakemake(runID, rec, to)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+// lintResult is the stream lint outcome for one input source.
+type lintResult struct {
+	Source string                `json:"source"`
+	Report *logschema.LintReport `json:"report,omitempty"`
+	Error  string                `json:"error,omitempty"`
+}
+
+func runLint(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: wes-logschema lint [flags] [file|glob|-]...")
+		fmt.Fprintln(stderr, "\nReports structured data (JSON, JSON-LD, NDJSON, PROV) found in stdout/stderr,")
+		fmt.Fprintln(stderr, "which are reserved for plain text, and suggests a log_schema for it.")
+		fmt.Fprintln(stderr, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	kind := fs.String("kind", kindAuto, "document kind: auto, run, task, wes-run or tes")
+	output := fs.String("o", "text", "output format: text or json")
+	deref := fs.Bool("dereference", false, "fetch stdout/stderr URLs and inspect their content")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitValid
+		}
+		return exitError
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(stderr, "wes-logschema: unknown output format %q\n", *output)
+		return exitError
+	}
+
+	inputs, err := expandInputs(fs.Args(), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+		return exitError
+	}
+
+	linter := &logschema.StreamLinter{Dereference: *deref}
+	code := exitValid
+	var results []lintResult
+	for _, in := range inputs {
+		res := lintResult{Source: in.name}
+		data, err := in.read()
+		if err == nil {
+			var rl *logschema.RunLog
+			var tasks []logschema.TaskLog
+			if _, rl, tasks, err = decodeDocument(data, *kind); err == nil {
+				res.Report = linter.LintRun(rl, tasks)
+			}
+		}
+		switch {
+		case err != nil:
+			res.Error = err.Error()
+			code = exitError
+		case len(res.Report.Findings) > 0 && code == exitValid:
+			code = exitInvalid
+		}
+		results = append(results, res)
+	}
+
+	if *output == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+			return exitError
+		}
+		return code
+	}
+	for _, res := range results {
+		fmt.Fprintln(stdout, res.Source)
+		switch {
+		case res.Error != "":
+			fmt.Fprintf(stdout, "  ERROR: %s\n", res.Error)
+		case len(res.Report.Findings) == 0:
+			fmt.Fprintln(stdout, "  ✓ stdout/stderr are plain text")
+		}
+		if res.Report == nil {
+			continue
+		}
+		for _, f := range res.Report.Findings {
+			fmt.Fprintf(stdout, "  ✗ %s\n", f)
+		}
+		for _, u := range res.Report.Unreachable {
+			fmt.Fprintf(stdout, "  ? could not fetch %s\n", u)
+		}
+	}
+	return code
+}
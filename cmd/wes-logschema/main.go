@@ -0,0 +1,109 @@
+// Command wes-logschema validates WES structured logs (Issue #215) from the
+// command line, for use in CI.
+//
+// Usage:
+//
+//	wes-logschema validate [flags] [file|glob|-]...
+//	wes-logschema validate -wes-url URL [run-id]...
+//	wes-logschema conformance -wes-url URL [flags]
+//	wes-logschema lint [flags] [file|glob|-]...
+//	wes-logschema fix [flags] [file|glob|-]...
+//	wes-logschema digest [flags] [file|glob|-]...
+//	wes-logschema sign -key-dir DIR -key-id ID [flags] [file|glob|-]...
+//	wes-logschema keygen -key-dir DIR -key-id ID [-alg ALG]
+//	wes-logschema redact (-rules FILE | -defaults) [flags] [file|glob|-]...
+//	wes-logschema encode [-encoding ENC | -d] [flags] [file|glob|-]...
+//	wes-logschema store -to STORE [flags] [file|glob|-]...
+//	wes-logschema import -from ENGINE [flags] PATH...
+//	wes-logschema query (-jsonpath EXPR | -graph QUERY) [flags] [file|glob|-]...
+//	wes-logschema diff [flags] OLD NEW
+//
+// Exit codes: 0 when everything validated, 1 when at least one structured
+// log is invalid (for lint: a stream holds structured data; for fix: a schema
+// could not be inferred; for digest and sign: a structured_log could not be
+// hashed or signed; for redact: a structured_log could not be redacted
+// safely; for encode: a structured_log could not be encoded or decoded; for
+// store: a structured_log could not be stored, or -list found nothing; for
+// import: the imported run does not validate; for query: nothing matched;
+// for diff: the runs differ), 2 on usage, I/O or parse errors.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	exitValid   = 0
+	exitInvalid = 1
+	exitError   = 2
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run dispatches to a subcommand and returns the process exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return exitError
+	}
+	switch args[0] {
+	case "validate":
+		return runValidate(args[1:], stdin, stdout, stderr)
+	case "fix":
+		return runFix(args[1:], stdin, stdout, stderr)
+	case "digest":
+		return runDigest(args[1:], stdin, stdout, stderr)
+	case "sign":
+		return runSign(args[1:], stdin, stdout, stderr)
+	case "keygen":
+		return runKeygen(args[1:], stderr)
+	case "redact":
+		return runRedact(args[1:], stdin, stdout, stderr)
+	case "encode":
+		return runEncode(args[1:], stdin, stdout, stderr)
+	case "store":
+		return runStore(args[1:], stdin, stdout, stderr)
+	case "import":
+		return runImport(args[1:], stdout, stderr)
+	case "diff":
+		return runDiff(args[1:], stdout, stderr)
+	case "query":
+		return runQuery(args[1:], stdin, stdout, stderr)
+	case "lint":
+		return runLint(args[1:], stdin, stdout, stderr)
+	case "conformance":
+		return runConformance(args[1:], stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		usage(stdout)
+		return exitValid
+	}
+	fmt.Fprintf(stderr, "wes-logschema: unknown command %q\n\n", args[0])
+	usage(stderr)
+	return exitError
+}
+
+func usage(w io.Writer) {
+	fmt.Fprint(w, `Usage: wes-logschema <command> [flags] [args]
+
+Commands:
+  validate      validate RunLog/TaskLog/WES run documents or bare payloads
+  conformance   score a WES server against the structured logging requirements
+  lint          find structured data smuggled into stdout/stderr
+  fix           fill in missing log_schema declarations by format detection
+  digest        record structured_log_digest content hashes
+  sign          add detached JWS or DSSE signatures to structured logs
+  keygen        create a local Ed25519 or ECDSA signing key
+  redact        remove secrets and personal data before export
+  encode        compress inline structured logs, or decode them with -d
+  store         move structured logs to a directory or S3 bucket
+  import        convert workflow engine records into a WES run document
+  query         query structured logs with JSONPath or a graph pattern
+  diff          compare the provenance of two runs
+
+Run "wes-logschema <command> -h" for command flags.
+`)
+}
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+	"github.com/animeshs34/wes-logging-schema/internal/wes"
+)
+
+const validRun = `{
+	"name": "pipeline",
+	"structured_log": "{\"@context\": \"https://w3id.org/ro/crate/1.1/context\", \"@graph\": []}",
+	"log_schema": {"schema_uri": "https://w3id.org/ro/crate/1.1", "format": "ro-crate"}
+}`
+
+const invalidWESRun = `{
+	"run_id": "run-1",
+	"run_log": {
+		"structured_log": "{\"@context\": \"https://w3id.org/ro/crate/1.1/context\", \"@graph\": []}",
+		"log_schema": {"schema_uri": "https://w3id.org/ro/crate/1.1", "format": "ro-crate"}
+	},
+	"task_logs": [{"id": "align", "structured_log": "{\"@context\": \"x\"}"}]
+}`
+
+func runCLI(t *testing.T, stdin string, args ...string) (int, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String() + stderr.String()
+}
+
+func TestValidate_ExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	good := write("good.json", validRun)
+	bad := write("bad.json", invalidWESRun)
+	broken := write("broken.json", `{not json`)
+
+	tests := []struct {
+		name  string
+		stdin string
+		args  []string
+		want  int
+	}{
+		{"valid RunLog file", "", []string{"validate", good}, exitValid},
+		{"invalid task in WES run", "", []string{"validate", bad}, exitInvalid},
+		{"glob mixing valid and invalid", "", []string{"validate", filepath.Join(dir, "[g]*.json"), filepath.Join(dir, "ba?.json")}, exitInvalid},
+		{"unparseable document is an error", "", []string{"validate", good, broken}, exitError},
+		{"missing file is an error", "", []string{"validate", filepath.Join(dir, "nope.json")}, exitError},
+		{"RunLog on stdin", validRun, []string{"validate"}, exitValid},
+		{"bare payload with schema flags", `{"entity": {}}`, []string{"validate", "-schema-uri", "https://www.w3.org/TR/prov-o/", "-format", "opm", "-"}, exitValid},
+		{"bare payload failing format checks", `{"foo": 1}`, []string{"validate", "-schema-uri", "https://www.w3.org/TR/prov-o/", "-format", "opm"}, exitInvalid},
+		{"offline schema resolution without schema dir", validRun, []string{"validate", "-offline", "-resolve-schemas"}, exitInvalid},
+		{"unknown command", "", []string{"frobnicate"}, exitError},
+		{"payload kind without schema", "{}", []string{"validate", "-kind", "payload"}, exitError},
+		{"TES task", `{"id": "t1", "executors": [{"image": "bwa", "command": ["bwa"]}], "logs": [{"logs": [{"stdout": "{\"entity\": {}, \"activity\": {}}", "exit_code": 0}]}]}`, []string{"validate"}, exitValid},
+		{"TES task list with an invalid crate", `{"tasks": [{"id": "t1", "logs": [{"logs": [{"stdout": "{\"@context\": \"https://w3id.org/ro/crate/1.1/context\"}", "exit_code": 1}]}]}]}`, []string{"validate", "-kind", "tes"}, exitInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, out := runCLI(t, tt.stdin, tt.args...)
+			if code != tt.want {
+				t.Errorf("exit code = %d, want %d; output:\n%s", code, tt.want, out)
+			}
+		})
+	}
+}
+
+func TestValidate_OutputFormats(t *testing.T) {
+	t.Run("json", func(t *testing.T) {
+		code, out := runCLI(t, invalidWESRun, "validate", "-o", "json")
+		if code != exitInvalid {
+			t.Fatalf("exit code = %d", code)
+		}
+		var doc struct {
+			Valid   bool
+			Reports []report
+		}
+		if err := json.Unmarshal([]byte(out), &doc); err != nil {
+			t.Fatalf("output is not JSON: %v\n%s", err, out)
+		}
+		if doc.Valid || len(doc.Reports) != 1 || len(doc.Reports[0].Checks) != 2 {
+			t.Errorf("unexpected report: %+v", doc)
+		}
+		if doc.Reports[0].Checks[1].Name != "task align" {
+			t.Errorf("task check named %q", doc.Reports[0].Checks[1].Name)
+		}
+	})
+
+	t.Run("junit", func(t *testing.T) {
+		_, out := runCLI(t, invalidWESRun, "validate", "-o", "junit")
+		var suites junitSuites
+		if err := xml.Unmarshal([]byte(out), &suites); err != nil {
+			t.Fatalf("output is not XML: %v\n%s", err, out)
+		}
+		if suites.Tests != 2 || suites.Failures != 1 || suites.Errors != 0 {
+			t.Errorf("unexpected totals: tests=%d failures=%d errors=%d", suites.Tests, suites.Failures, suites.Errors)
+		}
+	})
+}
+
+func TestValidate_WESServer(t *testing.T) {
+	crate := `{"@context": "https://w3id.org/ro/crate/1.1/context", "@graph": []}`
+	srv := wes.NewMockServer(
+		&logschema.Run{RunID: "good", RunLog: &logschema.RunLog{StructuredLog: crate, LogSchema: &logschema.LogSchema{
+			SchemaURI: "https://w3id.org/ro/crate/1.1", Format: logschema.FormatROCrate,
+		}}},
+		&logschema.Run{RunID: "bad", RunLog: &logschema.RunLog{StructuredLog: crate}},
+	)
+	defer srv.Close()
+
+	if code, out := runCLI(t, "", "validate", "-wes-url", srv.BaseURL(), "good"); code != exitValid {
+		t.Errorf("single good run: exit code = %d\n%s", code, out)
+	}
+	if code, out := runCLI(t, "", "validate", "-wes-url", srv.BaseURL(), "-page-size", "1"); code != exitInvalid {
+		t.Errorf("all runs: exit code = %d\n%s", code, out)
+	}
+	if code, out := runCLI(t, "", "validate", "-wes-url", srv.BaseURL(), "missing"); code != exitError {
+		t.Errorf("missing run: exit code = %d\n%s", code, out)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	srv := wes.NewFixtureServer()
+	defer srv.Close()
+
+	code, out := runCLI(t, "", "conformance", "-wes-url", srv.BaseURL())
+	if code != exitInvalid || !strings.Contains(out, "NOT CONFORMANT") {
+		t.Errorf("exit code = %d, output:\n%s", code, out)
+	}
+	if code, out := runCLI(t, "", "conformance"); code != exitError {
+		t.Errorf("missing -wes-url: exit code = %d\n%s", code, out)
+	}
+}
+
+func TestLint(t *testing.T) {
+	smuggled := `{"stdout": "{\"wasGeneratedBy\": {}}", "stderr": "plain warning"}`
+	code, out := runCLI(t, smuggled, "lint")
+	if code != exitInvalid || !strings.Contains(out, `format="opm"`) {
+		t.Errorf("exit code = %d, output:\n%s", code, out)
+	}
+	if code, out := runCLI(t, `{"stdout": "https://example.com/out.txt"}`, "lint"); code != exitValid {
+		t.Errorf("URL stdout without -dereference: exit code = %d\n%s", code, out)
+	}
+}
+
+func TestFix(t *testing.T) {
+	for name, log := range map[string]string{
+		"RO-Crate":  `{"@context": "https://w3id.org/ro/crate/1.1/context", "@graph": []}`,
+		"PROV-JSON": `{"prefix": {}, "entity": {}, "used": {}}`,
+		"PROV-N":    "document\n  entity(ex:a)\nendDocument",
+		"OTLP":      `{"resourceLogs": []}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			doc, _ := json.Marshal(map[string]string{"structured_log": log})
+			var stdout, stderr bytes.Buffer
+			if code := run([]string{"fix"}, bytes.NewReader(doc), &stdout, &stderr); code != exitValid {
+				t.Fatalf("exit code = %d\n%s", code, stderr.String())
+			}
+			if code, out := runCLI(t, stdout.String(), "validate"); code != exitValid {
+				t.Errorf("fixed document does not validate: %d\n%s", code, out)
+			}
+		})
+	}
+
+	if code, out := runCLI(t, `{"structured_log": "{\"a\": 1}"}`, "fix"); code != exitInvalid {
+		t.Errorf("opaque payload: exit code = %d\n%s", code, out)
+	}
+}
+
+func TestDigest(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"digest"}, strings.NewReader(validRun), &stdout, &stderr); code != exitValid {
+		t.Fatalf("exit code = %d\n%s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), `"canonicalization": "jcs"`) {
+		t.Errorf("no digest recorded:\n%s", stdout.String())
+	}
+	if code, out := runCLI(t, stdout.String(), "validate"); code != exitValid {
+		t.Errorf("digested document does not validate: %d\n%s", code, out)
+	}
+
+	tampered := strings.Replace(stdout.String(), `\"@graph\": []`, `\"@graph\": [{\"@id\": \"x\", \"name\": \"y\"}]`, 1)
+	if code, out := runCLI(t, tampered, "validate"); code != exitInvalid || !strings.Contains(out, "digest mismatch") {
+		t.Errorf("tampered document: exit code = %d\n%s", code, out)
+	}
+
+	if code, out := runCLI(t, `{"structured_log": "https://example.com/log.json"}`, "digest"); code != exitInvalid {
+		t.Errorf("URI without -fetch: exit code = %d\n%s", code, out)
+	}
+}
+
+func TestSign(t *testing.T) {
+	keys := t.TempDir()
+	if code, out := runCLI(t, "", "keygen", "-key-dir", keys, "-key-id", "ci", "-alg", "es256"); code != exitValid {
+		t.Fatalf("keygen: exit code = %d\n%s", code, out)
+	}
+	if code, _ := runCLI(t, "", "keygen", "-key-dir", keys, "-key-id", "ci"); code != exitError {
+		t.Errorf("keygen over an existing key: exit code = %d", code)
+	}
+
+	for _, format := range []string{"jws", "dsse"} {
+		t.Run(format, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := run([]string{"sign", "-key-dir", keys, "-key-id", "ci", "-format", format}, strings.NewReader(validRun), &stdout, &stderr); code != exitValid {
+				t.Fatalf("exit code = %d\n%s", code, stderr.String())
+			}
+			signed := stdout.String()
+			if code, out := runCLI(t, signed, "validate", "-key-dir", keys, "-require-signatures"); code != exitValid || !strings.Contains(out, "ci verified") {
+				t.Errorf("signed document: exit code = %d\n%s", code, out)
+			}
+			if code, out := runCLI(t, validRun, "validate", "-key-dir", keys, "-require-signatures"); code != exitInvalid {
+				t.Errorf("unsigned document: exit code = %d\n%s", code, out)
+			}
+			tampered := strings.Replace(signed, `\"@graph\": []`, `\"@graph\": [{\"@id\": \"x\", \"name\": \"y\"}]`, 1)
+			if code, out := runCLI(t, tampered, "validate", "-key-dir", keys); code != exitInvalid {
+				t.Errorf("tampered document: exit code = %d\n%s", code, out)
+			}
+		})
+	}
+
+	if code, _ := runCLI(t, validRun, "sign", "-key-dir", keys); code != exitError {
+		t.Errorf("missing -key-id: exit code = %d", code)
+	}
+	if code, _ := runCLI(t, validRun, "sign", "-key-dir", keys, "-key-id", "nope"); code != exitInvalid {
+		t.Errorf("unknown key: exit code = %d", code)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	dir := t.TempDir()
+	rules := filepath.Join(dir, "rules.json")
+	if err := os.WriteFile(rules, []byte(`[{"name": "patient", "property": "patientName"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	doc := `{
+		"cmd": ["run", "--password=hunter2"],
+		"structured_log": "{\"@context\": \"https://w3id.org/ro/crate/1.1/context\", \"@graph\": [{\"@id\": \"#s\", \"patientName\": \"Jane Doe\"}]}",
+		"log_schema": {"schema_uri": "https://w3id.org/ro/crate/1.1", "format": "ro-crate"}
+	}`
+	report := filepath.Join(dir, "report.json")
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"redact", "-defaults", "-rules", rules, "-report", report}, strings.NewReader(doc), &stdout, &stderr); code != exitValid {
+		t.Fatalf("exit code = %d\n%s", code, stderr.String())
+	}
+	if strings.Contains(stdout.String(), "hunter2") || strings.Contains(stdout.String(), "Jane Doe") {
+		t.Errorf("secrets left in output:\n%s", stdout.String())
+	}
+	if code, out := runCLI(t, stdout.String(), "validate"); code != exitValid {
+		t.Errorf("redacted document does not validate: %d\n%s", code, out)
+	}
+	data, err := os.ReadFile(report)
+	if err != nil || !strings.Contains(string(data), `"rule": "patient"`) || strings.Contains(string(data), "Jane") {
+		t.Errorf("report = %s (%v)", data, err)
+	}
+
+	if code, _ := runCLI(t, doc, "redact"); code != exitError {
+		t.Errorf("no rules: exit code = %d", code)
+	}
+
+	t.Run("pseudonym key", func(t *testing.T) {
+		idRules := filepath.Join(dir, "id-rules.json")
+		key := filepath.Join(dir, "pseudonym.key")
+		if err := os.WriteFile(idRules, []byte(`[{"pattern": "#s"}]`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(key, []byte("0123456789abcdef\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if code, out := runCLI(t, doc, "redact", "-rules", idRules); code != exitInvalid || !strings.Contains(out, "no pseudonym key") {
+			t.Errorf("without a key: exit code = %d\n%s", code, out)
+		}
+		if code, out := runCLI(t, doc, "redact", "-rules", idRules, "-pseudonym-key", key); code != exitValid || !strings.Contains(out, `\"redacted-`) {
+			t.Errorf("with a key: exit code = %d\n%s", code, out)
+		}
+	})
+}
+
+func TestQuery(t *testing.T) {
+	rl := &logschema.RunLog{}
+	err := logschema.NewCrateBuilder("run-1", "pipeline").
+		Input(logschema.CrateFile{ID: "reads.fastq"}).
+		Output(logschema.CrateFile{ID: "calls.vcf"}).
+		Task(logschema.CrateTask{ID: "call", Inputs: []string{"reads.fastq"}, Outputs: []string{"calls.vcf"}}).
+		ApplyTo(rl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, _ := json.Marshal(rl)
+
+	code, out := runCLI(t, string(doc), "query", "-graph", "calls.vcf wasGeneratedBy ?step . ?step a CreateAction")
+	if code != exitValid || !strings.Contains(out, "<stdin>: run: ?step=#task-call") {
+		t.Errorf("graph query: exit code = %d\n%s", code, out)
+	}
+	code, out = runCLI(t, string(doc), "query", "-o", "json", "-jsonpath", "$['@graph'][?(@['@type'] == 'File')]['@id']")
+	if code != exitValid || !strings.Contains(out, `"value": "calls.vcf"`) {
+		t.Errorf("jsonpath query: exit code = %d\n%s", code, out)
+	}
+	if code, out := runCLI(t, string(doc), "query", "-graph", "?x used nothing"); code != exitInvalid {
+		t.Errorf("no match: exit code = %d\n%s", code, out)
+	}
+	if code, out := runCLI(t, string(doc), "query"); code != exitError {
+		t.Errorf("missing query: exit code = %d\n%s", code, out)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, endTime string) string {
+		run := logschema.Run{RunID: name, RunLog: &logschema.RunLog{}, TaskLogs: []logschema.TaskLog{{ID: "call", EndTime: endTime}}}
+		if err := logschema.NewCrateBuilder(name, "pipeline").
+			Task(logschema.CrateTask{ID: "call", EndTime: endTime}).ApplyTo(run.RunLog); err != nil {
+			t.Fatal(err)
+		}
+		data, _ := json.Marshal(run)
+		path := filepath.Join(dir, name+".json")
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	a, b, c := write("a", "2024-01-01T10:00:00Z"), write("b", "2024-01-01T10:00:00Z"), write("c", "2024-01-01T11:00:00Z")
+
+	if code, out := runCLI(t, "", "diff", a, b); code != exitValid || !strings.Contains(out, "no differences") {
+		t.Errorf("same runs: exit code = %d\n%s", code, out)
+	}
+	code, out := runCLI(t, "", "diff", "-o", "json", a, c)
+	if code != exitInvalid || !strings.Contains(out, `"aspect": "timing"`) {
+		t.Errorf("changed runs: exit code = %d\n%s", code, out)
+	}
+	if code, _ := runCLI(t, "", "diff", a); code != exitError {
+		t.Errorf("one argument: exit code = %d", code)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"encode"}, strings.NewReader(validRun), &stdout, &stderr); code != exitValid {
+		t.Fatalf("exit code = %d\n%s", code, stderr.String())
+	}
+	encoded := stdout.String()
+	if !strings.Contains(encoded, `"content_encoding": "gzip+base64"`) || strings.Contains(encoded, "@graph") {
+		t.Errorf("structured_log not encoded:\n%s", encoded)
+	}
+	if code, out := runCLI(t, encoded, "validate"); code != exitValid {
+		t.Errorf("encoded document does not validate: %d\n%s", code, out)
+	}
+	if code, out := runCLI(t, encoded, "validate", "-max-decoded-size", "10"); code != exitInvalid || !strings.Contains(out, "size limit") {
+		t.Errorf("-max-decoded-size not applied: %d\n%s", code, out)
+	}
+
+	stdout.Reset()
+	if code := run([]string{"encode", "-d"}, strings.NewReader(encoded), &stdout, &stderr); code != exitValid {
+		t.Fatalf("decode: exit code = %d\n%s", code, stderr.String())
+	}
+	if strings.Contains(stdout.String(), "content_encoding") || !strings.Contains(stdout.String(), "@graph") {
+		t.Errorf("structured_log not decoded:\n%s", stdout.String())
+	}
+
+	if code, _ := runCLI(t, validRun, "encode", "-encoding", "lz4+base64"); code != exitError {
+		t.Errorf("unregistered compression: exit code = %d", code)
+	}
+}
+
+func TestStore(t *testing.T) {
+	fake := logschema.NewFakeS3("logs")
+	defer fake.Close()
+	t.Setenv("AWS_ENDPOINT_URL", fake.URL)
+	t.Setenv("AWS_ACCESS_KEY_ID", fake.AccessKeyID)
+	t.Setenv("AWS_SECRET_ACCESS_KEY", fake.SecretAccessKey)
+
+	for _, to := range []string{t.TempDir(), "s3://logs"} {
+		t.Run(to, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := run([]string{"store", "-to", to, "-run-id", "run-1"}, strings.NewReader(validRun), &stdout, &stderr); code != exitValid {
+				t.Fatalf("exit code = %d\n%s", code, stderr.String())
+			}
+			stored := stdout.String()
+			if strings.Contains(stored, "@graph") {
+				t.Errorf("structured_log left inline:\n%s", stored)
+			}
+			if code, out := runCLI(t, stored, "validate", "-offline", "-store", to); code != exitValid || !strings.Contains(out, "valid") {
+				t.Errorf("stored document does not validate: %d\n%s", code, out)
+			}
+			if code, out := runCLI(t, "", "store", "-to", to, "-list", "-run-id", "run-1"); code != exitValid || !strings.HasPrefix(out, "runs/run-1/structured_log.json\t") {
+				t.Errorf("-list: %d\n%s", code, out)
+			}
+			if code, _ := runCLI(t, "", "store", "-to", to, "-list", "-run-id", "run-2"); code != exitInvalid {
+				t.Errorf("-list of an unknown run: exit code = %d", code)
+			}
+		})
+	}
+
+	if code, _ := runCLI(t, validRun, "store", "-to", t.TempDir()); code != exitError {
+		t.Errorf("stdin without -run-id: exit code = %d", code)
+	}
+}
+
+func TestValidate_DRS(t *testing.T) {
+	m := logschema.NewMockDRS()
+	defer m.Close()
+	m.Token = "drs-token"
+	t.Setenv("DRS_BEARER_TOKEN", m.Token)
+	// The mock serves TLS with a test certificate.
+	defer func(rt http.RoundTripper) { http.DefaultTransport = rt }(http.DefaultTransport)
+	http.DefaultTransport = m.Client().Transport
+
+	m.AddObject("log-1", []byte(`{"@context": "https://w3id.org/ro/crate/1.1/context", "@graph": []}`), "application/ld+json")
+	doc := func(uri string) string {
+		return `{"structured_log": "` + uri + `", "log_schema": {"schema_uri": "https://w3id.org/ro/crate/1.1", "format": "ro-crate"}}`
+	}
+	tests := []struct {
+		name string
+		doc  string
+		args []string
+		want int
+	}{
+		{"hostname-based", doc(m.URI("log-1")), []string{"-drs"}, exitValid},
+		{"compact identifier", doc("drs://mock:log-1"), []string{"-drs-prefix", "mock=" + m.URL + "/ga4gh/drs/v1"}, exitValid},
+		{"unknown object", doc(m.URI("log-2")), []string{"-drs"}, exitInvalid},
+		{"malformed prefix", doc(m.URI("log-1")), []string{"-drs-prefix", "mock"}, exitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, out := runCLI(t, tt.doc, append([]string{"validate"}, tt.args...)...); code != tt.want {
+				t.Errorf("exit code = %d, want %d\n%s", code, tt.want, out)
+			}
+		})
+	}
+}
+
+func TestImport(t *testing.T) {
+	testdata := filepath.Join("..", "..", "internal", "logschema", "testdata")
+	trace := filepath.Join(testdata, "nextflow", "trace.txt")
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"nextflow trace and report", []string{"-from", "nextflow", "-run-id", "r1", trace, filepath.Join(testdata, "nextflow", "report.html")}, exitValid},
+		{"nextflow as PROV", []string{"-from", "nextflow", "-run-id", "r1", "-format", "opm", trace}, exitValid},
+		{"cromwell", []string{"-from", "cromwell", filepath.Join(testdata, "cromwell", "metadata.json")}, exitValid},
+		{"cwlprov", []string{"-from", "cwlprov", filepath.Join(testdata, "cwlprov", "revsort")}, exitValid},
+		{"cwlprov as RO-Crate", []string{"-from", "cwlprov", "-format", "ro-crate", filepath.Join(testdata, "cwlprov", "revsort")}, exitValid},
+		{"cwlprov file", []string{"-from", "cwlprov", trace}, exitError},
+		{"snakemake", []string{"-from", "snakemake", "-run-id", "r1", filepath.Join(testdata, "snakemake"), filepath.Join(testdata, "snakemake", "report.html")}, exitValid},
+		{"snakemake as PROV", []string{"-from", "snakemake", "-run-id", "r1", "-format", "opm", filepath.Join(testdata, "snakemake", ".snakemake", "metadata")}, exitValid},
+		{"snakemake without run ID", []string{"-from", "snakemake", filepath.Join(testdata, "snakemake")}, exitError},
+		{"cromwell with two files", []string{"-from", "cromwell", trace, trace}, exitError},
+		{"nextflow without run ID", []string{"-from", "nextflow", trace}, exitError},
+		{"unknown engine", []string{"-from", "make", trace}, exitError},
+		{"missing file", []string{"-from", "nextflow", "-run-id", "r1", filepath.Join(testdata, "nope.txt")}, exitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(append([]string{"import"}, tt.args...), strings.NewReader(""), &stdout, &stderr)
+			if code != tt.want {
+				t.Fatalf("exit code = %d, want %d\n%s", code, tt.want, stderr.String())
+			}
+			if code != exitValid {
+				return
+			}
+			if vcode, out := runCLI(t, stdout.String(), "validate", "-offline"); vcode != exitValid {
+				t.Errorf("imported run does not validate: %d\n%s", vcode, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+func writeReports(w io.Writer, format string, reports []*report) error {
+	switch format {
+	case "json":
+		return writeJSON(w, reports)
+	case "junit":
+		return writeJUnit(w, reports)
+	}
+	return writeText(w, reports)
+}
+
+func writeText(w io.Writer, reports []*report) error {
+	for _, r := range reports {
+		fmt.Fprintln(w, r.Source)
+		if r.Error != "" {
+			fmt.Fprintf(w, "  ERROR: %s\n", r.Error)
+			continue
+		}
+		if len(r.Checks) == 0 {
+			fmt.Fprintln(w, "  → No structured_log present, skipped")
+			continue
+		}
+		for _, c := range r.Checks {
+			fmt.Fprintf(w, "  %s: %s\n", c.Name, c.Result)
+		}
+	}
+	return nil
+}
+
+func writeJSON(w io.Writer, reports []*report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Valid   bool      `json:"valid"`
+		Reports []*report `json:"reports"`
+	}{Valid: exitCode(reports) == exitValid, Reports: reports})
+}
+
+// JUnit XML structures, as understood by common CI systems.
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+func writeJUnit(w io.Writer, reports []*report) error {
+	out := junitSuites{Name: "wes-logschema"}
+	for _, r := range reports {
+		suite := junitSuite{Name: r.Source}
+		if r.Error != "" {
+			suite.Cases = append(suite.Cases, junitCase{
+				Name:      "parse",
+				Classname: r.Source,
+				Time:      "0",
+				Error:     &junitMessage{Message: r.Error, Body: r.Error},
+			})
+			suite.Errors++
+		}
+		for _, c := range r.Checks {
+			tc := junitCase{
+				Name:      c.Name,
+				Classname: r.Source,
+				Time:      fmt.Sprintf("%.6f", c.Result.Elapsed.Seconds()),
+			}
+			if !c.Result.Valid {
+				msg := strings.Join(c.Result.Errors, "; ")
+				tc.Failure = &junitMessage{Message: msg, Body: c.Result.String()}
+				suite.Failures++
+			}
+			suite.Cases = append(suite.Cases, tc)
+		}
+		suite.Tests = len(suite.Cases)
+		out.Tests += suite.Tests
+		out.Failures += suite.Failures
+		out.Errors += suite.Errors
+		out.Suites = append(out.Suites, suite)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
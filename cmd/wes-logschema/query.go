@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+// queryResult is the query outcome for one input source.
+type queryResult struct {
+	Source  string                  `json:"source"`
+	Results []logschema.QueryResult `json:"results"`
+	Skipped []string                `json:"skipped,omitempty"`
+	Error   string                  `json:"error,omitempty"`
+}
+
+func runQuery(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: wes-logschema query (-jsonpath EXPR | -graph QUERY) [flags] [file|glob|-]...")
+		fmt.Fprintln(stderr, "\nQueries the run, task and attempt structured logs of each document.")
+		fmt.Fprintln(stderr, "Graph queries are \"subject predicate object\" patterns joined by \" . \",")
+		fmt.Fprintln(stderr, "e.g. -graph '?task used reads.fastq' or -graph 'calls.vcf wasGeneratedBy ?step'.")
+		fmt.Fprintln(stderr, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	kind := fs.String("kind", kindAuto, "document kind: auto, run, task, wes-run or tes")
+	output := fs.String("o", "text", "output format: text or json")
+	jsonPath := fs.String("jsonpath", "", "JSONPath expression evaluated against each structured log")
+	graph := fs.String("graph", "", "graph pattern over RO-Crate @id links and PROV relations")
+	all := fs.Bool("all", false, "also query structured logs that fail validation")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitValid
+		}
+		return exitError
+	}
+	if (*jsonPath == "") == (*graph == "") {
+		fmt.Fprintln(stderr, "wes-logschema: exactly one of -jsonpath and -graph is required")
+		return exitError
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(stderr, "wes-logschema: unknown output format %q\n", *output)
+		return exitError
+	}
+
+	inputs, err := expandInputs(fs.Args(), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+		return exitError
+	}
+
+	var v *logschema.Validator
+	if !*all {
+		v = &logschema.Validator{}
+	}
+	code := exitInvalid // like grep: 1 when nothing matched
+	var results []queryResult
+	for _, in := range inputs {
+		res := queryResult{Source: in.name}
+		data, err := in.read()
+		if err == nil {
+			var rl *logschema.RunLog
+			var tasks []logschema.TaskLog
+			var set *logschema.LogSet
+			if _, rl, tasks, err = decodeDocument(data, *kind); err == nil {
+				if set, err = logschema.NewLogSet(v, rl, tasks); err == nil {
+					res.Skipped = set.Skipped
+					if *jsonPath != "" {
+						res.Results, err = set.JSONPath(*jsonPath)
+					} else {
+						res.Results, err = set.GraphQuery(*graph)
+					}
+				}
+			}
+		}
+		switch {
+		case err != nil:
+			res.Error = err.Error()
+			code = exitError
+		case len(res.Results) > 0 && code == exitInvalid:
+			code = exitValid
+		}
+		results = append(results, res)
+	}
+
+	if *output == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+			return exitError
+		}
+		return code
+	}
+	for _, res := range results {
+		if res.Error != "" {
+			fmt.Fprintf(stdout, "%s: ERROR: %s\n", res.Source, res.Error)
+			continue
+		}
+		for _, r := range res.Results {
+			fmt.Fprintf(stdout, "%s: %s: %s\n", res.Source, r.Location, formatQueryResult(r))
+		}
+		for _, s := range res.Skipped {
+			fmt.Fprintf(stderr, "%s: skipped %s\n", res.Source, s)
+		}
+	}
+	return code
+}
+
+// formatQueryResult renders bindings as "?a=x ?b=y" and values as JSON.
+func formatQueryResult(r logschema.QueryResult) string {
+	if r.Bindings != nil {
+		keys := make([]string, 0, len(r.Bindings))
+		for k := range r.Bindings {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		parts := make([]string, len(keys))
+		for i, k := range keys {
+			parts[i] = "?" + k + "=" + r.Bindings[k]
+		}
+		return strings.Join(parts, " ")
+	}
+	b, err := json.Marshal(r.Value)
+	if err != nil {
+		return fmt.Sprint(r.Value)
+	}
+	return string(b)
+}
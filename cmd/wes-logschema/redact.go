@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+// redactionReport is the -report output for one input.
+type redactionReport struct {
+	Source string                     `json:"source"`
+	Report *logschema.RedactionReport `json:"report,omitempty"`
+	Error  string                     `json:"error,omitempty"`
+}
+
+func runRedact(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("redact", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: wes-logschema redact (-rules FILE | -defaults) [flags] [file|glob|-]...")
+		fmt.Fprintln(stderr, "\nRedacts secrets and personal data from the command line, stdout/stderr,")
+		fmt.Fprintln(stderr, "task metadata and structured logs before they are exported. FILE holds a")
+		fmt.Fprintln(stderr, `JSON array of rules such as {"pattern": "MRN-\\d+"}, {"pointer":`)
+		fmt.Fprintln(stderr, `"/@graph/*/patient"} or {"property": "patientName"}. Writes the redacted`)
+		fmt.Fprintln(stderr, "document to stdout, or in place with -w. Exits 1 if a structured_log")
+		fmt.Fprintln(stderr, "could not be redacted without breaking its log_schema.")
+		fmt.Fprintln(stderr, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	kind := fs.String("kind", kindAuto, "document kind: auto, run, task or wes-run")
+	rulesFile := fs.String("rules", "", "JSON file of redaction rules")
+	defaults := fs.Bool("defaults", false, "redact common credentials (tokens, signed URLs, access keys)")
+	keyFile := fs.String("pseudonym-key", "", "file holding the secret key for @id pseudonyms (at least 16 bytes)")
+	reportFile := fs.String("report", "", "write a JSON report of what was redacted to this file")
+	write := fs.Bool("w", false, "write redacted documents back to their files")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitValid
+		}
+		return exitError
+	}
+
+	var rules []logschema.RedactionRule
+	if *defaults {
+		rules = logschema.DefaultRedactionRules()
+	}
+	if *rulesFile != "" {
+		extra, err := logschema.LoadRedactionRules(*rulesFile)
+		if err != nil {
+			fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+			return exitError
+		}
+		rules = append(rules, extra...)
+	}
+	if len(rules) == 0 {
+		fmt.Fprintln(stderr, "wes-logschema: no redaction rules; use -rules or -defaults")
+		return exitError
+	}
+	redactor, err := logschema.NewRedactor(rules)
+	if err != nil {
+		fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+		return exitError
+	}
+	if *keyFile != "" {
+		if redactor.PseudonymKey, err = logschema.LoadPseudonymKey(*keyFile); err != nil {
+			fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+			return exitError
+		}
+	}
+
+	inputs, err := expandInputs(fs.Args(), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+		return exitError
+	}
+	if len(inputs) > 1 && !*write {
+		fmt.Fprintln(stderr, "wes-logschema: redacting several inputs requires -w")
+		return exitError
+	}
+
+	code := exitValid
+	var reports []redactionReport
+	for _, in := range inputs {
+		data, err := in.read()
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", in.name, err)
+			code = exitError
+			continue
+		}
+		var (
+			rep       *logschema.RedactionReport
+			redactErr error
+		)
+		out, err := updateDocument(data, *kind, func(rl *logschema.RunLog, tasks []logschema.TaskLog) {
+			rep, redactErr = redactor.RedactRun(rl, tasks)
+		})
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", in.name, err)
+			code = exitError
+			continue
+		}
+		if redactErr != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", in.name, redactErr)
+			reports = append(reports, redactionReport{Source: in.name, Error: redactErr.Error()})
+			if code == exitValid {
+				code = exitInvalid
+			}
+			continue
+		}
+		reports = append(reports, redactionReport{Source: in.name, Report: rep})
+		for _, r := range rep.Redactions {
+			fmt.Fprintf(stderr, "%s: %s\n", in.name, r)
+		}
+		for _, loc := range rep.Invalidated {
+			fmt.Fprintf(stderr, "%s: %s: dropped structured_log_digest and signatures\n", in.name, loc)
+		}
+		for _, loc := range rep.Remote {
+			fmt.Fprintf(stderr, "%s: %s: structured_log is a URI; its content was not redacted\n", in.name, loc)
+		}
+
+		if *write && in.name != "<stdin>" {
+			if err := os.WriteFile(in.name, out, 0o644); err != nil {
+				fmt.Fprintf(stderr, "%s: %v\n", in.name, err)
+				code = exitError
+			}
+			continue
+		}
+		stdout.Write(out)
+	}
+
+	if *reportFile != "" {
+		data, err := json.MarshalIndent(reports, "", "  ")
+		if err == nil {
+			err = os.WriteFile(*reportFile, append(data, '\n'), 0o644)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+			return exitError
+		}
+	}
+	return code
+}
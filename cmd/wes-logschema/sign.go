@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+func runSign(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("sign", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: wes-logschema sign -key-dir DIR -key-id ID [flags] [file|glob|-]...")
+		fmt.Fprintln(stderr, "\nAdds a detached signature to every structured_log the key has not signed")
+		fmt.Fprintln(stderr, "yet. Keys are read from DIR/ID.pem (PKCS #8); see keygen. Writes the")
+		fmt.Fprintln(stderr, "updated document to stdout, or in place with -w. Exits 1 if some")
+		fmt.Fprintln(stderr, "structured_log could not be signed. Use validate -key-dir to verify.")
+		fmt.Fprintln(stderr, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	kind := fs.String("kind", kindAuto, "document kind: auto, run, task or wes-run")
+	keyDir := fs.String("key-dir", "", "directory holding the signing key")
+	keyID := fs.String("key-id", "", "ID of the signing key")
+	format := fs.String("format", logschema.SignatureFormatJWS, "signature format: jws or dsse")
+	canon := fs.String("canonicalization", "", "none, jcs or urdna2015 (default: chosen from each log_schema)")
+	fetch := fs.Bool("fetch", false, "fetch structured_log URIs and remote JSON-LD contexts to sign them")
+	schemaDir := fs.String("schema-dir", "", "local directory of JSON-LD contexts, consulted before the network")
+	write := fs.Bool("w", false, "write updated documents back to their files")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitValid
+		}
+		return exitError
+	}
+	if *keyDir == "" || *keyID == "" {
+		fmt.Fprintln(stderr, "wes-logschema: sign requires -key-dir and -key-id")
+		return exitError
+	}
+	switch *format {
+	case logschema.SignatureFormatJWS, logschema.SignatureFormatDSSE:
+	default:
+		fmt.Fprintf(stderr, "wes-logschema: unknown signature format %q\n", *format)
+		return exitError
+	}
+
+	inputs, err := expandInputs(fs.Args(), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+		return exitError
+	}
+	if len(inputs) > 1 && !*write {
+		fmt.Fprintln(stderr, "wes-logschema: signing several inputs requires -w")
+		return exitError
+	}
+	signer := &logschema.LogSigner{
+		Keys:             &logschema.FileKeyProvider{Dir: *keyDir},
+		KeyID:            *keyID,
+		Format:           *format,
+		Canonicalization: logschema.Canonicalization(*canon),
+	}
+	if *fetch || *schemaDir != "" {
+		signer.Validator = &logschema.Validator{SchemaDir: *schemaDir, Offline: !*fetch}
+	}
+
+	code := exitValid
+	for _, in := range inputs {
+		data, err := in.read()
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", in.name, err)
+			code = exitError
+			continue
+		}
+		var signed, skipped []string
+		out, err := updateDocument(data, *kind, func(rl *logschema.RunLog, tasks []logschema.TaskLog) {
+			signed, skipped = signer.SignRun(rl, tasks)
+		})
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", in.name, err)
+			code = exitError
+			continue
+		}
+		for _, loc := range signed {
+			fmt.Fprintf(stderr, "%s: %s: signed with %s\n", in.name, loc, *keyID)
+		}
+		for _, s := range skipped {
+			fmt.Fprintf(stderr, "%s: %s\n", in.name, s)
+			if code == exitValid {
+				code = exitInvalid
+			}
+		}
+
+		if *write && in.name != "<stdin>" {
+			if err := os.WriteFile(in.name, out, 0o644); err != nil {
+				fmt.Fprintf(stderr, "%s: %v\n", in.name, err)
+				code = exitError
+			}
+			continue
+		}
+		stdout.Write(out)
+	}
+	return code
+}
+
+func runKeygen(args []string, stderr io.Writer) int {
+	fs := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: wes-logschema keygen -key-dir DIR -key-id ID [-alg ALG]")
+		fmt.Fprintln(stderr, "\nWrites a new signing key to DIR/ID.pem and its public key to DIR/ID.pub.pem.")
+		fmt.Fprintln(stderr, "Verifiers only need the .pub.pem file. Local keys are meant for testing.")
+		fmt.Fprintln(stderr, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	keyDir := fs.String("key-dir", "", "directory to write the key files to")
+	keyID := fs.String("key-id", "", "ID of the new key")
+	alg := fs.String("alg", logschema.KeyEd25519, "key algorithm: ed25519, es256 or es384")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitValid
+		}
+		return exitError
+	}
+	if *keyDir == "" || *keyID == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return exitError
+	}
+	if _, err := os.Stat(filepath.Join(*keyDir, *keyID+".pem")); err == nil {
+		fmt.Fprintf(stderr, "wes-logschema: key %q already exists in %s\n", *keyID, *keyDir)
+		return exitError
+	}
+	key, err := logschema.GenerateKey(*alg)
+	if err == nil {
+		err = logschema.WriteKeyFiles(*keyDir, *keyID, key)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+		return exitError
+	}
+	return exitValid
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+// openStore opens the LogStore named by spec: "s3://BUCKET", configured
+// from the usual AWS_* environment variables (AWS_ENDPOINT_URL selects a
+// MinIO-style endpoint), or a local directory, optionally as a file:// URI.
+func openStore(spec string) (logschema.LogStore, error) {
+	if bucket, ok := strings.CutPrefix(spec, "s3://"); ok {
+		bucket = strings.TrimSuffix(bucket, "/")
+		if bucket == "" || strings.Contains(bucket, "/") {
+			return nil, fmt.Errorf("log store %q: want s3://BUCKET", spec)
+		}
+		region := os.Getenv("AWS_REGION")
+		if region == "" {
+			region = os.Getenv("AWS_DEFAULT_REGION")
+		}
+		if region == "" {
+			region = "us-east-1"
+		}
+		s := &logschema.S3LogStore{
+			Endpoint:        os.Getenv("AWS_ENDPOINT_URL"),
+			Region:          region,
+			Bucket:          bucket,
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+		if s.Endpoint == "" {
+			s.Endpoint = "https://s3." + region + ".amazonaws.com"
+			s.VirtualHosted = true
+		}
+		if s.AccessKeyID == "" || s.SecretAccessKey == "" {
+			return nil, fmt.Errorf("log store %q: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set", spec)
+		}
+		return s, nil
+	}
+	dir := strings.TrimPrefix(spec, "file://")
+	if dir == "" {
+		return nil, fmt.Errorf("empty log store")
+	}
+	return &logschema.FSLogStore{Dir: dir}, nil
+}
+
+func runStore(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("store", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: wes-logschema store -to STORE [flags] [file|glob|-]...")
+		fmt.Fprintln(stderr, "       wes-logschema store -to STORE -list -run-id ID [-task-id ID] [-presign TTL]")
+		fmt.Fprintln(stderr, "\nMoves inline structured logs into a log store and replaces them with their")
+		fmt.Fprintln(stderr, "URIs, or lists the logs of a run or task. STORE is a directory or s3://BUCKET;")
+		fmt.Fprintln(stderr, "S3 credentials come from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, and")
+		fmt.Fprintln(stderr, "AWS_ENDPOINT_URL selects an S3-compatible server such as MinIO. Writes the")
+		fmt.Fprintln(stderr, "updated document to stdout, or in place with -w. Exits 1 if some")
+		fmt.Fprintln(stderr, "structured_log could not be stored. Use validate -store to check them.")
+		fmt.Fprintln(stderr, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	kind := fs.String("kind", kindAuto, "document kind: auto, run, task or wes-run")
+	to := fs.String("to", "", "log store: a directory or s3://BUCKET")
+	runID := fs.String("run-id", "", "run ID to store logs under (default: the document's run_id, else the file name)")
+	taskID := fs.String("task-id", "", "with -list, list the logs of this task only")
+	minSize := fs.Int("min-size", 0, "leave structured logs smaller than this many bytes inline")
+	list := fs.Bool("list", false, "list stored logs instead")
+	presign := fs.Duration("presign", 0, "with -list, print URLs presigned for this long instead of URIs")
+	write := fs.Bool("w", false, "write updated documents back to their files")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitValid
+		}
+		return exitError
+	}
+	if *to == "" {
+		fmt.Fprintln(stderr, "wes-logschema: store requires -to")
+		return exitError
+	}
+	store, err := openStore(*to)
+	if err != nil {
+		fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+		return exitError
+	}
+	if *list {
+		if *runID == "" || fs.NArg() > 0 {
+			fmt.Fprintln(stderr, "wes-logschema: -list requires -run-id and no inputs")
+			return exitError
+		}
+		return listStore(store, *runID, *taskID, *presign, stdout, stderr)
+	}
+
+	inputs, err := expandInputs(fs.Args(), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+		return exitError
+	}
+	if len(inputs) > 1 && !*write {
+		fmt.Fprintln(stderr, "wes-logschema: storing several inputs requires -w")
+		return exitError
+	}
+
+	code := exitValid
+	for _, in := range inputs {
+		data, err := in.read()
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", in.name, err)
+			code = exitError
+			continue
+		}
+		id := documentRunID(data, in.name, *runID)
+		if id == "" {
+			fmt.Fprintf(stderr, "%s: no run_id; use -run-id\n", in.name)
+			code = exitError
+			continue
+		}
+		var stored, skipped []string
+		out, err := updateDocument(data, *kind, func(rl *logschema.RunLog, tasks []logschema.TaskLog) {
+			stored, skipped = logschema.ExternalizeRun(store, id, rl, tasks, *minSize)
+		})
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", in.name, err)
+			code = exitError
+			continue
+		}
+		for _, loc := range stored {
+			fmt.Fprintf(stderr, "%s: %s: stored in %s\n", in.name, loc, *to)
+		}
+		for _, s := range skipped {
+			fmt.Fprintf(stderr, "%s: %s\n", in.name, s)
+			if code == exitValid {
+				code = exitInvalid
+			}
+		}
+
+		if *write && in.name != "<stdin>" {
+			if err := os.WriteFile(in.name, out, 0o644); err != nil {
+				fmt.Fprintf(stderr, "%s: %v\n", in.name, err)
+				code = exitError
+			}
+			continue
+		}
+		stdout.Write(out)
+	}
+	return code
+}
+
+// documentRunID picks the run ID to store a document's logs under.
+func documentRunID(data []byte, name, flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	var doc struct {
+		RunID string `json:"run_id"`
+	}
+	if json.Unmarshal(data, &doc) == nil && doc.RunID != "" {
+		return doc.RunID
+	}
+	if name == "<stdin>" {
+		return ""
+	}
+	return strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+}
+
+func listStore(store logschema.LogStore, runID, taskID string, presign time.Duration, stdout, stderr io.Writer) int {
+	logs, err := store.List(logschema.LogPrefix(runID, taskID))
+	if err != nil {
+		fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+		return exitError
+	}
+	for _, l := range logs {
+		uri := l.URI
+		if presign > 0 {
+			if uri, err = store.Presign(l.URI, presign); err != nil {
+				fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+				return exitError
+			}
+		}
+		fmt.Fprintf(stdout, "%s\t%d\t%s\n", l.Key, l.Size, uri)
+	}
+	if len(logs) == 0 {
+		return exitInvalid
+	}
+	return exitValid
+}
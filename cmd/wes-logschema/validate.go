@@ -0,0 +1,422 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+	"github.com/animeshs34/wes-logging-schema/internal/wes"
+)
+
+// Document kinds accepted by the validate command.
+const (
+	kindAuto    = "auto"
+	kindRun     = "run"     // a RunLog (WES run_log)
+	kindTask    = "task"    // a single TaskLog
+	kindWESRun  = "wes-run" // a GET /runs/{run_id} response
+	kindPayload = "payload" // a bare structured_log payload
+	kindTES     = "tes"     // a GA4GH TES task, or a TES task list
+)
+
+// tesMinConfidence is the detection confidence at which structured data in
+// TES logs is moved to structured_log, as for fix -min-confidence.
+const tesMinConfidence = 0.5
+
+// check is one validated structured_log within a document.
+type check struct {
+	Name   string                      `json:"name"`
+	Result *logschema.ValidationResult `json:"result"`
+}
+
+// report collects the checks for one input source.
+type report struct {
+	Source string  `json:"source"`
+	Kind   string  `json:"kind,omitempty"`
+	Checks []check `json:"checks"`
+	Error  string  `json:"error,omitempty"`
+}
+
+func (r *report) valid() bool {
+	for _, c := range r.Checks {
+		if !c.Result.Valid {
+			return false
+		}
+	}
+	return true
+}
+
+// input is a named document to validate.
+type input struct {
+	name string
+	read func() ([]byte, error)
+}
+
+func runValidate(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: wes-logschema validate [flags] [file|glob|-]...")
+		fmt.Fprintln(stderr, "       wes-logschema validate -wes-url URL [run-id]...")
+		fmt.Fprintln(stderr, "\nReads standard input when no files are given. With -wes-url, validates")
+		fmt.Fprintln(stderr, "the given runs (or every run) fetched from a WES server.")
+		fmt.Fprintln(stderr, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	kind := fs.String("kind", kindAuto, "document kind: auto, run, task, wes-run, tes or payload")
+	output := fs.String("o", "text", "output format: text, json or junit")
+	schemaURI := fs.String("schema-uri", "", "schema_uri for bare payloads (implies -kind payload), or the inherited run schema for -kind task")
+	format := fs.String("format", "", "log_schema format used with -schema-uri")
+	mediaType := fs.String("media-type", "", "log_schema media_type used with -schema-uri")
+	schemaVersion := fs.String("schema-version", "", "log_schema schema_version used with -schema-uri")
+	offline := fs.Bool("offline", false, "never access the network")
+	schemaDir := fs.String("schema-dir", "", "local directory of schema documents, consulted before the network")
+	resolve := fs.Bool("resolve-schemas", false, "fail validation when a schema_uri cannot be fetched")
+	keyDir := fs.String("key-dir", "", "directory of PEM public keys used to verify structured_log_signatures")
+	requireSigs := fs.Bool("require-signatures", false, "fail validation unless every structured_log has a verified signature")
+	maxDecoded := fs.Int64("max-decoded-size", logschema.DefaultMaxDecodedSize, "maximum size in bytes of a decoded or fetched structured_log")
+	storeSpec := fs.String("store", "", "log store (directory or s3://BUCKET) to read stored structured logs from")
+	drs := drsFlags(fs, "fetch drs:// structured logs through the GA4GH DRS API (bearer token from $DRS_BEARER_TOKEN)")
+	wesURL := fs.String("wes-url", "", "WES API root (e.g. https://host/ga4gh/wes/v1) to fetch runs from")
+	pageSize := fs.Int("page-size", 0, "page_size used when listing runs and tasks with -wes-url")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitValid
+		}
+		return exitError
+	}
+
+	switch *output {
+	case "text", "json", "junit":
+	default:
+		fmt.Fprintf(stderr, "wes-logschema: unknown output format %q\n", *output)
+		return exitError
+	}
+
+	var flagSchema *logschema.LogSchema
+	if *schemaURI != "" {
+		flagSchema = &logschema.LogSchema{
+			SchemaURI:     *schemaURI,
+			Format:        logschema.Format(*format),
+			MediaType:     *mediaType,
+			SchemaVersion: *schemaVersion,
+		}
+		if *kind == kindAuto {
+			*kind = kindPayload
+		}
+	}
+	switch *kind {
+	case kindAuto, kindRun, kindTask, kindWESRun, kindTES:
+	case kindPayload:
+		if flagSchema == nil {
+			fmt.Fprintln(stderr, "wes-logschema: -kind payload requires -schema-uri")
+			return exitError
+		}
+	default:
+		fmt.Fprintf(stderr, "wes-logschema: unknown document kind %q\n", *kind)
+		return exitError
+	}
+
+	v := &logschema.Validator{
+		SchemaDir:      *schemaDir,
+		Offline:        *offline,
+		ResolveSchemas: *resolve,
+		MaxDecodedSize: *maxDecoded,
+	}
+	if *storeSpec != "" {
+		store, err := openStore(*storeSpec)
+		if err != nil {
+			fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+			return exitError
+		}
+		v.Store = store
+	}
+	v.DRS = drs()
+	if *keyDir != "" {
+		v.Keys = &logschema.FileKeyProvider{Dir: *keyDir}
+	}
+	if *requireSigs {
+		if v.Keys == nil {
+			fmt.Fprintln(stderr, "wes-logschema: -require-signatures requires -key-dir")
+			return exitError
+		}
+		v.RequireSignatures = true
+	}
+
+	if *wesURL != "" {
+		if *offline {
+			fmt.Fprintln(stderr, "wes-logschema: -wes-url cannot be combined with -offline")
+			return exitError
+		}
+		c := &wes.Client{BaseURL: *wesURL, PageSize: *pageSize}
+		reports, err := validateRemote(c, v, fs.Args())
+		if err != nil {
+			fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+			return exitError
+		}
+		if err := writeReports(stdout, *output, reports); err != nil {
+			fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+			return exitError
+		}
+		return exitCode(reports)
+	}
+
+	inputs, err := expandInputs(fs.Args(), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+		return exitError
+	}
+
+	var reports []*report
+	for _, in := range inputs {
+		rep := &report{Source: in.name}
+		data, err := in.read()
+		if err != nil {
+			rep.Error = err.Error()
+		} else if err := validateDocument(v, rep, data, *kind, flagSchema); err != nil {
+			rep.Error = err.Error()
+		}
+		reports = append(reports, rep)
+	}
+
+	if err := writeReports(stdout, *output, reports); err != nil {
+		fmt.Fprintf(stderr, "wes-logschema: %v\n", err)
+		return exitError
+	}
+	return exitCode(reports)
+}
+
+// validateRemote validates runIDs (or every run when empty) on a WES server.
+func validateRemote(c *wes.Client, v *logschema.Validator, runIDs []string) ([]*report, error) {
+	var reports []*report
+	add := func(r *wes.RunReport) error {
+		rep := &report{Source: "run " + r.RunID, Kind: kindWESRun}
+		if r.Err != nil {
+			rep.Error = r.Err.Error()
+		} else {
+			appendRunResult(rep, r.Result, r.Run.TaskLogs)
+		}
+		reports = append(reports, rep)
+		return nil
+	}
+	if len(runIDs) == 0 {
+		if err := c.ValidateRuns(v, add); err != nil {
+			return nil, err
+		}
+		return reports, nil
+	}
+	for _, id := range runIDs {
+		add(c.ValidateRun(v, id))
+	}
+	return reports, nil
+}
+
+// exitCode maps reports to the process exit code. Errors take precedence
+// over invalid results so that CI can tell broken inputs from bad logs.
+func exitCode(reports []*report) int {
+	code := exitValid
+	for _, r := range reports {
+		if r.Error != "" {
+			return exitError
+		}
+		if !r.valid() {
+			code = exitInvalid
+		}
+	}
+	return code
+}
+
+// expandInputs turns file names, globs and "-" into inputs. No arguments
+// means standard input.
+func expandInputs(args []string, stdin io.Reader) ([]input, error) {
+	if len(args) == 0 {
+		args = []string{"-"}
+	}
+	var inputs []input
+	for _, arg := range args {
+		if arg == "-" {
+			inputs = append(inputs, input{name: "<stdin>", read: func() ([]byte, error) { return io.ReadAll(stdin) }})
+			continue
+		}
+		paths := []string{arg}
+		if strings.ContainsAny(arg, "*?[") {
+			matches, err := filepath.Glob(arg)
+			if err != nil {
+				return nil, fmt.Errorf("bad glob %q: %w", arg, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match %q", arg)
+			}
+			paths = matches
+		}
+		for _, p := range paths {
+			p := p
+			inputs = append(inputs, input{name: p, read: func() ([]byte, error) { return os.ReadFile(p) }})
+		}
+	}
+	return inputs, nil
+}
+
+// validateDocument decodes data according to kind and appends a check for
+// every structured_log it contains.
+func validateDocument(v *logschema.Validator, rep *report, data []byte, kind string, flagSchema *logschema.LogSchema) error {
+	if kind == kindPayload {
+		rep.Kind = kindPayload
+		res, err := v.ValidateRunLog(&logschema.RunLog{StructuredLog: string(data), LogSchema: flagSchema})
+		if err != nil {
+			return err
+		}
+		if res == nil {
+			return fmt.Errorf("empty payload")
+		}
+		rep.Checks = append(rep.Checks, check{Name: "payload", Result: res})
+		return nil
+	}
+
+	kind, rl, tasks, err := decodeDocument(data, kind)
+	if err != nil {
+		return err
+	}
+	rep.Kind = kind
+	if kind == kindTask {
+		// A lone task inherits the schema given on the command line, if any.
+		rl = &logschema.RunLog{LogSchema: flagSchema}
+	}
+	return addRunChecks(v, rep, rl, tasks)
+}
+
+// decodeDocument decodes a run, task, WES run or TES document into the run log
+// and task logs it holds. kind may be kindAuto; the resolved kind is returned.
+func decodeDocument(data []byte, kind string) (string, *logschema.RunLog, []logschema.TaskLog, error) {
+	if kind == kindAuto {
+		var err error
+		if kind, err = detectKind(data); err != nil {
+			return "", nil, nil, err
+		}
+	}
+	switch kind {
+	case kindRun:
+		var rl logschema.RunLog
+		if err := json.Unmarshal(data, &rl); err != nil {
+			return "", nil, nil, fmt.Errorf("decoding RunLog: %w", err)
+		}
+		return kind, &rl, nil, nil
+	case kindTask:
+		var tl logschema.TaskLog
+		if err := json.Unmarshal(data, &tl); err != nil {
+			return "", nil, nil, fmt.Errorf("decoding TaskLog: %w", err)
+		}
+		return kind, nil, []logschema.TaskLog{tl}, nil
+	case kindWESRun:
+		var run logschema.Run
+		if err := json.Unmarshal(data, &run); err != nil {
+			return "", nil, nil, fmt.Errorf("decoding WES run: %w", err)
+		}
+		return kind, run.RunLog, run.TaskLogs, nil
+	case kindTES:
+		// A GET /tasks/{id} response or a GET /tasks?view=FULL list.
+		var list struct {
+			Tasks []logschema.TESTask `json:"tasks"`
+		}
+		if err := json.Unmarshal(data, &list); err != nil {
+			return "", nil, nil, fmt.Errorf("decoding TES task: %w", err)
+		}
+		if list.Tasks == nil {
+			var task logschema.TESTask
+			if err := json.Unmarshal(data, &task); err != nil {
+				return "", nil, nil, fmt.Errorf("decoding TES task: %w", err)
+			}
+			list.Tasks = []logschema.TESTask{task}
+		}
+		return kind, nil, logschema.TaskLogsFromTES(list.Tasks, tesMinConfidence), nil
+	}
+	return "", nil, nil, fmt.Errorf("unknown document kind %q", kind)
+}
+
+func addRunChecks(v *logschema.Validator, rep *report, rl *logschema.RunLog, tasks []logschema.TaskLog) error {
+	res, err := v.ValidateRun(rl, tasks)
+	if err != nil {
+		return err
+	}
+	appendRunResult(rep, res, tasks)
+	return nil
+}
+
+func appendRunResult(rep *report, res *logschema.RunResult, tasks []logschema.TaskLog) {
+	if res.Run != nil {
+		rep.Checks = append(rep.Checks, check{Name: "run", Result: res.Run})
+	}
+	for i, tr := range res.Tasks {
+		if tr != nil {
+			rep.Checks = append(rep.Checks, check{Name: taskName(&tasks[i], i), Result: tr})
+		}
+	}
+	for i, attempts := range res.Attempts {
+		for j, ar := range attempts {
+			if ar != nil {
+				rep.Checks = append(rep.Checks, check{Name: fmt.Sprintf("%s attempt %d", taskName(&tasks[i], i), j), Result: ar})
+			}
+		}
+	}
+}
+
+func taskName(tl *logschema.TaskLog, i int) string {
+	switch {
+	case tl.ID != "":
+		return "task " + tl.ID
+	case tl.Name != "":
+		return "task " + tl.Name
+	}
+	return fmt.Sprintf("task #%d", i)
+}
+
+// detectKind guesses what sort of document data holds from its top-level keys.
+func detectKind(data []byte) (string, error) {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return "", fmt.Errorf("not a JSON object: %w", err)
+	}
+	for _, k := range []string{"run_id", "run_log", "task_logs", "task_logs_url"} {
+		if _, ok := keys[k]; ok {
+			return kindWESRun, nil
+		}
+	}
+	for _, k := range []string{"executors", "tasks"} {
+		if _, ok := keys[k]; ok {
+			return kindTES, nil
+		}
+	}
+	for _, k := range []string{"logs", "metadata", "id"} {
+		if _, ok := keys[k]; ok {
+			return kindTask, nil
+		}
+	}
+	return kindRun, nil
+}
+
+// drsFlags defines -drs, described by usage, and -drs-prefix on fs. The
+// returned function builds the configured DRSResolver after parsing, or
+// nil if neither flag was set.
+func drsFlags(fs *flag.FlagSet, usage string) func() *logschema.DRSResolver {
+	enabled := fs.Bool("drs", false, usage)
+	prefixes := map[string]string{}
+	fs.Func("drs-prefix", "PREFIX=URL DRS API root for compact drs://PREFIX:ID URIs (repeatable, implies -drs)", func(s string) error {
+		prefix, root, ok := strings.Cut(s, "=")
+		if !ok || prefix == "" || root == "" {
+			return fmt.Errorf("want PREFIX=URL, got %q", s)
+		}
+		prefixes[prefix] = root
+		return nil
+	})
+	return func() *logschema.DRSResolver {
+		if !*enabled && len(prefixes) == 0 {
+			return nil
+		}
+		return &logschema.DRSResolver{Prefixes: prefixes, Token: os.Getenv("DRS_BEARER_TOKEN")}
+	}
+}
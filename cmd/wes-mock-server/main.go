@@ -0,0 +1,50 @@
+// Command wes-mock-server runs the reference WES server with structured
+// logs. By default it serves the built-in fixtures from memory; with -dir it
+// serves one <run_id>.json file per run from a directory instead.
+//
+// Run: go run ./cmd/wes-mock-server -listen :8000
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/animeshs34/wes-logging-schema/internal/wes"
+)
+
+func main() {
+	listen := flag.String("listen", ":8000", "address to listen on")
+	dir := flag.String("dir", "", "serve runs from <dir>/<run_id>.json instead of the built-in fixtures")
+	dump := flag.String("dump-fixtures", "", "write the built-in fixtures into this directory and exit")
+	pageSize := flag.Int("page-size", 10, "default page size for /runs and /runs/{run_id}/tasks")
+	flag.Parse()
+
+	if *dump != "" {
+		if err := os.MkdirAll(*dump, 0o755); err != nil {
+			fmt.Fprintf(os.Stderr, "wes-mock-server: %v\n", err)
+			os.Exit(1)
+		}
+		store := &wes.DirStore{Dir: *dump}
+		for _, run := range wes.FixtureRuns() {
+			if err := store.PutRun(run); err != nil {
+				fmt.Fprintf(os.Stderr, "wes-mock-server: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		return
+	}
+
+	var store wes.Store = wes.NewMemoryStore(wes.FixtureRuns()...)
+	if *dir != "" {
+		store = &wes.DirStore{Dir: *dir}
+	}
+
+	slog.Info("WES mock server listening", "addr", *listen, "base_path", wes.BasePath, "dir", *dir)
+	if err := http.ListenAndServe(*listen, &wes.Server{Store: store, PageSize: *pageSize}); err != nil {
+		slog.Error("server stopped", "error", err)
+		os.Exit(1)
+	}
+}
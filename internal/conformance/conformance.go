@@ -0,0 +1,369 @@
+// Package conformance checks a WES server against the structured logging
+// requirements of GA4GH WES Issue #215 and produces a scored report.
+package conformance
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+	"github.com/animeshs34/wes-logging-schema/internal/wes"
+)
+
+// Level is the RFC 2119 keyword of a requirement.
+type Level string
+
+const (
+	Must   Level = "MUST"
+	Should Level = "SHOULD"
+)
+
+// weight is how much a requirement level counts towards the score.
+func (l Level) weight() float64 {
+	if l == Must {
+		return 3
+	}
+	return 1
+}
+
+// Requirement is one testable statement of the proposal.
+type Requirement struct {
+	ID          string `json:"id"`
+	Level       Level  `json:"level"`
+	Description string `json:"description"`
+}
+
+// Requirement IDs.
+const (
+	ReqAPI              = "WES-1"
+	ReqSchemaPresent    = "SL-1"
+	ReqSchemaWellFormed = "SL-2"
+	ReqMediaType        = "SL-3"
+	ReqFormat           = "SL-4"
+	ReqSchemaResolvable = "SL-5"
+	ReqLogResolvable    = "SL-6"
+	ReqPlainStreams     = "SL-7"
+	ReqEncoding         = "SL-8"
+	ReqDigest           = "SL-9"
+	ReqSignatures       = "SL-10"
+)
+
+// Requirements lists every requirement checked by the Runner, in report order.
+var Requirements = []Requirement{
+	{ReqAPI, Must, "GET /runs, /runs/{run_id} and /runs/{run_id}/tasks succeed and decode"},
+	{ReqSchemaPresent, Must, "structured_log present implies log_schema present or inherited"},
+	{ReqSchemaWellFormed, Must, "log_schema is well-formed (absolute HTTP(S) or DRS schema_uri, known format)"},
+	{ReqMediaType, Must, "structured_log content matches the declared media_type"},
+	{ReqFormat, Must, "structured_log content has the structure required by its format"},
+	{ReqSchemaResolvable, Should, "log_schema.schema_uri is resolvable"},
+	{ReqLogResolvable, Should, "structured_log URIs are resolvable"},
+	{ReqPlainStreams, Must, "stdout/stderr carry plain text only, never structured data"},
+	{ReqEncoding, Must, "structured_log with a content_encoding decodes"},
+	{ReqDigest, Must, "structured_log_digest matches the structured_log content"},
+	{ReqSignatures, Must, "structured_log_signatures verify"},
+}
+
+// Finding is the outcome of one check of one requirement.
+type Finding struct {
+	Requirement string `json:"requirement"`
+	Subject     string `json:"subject"`
+	Passed      bool   `json:"passed"`
+	Message     string `json:"message,omitempty"`
+}
+
+// RequirementResult aggregates the findings for one requirement.
+type RequirementResult struct {
+	Requirement
+	Passed   int       `json:"passed"`
+	Failed   int       `json:"failed"`
+	Failures []Finding `json:"failures,omitempty"`
+}
+
+// Status is "pass", "fail", or "n/a" when nothing exercised the requirement.
+func (r *RequirementResult) Status() string {
+	switch {
+	case r.Failed > 0:
+		return "fail"
+	case r.Passed > 0:
+		return "pass"
+	}
+	return "n/a"
+}
+
+// Report is the scored outcome of a conformance run.
+type Report struct {
+	BaseURL      string              `json:"base_url"`
+	Runs         int                 `json:"runs"`
+	Requirements []RequirementResult `json:"requirements"`
+
+	// Score is the weighted percentage of passed checks over all applicable
+	// requirements; MUST requirements weigh three times as much as SHOULD.
+	Score float64 `json:"score"`
+
+	// Conformant is true when no MUST requirement failed.
+	Conformant bool `json:"conformant"`
+}
+
+// Runner exercises a WES server against Requirements.
+type Runner struct {
+	// Client points at the server under test.
+	Client *wes.Client
+
+	// Validator performs the structured log checks. Its Offline and
+	// SchemaDir settings apply to resolvability checks.
+	// Defaults to a zero Validator.
+	Validator *logschema.Validator
+
+	// Resolve enables the SHOULD checks that fetch schema_uri and
+	// structured_log URIs. drs:// URIs are resolved through the
+	// Validator's DRS resolver, or a default DRSResolver, which handles
+	// hostname-based URIs, if it has none.
+	Resolve bool
+
+	// FetchStreams dereferences stdout/stderr URLs and inspects their
+	// content, not only inline values.
+	FetchStreams bool
+}
+
+func (r *Runner) validator() *logschema.Validator {
+	if r.Validator != nil {
+		return r.Validator
+	}
+	return &logschema.Validator{}
+}
+
+// resolver returns the Validator used by the resolvability checks.
+func (r *Runner) resolver() *logschema.Validator {
+	v := *r.validator()
+	if v.DRS == nil {
+		v.DRS = &logschema.DRSResolver{}
+	}
+	return &v
+}
+
+// Run checks every run on the server and returns the report. An error is
+// returned only if the report itself cannot be produced.
+func (r *Runner) Run() (*Report, error) {
+	if r.Client == nil {
+		return nil, fmt.Errorf("conformance: no WES client configured")
+	}
+	var findings []Finding
+	add := func(req, subject string, passed bool, msg string) {
+		findings = append(findings, Finding{Requirement: req, Subject: subject, Passed: passed, Message: msg})
+	}
+
+	runs, err := r.Client.AllRuns()
+	if err != nil {
+		add(ReqAPI, "GET /runs", false, err.Error())
+		return r.report(0, findings), nil
+	}
+	add(ReqAPI, "GET /runs", true, "")
+
+	schemasSeen := map[string]bool{}
+	for _, rs := range runs {
+		subject := "run " + rs.RunID
+		run, err := r.Client.GetFullRun(rs.RunID)
+		if err != nil {
+			add(ReqAPI, subject, false, err.Error())
+			continue
+		}
+		add(ReqAPI, subject, true, "")
+		findings = append(findings, r.checkRun(run, schemasSeen)...)
+	}
+	return r.report(len(runs), findings), nil
+}
+
+// location is one place in a run that may hold logs.
+type location struct {
+	subject       string
+	stdout        string
+	stderr        string
+	structuredLog string
+	schema        *logschema.LogSchema // as declared, not inherited
+	encoded       bool                 // the declared or inherited schema has a content_encoding
+	digest        bool                 // a structured_log_digest is recorded
+	result        *logschema.ValidationResult
+}
+
+func (r *Runner) checkRun(run *logschema.Run, schemasSeen map[string]bool) []Finding {
+	v := *r.validator()
+	v.ResolveSchemas = false // resolvability is a separate SHOULD
+	res, err := v.ValidateRun(run.RunLog, run.TaskLogs)
+	if err != nil {
+		return []Finding{{Requirement: ReqAPI, Subject: "run " + run.RunID, Message: err.Error()}}
+	}
+
+	var locs []location
+	var runSchema *logschema.LogSchema
+	if run.RunLog != nil {
+		runSchema = run.RunLog.LogSchema
+		locs = append(locs, location{
+			subject: "run " + run.RunID, stdout: run.RunLog.Stdout, stderr: run.RunLog.Stderr,
+			structuredLog: run.RunLog.StructuredLog, schema: runSchema,
+			encoded: encoded(runSchema), digest: run.RunLog.StructuredLogDigest != nil, result: res.Run,
+		})
+	}
+	for i, tl := range run.TaskLogs {
+		id := tl.ID
+		if id == "" {
+			id = fmt.Sprintf("#%d", i)
+		}
+		taskSubject := fmt.Sprintf("run %s task %s", run.RunID, id)
+		taskSchema := inherit(tl.LogSchema, runSchema)
+		locs = append(locs, location{
+			subject: taskSubject, stdout: tl.Stdout, stderr: tl.Stderr,
+			structuredLog: tl.StructuredLog, schema: tl.LogSchema,
+			encoded: encoded(taskSchema), digest: tl.StructuredLogDigest != nil, result: res.Tasks[i],
+		})
+		for j, l := range tl.Logs {
+			var ar *logschema.ValidationResult
+			if res.Attempts != nil {
+				ar = res.Attempts[i][j]
+			}
+			locs = append(locs, location{
+				subject: fmt.Sprintf("%s attempt %d", taskSubject, j), stdout: l.Stdout, stderr: l.Stderr,
+				structuredLog: l.StructuredLog, schema: l.LogSchema,
+				encoded: encoded(inherit(l.LogSchema, taskSchema)), digest: l.StructuredLogDigest != nil, result: ar,
+			})
+		}
+	}
+
+	linter := &logschema.StreamLinter{Validator: r.validator(), Dereference: r.FetchStreams}
+	resolver := r.resolver()
+	var out []Finding
+	add := func(req, subject string, passed bool, msg string) {
+		out = append(out, Finding{Requirement: req, Subject: subject, Passed: passed, Message: msg})
+	}
+	for _, loc := range locs {
+		if loc.result != nil {
+			for _, f := range stageFindings(loc) {
+				f.Subject = loc.subject
+				out = append(out, f)
+			}
+		}
+		if r.Resolve && loc.schema != nil && isURI(loc.schema.SchemaURI) && !schemasSeen[loc.schema.SchemaURI] {
+			schemasSeen[loc.schema.SchemaURI] = true
+			_, err := resolver.FetchRemoteSchema(loc.schema)
+			add(ReqSchemaResolvable, loc.schema.SchemaURI, err == nil, errString(err))
+		}
+		if r.Resolve && isURI(loc.structuredLog) {
+			_, err := resolver.FetchURI(loc.structuredLog)
+			add(ReqLogResolvable, loc.subject+" structured_log", err == nil, errString(err))
+		}
+		for _, stream := range []struct{ name, value string }{{"stdout", loc.stdout}, {"stderr", loc.stderr}} {
+			if stream.value == "" {
+				continue
+			}
+			f, unreachable := linter.LintValue(loc.subject, stream.name, stream.value)
+			switch {
+			case unreachable:
+				// Not checkable; resolvability of streams is not a requirement.
+			case f != nil:
+				add(ReqPlainStreams, loc.subject+" "+stream.name, false, f.String())
+			default:
+				add(ReqPlainStreams, loc.subject+" "+stream.name, true, "")
+			}
+		}
+	}
+	return out
+}
+
+// stageFindings maps a validation result onto the requirements checked by
+// the Validator, in the order of its stages. Requirements after the failing
+// stage are not reported, since they were not reached, and optional steps
+// only count as passed when the log exercised them. A failure in a stage
+// without a requirement is reported against SL-4 alone.
+func stageFindings(loc location) []Finding {
+	res := loc.result
+	order := []struct {
+		stage, req string
+		checked    bool
+	}{
+		{logschema.StageMissingSchema, ReqSchemaPresent, true},
+		{logschema.StageSchema, ReqSchemaWellFormed, true},
+		{logschema.StageResolve, ReqSchemaResolvable, false},
+		{logschema.StageEncoding, ReqEncoding, loc.encoded},
+		{logschema.StageFetch, ReqLogResolvable, false},
+		{logschema.StageMediaType, ReqMediaType, true},
+		{logschema.StageFormat, ReqFormat, true},
+		{logschema.StageDigest, ReqDigest, loc.digest},
+		{logschema.StageSignature, ReqSignatures, len(res.Signatures) > 0},
+	}
+	var out []Finding
+	for _, o := range order {
+		if res.Stage == o.stage {
+			return append(out, Finding{Requirement: o.req, Message: strings.Join(res.Errors, "; ")})
+		}
+		if o.checked {
+			out = append(out, Finding{Requirement: o.req, Passed: true})
+		}
+	}
+	if !res.Valid {
+		return []Finding{{Requirement: ReqFormat, Message: fmt.Sprintf("%s: %s", res.Stage, strings.Join(res.Errors, "; "))}}
+	}
+	return out
+}
+
+// inherit returns the schema a log is validated against: its own, or the
+// one of its parent.
+func inherit(own, parent *logschema.LogSchema) *logschema.LogSchema {
+	if own != nil {
+		return own
+	}
+	return parent
+}
+
+func encoded(s *logschema.LogSchema) bool {
+	return s != nil && s.ContentEncoding != ""
+}
+
+func (r *Runner) report(runs int, findings []Finding) *Report {
+	rep := &Report{BaseURL: r.Client.BaseURL, Runs: runs, Conformant: true}
+	byID := map[string]*RequirementResult{}
+	for _, req := range Requirements {
+		rep.Requirements = append(rep.Requirements, RequirementResult{Requirement: req})
+	}
+	for i := range rep.Requirements {
+		byID[rep.Requirements[i].ID] = &rep.Requirements[i]
+	}
+	for _, f := range findings {
+		rr := byID[f.Requirement]
+		if f.Passed {
+			rr.Passed++
+		} else {
+			rr.Failed++
+			rr.Failures = append(rr.Failures, f)
+		}
+	}
+
+	var got, total float64
+	for _, rr := range rep.Requirements {
+		n := rr.Passed + rr.Failed
+		if n == 0 {
+			continue
+		}
+		w := rr.Level.weight()
+		got += w * float64(rr.Passed) / float64(n)
+		total += w
+		if rr.Level == Must && rr.Failed > 0 {
+			rep.Conformant = false
+		}
+	}
+	if total > 0 {
+		rep.Score = 100 * got / total
+	}
+	return rep
+}
+
+// isURI reports whether s is a URI the resolvability checks fetch: an
+// HTTP(S) or DRS URI.
+func isURI(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "drs://")
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,211 @@
+package conformance_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/animeshs34/wes-logging-schema/internal/conformance"
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+	"github.com/animeshs34/wes-logging-schema/internal/wes"
+)
+
+func result(t *testing.T, rep *conformance.Report, id string) conformance.RequirementResult {
+	t.Helper()
+	for _, rr := range rep.Requirements {
+		if rr.ID == id {
+			return rr
+		}
+	}
+	t.Fatalf("requirement %s missing from report", id)
+	return conformance.RequirementResult{}
+}
+
+func failedSubjects(rr conformance.RequirementResult) []string {
+	var out []string
+	for _, f := range rr.Failures {
+		out = append(out, f.Subject)
+	}
+	return out
+}
+
+func TestRunner_FixtureServer(t *testing.T) {
+	srv := wes.NewFixtureServer()
+	defer srv.Close()
+
+	rep, err := (&conformance.Runner{Client: &wes.Client{BaseURL: srv.BaseURL()}}).Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rep.Conformant {
+		t.Error("fixture server contains broken runs and must not be conformant")
+	}
+	if rep.Runs != len(wes.Fixtures()) {
+		t.Errorf("Runs = %d, want %d", rep.Runs, len(wes.Fixtures()))
+	}
+
+	wantFailures := map[string][]string{
+		conformance.ReqSchemaPresent:    {"run broken-missing-schema", "run broken-orphan-task task step-1"},
+		conformance.ReqSchemaWellFormed: {"run broken-attempt-schema task step-1 attempt 0"},
+		conformance.ReqMediaType:        {"run broken-malformed-json"},
+		conformance.ReqFormat:           {"run broken-task-crate task step-1"},
+	}
+	for id, want := range wantFailures {
+		got := failedSubjects(result(t, rep, id))
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s failures = %v, want %v", id, got, want)
+		}
+	}
+	if rr := result(t, rep, conformance.ReqSchemaResolvable); rr.Status() != "n/a" {
+		t.Errorf("resolvability should not be checked without Resolve, got %s", rr.Status())
+	}
+
+	var buf bytes.Buffer
+	if err := rep.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "NOT CONFORMANT") {
+		t.Errorf("text report lacks verdict:\n%s", buf.String())
+	}
+}
+
+func TestRunner_ConformantServer(t *testing.T) {
+	var runs []*logschema.Run
+	for _, f := range wes.Fixtures() {
+		if f.Valid {
+			runs = append(runs, f.Run)
+		}
+	}
+	srv := wes.NewMockServer(runs...)
+	defer srv.Close()
+
+	rep, err := (&conformance.Runner{Client: &wes.Client{BaseURL: srv.BaseURL()}}).Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !rep.Conformant || rep.Score != 100 {
+		t.Errorf("expected a conformant 100%% report, got conformant=%v score=%.1f", rep.Conformant, rep.Score)
+	}
+}
+
+func TestRunner_StreamsAndResolution(t *testing.T) {
+	assets := http.NewServeMux()
+	assets.HandleFunc("/schema.json", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`{}`)) })
+	assets.HandleFunc("/stdout.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{\"level\":\"info\"}\n{\"level\":\"warn\"}\n"))
+	})
+	files := httptest.NewServer(assets)
+	defer files.Close()
+
+	srv := wes.NewMockServer(&logschema.Run{
+		RunID: "r1",
+		RunLog: &logschema.RunLog{
+			Stdout:        files.URL + "/stdout.txt",
+			Stderr:        `{"error": "inline JSON on stderr"}`,
+			StructuredLog: files.URL + "/missing.json",
+			LogSchema:     &logschema.LogSchema{SchemaURI: files.URL + "/schema.json", Format: logschema.FormatCustom},
+		},
+	})
+	defer srv.Close()
+
+	rep, err := (&conformance.Runner{
+		Client:       &wes.Client{BaseURL: srv.BaseURL()},
+		Resolve:      true,
+		FetchStreams: true,
+	}).Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := failedSubjects(result(t, rep, conformance.ReqPlainStreams)); len(got) != 2 {
+		t.Errorf("expected NDJSON stdout and inline JSON stderr to fail, got %v", got)
+	}
+	if rr := result(t, rep, conformance.ReqSchemaResolvable); rr.Status() != "pass" {
+		t.Errorf("schema_uri should resolve, got %+v", rr)
+	}
+	if rr := result(t, rep, conformance.ReqLogResolvable); rr.Status() != "fail" {
+		t.Errorf("missing structured_log URI should fail, got %+v", rr)
+	}
+}
+
+func TestRunner_LaterStages(t *testing.T) {
+	content := `{"level": "info", "msg": "done"}`
+	schema := &logschema.LogSchema{SchemaURI: "https://example.org/log.json", Format: logschema.FormatCustom}
+	digest, err := logschema.ComputeDigest([]byte(content), schema, "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tampered := *digest
+	tampered.Value = strings.Repeat("0", len(digest.Value))
+
+	srv := wes.NewMockServer(
+		&logschema.Run{RunID: "digest-ok", RunLog: &logschema.RunLog{
+			StructuredLog: content, LogSchema: schema, StructuredLogDigest: digest,
+		}},
+		&logschema.Run{RunID: "digest-tampered", RunLog: &logschema.RunLog{
+			StructuredLog: content, LogSchema: schema, StructuredLogDigest: &tampered,
+		}},
+		&logschema.Run{RunID: "bad-encoding", RunLog: &logschema.RunLog{
+			StructuredLog: "not base64!",
+			LogSchema:     &logschema.LogSchema{SchemaURI: schema.SchemaURI, Format: logschema.FormatCustom, ContentEncoding: logschema.EncodingBase64},
+		}},
+	)
+	defer srv.Close()
+
+	rep, err := (&conformance.Runner{Client: &wes.Client{BaseURL: srv.BaseURL()}}).Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rep.Conformant {
+		t.Error("a tampered digest must make the server non-conformant")
+	}
+	for id, want := range map[string]struct {
+		passed   int
+		failures string
+	}{
+		conformance.ReqDigest:     {1, "run digest-tampered"},
+		conformance.ReqEncoding:   {0, "run bad-encoding"},
+		conformance.ReqMediaType:  {2, ""},
+		conformance.ReqSignatures: {0, ""},
+	} {
+		rr := result(t, rep, id)
+		if rr.Passed != want.passed || strings.Join(failedSubjects(rr), ",") != want.failures {
+			t.Errorf("%s: passed %d, failures %v; want %d, %q", id, rr.Passed, failedSubjects(rr), want.passed, want.failures)
+		}
+	}
+}
+
+func TestRunner_ResolvesDRS(t *testing.T) {
+	m := logschema.NewMockDRS()
+	defer m.Close()
+	schemaURI := m.AddObject("schema", []byte(`{}`), "application/json")
+	logURI := m.AddObject("log", []byte(`{"level": "info"}`), "application/json")
+	schema := func() *logschema.LogSchema {
+		return &logschema.LogSchema{SchemaURI: schemaURI, Format: logschema.FormatCustom}
+	}
+
+	srv := wes.NewMockServer(
+		&logschema.Run{RunID: "drs-ok", RunLog: &logschema.RunLog{StructuredLog: logURI, LogSchema: schema()}},
+		&logschema.Run{RunID: "drs-missing", RunLog: &logschema.RunLog{StructuredLog: m.URI("gone"), LogSchema: schema()}},
+	)
+	defer srv.Close()
+
+	// No DRS resolver is configured: hostname-based URIs are resolved
+	// with a default one.
+	rep, err := (&conformance.Runner{
+		Client:    &wes.Client{BaseURL: srv.BaseURL()},
+		Validator: &logschema.Validator{HTTPClient: m.Client()},
+		Resolve:   true,
+	}).Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rr := result(t, rep, conformance.ReqSchemaResolvable); rr.Passed != 1 || rr.Failed != 0 {
+		t.Errorf("DRS schema_uri should resolve once, got %+v", rr)
+	}
+	rr := result(t, rep, conformance.ReqLogResolvable)
+	if got := strings.Join(failedSubjects(rr), ","); rr.Passed != 1 || got != "run drs-missing structured_log" {
+		t.Errorf("SL-6: passed %d, failures %s", rr.Passed, got)
+	}
+}
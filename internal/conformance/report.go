@@ -0,0 +1,25 @@
+package conformance
+
+import (
+	"fmt"
+	"io"
+)
+
+// WriteText renders the report for humans.
+func (r *Report) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "WES structured logging conformance: %s\n", r.BaseURL)
+	fmt.Fprintf(w, "Runs checked: %d\n\n", r.Runs)
+	for _, rr := range r.Requirements {
+		fmt.Fprintf(w, "[%-4s] %-6s %-5s %s (%d passed, %d failed)\n",
+			rr.Status(), rr.Level, rr.ID, rr.Description, rr.Passed, rr.Failed)
+		for _, f := range rr.Failures {
+			fmt.Fprintf(w, "         ✗ %s: %s\n", f.Subject, f.Message)
+		}
+	}
+	verdict := "CONFORMANT"
+	if !r.Conformant {
+		verdict = "NOT CONFORMANT"
+	}
+	_, err := fmt.Fprintf(w, "\nScore: %.1f%% — %s\n", r.Score, verdict)
+	return err
+}
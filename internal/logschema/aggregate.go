@@ -0,0 +1,314 @@
+package logschema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// EntityConflict records an entity property that two structured logs
+// define differently. The first definition is kept.
+type EntityConflict struct {
+	ID       string      `json:"id"`
+	Property string      `json:"property"`
+	Kept     interface{} `json:"kept"`
+	Dropped  interface{} `json:"dropped"`
+	Location string      `json:"location"` // log that defined the dropped value
+}
+
+func (c EntityConflict) String() string {
+	kept, _ := json.Marshal(c.Kept)
+	dropped, _ := json.Marshal(c.Dropped)
+	return fmt.Sprintf("%s: %s.%s is %s, keeping %s", c.Location, c.ID, c.Property, dropped, kept)
+}
+
+// AggregateReport describes how task logs were merged into a run-level log.
+type AggregateReport struct {
+	Conflicts []EntityConflict `json:"conflicts,omitempty"`
+	Losses    []ConversionLoss `json:"losses,omitempty"`
+	// Skipped lists logs whose structured_log could not be merged, with the
+	// reason. Their tasks still appear in the result, built from the TaskLog.
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// AggregateCrate merges the run's and every task's structured_log into one
+// run-level Workflow Run Crate. Task logs in PROV are converted first.
+// Entities with the same @id are merged: references are combined and
+// differing values are reported as conflicts. Every task action is
+// mentioned by the root dataset and linked to the run's CreateAction with
+// isPartOf; tasks without a usable crate get an action built from their
+// TaskLog.
+func AggregateCrate(runID string, rl *RunLog, tasks []TaskLog) (*Crate, *AggregateReport, error) {
+	report := &AggregateReport{}
+	var runSchema *LogSchema
+	if rl != nil {
+		runSchema = rl.LogSchema
+	}
+	load := func(location, content string, schema *LogSchema) *Crate {
+		if content == "" {
+			return nil
+		}
+		content, schema, err := DecodeStructuredLog(content, schema)
+		if err != nil {
+			report.Skipped = append(report.Skipped, fmt.Sprintf("%s: %v", location, err))
+			return nil
+		}
+		out, _, losses, err := ConvertStructuredLog(content, schema, FormatROCrate)
+		if err != nil {
+			report.Skipped = append(report.Skipped, fmt.Sprintf("%s: %v", location, err))
+			return nil
+		}
+		for _, l := range losses {
+			l.Location = location
+			report.Losses = append(report.Losses, l)
+		}
+		crate, err := ParseCrate(out)
+		if err != nil {
+			report.Skipped = append(report.Skipped, fmt.Sprintf("%s: %v", location, err))
+			return nil
+		}
+		return crate
+	}
+
+	var crate *Crate
+	if rl != nil {
+		crate = load("run", rl.StructuredLog, runSchema)
+	}
+	if crate == nil {
+		var err error
+		if crate, err = CrateBuilderFromRun(runID, rl, nil).Build(); err != nil {
+			return nil, nil, err
+		}
+	}
+	m := &crateMerger{crate: crate, byID: map[string]Entity{}, report: report}
+	for _, e := range crate.Graph {
+		m.byID[e.ID()] = e
+	}
+	root := crate.Root()
+	if root == nil {
+		return nil, nil, fmt.Errorf("run crate has no root dataset")
+	}
+	run := m.byID[RunEntityID(runID)]
+	if run == nil {
+		run = Entity{"@id": RunEntityID(runID), "@type": "CreateAction", "name": "WES run " + runID}
+		if rl != nil {
+			setTimes(run, rl.StartTime, rl.EndTime)
+		}
+		m.add(run)
+		addRef(root, "mentions", run.ID())
+	}
+
+	for i := range tasks {
+		tl := &tasks[i]
+		location := taskLocation(tl, i)
+		schema := tl.LogSchema
+		if schema == nil {
+			schema = runSchema
+		}
+		var actions []string
+		if tc := load(location, tl.StructuredLog, schema); tc != nil {
+			actions = m.merge(location, tc, run.ID())
+		}
+		if len(actions) == 0 {
+			task := crateTaskFromLog(tl, i).entity()
+			m.mergeEntity(location, task)
+			actions = []string{task.ID()}
+		}
+		for _, id := range actions {
+			addRef(root, "mentions", id)
+			m.mergeEntity(location, Entity{"@id": id, "isPartOf": ref(run.ID())})
+		}
+	}
+
+	if err := crate.CheckReferences(); err != nil {
+		return nil, report, fmt.Errorf("aggregating task logs: %w", err)
+	}
+	return crate, report, nil
+}
+
+// AggregateRun aggregates the task logs with AggregateCrate and stores the
+// result in rl.StructuredLog as RO-Crate or, for FormatOPM, as PROV with
+// each task activity started by the run activity. Tasks whose schema was
+// inherited from the run and would now change are given an explicit
+// log_schema, so their own structured logs still validate.
+func AggregateRun(runID string, rl *RunLog, tasks []TaskLog, to Format) (*AggregateReport, error) {
+	if rl == nil {
+		return nil, errors.New("no run log to populate")
+	}
+	crate, report, err := AggregateCrate(runID, rl, tasks)
+	if err != nil {
+		return report, err
+	}
+	var content string
+	var schema *LogSchema
+	switch to {
+	case FormatROCrate:
+		if content, err = crate.Marshal(); err != nil {
+			return report, err
+		}
+		schema = ROCrateLogSchema()
+	case FormatOPM:
+		doc, losses, err := CrateToProv(crate)
+		if err != nil {
+			return report, err
+		}
+		for _, l := range losses {
+			l.Location = "run"
+			report.Losses = append(report.Losses, l)
+		}
+		names := &provNames{doc: doc}
+		run := names.qname(RunEntityID(runID))
+		b := &ProvBuilder{doc: *doc}
+		for _, e := range crate.Graph {
+			if isAction(e) && e.ID() != RunEntityID(runID) && len(e.Refs("isPartOf")) > 0 {
+				b.WasStartedBy(names.qname(e.ID()), run, "")
+			}
+		}
+		if doc, err = b.Build(); err != nil {
+			return report, err
+		}
+		if content, err = doc.JSON(); err != nil {
+			return report, err
+		}
+		schema = ProvLogSchema()
+	default:
+		return report, fmt.Errorf("%w: cannot aggregate into %s", ErrUnsupportedConversion, to)
+	}
+
+	pinInheritedSchemas(rl.LogSchema, schema, tasks)
+	rl.StructuredLog, rl.LogSchema = content, schema
+	rl.StructuredLogDigest, rl.StructuredLogSignatures = nil, nil
+	return report, nil
+}
+
+// pinInheritedSchemas gives tasks that inherit the run's schema an explicit
+// one when the run's schema changes from oldRun to newRun. A task that had
+// nothing to inherit gets its detected schema when that differs in format
+// from newRun.
+func pinInheritedSchemas(oldRun, newRun *LogSchema, tasks []TaskLog) {
+	if sameSchema(oldRun, newRun) {
+		return
+	}
+	for i := range tasks {
+		tl := &tasks[i]
+		if tl.LogSchema != nil || !hasStructuredContent(tl) {
+			continue
+		}
+		switch {
+		case oldRun != nil:
+			tl.LogSchema = oldRun
+		case tl.StructuredLog != "" && !isLogURI(tl.StructuredLog):
+			if d := DetectSchema([]byte(tl.StructuredLog)); d != nil && d.Schema.SchemaURI != "" && d.Schema.Format != newRun.Format {
+				tl.LogSchema = d.Schema
+			}
+		}
+	}
+}
+
+// hasStructuredContent reports whether a task or any of its attempts
+// carries a structured_log.
+func hasStructuredContent(tl *TaskLog) bool {
+	if tl.StructuredLog != "" {
+		return true
+	}
+	for _, a := range tl.Logs {
+		if a.StructuredLog != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// crateMerger accumulates entities into a run-level crate.
+type crateMerger struct {
+	crate  *Crate
+	byID   map[string]Entity
+	report *AggregateReport
+}
+
+func (m *crateMerger) add(e Entity) {
+	m.crate.Graph = append(m.crate.Graph, e)
+	m.byID[e.ID()] = e
+}
+
+// merge adds a task crate's entities and returns its actions, other than
+// the run action. The task crate's descriptor and root are not copied; the
+// root's hasPart is combined into the run root's.
+func (m *crateMerger) merge(location string, tc *Crate, runAction string) []string {
+	root := m.crate.Root()
+	var taskRoot string
+	if r := tc.Root(); r != nil {
+		taskRoot = r.ID()
+		for _, id := range r.Refs("hasPart") {
+			addRef(root, "hasPart", id)
+		}
+	}
+	var actions []string
+	for _, e := range tc.Graph {
+		if e.ID() == ROCrateMetadataID || e.ID() == taskRoot {
+			continue
+		}
+		m.mergeEntity(location, e)
+		if isAction(e) && e.ID() != runAction {
+			actions = append(actions, e.ID())
+		}
+	}
+	return actions
+}
+
+// mergeEntity adds e, or merges it into the entity with the same @id.
+func (m *crateMerger) mergeEntity(location string, e Entity) {
+	dst := m.byID[e.ID()]
+	if dst == nil {
+		cp := Entity{}
+		for k, v := range e {
+			cp[k] = v
+		}
+		m.add(cp)
+		return
+	}
+	for _, prop := range sortedKeys(e) {
+		v := e[prop]
+		cur, ok := dst[prop]
+		switch {
+		case !ok:
+			dst[prop] = v
+		case prop == "@type":
+			if !sameStrings(stringsOf(cur), stringsOf(v)) {
+				m.conflict(dst.ID(), prop, cur, v, location)
+			}
+		case jsonEqual(cur, v):
+		case isRefList(cur) && isRefList(v):
+			for _, id := range (Entity{prop: v}).Refs(prop) {
+				addRef(dst, prop, id)
+			}
+		default:
+			m.conflict(dst.ID(), prop, cur, v, location)
+		}
+	}
+}
+
+func (m *crateMerger) conflict(id, prop string, kept, dropped interface{}, location string) {
+	m.report.Conflicts = append(m.report.Conflicts, EntityConflict{ID: id, Property: prop, Kept: kept, Dropped: dropped, Location: location})
+}
+
+// isRefList reports whether v is a reference or a list of references.
+func isRefList(v interface{}) bool {
+	items := asSlice(v)
+	return len(items) > 0 && len(Entity{"p": v}.Refs("p")) == len(items)
+}
+
+func jsonEqual(a, b interface{}) bool {
+	x, err1 := json.Marshal(a)
+	y, err2 := json.Marshal(b)
+	return err1 == nil && err2 == nil && string(x) == string(y)
+}
+
+func sameStrings(a, b []string) bool {
+	a, b = append([]string{}, a...), append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	return strings.Join(a, "\x00") == strings.Join(b, "\x00")
+}
@@ -0,0 +1,113 @@
+package logschema_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+func taskCrate(graph string) string {
+	return `{"@context": "https://w3id.org/ro/crate/1.1/context", "@graph": [
+		{"@id": "ro-crate-metadata.json", "@type": "CreativeWork", "about": {"@id": "./"}},
+		{"@id": "./", "@type": "Dataset", "hasPart": [{"@id": "aligned.bam"}]},
+		` + graph + `]}`
+}
+
+func aggregationTasks() []logschema.TaskLog {
+	return []logschema.TaskLog{
+		{ID: "bwa", StartTime: "2024-01-01T10:00:00Z", EndTime: "2024-01-01T10:30:00Z", StructuredLog: taskCrate(`
+			{"@id": "#task-bwa", "@type": "CreateAction", "object": {"@id": "reads.fastq"}, "result": {"@id": "aligned.bam"}},
+			{"@id": "reads.fastq", "@type": "File"},
+			{"@id": "aligned.bam", "@type": "File", "contentSize": "100"}`)},
+		{ID: "gatk", StartTime: "2024-01-01T10:30:00Z", EndTime: "2024-01-01T12:00:00Z", StructuredLog: taskCrate(`
+			{"@id": "#task-gatk", "@type": "CreateAction", "object": {"@id": "aligned.bam"}},
+			{"@id": "aligned.bam", "@type": "File", "contentSize": "200"}`)},
+		{ID: "index", Name: "samtools index", StartTime: "2024-01-01T10:30:00Z", EndTime: "2024-01-01T10:31:00Z"},
+		{ID: "qc", StructuredLog: `{"prefix": {"ex": "https://example.org/"}, "activity": {"ex:fastqc": {}}, "entity": {"ex:report": {}},
+			"wasGeneratedBy": {"_:g1": {"prov:entity": "ex:report", "prov:activity": "ex:fastqc"}}}`,
+			LogSchema: logschema.ProvLogSchema()},
+		{ID: "remote", StructuredLog: "https://storage.example.com/remote/crate.json"},
+	}
+}
+
+func TestAggregateCrate(t *testing.T) {
+	rl := &logschema.RunLog{Name: "variant-calling", StartTime: "2024-01-01T10:00:00Z", EndTime: "2024-01-01T12:00:00Z",
+		LogSchema: logschema.ROCrateLogSchema()}
+	crate, report, err := logschema.AggregateCrate("run-001", rl, aggregationTasks())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := crate.CheckReferences(); err != nil {
+		t.Errorf("aggregated crate: %v", err)
+	}
+	if n := len(crate.OfType("File")); n != 2 {
+		t.Errorf("expected reads.fastq and aligned.bam once each, got %d files", n)
+	}
+	run := logschema.RunEntityID("run-001")
+	if crate.Get(run) == nil {
+		t.Fatalf("missing run CreateAction")
+	}
+	for _, id := range []string{"#task-bwa", "#task-gatk", "#task-index", "https://example.org/fastqc", "#task-remote"} {
+		task := crate.Get(id)
+		if task == nil {
+			t.Errorf("missing task action %s", id)
+			continue
+		}
+		if got := task.Refs("isPartOf"); len(got) != 1 || got[0] != run {
+			t.Errorf("%s not linked to the run: %v", id, task)
+		}
+		if !strings.Contains(strings.Join(crate.Root().Refs("mentions"), " "), id) {
+			t.Errorf("root does not mention %s", id)
+		}
+	}
+	if crate.Get("#task-index").String("name") != "samtools index" {
+		t.Errorf("task without structured_log should be built from its TaskLog: %v", crate.Get("#task-index"))
+	}
+
+	if len(report.Conflicts) != 1 || report.Conflicts[0].ID != "aligned.bam" || report.Conflicts[0].Property != "contentSize" {
+		t.Errorf("expected one contentSize conflict, got %v", report.Conflicts)
+	}
+	if report.Conflicts[0].Kept != "100" || report.Conflicts[0].Location != "task gatk" {
+		t.Errorf("first definition should win: %v", report.Conflicts[0])
+	}
+	if len(report.Skipped) != 1 || !strings.HasPrefix(report.Skipped[0], "task remote") {
+		t.Errorf("expected the by-reference task to be skipped, got %v", report.Skipped)
+	}
+}
+
+func TestAggregateRun(t *testing.T) {
+	for _, format := range []logschema.Format{logschema.FormatROCrate, logschema.FormatOPM} {
+		t.Run(string(format), func(t *testing.T) {
+			rl := &logschema.RunLog{StartTime: "2024-01-01T10:00:00Z", EndTime: "2024-01-01T12:00:00Z",
+				LogSchema: logschema.ROCrateLogSchema()}
+			tasks := aggregationTasks()[:4]
+			if _, err := logschema.AggregateRun("run-001", rl, tasks, format); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if rl.LogSchema.Format != format {
+				t.Errorf("run log_schema = %+v", rl.LogSchema)
+			}
+			res, err := (&logschema.Validator{}).ValidateRun(rl, tasks)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !res.Valid() {
+				t.Errorf("aggregated run does not validate: run %v, tasks %v", res.Run, res.Tasks)
+			}
+			if format == logschema.FormatOPM {
+				doc, err := logschema.ParseProv(rl.StructuredLog)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(doc.WasStartedBy) != 4 {
+					t.Errorf("expected every task started by the run, got %v", doc.WasStartedBy)
+				}
+				if tasks[0].LogSchema == nil || tasks[0].LogSchema.Format != logschema.FormatROCrate {
+					t.Errorf("RO-Crate task should pin its inherited schema, got %+v", tasks[0].LogSchema)
+				}
+			}
+		})
+	}
+}
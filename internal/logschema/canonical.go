@@ -0,0 +1,759 @@
+package logschema
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// CanonicalizeJSON returns the RFC 8785 JSON Canonicalization Scheme (JCS)
+// form of a JSON document: no insignificant whitespace, object members
+// sorted by the UTF-16 code units of their names, ECMAScript number
+// formatting and minimal string escaping. Two documents that differ only in
+// layout, member order or number spelling canonicalise to the same bytes.
+func CanonicalizeJSON(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("not valid JSON: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("not valid JSON: trailing data after the top-level value")
+	}
+	var buf bytes.Buffer
+	if err := writeJCS(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeJCS serialises a value decoded with UseNumber in JCS form.
+func writeJCS(buf *bytes.Buffer, v interface{}) error {
+	switch x := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(x))
+	case json.Number:
+		f, err := strconv.ParseFloat(string(x), 64)
+		if err != nil {
+			return fmt.Errorf("number %s cannot be represented as an IEEE 754 double", x)
+		}
+		buf.WriteString(formatES(f))
+	case string:
+		writeJCSString(buf, x)
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, e := range x {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJCS(buf, e); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return utf16Less(keys[i], keys[j]) })
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJCSString(buf, k)
+			buf.WriteByte(':')
+			if err := writeJCS(buf, x[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("unexpected JSON value of type %T", v)
+	}
+	return nil
+}
+
+// writeJCSString writes s as a JSON string, escaping only what
+// ECMAScript's JSON.stringify escapes.
+func writeJCSString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(buf, `\u%04x`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// utf16Less orders strings by their UTF-16 code units, as JCS requires.
+func utf16Less(a, b string) bool {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
+
+// formatES formats f like ECMAScript's Number.prototype.toString: the
+// shortest round-tripping digits, in plain notation for exponents in
+// [-7, 21) and in exponent notation otherwise.
+func formatES(f float64) string {
+	if f == 0 {
+		return "0" // also for -0
+	}
+	sign := ""
+	if f < 0 {
+		sign, f = "-", -f
+	}
+	s := strconv.FormatFloat(f, 'e', -1, 64)
+	mant, exp, _ := strings.Cut(s, "e")
+	e, _ := strconv.Atoi(exp)
+	digits := strings.Replace(mant, ".", "", 1)
+	k, n := len(digits), e+1
+	switch {
+	case k <= n && n <= 21:
+		return sign + digits + strings.Repeat("0", n-k)
+	case 0 < n && n <= 21:
+		return sign + digits[:n] + "." + digits[n:]
+	case -6 < n && n <= 0:
+		return sign + "0." + strings.Repeat("0", -n) + digits
+	}
+	m := digits[:1]
+	if k > 1 {
+		m += "." + digits[1:]
+	}
+	if n-1 < 0 {
+		return sign + m + "e-" + strconv.Itoa(1-n)
+	}
+	return sign + m + "e+" + strconv.Itoa(n-1)
+}
+
+// rdfTerm is an IRI, blank node or literal in an RDF quad. The zero value
+// is the default graph.
+type rdfTerm struct {
+	kind     rdfKind
+	value    string // IRI, blank node label without "_:", or lexical form
+	datatype string // literals only
+	language string // language-tagged literals only
+}
+
+type rdfKind int
+
+const (
+	rdfDefaultGraph rdfKind = iota
+	rdfIRI
+	rdfBlank
+	rdfLiteral
+)
+
+// rdfQuad is one statement of an RDF dataset.
+type rdfQuad struct {
+	s, p, o, g rdfTerm
+}
+
+const (
+	rdfType    = "http://www.w3.org/1999/02/22-rdf-syntax-ns#type"
+	rdfLangStr = "http://www.w3.org/1999/02/22-rdf-syntax-ns#langString"
+	xsdString  = "http://www.w3.org/2001/XMLSchema#string"
+	xsdBoolean = "http://www.w3.org/2001/XMLSchema#boolean"
+	xsdInteger = "http://www.w3.org/2001/XMLSchema#integer"
+	xsdDouble  = "http://www.w3.org/2001/XMLSchema#double"
+)
+
+// nquad serialises t in N-Quads syntax, with blank node labels mapped by
+// label (or kept when label is nil).
+func (t rdfTerm) nquad(label func(string) string) string {
+	switch t.kind {
+	case rdfIRI:
+		return "<" + t.value + ">"
+	case rdfBlank:
+		if label != nil {
+			return "_:" + label(t.value)
+		}
+		return "_:" + t.value
+	case rdfLiteral:
+		s := `"` + nquadEscaper.Replace(t.value) + `"`
+		switch {
+		case t.language != "":
+			s += "@" + t.language
+		case t.datatype != "" && t.datatype != xsdString:
+			s += "^^<" + t.datatype + ">"
+		}
+		return s
+	}
+	return ""
+}
+
+var nquadEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`, `"`, `\"`)
+
+// nquad serialises q as one N-Quads line, including the trailing newline.
+func (q rdfQuad) nquad(label func(string) string) string {
+	s := q.s.nquad(label) + " " + q.p.nquad(label) + " " + q.o.nquad(label)
+	if q.g.kind != rdfDefaultGraph {
+		s += " " + q.g.nquad(label)
+	}
+	return s + " .\n"
+}
+
+// parseNQuads reads an N-Quads document. Statements repeated in the
+// document are kept once, since an RDF dataset is a set.
+func parseNQuads(doc string) ([]rdfQuad, error) {
+	var quads []rdfQuad
+	seen := map[string]bool{}
+	for n, line := range strings.Split(doc, "\n") {
+		r := &nquadReader{s: strings.TrimSuffix(line, "\r")}
+		if r.skipSpace(); r.done() {
+			continue
+		}
+		q, err := r.quad()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		if key := q.nquad(nil); !seen[key] {
+			seen[key] = true
+			quads = append(quads, q)
+		}
+	}
+	return quads, nil
+}
+
+// nquadReader scans one N-Quads line.
+type nquadReader struct {
+	s string
+	i int
+}
+
+func (r *nquadReader) skipSpace() {
+	for r.i < len(r.s) && (r.s[r.i] == ' ' || r.s[r.i] == '\t') {
+		r.i++
+	}
+}
+
+// done reports whether the rest of the line is empty or a comment.
+func (r *nquadReader) done() bool {
+	return r.i >= len(r.s) || r.s[r.i] == '#'
+}
+
+func (r *nquadReader) quad() (rdfQuad, error) {
+	var q rdfQuad
+	var err error
+	if q.s, err = r.term(); err != nil {
+		return q, err
+	}
+	if q.p, err = r.term(); err != nil {
+		return q, err
+	}
+	if q.o, err = r.term(); err != nil {
+		return q, err
+	}
+	if r.i < len(r.s) && r.s[r.i] != '.' {
+		if q.g, err = r.term(); err != nil {
+			return q, err
+		}
+	}
+	switch {
+	case q.s.kind == rdfLiteral, q.p.kind != rdfIRI, q.g.kind == rdfLiteral:
+		return q, fmt.Errorf("literal or blank node in a position that does not allow it")
+	}
+	if r.i >= len(r.s) || r.s[r.i] != '.' {
+		return q, fmt.Errorf("expected '.' at column %d", r.i+1)
+	}
+	r.i++
+	if r.skipSpace(); !r.done() {
+		return q, fmt.Errorf("unexpected %q after '.'", r.s[r.i:])
+	}
+	return q, nil
+}
+
+// term reads an IRI, blank node or literal and the space after it.
+func (r *nquadReader) term() (rdfTerm, error) {
+	if r.i >= len(r.s) {
+		return rdfTerm{}, fmt.Errorf("unexpected end of line")
+	}
+	var t rdfTerm
+	switch r.s[r.i] {
+	case '<':
+		iri, err := r.iri()
+		if err != nil {
+			return t, err
+		}
+		t = rdfTerm{kind: rdfIRI, value: iri}
+	case '_':
+		if !strings.HasPrefix(r.s[r.i:], "_:") {
+			return t, fmt.Errorf("invalid blank node at column %d", r.i+1)
+		}
+		start := r.i + 2
+		r.i = start
+		for r.i < len(r.s) && r.s[r.i] != ' ' && r.s[r.i] != '\t' {
+			r.i++
+		}
+		if r.s[r.i-1] == '.' && r.i-1 > start { // "_:b0." ends the statement
+			r.i--
+		}
+		if r.i == start {
+			return t, fmt.Errorf("empty blank node label at column %d", start+1)
+		}
+		t = rdfTerm{kind: rdfBlank, value: r.s[start:r.i]}
+	case '"':
+		value, err := r.literal()
+		if err != nil {
+			return t, err
+		}
+		t = rdfTerm{kind: rdfLiteral, value: value, datatype: xsdString}
+		switch {
+		case strings.HasPrefix(r.s[r.i:], "^^"):
+			r.i += 2
+			if r.i >= len(r.s) || r.s[r.i] != '<' {
+				return t, fmt.Errorf("expected a datatype IRI at column %d", r.i+1)
+			}
+			if t.datatype, err = r.iri(); err != nil {
+				return t, err
+			}
+		case r.i < len(r.s) && r.s[r.i] == '@':
+			start := r.i + 1
+			r.i = start
+			for r.i < len(r.s) && (isAlphaNum(r.s[r.i]) || r.s[r.i] == '-') {
+				r.i++
+			}
+			if r.i == start {
+				return t, fmt.Errorf("empty language tag at column %d", start)
+			}
+			t.datatype, t.language = rdfLangStr, r.s[start:r.i]
+		}
+	default:
+		return t, fmt.Errorf("unexpected %q at column %d", r.s[r.i], r.i+1)
+	}
+	r.skipSpace()
+	return t, nil
+}
+
+func (r *nquadReader) iri() (string, error) {
+	end := strings.IndexByte(r.s[r.i:], '>')
+	if end < 0 {
+		return "", fmt.Errorf("unterminated IRI at column %d", r.i+1)
+	}
+	iri, err := unescapeNQuads(r.s[r.i+1 : r.i+end])
+	if err != nil {
+		return "", err
+	}
+	if strings.ContainsAny(iri, " <>\"{}|^`") || !isAbsoluteIRI(iri) {
+		return "", fmt.Errorf("invalid IRI <%s>", iri)
+	}
+	r.i += end + 1
+	return iri, nil
+}
+
+func (r *nquadReader) literal() (string, error) {
+	start := r.i + 1
+	for i := start; i < len(r.s); i++ {
+		switch r.s[i] {
+		case '\\':
+			i++
+		case '"':
+			r.i = i + 1
+			return unescapeNQuads(r.s[start:i])
+		}
+	}
+	return "", fmt.Errorf("unterminated literal at column %d", start)
+}
+
+// unescapeNQuads decodes the ECHAR and UCHAR escapes of N-Quads.
+func unescapeNQuads(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i++; i >= len(s) {
+			return "", fmt.Errorf("dangling escape in %q", s)
+		}
+		switch c := s[i]; c {
+		case 't':
+			b.WriteByte('\t')
+		case 'b':
+			b.WriteByte('\b')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case '"', '\'', '\\':
+			b.WriteByte(c)
+		case 'u', 'U':
+			n := 4
+			if c == 'U' {
+				n = 8
+			}
+			if i+n >= len(s) {
+				return "", fmt.Errorf("short \\%c escape in %q", c, s)
+			}
+			code, err := strconv.ParseUint(s[i+1:i+1+n], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(code)) {
+				return "", fmt.Errorf("invalid \\%c escape in %q", c, s)
+			}
+			b.WriteRune(rune(code))
+			i += n
+		default:
+			return "", fmt.Errorf("invalid escape \\%c in %q", c, s)
+		}
+	}
+	return b.String(), nil
+}
+
+func isAlphaNum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// CanonicalizeNQuads returns the URDNA2015 canonical form of an RDF
+// dataset written as N-Quads. It is the form the W3C RDF Dataset
+// Canonicalization test suite checks.
+func CanonicalizeNQuads(data []byte) ([]byte, error) {
+	quads, err := parseNQuads(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("not valid N-Quads: %w", err)
+	}
+	return urdna2015(quads)
+}
+
+// CanonicalizeJSONLD returns the URDNA2015 canonical N-Quads of a JSON-LD
+// document, such as an RO-Crate. The document is converted to RDF as
+// described on jsonldToRDF, with remote contexts fetched by load, so the
+// output matches that of a JSON-LD processor run with JSONLDBase as its
+// base IRI. Blank nodes are relabelled _:c14n0, _:c14n1, ... so that
+// isomorphic graphs canonicalise to the same bytes regardless of node
+// order or blank node naming.
+func CanonicalizeJSONLD(data []byte, load ContextLoader) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("not valid JSON: %w", err)
+	}
+	quads, err := jsonldToRDF(doc, load)
+	if err != nil {
+		return nil, err
+	}
+	return urdna2015(quads)
+}
+
+// maxCanonicalizationWork bounds the work of the N-degree hashing step of
+// URDNA2015, counted in labellings tried. The step is exponential in the
+// number of blank nodes that cannot be told apart by their own quads, such
+// as a clique of blank nodes, so without a bound a small document could
+// stall every validator that checks its digest. Real structured logs,
+// whose blank nodes are few and distinct, need none of it.
+const maxCanonicalizationWork = 20000
+
+// ErrCanonicalizationTooComplex is returned when canonicalising a dataset
+// would exceed maxCanonicalizationWork.
+var ErrCanonicalizationTooComplex = errors.New("RDF dataset is too complex to canonicalise: too many indistinguishable blank nodes")
+
+// urdna2015 canonicalises an RDF dataset with the URDNA2015 algorithm and
+// returns its sorted N-Quads.
+func urdna2015(quads []rdfQuad) ([]byte, error) {
+	c := &canonicalizer{
+		quads:    quads,
+		byBlank:  map[string][]int{},
+		canon:    newIDIssuer("c14n"),
+		firstDeg: map[string]string{},
+		budget:   maxCanonicalizationWork,
+	}
+	for i, q := range quads {
+		for _, t := range []rdfTerm{q.s, q.o, q.g} {
+			if t.kind != rdfBlank {
+				continue
+			}
+			if qs := c.byBlank[t.value]; len(qs) == 0 || qs[len(qs)-1] != i {
+				c.byBlank[t.value] = append(qs, i)
+			}
+		}
+	}
+
+	hashToBlanks := map[string][]string{}
+	for _, id := range sortedKeys(c.byBlank) {
+		h := c.hashFirstDegree(id)
+		hashToBlanks[h] = append(hashToBlanks[h], id)
+	}
+	hashes := sortedKeys(hashToBlanks)
+	for _, h := range hashes {
+		if ids := hashToBlanks[h]; len(ids) == 1 {
+			c.canon.issue(ids[0])
+		}
+	}
+	for _, h := range hashes {
+		ids := hashToBlanks[h]
+		if len(ids) == 1 {
+			continue
+		}
+		var results []nDegreeResult
+		for _, id := range ids {
+			if c.canon.has(id) {
+				continue
+			}
+			tmp := newIDIssuer("b")
+			tmp.issue(id)
+			res, err := c.hashNDegree(id, tmp)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, res)
+		}
+		sort.SliceStable(results, func(i, j int) bool { return results[i].hash < results[j].hash })
+		for _, r := range results {
+			for _, id := range r.issuer.order {
+				c.canon.issue(id)
+			}
+		}
+	}
+
+	lines := make([]string, len(quads))
+	for i, q := range quads {
+		lines[i] = q.nquad(c.canon.get)
+	}
+	sort.Strings(lines)
+	return []byte(strings.Join(lines, "")), nil
+}
+
+// idIssuer hands out sequential blank node identifiers.
+type idIssuer struct {
+	prefix string
+	issued map[string]string
+	order  []string
+}
+
+func newIDIssuer(prefix string) *idIssuer {
+	return &idIssuer{prefix: prefix, issued: map[string]string{}}
+}
+
+func (is *idIssuer) issue(id string) string {
+	if v, ok := is.issued[id]; ok {
+		return v
+	}
+	v := is.prefix + strconv.Itoa(len(is.order))
+	is.issued[id] = v
+	is.order = append(is.order, id)
+	return v
+}
+
+func (is *idIssuer) has(id string) bool {
+	_, ok := is.issued[id]
+	return ok
+}
+
+func (is *idIssuer) get(id string) string {
+	return is.issued[id]
+}
+
+func (is *idIssuer) clone() *idIssuer {
+	c := &idIssuer{prefix: is.prefix, issued: make(map[string]string, len(is.issued))}
+	for k, v := range is.issued {
+		c.issued[k] = v
+	}
+	c.order = append([]string(nil), is.order...)
+	return c
+}
+
+// canonicalizer holds the URDNA2015 state for one dataset.
+type canonicalizer struct {
+	quads    []rdfQuad
+	byBlank  map[string][]int // blank node label -> indexes of quads mentioning it
+	canon    *idIssuer
+	firstDeg map[string]string
+	budget   int // labellings left to try in hashNDegree
+}
+
+type nDegreeResult struct {
+	hash   string
+	issuer *idIssuer
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// hashFirstDegree hashes the quads mentioning id, with id written as _:a
+// and every other blank node as _:z.
+func (c *canonicalizer) hashFirstDegree(id string) string {
+	if h, ok := c.firstDeg[id]; ok {
+		return h
+	}
+	label := func(b string) string {
+		if b == id {
+			return "a"
+		}
+		return "z"
+	}
+	var lines []string
+	for _, i := range c.byBlank[id] {
+		lines = append(lines, c.quads[i].nquad(label))
+	}
+	sort.Strings(lines)
+	h := sha256Hex(strings.Join(lines, ""))
+	c.firstDeg[id] = h
+	return h
+}
+
+// hashRelated hashes the blank node related as seen from quad q at
+// position "s", "o" or "g".
+func (c *canonicalizer) hashRelated(related string, q rdfQuad, issuer *idIssuer, position string) string {
+	var id string
+	switch {
+	case c.canon.has(related):
+		id = "_:" + c.canon.get(related)
+	case issuer.has(related):
+		id = "_:" + issuer.get(related)
+	default:
+		id = c.hashFirstDegree(related)
+	}
+	input := position
+	if position != "g" {
+		input += "<" + q.p.value + ">"
+	}
+	return sha256Hex(input + id)
+}
+
+// hashNDegree disambiguates id from blank nodes with the same first-degree
+// hash by exploring every labelling of the blank nodes around it.
+func (c *canonicalizer) hashNDegree(id string, issuer *idIssuer) (nDegreeResult, error) {
+	related := map[string][]string{}
+	for _, i := range c.byBlank[id] {
+		q := c.quads[i]
+		for _, comp := range []struct {
+			t   rdfTerm
+			pos string
+		}{{q.s, "s"}, {q.o, "o"}, {q.g, "g"}} {
+			if comp.t.kind == rdfBlank && comp.t.value != id {
+				h := c.hashRelated(comp.t.value, q, issuer, comp.pos)
+				related[h] = append(related[h], comp.t.value)
+			}
+		}
+	}
+
+	var data strings.Builder
+	for _, h := range sortedKeys(related) {
+		data.WriteString(h)
+		var chosenPath string
+		var chosenIssuer *idIssuer
+		perm := append([]string(nil), related[h]...)
+		sort.Strings(perm)
+		for ok := true; ok; ok = nextPermutation(perm) {
+			if c.budget--; c.budget < 0 {
+				return nDegreeResult{}, ErrCanonicalizationTooComplex
+			}
+			issuerCopy := issuer.clone()
+			path := ""
+			var recursion []string
+			worse := func() bool {
+				return chosenPath != "" && len(path) >= len(chosenPath) && path > chosenPath
+			}
+			skip := false
+			for _, r := range perm {
+				if c.canon.has(r) {
+					path += "_:" + c.canon.get(r)
+				} else {
+					if !issuerCopy.has(r) {
+						recursion = append(recursion, r)
+					}
+					path += "_:" + issuerCopy.issue(r)
+				}
+				if worse() {
+					skip = true
+					break
+				}
+			}
+			if skip {
+				continue
+			}
+			for _, r := range recursion {
+				res, err := c.hashNDegree(r, issuerCopy)
+				if err != nil {
+					return nDegreeResult{}, err
+				}
+				path += "_:" + issuerCopy.issue(r) + "<" + res.hash + ">"
+				issuerCopy = res.issuer
+				if worse() {
+					skip = true
+					break
+				}
+			}
+			if skip {
+				continue
+			}
+			if chosenPath == "" || path < chosenPath {
+				chosenPath, chosenIssuer = path, issuerCopy
+			}
+		}
+		data.WriteString(chosenPath)
+		issuer = chosenIssuer
+	}
+	return nDegreeResult{hash: sha256Hex(data.String()), issuer: issuer}, nil
+}
+
+// nextPermutation rearranges s into the next lexicographic permutation and
+// reports whether there was one.
+func nextPermutation(s []string) bool {
+	i := len(s) - 2
+	for i >= 0 && s[i] >= s[i+1] {
+		i--
+	}
+	if i < 0 {
+		return false
+	}
+	j := len(s) - 1
+	for s[j] <= s[i] {
+		j--
+	}
+	s[i], s[j] = s[j], s[i]
+	for l, r := i+1, len(s)-1; l < r; l, r = l+1, r-1 {
+		s[l], s[r] = s[r], s[l]
+	}
+	return true
+}
+
+// isIntegral reports whether f is a JSON-LD integer: no fractional part
+// and below 10^21 in magnitude.
+func isIntegral(f float64) bool {
+	return f == math.Trunc(f) && math.Abs(f) < 1e21
+}
@@ -0,0 +1,298 @@
+package logschema_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+func TestCanonicalizeJSON(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{
+			// RFC 8785, section 3.2.2.
+			"RFC 8785 example",
+			`{"numbers": [333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001], "string": "\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/", "literals": [null, true, false]}`,
+			`{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`,
+		},
+		{"UTF-16 key order", "{\"\ufb33\": 3, \"\U0001F600\": 2, \"\u20ac\": 1}", "{\"\u20ac\":1,\"\U0001F600\":2,\"\ufb33\":3}"},
+		{"numbers", `[-0, 1.0, 100, 1e21, 1e-7, 0.000001, -12.5e3]`, `[0,1,100,1e+21,1e-7,0.000001,-12500]`},
+		{"nested", "{\n  \"b\": {\"y\": [], \"x\": {}},\n  \"a\": \"\"\n}", `{"a":"","b":{"x":{},"y":[]}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := logschema.CanonicalizeJSON([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+
+	for _, bad := range []string{`{`, `{} {}`, `[1e400]`} {
+		if _, err := logschema.CanonicalizeJSON([]byte(bad)); err == nil {
+			t.Errorf("CanonicalizeJSON(%s) should fail", bad)
+		}
+	}
+}
+
+func TestCanonicalizeJSONLD(t *testing.T) {
+	t.Run("nested nodes and literals", func(t *testing.T) {
+		doc := `{"@context": {"@vocab": "http://ex.org/"}, "@id": "http://ex.org/a",
+			"p": {"q": "x\ty"}, "n": 5, "d": 1.5, "ok": true}`
+		got, err := logschema.CanonicalizeJSONLD([]byte(doc), nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := `<http://ex.org/a> <http://ex.org/d> "1.5E0"^^<http://www.w3.org/2001/XMLSchema#double> .
+<http://ex.org/a> <http://ex.org/n> "5"^^<http://www.w3.org/2001/XMLSchema#integer> .
+<http://ex.org/a> <http://ex.org/ok> "true"^^<http://www.w3.org/2001/XMLSchema#boolean> .
+<http://ex.org/a> <http://ex.org/p> _:c14n0 .
+_:c14n0 <http://ex.org/q> "x\ty" .
+`
+		if string(got) != want {
+			t.Errorf("got:\n%s\nwant:\n%s", got, want)
+		}
+	})
+
+	t.Run("blank node labels and order are irrelevant", func(t *testing.T) {
+		a := `{"@context": {"@vocab": "http://ex.org/"}, "@graph": [
+			{"@id": "_:x", "knows": {"@id": "_:y"}, "name": "n"},
+			{"@id": "_:y", "knows": {"@id": "_:x"}, "name": "n"}]}`
+		b := `{"@context": {"@vocab": "http://ex.org/"}, "@graph": [
+			{"@id": "_:second", "name": "n", "knows": {"@id": "_:first"}},
+			{"@id": "_:first", "knows": {"@id": "_:second"}, "name": "n"}]}`
+		ca, err := logschema.CanonicalizeJSONLD([]byte(a), nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		cb, err := logschema.CanonicalizeJSONLD([]byte(b), nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(ca) != string(cb) {
+			t.Errorf("isomorphic graphs differ:\n%s\n%s", ca, cb)
+		}
+		if !strings.Contains(string(ca), "_:c14n0 <http://ex.org/knows> _:c14n1 .") {
+			t.Errorf("blank nodes not relabelled:\n%s", ca)
+		}
+	})
+
+	t.Run("RO-Crate contexts are loaded like any other", func(t *testing.T) {
+		crate, err := variantCallingCrate().Build()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		content, err := crate.Marshal()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := logschema.CanonicalizeJSONLD([]byte(content), nil); err == nil {
+			t.Fatal("expected an error without a loader")
+		}
+		got, err := logschema.CanonicalizeJSONLD([]byte(content), roCrateContextLoader(t))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, want := range []string{
+			`<arcp://name,ro-crate/calls.vcf> <http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <http://schema.org/MediaObject> .`,
+			`<arcp://name,ro-crate/#run-run-001> <http://schema.org/result> <arcp://name,ro-crate/calls.vcf> .`,
+		} {
+			if !strings.Contains(string(got), want) {
+				t.Errorf("missing %s in:\n%s", want, got)
+			}
+		}
+	})
+
+	t.Run("standard expansion", func(t *testing.T) {
+		tests := []struct {
+			name, doc, want string
+		}{
+			{"undefined terms are dropped",
+				`{"@context": {"name": "http://ex.org/name"}, "@id": "http://ex.org/a", "name": "x", "other": "y"}`,
+				"<http://ex.org/a> <http://ex.org/name> \"x\" .\n"},
+			{"null terms are dropped despite @vocab",
+				`{"@context": {"@vocab": "http://ex.org/", "other": null}, "@id": "http://ex.org/a", "name": "x", "other": "y"}`,
+				"<http://ex.org/a> <http://ex.org/name> \"x\" .\n"},
+			{"prefixes defined by other terms",
+				`{"@context": {"n": "ex:name", "ex": "e:", "e": "http://ex.org/"}, "@id": "e:a", "n": "x"}`,
+				"<http://ex.org/a> <http://ex.org/name> \"x\" .\n"},
+			{"terms ending without a delimiter are not prefixes",
+				`{"@context": {"ex": "http://ex.org/x", "n": "http://ex.org/name"}, "@id": "ex:a", "n": "x"}`,
+				"<ex:a> <http://ex.org/name> \"x\" .\n"},
+			{"keyword aliases",
+				`{"@context": {"id": "@id", "type": "@type", "@vocab": "http://ex.org/"}, "id": "http://ex.org/a", "type": "T"}`,
+				"<http://ex.org/a> <http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <http://ex.org/T> .\n"},
+			{"relative IRIs without a base are dropped",
+				`{"@context": {"@base": null, "@vocab": "http://ex.org/"}, "@id": "a", "p": "x"}`,
+				""},
+			{"repeated statements are kept once",
+				`{"@context": {"@vocab": "http://ex.org/"}, "@graph": [{"@id": "http://ex.org/a", "p": "x"}, {"@id": "http://ex.org/a", "p": ["x", "x"]}]}`,
+				"<http://ex.org/a> <http://ex.org/p> \"x\" .\n"},
+			{"datatype coercion of booleans",
+				`{"@context": {"p": {"@id": "http://ex.org/p", "@type": "http://ex.org/dt"}}, "@id": "http://ex.org/a", "p": true}`,
+				"<http://ex.org/a> <http://ex.org/p> \"true\"^^<http://ex.org/dt> .\n"},
+		}
+		for _, tt := range tests {
+			got, err := logschema.CanonicalizeJSONLD([]byte(tt.doc), nil)
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.name, err)
+				continue
+			}
+			if string(got) != tt.want {
+				t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("remote contexts use the loader", func(t *testing.T) {
+		doc := `{"@context": "https://example.org/ctx", "@id": "http://ex.org/a", "name": "x"}`
+		if _, err := logschema.CanonicalizeJSONLD([]byte(doc), nil); err == nil {
+			t.Fatal("expected an error without a loader")
+		}
+		load := func(uri string) ([]byte, error) {
+			return []byte(`{"@context": {"ex": "http://ex.org/", "name": "ex:label"}}`), nil
+		}
+		got, err := logschema.CanonicalizeJSONLD([]byte(doc), load)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want := "<http://ex.org/a> <http://ex.org/label> \"x\" .\n"; string(got) != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	for name, doc := range map[string]string{
+		"no context":  `{"used": {}}`,
+		"@list":       `{"@context": {"@vocab": "http://ex.org/"}, "p": {"@list": [1]}}`,
+		"named graph": `{"@context": {"@vocab": "http://ex.org/"}, "@id": "http://ex.org/g", "@graph": []}`,
+		"cyclic term": `{"@context": {"a": "b:x", "b": "a:y"}, "a": 1}`,
+		"scoped":      `{"@context": {"p": {"@id": "http://ex.org/p", "@context": {}}}, "p": 1}`,
+	} {
+		if _, err := logschema.CanonicalizeJSONLD([]byte(doc), nil); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// roCrateContextLoader serves a cut-down RO-Crate 1.1 context, enough for
+// the crates built in these tests, from a schema directory.
+func roCrateContextLoader(t *testing.T) logschema.ContextLoader {
+	v := &logschema.Validator{SchemaDir: roCrateSchemaDir(t), Offline: true}
+	return func(uri string) ([]byte, error) {
+		return v.FetchRemoteSchema(&logschema.LogSchema{SchemaURI: uri})
+	}
+}
+
+func roCrateSchemaDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	ctxDir := filepath.Join(dir, "w3id.org", "ro", "crate", "1.1")
+	if err := os.MkdirAll(ctxDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	ctx := `{"@context": {"@vocab": "http://schema.org/", "File": "http://schema.org/MediaObject",
+		"conformsTo": "http://purl.org/dc/terms/conformsTo"}}`
+	if err := os.WriteFile(filepath.Join(ctxDir, "context.json"), []byte(ctx), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// The examples of the W3C RDF Dataset Canonicalization recommendation.
+func TestCanonicalizeNQuads(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"unique hashes",
+			`<http://example.com/#p> <http://example.com/#q> _:e0 .
+<http://example.com/#p> <http://example.com/#r> _:e1 .
+_:e0 <http://example.com/#s> <http://example.com/#u> .
+_:e1 <http://example.com/#t> <http://example.com/#u> .
+`,
+			`<http://example.com/#p> <http://example.com/#q> _:c14n0 .
+<http://example.com/#p> <http://example.com/#r> _:c14n1 .
+_:c14n0 <http://example.com/#s> <http://example.com/#u> .
+_:c14n1 <http://example.com/#t> <http://example.com/#u> .
+`},
+		{"shared hashes",
+			`<http://example.com/#p> <http://example.com/#q> _:e0 .
+<http://example.com/#p> <http://example.com/#q> _:e1 .
+_:e0 <http://example.com/#p> _:e2 .
+_:e1 <http://example.com/#p> _:e3 .
+_:e2 <http://example.com/#r> _:e3 .
+`,
+			`<http://example.com/#p> <http://example.com/#q> _:c14n2 .
+<http://example.com/#p> <http://example.com/#q> _:c14n3 .
+_:c14n0 <http://example.com/#r> _:c14n1 .
+_:c14n2 <http://example.com/#p> _:c14n1 .
+_:c14n3 <http://example.com/#p> _:c14n0 .
+`},
+		{"literals and graphs",
+			"_:x <http://ex.org/p> \"a\\u0062\\\"c\"@EN-gb <http://ex.org/g> .\n# comment\n\n_:x <http://ex.org/n> \"1\"^^<http://www.w3.org/2001/XMLSchema#integer>.\n",
+			"_:c14n0 <http://ex.org/n> \"1\"^^<http://www.w3.org/2001/XMLSchema#integer> .\n_:c14n0 <http://ex.org/p> \"ab\\\"c\"@EN-gb <http://ex.org/g> .\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := logschema.CanonicalizeNQuads([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+
+	for _, bad := range []string{
+		`<http://ex.org/a> <http://ex.org/p> .`,
+		`"s" <http://ex.org/p> <http://ex.org/o> .`,
+		`<http://ex.org/a> _:p <http://ex.org/o> .`,
+		`<relative> <http://ex.org/p> <http://ex.org/o> .`,
+		`<http://ex.org/a> <http://ex.org/p> "unterminated .`,
+		`<http://ex.org/a> <http://ex.org/p> <http://ex.org/o>`,
+	} {
+		if _, err := logschema.CanonicalizeNQuads([]byte(bad)); err == nil {
+			t.Errorf("CanonicalizeNQuads(%s) should fail", bad)
+		}
+	}
+}
+
+func TestCanonicalizeJSONLD_WorkBudget(t *testing.T) {
+	// Blank nodes that all know each other cannot be told apart by their
+	// own quads, so URDNA2015 would try every labelling of them.
+	clique := func(n int) []byte {
+		var nodes []string
+		for i := 0; i < n; i++ {
+			var refs []string
+			for j := 0; j < n; j++ {
+				if j != i {
+					refs = append(refs, fmt.Sprintf(`{"@id": "_:n%d"}`, j))
+				}
+			}
+			nodes = append(nodes, fmt.Sprintf(`{"@id": "_:n%d", "knows": [%s]}`, i, strings.Join(refs, ", ")))
+		}
+		return []byte(`{"@context": {"@vocab": "http://ex.org/"}, "@graph": [` + strings.Join(nodes, ", ") + `]}`)
+	}
+
+	if _, err := logschema.CanonicalizeJSONLD(clique(4), nil); err != nil {
+		t.Errorf("small clique: %v", err)
+	}
+	start := time.Now()
+	_, err := logschema.CanonicalizeJSONLD(clique(12), nil)
+	if !errors.Is(err, logschema.ErrCanonicalizationTooComplex) {
+		t.Errorf("large clique: got %v, want ErrCanonicalizationTooComplex", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("large clique took %v to fail", elapsed)
+	}
+}
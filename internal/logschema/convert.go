@@ -0,0 +1,619 @@
+package logschema
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Namespaces used when converting between RO-Crate and PROV. Crate-local
+// @ids ("#run", "reads.fastq") become qualified names under
+// ProvCratePrefix, and other properties become schema.org attributes.
+const (
+	ProvCratePrefix    = "crate"
+	ProvCrateNamespace = "arcp://name,ro-crate/"
+	provSchemaPrefix   = "schema"
+	schemaOrgNamespace = "http://schema.org/"
+	provAnyURI         = "xsd:anyURI"
+)
+
+// ErrUnsupportedConversion is returned when a structured log's format has
+// no RO-Crate/PROV mapping.
+var ErrUnsupportedConversion = errors.New("unsupported conversion")
+
+// ConversionLoss records information a conversion could not carry over.
+type ConversionLoss struct {
+	Location string `json:"location,omitempty"` // set by ConvertRun
+	ID       string `json:"id"`                 // record or relation affected
+	Property string `json:"property,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+func (l ConversionLoss) String() string {
+	s := l.ID
+	if l.Property != "" {
+		s += "." + l.Property
+	}
+	if l.Location != "" {
+		s = l.Location + ": " + s
+	}
+	return s + ": " + l.Reason
+}
+
+// crateActionProps are the action properties that become PROV relations.
+var crateActionProps = map[string]bool{"object": true, "result": true, "agent": true, "instrument": true}
+
+// isAction reports whether an entity is a schema.org Action.
+func isAction(e Entity) bool {
+	for _, t := range e.Types() {
+		if strings.HasSuffix(t, "Action") {
+			return true
+		}
+	}
+	return false
+}
+
+// CrateToProv maps a Workflow Run Crate to PROV: actions become
+// activities, their object/result/agent/instrument become used,
+// wasGeneratedBy and wasAssociatedWith (with instrument as plan), agents
+// become agents and every other entity becomes an entity. Remaining
+// properties are kept as schema.org attributes, with references encoded as
+// xsd:anyURI values so that ProvToCrate can restore them.
+func CrateToProv(c *Crate) (*ProvDocument, []ConversionLoss, error) {
+	doc := &ProvDocument{Prefix: map[string]string{
+		ProvCratePrefix:  ProvCrateNamespace,
+		provSchemaPrefix: schemaOrgNamespace,
+	}}
+	names := &provNames{doc: doc}
+	var losses []ConversionLoss
+
+	agents := map[string]bool{}
+	declared := map[string]bool{}
+	for _, e := range c.Graph {
+		declared[e.ID()] = true
+		if e.HasType("Person") || e.HasType("Organization") {
+			agents[e.ID()] = true
+		}
+		if isAction(e) {
+			for _, a := range e.Refs("agent") {
+				agents[a] = true
+			}
+		}
+	}
+
+	b := &ProvBuilder{doc: *doc}
+	for _, e := range c.Graph {
+		id := names.qname(e.ID())
+		attrs := ProvAttrs{}
+		var types []interface{}
+		for _, t := range e.Types() {
+			types = append(types, ProvQName(provSchemaPrefix+":"+t))
+		}
+		if len(types) == 1 {
+			attrs["prov:type"] = types[0]
+		} else if len(types) > 1 {
+			attrs["prov:type"] = types
+		}
+		action := isAction(e)
+		for _, prop := range sortedKeys(e) {
+			v := e[prop]
+			if prop == "@id" || prop == "@type" {
+				continue
+			}
+			if action && crateActionProps[prop] {
+				if n := len(asSlice(v)); n != len(e.Refs(prop)) {
+					losses = append(losses, ConversionLoss{ID: e.ID(), Property: prop, Reason: "non-reference values have no PROV equivalent"})
+				}
+				continue
+			}
+			value, ok := names.attrValue(v)
+			if !ok {
+				losses = append(losses, ConversionLoss{ID: e.ID(), Property: prop, Reason: "nested object has no PROV equivalent"})
+				continue
+			}
+			switch {
+			case action && (prop == "startTime" || prop == "endTime"):
+				attrs["prov:"+prop] = value
+			case prop == "name":
+				attrs["prov:label"] = value
+			case prop == "contentUrl":
+				attrs["prov:location"] = value
+			default:
+				attrs[provSchemaPrefix+":"+prop] = value
+			}
+		}
+		switch {
+		case action:
+			b.doc.Activity = b.record(b.doc.Activity, id, attrs)
+		case agents[e.ID()]:
+			b.doc.Agent = b.record(b.doc.Agent, id, attrs)
+		default:
+			b.doc.Entity = b.record(b.doc.Entity, id, attrs)
+		}
+	}
+
+	// References to entities outside the graph are declared as bare records
+	// so the document has no dangling relations.
+	target := func(crateID string, agent bool) string {
+		q := names.qname(crateID)
+		if !declared[crateID] {
+			declared[crateID] = true
+			if agent {
+				b.doc.Agent = b.record(b.doc.Agent, q, nil)
+			} else {
+				b.doc.Entity = b.record(b.doc.Entity, q, nil)
+			}
+		}
+		return q
+	}
+	for _, e := range c.Graph {
+		if !isAction(e) {
+			continue
+		}
+		act := names.qname(e.ID())
+		for _, o := range e.Refs("object") {
+			b.relation("used", ProvAttrs{"prov:activity": act, "prov:entity": target(o, false)}, "")
+		}
+		for _, r := range e.Refs("result") {
+			b.relation("wasGeneratedBy", ProvAttrs{"prov:entity": target(r, false), "prov:activity": act}, "")
+		}
+		plans := e.Refs("instrument")
+		for i, a := range e.Refs("agent") {
+			attrs := ProvAttrs{"prov:activity": act, "prov:agent": target(a, true)}
+			if i < len(plans) {
+				attrs["prov:plan"] = target(plans[i], false)
+			}
+			b.relation("wasAssociatedWith", attrs, "")
+		}
+		for i := len(e.Refs("agent")); i < len(plans); i++ {
+			b.relation("wasAssociatedWith", ProvAttrs{"prov:activity": act, "prov:plan": target(plans[i], false)}, "")
+		}
+	}
+
+	out, err := b.Build()
+	if err != nil {
+		return nil, losses, fmt.Errorf("converting RO-Crate to PROV: %w", err)
+	}
+	return out, losses, nil
+}
+
+// ProvToCrate is the inverse of CrateToProv. PROV documents that did not
+// come from a crate get a generated metadata descriptor and root dataset.
+// Relations other than used, wasGeneratedBy and wasAssociatedWith, relation
+// attributes such as prov:time, and attributes outside the schema.org
+// namespace are reported as losses.
+func ProvToCrate(d *ProvDocument) (*Crate, []ConversionLoss, error) {
+	names := &provNames{doc: d}
+	var losses []ConversionLoss
+	byID := map[string]Entity{}
+	var graph []Entity
+	var activities, parts []string
+
+	add := func(kind, qid string, attrs ProvAttrs) {
+		id := names.expand(qid)
+		if kind != "activity" && len(attrs) == 0 && !isLocalRef(id) {
+			return // an external reference, not an entity of the crate
+		}
+		e := Entity{"@id": id}
+		var types []interface{}
+		for _, t := range asSlice(attrs["prov:type"]) {
+			name := provString(t)
+			switch {
+			case strings.HasPrefix(name, provSchemaPrefix+":"):
+				types = append(types, strings.TrimPrefix(name, provSchemaPrefix+":"))
+			case name == "prov:Person":
+				types = append(types, "Person")
+			case name == "prov:Organization":
+				types = append(types, "Organization")
+			case name == "prov:SoftwareAgent":
+				types = append(types, "SoftwareApplication")
+			default:
+				losses = append(losses, ConversionLoss{ID: qid, Property: "prov:type", Reason: fmt.Sprintf("type %q has no RO-Crate equivalent", name)})
+			}
+		}
+		if len(types) == 0 {
+			switch {
+			case kind == "activity":
+				types = []interface{}{"CreateAction"}
+			case kind == "agent":
+				types = []interface{}{"Person"}
+			case attrs["prov:location"] != nil:
+				types = []interface{}{"File"}
+			default:
+				types = []interface{}{"CreativeWork"}
+			}
+		}
+		if len(types) == 1 {
+			e["@type"] = types[0]
+		} else {
+			e["@type"] = types
+		}
+		for _, k := range sortedKeys(attrs) {
+			v := names.crateValue(attrs[k])
+			switch {
+			case k == "prov:type":
+			case k == "prov:label":
+				e["name"] = v
+			case k == "prov:location":
+				e["contentUrl"] = v
+			case kind == "activity" && (k == "prov:startTime" || k == "prov:endTime"):
+				e[strings.TrimPrefix(k, "prov:")] = v
+			case strings.HasPrefix(k, provSchemaPrefix+":"):
+				e[strings.TrimPrefix(k, provSchemaPrefix+":")] = v
+			case strings.HasPrefix(k, "prov:") || !strings.Contains(k, ":"):
+				losses = append(losses, ConversionLoss{ID: qid, Property: k, Reason: "attribute has no RO-Crate equivalent"})
+			default:
+				local := k[strings.Index(k, ":")+1:]
+				e[local] = v
+				// The WES run vocabulary mirrors Workflow Run Crate properties.
+				if !isWESNamespace(d.Prefix[k[:strings.Index(k, ":")]]) {
+					losses = append(losses, ConversionLoss{ID: qid, Property: k, Reason: fmt.Sprintf("mapped to %q without its namespace", local)})
+				}
+			}
+		}
+		byID[id] = e
+		graph = append(graph, e)
+		if kind == "activity" {
+			activities = append(activities, id)
+		} else if kind == "entity" && e.HasType("File") && isLocalRef(id) {
+			parts = append(parts, id)
+		}
+	}
+	for _, id := range sortedKeys(d.Activity) {
+		add("activity", id, d.Activity[id])
+	}
+	for _, id := range sortedKeys(d.Agent) {
+		add("agent", id, d.Agent[id])
+	}
+	for _, id := range sortedKeys(d.Entity) {
+		add("entity", id, d.Entity[id])
+	}
+
+	mapped := map[string][]string{
+		"used":              {"prov:activity", "prov:entity"},
+		"wasGeneratedBy":    {"prov:entity", "prov:activity"},
+		"wasAssociatedWith": {"prov:activity", "prov:agent", "prov:plan"},
+	}
+	for _, rel := range provRelations {
+		records := d.relations(rel.name, false)
+		for _, rid := range relationIDs(records) {
+			attrs := records[rid]
+			args, ok := mapped[rel.name]
+			if !ok {
+				losses = append(losses, ConversionLoss{ID: rid, Property: rel.name, Reason: "relation has no Workflow Run Crate equivalent"})
+				continue
+			}
+			act := byID[names.expand(provString(attrs["prov:activity"]))]
+			if act == nil {
+				losses = append(losses, ConversionLoss{ID: rid, Property: rel.name, Reason: "relation has no activity"})
+				continue
+			}
+			for _, k := range sortedKeys(attrs) {
+				if !contains(args, k) {
+					losses = append(losses, ConversionLoss{ID: rid, Property: k, Reason: "relation attribute has no RO-Crate equivalent"})
+				}
+			}
+			link := func(prop, arg string) {
+				if q := provString(attrs[arg]); q != "" {
+					addRef(act, prop, names.expand(q))
+				}
+			}
+			switch rel.name {
+			case "used":
+				link("object", "prov:entity")
+			case "wasGeneratedBy":
+				link("result", "prov:entity")
+			case "wasAssociatedWith":
+				link("agent", "prov:agent")
+				link("instrument", "prov:plan")
+			}
+		}
+	}
+
+	var head []Entity
+	if byID[ROCrateMetadataID] == nil {
+		head = append(head, Entity{
+			"@id":        ROCrateMetadataID,
+			"@type":      "CreativeWork",
+			"conformsTo": ref(SchemaURIROCrate),
+			"about":      ref("./"),
+		})
+	}
+	if byID["./"] == nil {
+		root := Entity{"@id": "./", "@type": "Dataset", "name": "Converted PROV provenance",
+			"conformsTo": ref(ProfileProcessRunCrate)}
+		if len(activities) > 0 {
+			root["mentions"] = refs(activities)
+		}
+		if len(parts) > 0 {
+			root["hasPart"] = refs(parts)
+		}
+		head = append(head, root)
+	}
+
+	crate := &Crate{Context: ROCrateContext, Graph: append(head, graph...)}
+	if err := crate.CheckReferences(); err != nil {
+		return nil, losses, fmt.Errorf("converting PROV to RO-Crate: %w", err)
+	}
+	return crate, losses, nil
+}
+
+// ConvertStructuredLog converts structured log content between FormatROCrate
+// and FormatOPM and returns the rewritten content and LogSchema. When schema
+// is nil the source format is detected. Content already in the target
+// format is returned unchanged. Encoded content is decoded first, and
+// converted content is not re-encoded.
+func ConvertStructuredLog(content string, schema *LogSchema, to Format) (string, *LogSchema, []ConversionLoss, error) {
+	if isLogURI(content) {
+		return "", nil, nil, fmt.Errorf("%w: structured_log is a reference, not inline content", ErrUnsupportedConversion)
+	}
+	if schema != nil && schema.Format == to {
+		return content, schema, nil, nil
+	}
+	content, schema, err := DecodeStructuredLog(content, schema)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if schema == nil {
+		if d := DetectSchema([]byte(content)); d != nil {
+			schema = d.Schema
+		}
+	}
+	var from Format
+	if schema != nil {
+		from = schema.Format
+	}
+	switch {
+	case from == to:
+		return content, schema, nil, nil
+	case from == FormatROCrate && to == FormatOPM:
+		crate, err := ParseCrate(content)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		doc, losses, err := CrateToProv(crate)
+		if err != nil {
+			return "", nil, losses, err
+		}
+		out, err := doc.JSON()
+		return out, ProvLogSchema(), losses, err
+	case from == FormatOPM && to == FormatROCrate:
+		doc, err := ParseProv(content)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		crate, losses, err := ProvToCrate(doc)
+		if err != nil {
+			return "", nil, losses, err
+		}
+		out, err := crate.Marshal()
+		return out, ROCrateLogSchema(), losses, err
+	}
+	if from == "" {
+		from = "unknown"
+	}
+	return "", nil, nil, fmt.Errorf("%w: from %s to %s", ErrUnsupportedConversion, from, to)
+}
+
+// ConvertRun converts the run's, every task's and every attempt's
+// structured_log to the target format, rewriting log_schema declarations
+// so that inheritance still holds: levels whose schema now equals their
+// parent's drop it, and levels left unconverted (by-reference or custom
+// content) pin the schema they used to inherit.
+func ConvertRun(rl *RunLog, tasks []TaskLog, to Format) ([]ConversionLoss, error) {
+	var losses []ConversionLoss
+	level := func(location string, content *string, declared **LogSchema, digest **Digest, sigs *[]Signature, oldParent, newParent *LogSchema) (oldEff, newEff *LogSchema, err error) {
+		oldEff = *declared
+		if oldEff == nil {
+			oldEff = oldParent
+		}
+		newEff = oldEff
+		switch {
+		case *content == "":
+			if *declared == nil {
+				newEff = newParent
+			}
+		case !isLogURI(*content):
+			out, schema, ls, err := ConvertStructuredLog(*content, oldEff, to)
+			if errors.Is(err, ErrUnsupportedConversion) {
+				break
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", location, err)
+			}
+			for _, l := range ls {
+				l.Location = location
+				losses = append(losses, l)
+			}
+			*content, newEff = out, schema
+			*digest, *sigs = nil, nil // they covered the old content
+		}
+		if !sameSchema(newEff, oldEff) || !sameSchema(oldParent, newParent) {
+			*declared = newEff
+			if sameSchema(newEff, newParent) {
+				*declared = nil
+			}
+		}
+		return oldEff, newEff, nil
+	}
+
+	var oldRun, newRun *LogSchema
+	if rl != nil {
+		var err error
+		if oldRun, newRun, err = level("run", &rl.StructuredLog, &rl.LogSchema, &rl.StructuredLogDigest, &rl.StructuredLogSignatures, nil, nil); err != nil {
+			return losses, err
+		}
+	}
+	for i := range tasks {
+		tl := &tasks[i]
+		loc := taskLocation(tl, i)
+		oldTask, newTask, err := level(loc, &tl.StructuredLog, &tl.LogSchema, &tl.StructuredLogDigest, &tl.StructuredLogSignatures, oldRun, newRun)
+		if err != nil {
+			return losses, err
+		}
+		for j := range tl.Logs {
+			a := &tl.Logs[j]
+			if _, _, err := level(fmt.Sprintf("%s attempt %d", loc, j), &a.StructuredLog, &a.LogSchema, &a.StructuredLogDigest, &a.StructuredLogSignatures, oldTask, newTask); err != nil {
+				return losses, err
+			}
+		}
+	}
+	return losses, nil
+}
+
+// sameSchema reports whether two schemas are equal, treating nil as equal
+// only to nil.
+func sameSchema(a, b *LogSchema) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// provNames maps between crate @ids and PROV qualified names.
+type provNames struct {
+	doc *ProvDocument
+	n   int
+}
+
+// qname returns the qualified name for a crate @id, declaring a prefix for
+// the @id's namespace if needed.
+func (n *provNames) qname(id string) string {
+	if isLocalRef(id) {
+		return ProvCratePrefix + ":" + id
+	}
+	i := strings.LastIndexAny(strings.TrimRight(id, "/#"), "/#:")
+	ns, local := id[:i+1], id[i+1:]
+	for _, p := range sortedKeys(n.doc.Prefix) {
+		if n.doc.Prefix[p] == ns {
+			return p + ":" + local
+		}
+	}
+	for {
+		n.n++
+		p := fmt.Sprintf("ns%d", n.n)
+		if _, taken := n.doc.Prefix[p]; !taken {
+			n.doc.Prefix[p] = ns
+			return p + ":" + local
+		}
+	}
+}
+
+// expand returns the crate @id for a qualified name. Names in the crate
+// namespace become crate-local again, and names in a WES run namespace
+// become "#" fragments, matching CrateBuilder's @ids.
+func (n *provNames) expand(q string) string {
+	i := strings.Index(q, ":")
+	if i < 0 {
+		return q
+	}
+	ns, ok := n.doc.Prefix[q[:i]]
+	switch {
+	case !ok:
+		return q
+	case ns == ProvCrateNamespace:
+		return q[i+1:]
+	case isWESNamespace(ns):
+		return "#" + q[i+1:]
+	}
+	return ns + q[i+1:]
+}
+
+// isWESNamespace reports whether ns was produced by ProvRunNamespace.
+func isWESNamespace(ns string) bool {
+	return strings.HasPrefix(ns, "urn:ga4gh:wes:run")
+}
+
+// attrValue converts a crate property value to a PROV attribute value.
+// References become xsd:anyURI literals; other nested objects fail.
+func (n *provNames) attrValue(v interface{}) (interface{}, bool) {
+	switch t := v.(type) {
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, x := range t {
+			var ok bool
+			if out[i], ok = n.attrValue(x); !ok {
+				return nil, false
+			}
+		}
+		return out, true
+	case map[string]interface{}:
+		id, ok := t["@id"].(string)
+		if !ok || len(t) != 1 {
+			return nil, false
+		}
+		if isLocalRef(id) {
+			id = ProvCrateNamespace + id
+		}
+		return map[string]interface{}{"$": id, "type": provAnyURI}, true
+	}
+	return v, true
+}
+
+// crateValue is the inverse of attrValue.
+func (n *provNames) crateValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, x := range t {
+			out[i] = n.crateValue(x)
+		}
+		return out
+	case map[string]interface{}:
+		val, _ := t["$"].(string)
+		switch t["type"] {
+		case provAnyURI:
+			return ref(strings.TrimPrefix(val, ProvCrateNamespace))
+		case provQualifiedName:
+			return n.expand(val)
+		}
+		return val
+	}
+	return v
+}
+
+// provString returns a string or qualified-name attribute value.
+func provString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case map[string]interface{}:
+		s, _ := t["$"].(string)
+		return s
+	}
+	return ""
+}
+
+// relationIDs returns relation identifiers in creation order: shorter
+// blank-node counters sort before longer ones.
+func relationIDs(records map[string]ProvAttrs) []string {
+	ids := sortedKeys(records)
+	sort.SliceStable(ids, func(i, j int) bool { return len(ids[i]) < len(ids[j]) })
+	return ids
+}
+
+// addRef appends a reference to an entity property, keeping a single
+// reference as an object rather than an array.
+func addRef(e Entity, prop, id string) {
+	existing := asSlice(e[prop])
+	for _, x := range existing {
+		if m, ok := x.(map[string]interface{}); ok && m["@id"] == id {
+			return
+		}
+	}
+	if len(existing) == 0 {
+		e[prop] = ref(id)
+		return
+	}
+	e[prop] = append(append([]interface{}{}, existing...), ref(id))
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,339 @@
+package logschema_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+// randomCrate generates Workflow Run Crates within the subset that
+// CrateToProv maps without loss.
+type randomCrate struct{ *logschema.Crate }
+
+func (randomCrate) Generate(r *rand.Rand, size int) reflect.Value {
+	pick := func(ids []string) interface{} {
+		var out []interface{}
+		for _, id := range ids {
+			if r.Intn(3) == 0 {
+				out = append(out, map[string]interface{}{"@id": id})
+			}
+		}
+		switch len(out) {
+		case 0:
+			return nil
+		case 1:
+			return out[0]
+		}
+		return out
+	}
+	refList := func(ids []string) []interface{} {
+		out := make([]interface{}, len(ids))
+		for i, id := range ids {
+			out[i] = map[string]interface{}{"@id": id}
+		}
+		return out
+	}
+
+	var files, agents, tools, tasks []string
+	var graph []logschema.Entity
+	for i := 0; i < r.Intn(size%6+1)+1; i++ {
+		id := fmt.Sprintf("data/file-%d.txt", i)
+		if r.Intn(4) == 0 {
+			id = fmt.Sprintf("https://example.org/data/file-%d", i)
+		}
+		files = append(files, id)
+		graph = append(graph, logschema.Entity{"@id": id, "@type": "File", "contentSize": fmt.Sprint(r.Intn(1000))})
+	}
+	for i := 0; i < r.Intn(3); i++ {
+		id := fmt.Sprintf("https://orcid.org/0000-0000-0000-000%d", i)
+		agents = append(agents, id)
+		graph = append(graph, logschema.Entity{"@id": id, "@type": "Person", "name": fmt.Sprintf("Person %d", i)})
+	}
+	for i := 0; i < r.Intn(3); i++ {
+		id := fmt.Sprintf("#tool-%d", i)
+		tools = append(tools, id)
+		graph = append(graph, logschema.Entity{"@id": id, "@type": []interface{}{"SoftwareApplication", "SoftwareSourceCode"}, "name": "tool"})
+	}
+	for i := 0; i < r.Intn(size%5+1)+1; i++ {
+		id := logschema.TaskEntityID(fmt.Sprint(i))
+		tasks = append(tasks, id)
+		task := logschema.Entity{
+			"@id": id, "@type": "CreateAction", "name": fmt.Sprintf("task %d", i),
+			"startTime": fmt.Sprintf("2024-01-01T10:%02d:00Z", i), "exitCode": float64(r.Intn(3)),
+			"actionStatus": string(logschema.ActionCompleted),
+		}
+		for prop, ids := range map[string][]string{"object": files, "result": files, "agent": agents, "instrument": tools} {
+			if v := pick(ids); v != nil {
+				task[prop] = v
+			}
+		}
+		graph = append(graph, task)
+	}
+	root := logschema.Entity{"@id": "./", "@type": "Dataset", "name": "random run",
+		"conformsTo": map[string]interface{}{"@id": logschema.ProfileProcessRunCrate}, "mentions": refList(tasks)}
+	if parts := refList(files); len(parts) > 0 {
+		root["hasPart"] = parts
+	}
+	descriptor := logschema.Entity{"@id": logschema.ROCrateMetadataID, "@type": "CreativeWork",
+		"conformsTo": map[string]interface{}{"@id": logschema.SchemaURIROCrate}, "about": map[string]interface{}{"@id": "./"}}
+	crate := &logschema.Crate{Context: logschema.ROCrateContext, Graph: append([]logschema.Entity{descriptor, root}, graph...)}
+	return reflect.ValueOf(randomCrate{crate})
+}
+
+// normalizeCrate returns the crate's graph as sorted, JSON-decoded values.
+func normalizeCrate(t *testing.T, c *logschema.Crate) []interface{} {
+	t.Helper()
+	content, err := c.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := logschema.ParseCrate(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(parsed.Graph, func(i, j int) bool { return parsed.Graph[i].ID() < parsed.Graph[j].ID() })
+	out := make([]interface{}, len(parsed.Graph))
+	for i, e := range parsed.Graph {
+		out[i] = map[string]interface{}(e)
+	}
+	return out
+}
+
+func TestConvert_CrateRoundTrip(t *testing.T) {
+	property := func(rc randomCrate) bool {
+		doc, losses, err := logschema.CrateToProv(rc.Crate)
+		if err != nil || len(losses) > 0 {
+			t.Logf("CrateToProv: %v %v", err, losses)
+			return false
+		}
+		back, losses, err := logschema.ProvToCrate(doc)
+		if err != nil || len(losses) > 0 {
+			t.Logf("ProvToCrate: %v %v", err, losses)
+			return false
+		}
+		want, got := normalizeCrate(t, rc.Crate), normalizeCrate(t, back)
+		if !reflect.DeepEqual(want, got) {
+			w, _ := json.Marshal(want)
+			g, _ := json.Marshal(got)
+			t.Logf("round trip mismatch:\nwant %s\ngot  %s", w, g)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: 200}); err != nil {
+		t.Error(err)
+	}
+}
+
+// randomProv generates PROV documents within the subset that ProvToCrate
+// maps without loss.
+type randomProv struct{ *logschema.ProvDocument }
+
+func (randomProv) Generate(r *rand.Rand, size int) reflect.Value {
+	b := logschema.NewProvBuilder("ex", "https://example.org/")
+	var acts, ents, agents []string
+	for i := 0; i < r.Intn(size%5+1)+1; i++ {
+		id := fmt.Sprintf("ex:act-%d", i)
+		acts = append(acts, id)
+		b.Activity(id, "2024-01-01T10:00:00Z", "", logschema.ProvAttrs{"prov:label": id})
+	}
+	for i := 0; i < r.Intn(size%5+1); i++ {
+		id := fmt.Sprintf("ex:ent-%d", i)
+		ents = append(ents, id)
+		b.Entity(id, logschema.ProvAttrs{"prov:type": logschema.ProvQName("schema:File"), "schema:contentSize": "1"})
+	}
+	for i := 0; i < r.Intn(3); i++ {
+		id := fmt.Sprintf("ex:agent-%d", i)
+		agents = append(agents, id)
+		b.Agent(id, logschema.ProvAttrs{"prov:type": logschema.ProvQName("schema:Person")})
+	}
+	for _, a := range acts {
+		for _, e := range ents {
+			switch r.Intn(3) {
+			case 0:
+				b.Used(a, e, "")
+			case 1:
+				b.WasGeneratedBy(e, a, "")
+			}
+		}
+		for _, ag := range agents {
+			if r.Intn(2) == 0 {
+				b.WasAssociatedWith(a, ag, "")
+			}
+		}
+	}
+	doc, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+	return reflect.ValueOf(randomProv{doc})
+}
+
+// provFacts returns a document's records and relations with qualified
+// names expanded, so documents using different prefixes compare equal.
+func provFacts(d *logschema.ProvDocument) map[string]bool {
+	expand := func(v interface{}) string {
+		q, _ := v.(string)
+		i := strings.Index(q, ":")
+		if ns, ok := d.Prefix[q[:i]]; ok {
+			return ns + q[i+1:]
+		}
+		return q
+	}
+	facts := map[string]bool{}
+	for kind, records := range map[string]map[string]logschema.ProvAttrs{"entity": d.Entity, "activity": d.Activity, "agent": d.Agent} {
+		for id := range records {
+			facts[kind+" "+expand(id)] = true
+		}
+	}
+	for kind, records := range map[string]map[string]logschema.ProvAttrs{"used": d.Used, "wasGeneratedBy": d.WasGeneratedBy, "wasAssociatedWith": d.WasAssociatedWith} {
+		for _, attrs := range records {
+			var args []string
+			for _, k := range []string{"prov:activity", "prov:entity", "prov:agent", "prov:plan"} {
+				if attrs[k] != nil {
+					args = append(args, expand(attrs[k]))
+				}
+			}
+			facts[kind+"("+strings.Join(args, ", ")+")"] = true
+		}
+	}
+	return facts
+}
+
+func TestConvert_ProvRoundTrip(t *testing.T) {
+	property := func(rp randomProv) bool {
+		crate, losses, err := logschema.ProvToCrate(rp.ProvDocument)
+		if err != nil || len(losses) > 0 {
+			t.Logf("ProvToCrate: %v %v", err, losses)
+			return false
+		}
+		back, losses, err := logschema.CrateToProv(crate)
+		if err != nil || len(losses) > 0 {
+			t.Logf("CrateToProv: %v %v", err, losses)
+			return false
+		}
+		want, got := provFacts(rp.ProvDocument), provFacts(back)
+		// The generated descriptor and root dataset are the only additions.
+		want["entity "+logschema.ProvCrateNamespace+logschema.ROCrateMetadataID] = true
+		want["entity "+logschema.ProvCrateNamespace+"./"] = true
+		if !reflect.DeepEqual(want, got) {
+			t.Logf("round trip mismatch:\nwant %v\ngot  %v", want, got)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: 200}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProvToCrate_ReportsLosses(t *testing.T) {
+	rl := &logschema.RunLog{StartTime: "2024-01-01T10:00:00Z", EndTime: "2024-01-01T11:00:00Z"}
+	tasks := []logschema.TaskLog{
+		{ID: "a", StartTime: "2024-01-01T10:00:00Z", EndTime: "2024-01-01T10:30:00Z"},
+		{ID: "b", StartTime: "2024-01-01T10:30:00Z", EndTime: "2024-01-01T11:00:00Z"},
+	}
+	doc, err := logschema.ProvBuilderFromRun("r1", rl, tasks).
+		Prefix("ex", "https://example.org/").
+		Entity("ex:out", logschema.ProvAttrs{"ex:checksum": "abc"}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	crate, losses, err := logschema.ProvToCrate(doc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if crate.Get(logschema.TaskEntityID("a")) == nil || crate.Get(logschema.RunEntityID("r1")) == nil {
+		t.Errorf("WES run namespace should map to crate fragments: %v", crate.Graph)
+	}
+	if crate.Get(logschema.TaskEntityID("a"))["exitCode"] != 0 {
+		t.Errorf("wes:exitCode should map to exitCode: %v", crate.Get(logschema.TaskEntityID("a")))
+	}
+
+	reasons := map[string]bool{}
+	for _, l := range losses {
+		reasons[l.Property] = true
+	}
+	for _, want := range []string{"wasStartedBy", "wasInformedBy", "ex:checksum"} {
+		if !reasons[want] {
+			t.Errorf("expected loss for %s, got %v", want, losses)
+		}
+	}
+	if reasons["wes:exitCode"] {
+		t.Errorf("wes:exitCode should map without loss: %v", losses)
+	}
+}
+
+func TestConvertRun(t *testing.T) {
+	crate := func(id string) string {
+		return `{"@context": "https://w3id.org/ro/crate/1.1/context", "@graph": [
+			{"@id": "./", "@type": "Dataset"},
+			{"@id": "` + id + `", "@type": "CreateAction", "object": {"@id": "in.txt"}},
+			{"@id": "in.txt", "@type": "File"}]}`
+	}
+	rl := &logschema.RunLog{StructuredLog: crate("#run"), LogSchema: logschema.ROCrateLogSchema()}
+	tasks := []logschema.TaskLog{
+		{ID: "a", StructuredLog: crate("#task-a")},
+		{ID: "b", StructuredLog: "https://storage.example.com/b/crate.json"},
+		{ID: "c", StructuredLog: `{"event": "custom"}`, LogSchema: &logschema.LogSchema{SchemaURI: "https://example.com/events", Format: logschema.FormatCustom}},
+	}
+
+	losses, err := logschema.ConvertRun(rl, tasks, logschema.FormatOPM)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(losses) != 0 {
+		t.Errorf("unexpected losses: %v", losses)
+	}
+	if rl.LogSchema.Format != logschema.FormatOPM {
+		t.Errorf("run schema not rewritten: %+v", rl.LogSchema)
+	}
+	if tasks[0].LogSchema != nil {
+		t.Errorf("converted task should inherit the run schema, got %+v", tasks[0].LogSchema)
+	}
+	if tasks[1].LogSchema == nil || tasks[1].LogSchema.Format != logschema.FormatROCrate {
+		t.Errorf("by-reference task should pin its RO-Crate schema, got %+v", tasks[1].LogSchema)
+	}
+	if tasks[2].LogSchema.Format != logschema.FormatCustom {
+		t.Errorf("custom task schema changed: %+v", tasks[2].LogSchema)
+	}
+
+	res, err := (&logschema.Validator{}).ValidateRun(rl, tasks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Valid() {
+		t.Errorf("converted run does not validate: %+v", res)
+	}
+
+	t.Run("and back", func(t *testing.T) {
+		if _, err := logschema.ConvertRun(rl, tasks, logschema.FormatROCrate); err != nil {
+			t.Fatal(err)
+		}
+		if rl.LogSchema.Format != logschema.FormatROCrate || tasks[0].LogSchema != nil || tasks[1].LogSchema != nil {
+			t.Errorf("schemas not restored: run %+v, tasks %+v %+v", rl.LogSchema, tasks[0].LogSchema, tasks[1].LogSchema)
+		}
+		c, err := logschema.ParseCrate(tasks[0].StructuredLog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := c.Get(logschema.TaskEntityID("a")).Refs("object"); len(got) != 1 || got[0] != "in.txt" {
+			t.Errorf("task crate not restored: %v", c.Graph)
+		}
+	})
+}
+
+func TestConvertStructuredLog_Unsupported(t *testing.T) {
+	_, _, _, err := logschema.ConvertStructuredLog(`{"event": 1}`, &logschema.LogSchema{SchemaURI: "https://example.com/x", Format: logschema.FormatCustom}, logschema.FormatOPM)
+	if err == nil || !strings.Contains(err.Error(), "unsupported conversion") {
+		t.Errorf("expected unsupported conversion, got %v", err)
+	}
+}
@@ -0,0 +1,329 @@
+package logschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CromwellMetadata is the part of Cromwell's GET
+// /api/workflows/{version}/{id}/metadata response that ImportCromwell
+// reads. Fetch it with expandSubWorkflows=true to import subworkflow calls.
+type CromwellMetadata struct {
+	ID             string                    `json:"id"`
+	WorkflowName   string                    `json:"workflowName"`
+	Status         string                    `json:"status"`
+	Start          string                    `json:"start"`
+	End            string                    `json:"end"`
+	Calls          map[string][]CromwellCall `json:"calls"`
+	Inputs         map[string]interface{}    `json:"inputs"`
+	Outputs        map[string]interface{}    `json:"outputs"`
+	Labels         map[string]string         `json:"labels"`
+	Failures       []CromwellFailure         `json:"failures"`
+	SubmittedFiles struct {
+		WorkflowURL         string `json:"workflowUrl"`
+		WorkflowType        string `json:"workflowType"`
+		WorkflowTypeVersion string `json:"workflowTypeVersion"`
+	} `json:"submittedFiles"`
+}
+
+// CromwellCall is one attempt at one shard of a call.
+type CromwellCall struct {
+	ShardIndex        int                    `json:"shardIndex"`
+	Attempt           int                    `json:"attempt"`
+	ExecutionStatus   string                 `json:"executionStatus"`
+	ReturnCode        *int                   `json:"returnCode"`
+	Start             string                 `json:"start"`
+	End               string                 `json:"end"`
+	Stdout            string                 `json:"stdout"`
+	Stderr            string                 `json:"stderr"`
+	Backend           string                 `json:"backend"`
+	JobID             string                 `json:"jobId"`
+	CallRoot          string                 `json:"callRoot"`
+	Inputs            map[string]interface{} `json:"inputs"`
+	Outputs           map[string]interface{} `json:"outputs"`
+	RuntimeAttributes map[string]interface{} `json:"runtimeAttributes"`
+	Failures          []CromwellFailure      `json:"failures"`
+	CallCaching       *struct {
+		Hit                      bool   `json:"hit"`
+		Result                   string `json:"result"`
+		AllowResultReuse         bool   `json:"allowResultReuse"`
+		EffectiveCallCachingMode string `json:"effectiveCallCachingMode"`
+	} `json:"callCaching"`
+	SubWorkflowID       string            `json:"subWorkflowId"`
+	SubWorkflowMetadata *CromwellMetadata `json:"subWorkflowMetadata"`
+}
+
+// CromwellFailure is a Cromwell failure with its causes.
+type CromwellFailure struct {
+	Message  string            `json:"message"`
+	CausedBy []CromwellFailure `json:"causedBy"`
+}
+
+// cromwellStates maps Cromwell workflow statuses to WES run states.
+var cromwellStates = map[string]string{
+	"Submitted": "QUEUED",
+	"On Hold":   "QUEUED",
+	"Running":   "RUNNING",
+	"Aborting":  "CANCELING",
+	"Aborted":   "CANCELED",
+	"Failed":    "EXECUTOR_ERROR",
+	"Succeeded": "COMPLETE",
+}
+
+// ImportCromwell converts Cromwell workflow metadata into a WES run. Each
+// call shard becomes a TaskLog, identified by its fully qualified name and,
+// for scatters, ":<shard>", with one Log per attempt, so retries and
+// preemptions are kept. Backend, job ID, runtime attributes, failures and
+// call caching results of the last attempt are recorded in Metadata under
+// "cromwell.". Workflow failures become the error of the run's action in
+// the crate. The calls of expanded subworkflows are imported too, with the
+// subworkflow's ID and calling task in Metadata. Their IDs are prefixed
+// with the calling task's ID and "/", e.g. "main.sub:1/sub.task", so that
+// the calls of each shard of a scattered subworkflow stay apart. Only the
+// subworkflow run by a call's last attempt is imported; those of earlier,
+// failed or preempted attempts are skipped. The run-level structured_log
+// is a Workflow Run Crate, with the files that calls used and produced, in
+// format to: FormatROCrate or, converted, FormatOPM.
+func ImportCromwell(md *CromwellMetadata, to Format) (*Run, error) {
+	run := &Run{RunID: md.ID, State: cromwellStates[md.Status], Request: map[string]interface{}{}, Outputs: md.Outputs}
+	if run.State == "" {
+		run.State = "UNKNOWN"
+	}
+	for k, v := range map[string]string{
+		"workflow_type":         strings.ToUpper(md.SubmittedFiles.WorkflowType),
+		"workflow_type_version": md.SubmittedFiles.WorkflowTypeVersion,
+		"workflow_url":          md.SubmittedFiles.WorkflowURL,
+	} {
+		if v != "" {
+			run.Request[k] = v
+		}
+	}
+	if len(md.Inputs) > 0 {
+		run.Request["workflow_params"] = md.Inputs
+	}
+	if len(md.Labels) > 0 {
+		run.Request["tags"] = md.Labels
+	}
+	rl := &RunLog{Name: md.WorkflowName, StartTime: md.Start, EndTime: md.End}
+	if md.Status == "Failed" {
+		rl.ExitCode = 1
+	}
+	run.RunLog = rl
+
+	c := &cromwellImport{b: NewCrateBuilder(md.ID, md.WorkflowName), files: map[string]bool{}}
+	if md.SubmittedFiles.WorkflowURL != "" {
+		c.b.Workflow(md.SubmittedFiles.WorkflowURL, md.WorkflowName, md.SubmittedFiles.WorkflowType)
+	}
+	c.b.Times(md.Start, md.End).Error(cromwellMessages(md.Failures))
+	switch md.Status {
+	case "Failed", "Aborted":
+		c.b.Status(ActionFailed)
+	case "Succeeded":
+		c.b.Status(ActionCompleted)
+	}
+	inputs, outputs := c.fileIDs(md.Inputs), c.fileIDs(md.Outputs)
+	if err := c.calls(md, ""); err != nil {
+		return nil, fmt.Errorf("importing Cromwell workflow %s: %w", md.ID, err)
+	}
+	run.TaskLogs = c.tasks
+	ids := make([]string, 0, len(c.files))
+	for id := range c.files {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		switch {
+		case contains(inputs, id):
+			c.b.Input(CrateFile{ID: id})
+		case contains(outputs, id):
+			c.b.Output(CrateFile{ID: id})
+		default:
+			c.b.File(CrateFile{ID: id})
+		}
+	}
+
+	crate, err := c.b.Build()
+	if err != nil {
+		return nil, fmt.Errorf("importing Cromwell workflow %s: %w", md.ID, err)
+	}
+	if err := setImportedLog(rl, crate, to); err != nil {
+		return nil, fmt.Errorf("importing Cromwell workflow %s: %w", md.ID, err)
+	}
+	return run, nil
+}
+
+// cromwellImport accumulates the task logs and crate of an import.
+type cromwellImport struct {
+	b     *CrateBuilder
+	tasks []TaskLog
+	files map[string]bool
+}
+
+// calls imports the calls of md, recursing into expanded subworkflows.
+// parent is the task ID of the call that ran md, if it is a subworkflow.
+func (c *cromwellImport) calls(md *CromwellMetadata, parent string) error {
+	type shard struct {
+		name     string
+		index    int
+		attempts []CromwellCall
+	}
+	var shards []*shard
+	byKey := map[string]*shard{}
+	for name, attempts := range md.Calls {
+		for _, a := range attempts {
+			key := name + ":" + strconv.Itoa(a.ShardIndex)
+			s, ok := byKey[key]
+			if !ok {
+				s = &shard{name: name, index: a.ShardIndex}
+				byKey[key] = s
+				shards = append(shards, s)
+			}
+			s.attempts = append(s.attempts, a)
+		}
+	}
+	sort.Slice(shards, func(i, j int) bool {
+		a, b := shards[i], shards[j]
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		return a.index < b.index
+	})
+
+	for _, s := range shards {
+		sort.SliceStable(s.attempts, func(i, j int) bool { return s.attempts[i].Attempt < s.attempts[j].Attempt })
+		tl := TaskLog{ID: s.name, Name: s.name}
+		if s.index >= 0 {
+			tl.ID = fmt.Sprintf("%s:%d", s.name, s.index)
+			tl.Name = fmt.Sprintf("%s (shard %d)", s.name, s.index)
+		}
+		if parent != "" {
+			tl.ID = parent + "/" + tl.ID
+		}
+		for _, a := range s.attempts {
+			l := Log{StartTime: a.Start, EndTime: a.End, Stdout: a.Stdout, Stderr: a.Stderr}
+			if a.ReturnCode != nil {
+				l.ExitCode = *a.ReturnCode
+			}
+			tl.Logs = append(tl.Logs, l)
+		}
+		last := s.attempts[len(s.attempts)-1]
+		tl.StartTime, tl.EndTime = tl.Logs[0].StartTime, last.End
+		tl.Stdout, tl.Stderr = last.Stdout, last.Stderr
+		tl.ExitCode = tl.Logs[len(tl.Logs)-1].ExitCode
+		tl.Metadata = cromwellCallMetadata(last, len(s.attempts))
+		if parent != "" {
+			tl.Metadata["cromwell.subWorkflowId"] = md.ID
+			tl.Metadata["cromwell.parentCall"] = parent
+		}
+
+		ct := CrateTask{ID: tl.ID, Name: tl.Name, StartTime: tl.StartTime, EndTime: tl.EndTime, ExitCode: tl.ExitCode}
+		ct.Tool = s.name[strings.LastIndex(s.name, ".")+1:]
+		switch last.ExecutionStatus {
+		case "Done":
+			ct.Status = ActionCompleted
+		case "Failed", "Aborted":
+			ct.Status = ActionFailed
+		case "Running", "QueuedInCromwell", "Starting":
+			ct.Status = ActionActive
+		}
+		ct.Inputs, ct.Outputs = c.fileIDs(last.Inputs), c.fileIDs(last.Outputs)
+		if last.SubWorkflowMetadata != nil || last.SubWorkflowID != "" {
+			ct.Tool = ""
+		}
+		c.b.Task(ct)
+		c.tasks = append(c.tasks, tl)
+
+		if sub := last.SubWorkflowMetadata; sub != nil {
+			if err := c.calls(sub, tl.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// cromwellCallMetadata records what a TaskLog has no field for.
+func cromwellCallMetadata(a CromwellCall, attempts int) map[string]string {
+	m := map[string]string{"cromwell.executionStatus": a.ExecutionStatus}
+	set := func(k, v string) {
+		if v != "" {
+			m["cromwell."+k] = v
+		}
+	}
+	set("backend", a.Backend)
+	set("jobId", a.JobID)
+	set("callRoot", a.CallRoot)
+	set("failures", cromwellMessages(a.Failures))
+	if a.SubWorkflowMetadata != nil && a.SubWorkflowID == "" {
+		a.SubWorkflowID = a.SubWorkflowMetadata.ID
+	}
+	set("subWorkflowId", a.SubWorkflowID)
+	if attempts > 1 {
+		m["cromwell.attempts"] = strconv.Itoa(attempts)
+	}
+	if cc := a.CallCaching; cc != nil {
+		m["cromwell.callCaching.hit"] = strconv.FormatBool(cc.Hit)
+		m["cromwell.callCaching.allowResultReuse"] = strconv.FormatBool(cc.AllowResultReuse)
+		set("callCaching.result", cc.Result)
+		set("callCaching.effectiveCallCachingMode", cc.EffectiveCallCachingMode)
+	}
+	for k, v := range a.RuntimeAttributes {
+		switch v := v.(type) {
+		case string:
+			set("runtime."+k, v)
+		default:
+			b, _ := json.Marshal(v)
+			set("runtime."+k, string(b))
+		}
+	}
+	return m
+}
+
+// cromwellMessages flattens failures and their causes, one per line.
+func cromwellMessages(fs []CromwellFailure) string {
+	var lines []string
+	var walk func([]CromwellFailure)
+	walk = func(fs []CromwellFailure) {
+		for _, f := range fs {
+			if f.Message != "" {
+				lines = append(lines, f.Message)
+			}
+			walk(f.CausedBy)
+		}
+	}
+	walk(fs)
+	return strings.Join(lines, "\n")
+}
+
+// fileIDs returns the distinct file paths and URIs among the values of a
+// Cromwell inputs or outputs map, sorted, and remembers them so that each
+// is added to the crate once.
+func (c *cromwellImport) fileIDs(values map[string]interface{}) []string {
+	var out []string
+	var walk func(interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case string:
+			if (strings.HasPrefix(v, "/") || strings.Contains(v, "://")) && !contains(out, v) {
+				out = append(out, v)
+				c.files[v] = true
+			}
+		case []interface{}:
+			for _, e := range v {
+				walk(e)
+			}
+		case map[string]interface{}:
+			for _, e := range v {
+				walk(e)
+			}
+		}
+	}
+	for _, v := range values {
+		walk(v)
+	}
+	sort.Strings(out)
+	return out
+}
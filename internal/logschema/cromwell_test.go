@@ -0,0 +1,140 @@
+package logschema_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+func loadCromwell(t *testing.T) *logschema.CromwellMetadata {
+	t.Helper()
+	return loadCromwellFile(t, "cromwell/metadata.json")
+}
+
+func loadCromwellFile(t *testing.T, name string) *logschema.CromwellMetadata {
+	t.Helper()
+	var md logschema.CromwellMetadata
+	if err := json.Unmarshal(readTestdata(t, name), &md); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return &md
+}
+
+func TestImportCromwell(t *testing.T) {
+	run, err := logschema.ImportCromwell(loadCromwell(t), logschema.FormatROCrate)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkImportedRun(t, run)
+	if run.RunID != "2d9a6f0e-6c1b-4b7e-9f3a-5c8e2b1d4a77" || run.State != "COMPLETE" || run.Request["workflow_type"] != "WDL" {
+		t.Errorf("run: %s %s %v", run.RunID, run.State, run.Request)
+	}
+
+	tasks := map[string]*logschema.TaskLog{}
+	var ids []string
+	for i := range run.TaskLogs {
+		tasks[run.TaskLogs[i].ID] = &run.TaskLogs[i]
+		ids = append(ids, run.TaskLogs[i].ID)
+	}
+	if got := strings.Join(ids, ","); got != "germline.align:0,germline.align:1,germline.call_variants,germline.call_variants/call_variants.haplotype_caller,germline.index_reference" {
+		t.Errorf("task IDs = %s", got)
+	}
+
+	retried := tasks["germline.align:1"]
+	if len(retried.Logs) != 2 || retried.StartTime != "2024-05-01T10:00:05.000Z" || retried.EndTime != "2024-05-01T10:18:40.000Z" {
+		t.Errorf("retried shard: %+v", retried)
+	}
+	if retried.Metadata["cromwell.attempts"] != "2" || retried.Metadata["cromwell.failures"] != "" || retried.Metadata["cromwell.runtime.docker"] != "biocontainers/bwa:0.7.17" {
+		t.Errorf("retried shard metadata: %v", retried.Metadata)
+	}
+	if cached := tasks["germline.index_reference"]; cached.Metadata["cromwell.callCaching.hit"] != "true" ||
+		!strings.HasPrefix(cached.Metadata["cromwell.callCaching.result"], "Cache Hit: 6f1c2e55") {
+		t.Errorf("call caching metadata: %v", cached.Metadata)
+	}
+	if sub := tasks["germline.call_variants/call_variants.haplotype_caller"]; sub.Metadata["cromwell.subWorkflowId"] != "8b7c1d2e-3f4a-4b5c-9d6e-7f8a9b0c1d2e" ||
+		sub.Metadata["cromwell.parentCall"] != "germline.call_variants" {
+		t.Errorf("subworkflow call metadata: %v", sub.Metadata)
+	}
+	if call := tasks["germline.call_variants"]; call.Metadata["cromwell.subWorkflowId"] != "8b7c1d2e-3f4a-4b5c-9d6e-7f8a9b0c1d2e" {
+		t.Errorf("subworkflow metadata: %v", call.Metadata)
+	}
+
+	crate, err := logschema.ParseCrate(run.RunLog.StructuredLog)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if wf := crate.Get("https://example.org/workflows/germline.wdl"); wf == nil || wf.Refs("programmingLanguage")[0] != "https://w3id.org/workflowhub/workflow-ro-crate#wdl" {
+		t.Errorf("workflow entity: %v", wf)
+	}
+	runAction := crate.Get(logschema.RunEntityID(run.RunID))
+	if got := strings.Join(runAction.Refs("object"), ","); got != "gs://cohort-7/s1.fq.gz,gs://cohort-7/s2.fq.gz,gs://refs/hg38.fa" {
+		t.Errorf("run objects = %s", got)
+	}
+	if got := strings.Join(runAction.Refs("result"), ","); got != "gs://cohort-7/out/cohort.vcf.gz" {
+		t.Errorf("run results = %s", got)
+	}
+	align := crate.Get(logschema.TaskEntityID("germline.align:1"))
+	if got := strings.Join(align.Refs("result"), ","); got != "gs://cromwell/germline/2d9a/call-align/shard-1/attempt-2/s2.bam" {
+		t.Errorf("align results = %s", got)
+	}
+
+	md := loadCromwell(t)
+	md.Status = "Failed"
+	md.Failures = []logschema.CromwellFailure{{Message: "Workflow failed", CausedBy: []logschema.CromwellFailure{{Message: "Job germline.align:1:2 exited with return code 1"}}}}
+	failed := md.Calls["germline.align"][2]
+	rc := 1
+	failed.ExecutionStatus, failed.ReturnCode = "Failed", &rc
+	md.Calls["germline.align"][2] = failed
+	run, err = logschema.ImportCromwell(md, logschema.FormatROCrate)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkImportedRun(t, run)
+	if run.State != "EXECUTOR_ERROR" || run.RunLog.ExitCode != 1 || run.RunLog.Stderr != "" {
+		t.Errorf("failed run: %s %+v", run.State, run.RunLog)
+	}
+	if crate, err = logschema.ParseCrate(run.RunLog.StructuredLog); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := crate.Get(logschema.RunEntityID(run.RunID)).String("error"); got != "Workflow failed\nJob germline.align:1:2 exited with return code 1" {
+		t.Errorf("run error = %q", got)
+	}
+	if run, err = logschema.ImportCromwell(md, logschema.FormatOPM); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkImportedRun(t, run)
+	if run.RunLog.LogSchema.Format != logschema.FormatOPM {
+		t.Errorf("failed run schema: %+v", run.RunLog.LogSchema)
+	}
+}
+
+func TestImportCromwell_ScatteredSubworkflow(t *testing.T) {
+	run, err := logschema.ImportCromwell(loadCromwellFile(t, "cromwell/scattered_subworkflow.json"), logschema.FormatROCrate)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkImportedRun(t, run)
+
+	var ids []string
+	for _, tl := range run.TaskLogs {
+		ids = append(ids, tl.ID)
+	}
+	if got := strings.Join(ids, ","); got != "cohort.per_sample:0,cohort.per_sample:0/per_sample.qc,cohort.per_sample:1,cohort.per_sample:1/per_sample.qc" {
+		t.Errorf("task IDs = %s", got)
+	}
+	qc := run.TaskLogs[3]
+	if qc.Name != "per_sample.qc" || qc.Metadata["cromwell.parentCall"] != "cohort.per_sample:1" ||
+		qc.Metadata["cromwell.subWorkflowId"] != "b2b2b2b2-0000-4000-8000-000000000000" {
+		t.Errorf("second shard's call: %+v", qc)
+	}
+
+	crate, err := logschema.ParseCrate(run.RunLog.StructuredLog)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a := crate.Get(logschema.TaskEntityID("cohort.per_sample:1/per_sample.qc")); a == nil || strings.Join(a.Refs("result"), ",") != "gs://cohort-8/out/b.qc.txt" {
+		t.Errorf("second shard's call in the crate: %v", a)
+	}
+}
@@ -0,0 +1,451 @@
+package logschema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// prov:type values that CWLProv gives workflow and step runs.
+const (
+	cwlprovWorkflowRun = "wfprov:WorkflowRun"
+	cwlprovProcessRun  = "wfprov:ProcessRun"
+)
+
+// cwlprovHasProvenance is the annotation motivation that links a run to
+// its provenance files in a research object manifest.
+const cwlprovHasProvenance = "http://www.w3.org/ns/prov#has_provenance"
+
+// cwlprovTimeLayouts are the formats of CWLProv timestamps. cwltool writes
+// local times without a time zone.
+var cwlprovTimeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999"}
+
+// cwlprovManifest is the part of a research object's metadata/manifest.json
+// that ImportCWLProv reads.
+type cwlprovManifest struct {
+	CreatedBy struct {
+		Name string `json:"name"`
+	} `json:"createdBy"`
+	Aggregates []struct {
+		URI        string      `json:"uri"`
+		ConformsTo interface{} `json:"conformsTo"`
+	} `json:"aggregates"`
+	Annotations []struct {
+		About       string      `json:"about"`
+		Content     interface{} `json:"content"`
+		MotivatedBy struct {
+			ID string `json:"@id"`
+		} `json:"oa:motivatedBy"`
+	} `json:"annotations"`
+}
+
+// ImportCWLProv converts a CWLProv research object, the directory written
+// by cwltool --provenance, into a WES run. The run's PROV-JSON graph
+// becomes the run-level structured_log, in format FormatOPM, and each step
+// run (a wfprov:ProcessRun started, through wasStartedBy, by the workflow
+// run or by a nested workflow run under it) becomes a TaskLog whose
+// structured_log is the slice of the graph about that step: the step
+// activity, what it used and generated, who ran it to which plan, and how
+// it was started and ended. Steps of nested workflows record the activity
+// that started them as "cwlprov.parent" metadata. Task logs inherit the
+// run's log_schema. Timestamps without a time zone are read as UTC.
+func ImportCWLProv(dir string) (*Run, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "metadata", "manifest.json"))
+	if err != nil {
+		return nil, fmt.Errorf("importing CWLProv research object: %w", err)
+	}
+	var m cwlprovManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("importing CWLProv research object: decoding manifest: %w", err)
+	}
+	about, provPath := m.provenance()
+	if provPath == ".." || strings.HasPrefix(provPath, "../") || path.IsAbs(provPath) {
+		return nil, fmt.Errorf("importing CWLProv research object: provenance file %q is outside the metadata directory", provPath)
+	}
+	if data, err = os.ReadFile(filepath.Join(dir, "metadata", filepath.FromSlash(provPath))); err != nil {
+		return nil, fmt.Errorf("importing CWLProv research object: %w", err)
+	}
+	content, err := normalizeProvJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("importing CWLProv %s: %w", provPath, err)
+	}
+	doc, err := ParseProv(content)
+	if err != nil {
+		return nil, fmt.Errorf("importing CWLProv %s: %w", provPath, err)
+	}
+
+	wf, err := cwlprovWorkflowActivity(doc, about)
+	if err != nil {
+		return nil, fmt.Errorf("importing CWLProv %s: %w", provPath, err)
+	}
+	starts, ends, starters := map[string]string{}, map[string]string{}, map[string]string{}
+	for _, r := range doc.WasStartedBy {
+		a, _ := r["prov:activity"].(string)
+		starts[a], _ = r["prov:time"].(string)
+		starters[a], _ = r["prov:starter"].(string)
+	}
+	for _, r := range doc.WasEndedBy {
+		a, _ := r["prov:activity"].(string)
+		ends[a], _ = r["prov:time"].(string)
+	}
+	times := func(activity string) (start, end string, err error) {
+		if start, err = cwlprovTime(starts[activity], doc.Activity[activity]["prov:startTime"]); err != nil {
+			return "", "", err
+		}
+		end, err = cwlprovTime(ends[activity], doc.Activity[activity]["prov:endTime"])
+		return start, end, err
+	}
+
+	runID := cwlprovLocal(wf)
+	run := &Run{RunID: runID, State: "UNKNOWN", Request: map[string]interface{}{"workflow_type": "CWL"}}
+	label, _ := doc.Activity[wf]["prov:label"].(string)
+	rl := &RunLog{Name: label, StructuredLog: content, LogSchema: ProvLogSchema()}
+	if rl.StartTime, rl.EndTime, err = times(wf); err != nil {
+		return nil, fmt.Errorf("importing CWLProv run %s: %w", runID, err)
+	}
+	if rl.EndTime != "" {
+		run.State = "COMPLETE"
+	}
+	run.RunLog = rl
+	if err := m.request(dir, run); err != nil {
+		return nil, fmt.Errorf("importing CWLProv run %s: %w", runID, err)
+	}
+
+	for _, id := range cwlprovStarted(doc, starters, wf) {
+		attrs := doc.Activity[id]
+		if !contains(provTypes(attrs), cwlprovProcessRun) {
+			continue
+		}
+		tl := TaskLog{ID: cwlprovLocal(id), Metadata: map[string]string{}}
+		if starters[id] != wf {
+			tl.Metadata["cwlprov.parent"] = cwlprovLocal(starters[id])
+		}
+		if tl.StartTime, tl.EndTime, err = times(id); err != nil {
+			return nil, fmt.Errorf("importing CWLProv step %s: %w", id, err)
+		}
+		if label, ok := attrs["prov:label"].(string); ok {
+			tl.Metadata["cwlprov.label"] = label
+			tl.Name = strings.TrimPrefix(label, "Run of ")
+		}
+		for _, r := range doc.WasAssociatedWith {
+			if r["prov:activity"] != id {
+				continue
+			}
+			if plan, ok := r["prov:plan"].(string); ok {
+				tl.Metadata["cwlprov.plan"] = plan
+				tl.Name = plan[strings.Index(plan, ":")+1:]
+			}
+			if agent, ok := r["prov:agent"].(string); ok {
+				tl.Metadata["cwlprov.agent"] = agent
+			}
+		}
+		if tl.StructuredLog, err = provSlice(doc, id).JSON(); err != nil {
+			return nil, fmt.Errorf("importing CWLProv step %s: %w", id, err)
+		}
+		run.TaskLogs = append(run.TaskLogs, tl)
+	}
+	sort.Slice(run.TaskLogs, func(i, j int) bool {
+		a, b := run.TaskLogs[i], run.TaskLogs[j]
+		if a.StartTime != b.StartTime {
+			return a.StartTime < b.StartTime
+		}
+		return a.ID < b.ID
+	})
+	return run, nil
+}
+
+// cwlprovStarted returns the activities that root started, directly or
+// through the activities it started, such as nested workflow runs, in
+// breadth-first order.
+func cwlprovStarted(doc *ProvDocument, starters map[string]string, root string) []string {
+	children := map[string][]string{}
+	for id := range doc.Activity {
+		if s, ok := starters[id]; ok {
+			children[s] = append(children[s], id)
+		}
+	}
+	seen := map[string]bool{root: true}
+	var out []string
+	for queue := []string{root}; len(queue) > 0; queue = queue[1:] {
+		next := children[queue[0]]
+		sort.Strings(next)
+		for _, id := range next {
+			if !seen[id] {
+				seen[id] = true
+				out = append(out, id)
+				queue = append(queue, id)
+			}
+		}
+	}
+	return out
+}
+
+// provenance returns the run a manifest's provenance annotation is about
+// and the path of its PROV-JSON file, relative to the metadata directory.
+func (m *cwlprovManifest) provenance() (about, file string) {
+	file = "provenance/primary.cwlprov.json"
+	for _, a := range m.Annotations {
+		if a.MotivatedBy.ID != cwlprovHasProvenance {
+			continue
+		}
+		var contents []string
+		switch c := a.Content.(type) {
+		case string:
+			contents = []string{c}
+		case []interface{}:
+			for _, v := range c {
+				if s, ok := v.(string); ok {
+					contents = append(contents, s)
+				}
+			}
+		}
+		for _, c := range contents {
+			if strings.HasSuffix(c, ".cwlprov.json") {
+				return a.About, path.Clean(c)
+			}
+		}
+	}
+	return "", file
+}
+
+// request fills in the workflow, its parameters and its outputs from the
+// research object's workflow directory, where present.
+func (m *cwlprovManifest) request(dir string, run *Run) error {
+	for _, a := range m.Aggregates {
+		if path.Base(a.URI) != "packed.cwl" {
+			continue
+		}
+		run.Request["workflow_url"] = path.Clean(path.Join("metadata", a.URI))
+		if s, ok := a.ConformsTo.(string); ok {
+			if v := path.Base(strings.TrimSuffix(s, "/")); strings.HasPrefix(v, "v") {
+				run.Request["workflow_type_version"] = v
+			}
+		}
+	}
+	if m.CreatedBy.Name != "" {
+		name, version, _ := strings.Cut(m.CreatedBy.Name, " ")
+		run.Request["workflow_engine"] = name
+		if version != "" {
+			run.Request["workflow_engine_version"] = version
+		}
+	}
+	for file, set := range map[string]func(map[string]interface{}){
+		"primary-job.json":    func(v map[string]interface{}) { run.Request["workflow_params"] = v },
+		"primary-output.json": func(v map[string]interface{}) { run.Outputs = v },
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, "workflow", file))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var v map[string]interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return fmt.Errorf("decoding %s: %w", file, err)
+		}
+		set(v)
+	}
+	return nil
+}
+
+// cwlprovWorkflowActivity finds the workflow run a provenance graph
+// describes: the wfprov:WorkflowRun the manifest says it is about or,
+// failing that, the one that no other activity started.
+func cwlprovWorkflowActivity(doc *ProvDocument, about string) (string, error) {
+	var runs []string
+	for id, attrs := range doc.Activity {
+		if !contains(provTypes(attrs), cwlprovWorkflowRun) {
+			continue
+		}
+		if about != "" && cwlprovExpand(doc, id) == about {
+			return id, nil
+		}
+		runs = append(runs, id)
+	}
+	sort.Strings(runs)
+	for _, id := range runs {
+		nested := false
+		for _, r := range doc.WasStartedBy {
+			if starter, _ := r["prov:starter"].(string); r["prov:activity"] == id && doc.Activity[starter] != nil {
+				nested = true
+			}
+		}
+		if !nested {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("no %s activity found", cwlprovWorkflowRun)
+}
+
+// provSlice returns the part of d about one activity: the relations it
+// takes part in and the entities, activities and agents they reference.
+func provSlice(d *ProvDocument, activity string) *ProvDocument {
+	s := &ProvDocument{Prefix: d.Prefix}
+	refs := map[string]bool{activity: true}
+	for _, rel := range provRelations {
+		for rid, attrs := range d.relations(rel.name, false) {
+			involved := false
+			for _, arg := range rel.args {
+				if attrs[arg] == activity {
+					involved = true
+				}
+			}
+			if !involved {
+				continue
+			}
+			s.relations(rel.name, true)[rid] = attrs
+			for _, arg := range rel.args {
+				if ref, ok := attrs[arg].(string); ok && arg != "prov:time" {
+					refs[ref] = true
+				}
+			}
+		}
+	}
+	for _, kind := range []struct {
+		from map[string]ProvAttrs
+		to   *map[string]ProvAttrs
+	}{{d.Entity, &s.Entity}, {d.Activity, &s.Activity}, {d.Agent, &s.Agent}} {
+		for id, attrs := range kind.from {
+			if !refs[id] {
+				continue
+			}
+			if *kind.to == nil {
+				*kind.to = map[string]ProvAttrs{}
+			}
+			(*kind.to)[id] = attrs
+		}
+	}
+	return s
+}
+
+// normalizeProvJSON rewrites the records that PROV-JSON writers such as
+// the Python prov library emit as arrays, when one identifier has several
+// records, as single records: the attributes of repeated entities,
+// activities and agents are merged, and repeated relations are given
+// distinct identifiers. Other keys, such as relations this package does not
+// model, are kept as they are.
+func normalizeProvJSON(data []byte) (string, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return "", fmt.Errorf("not a PROV-JSON document: %w", err)
+	}
+	for key, raw := range doc {
+		if key == "prefix" || key == "bundle" {
+			continue
+		}
+		var records map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &records); err != nil {
+			continue
+		}
+		changed := false
+		for _, id := range sortedKeys(records) {
+			var list []ProvAttrs
+			if json.Unmarshal(records[id], &list) != nil {
+				continue
+			}
+			changed = true
+			delete(records, id)
+			switch key {
+			case "entity", "activity", "agent":
+				merged := ProvAttrs{}
+				for _, attrs := range list {
+					for k, v := range attrs {
+						if _, ok := merged[k]; !ok {
+							merged[k] = v
+						}
+					}
+				}
+				records[id], _ = json.Marshal(merged)
+			default:
+				n := 1
+				for i, attrs := range list {
+					rid := id
+					for i > 0 && (rid == id || records[rid] != nil) {
+						n++
+						rid = fmt.Sprintf("%s.%d", id, n)
+					}
+					records[rid], _ = json.Marshal(attrs)
+				}
+			}
+		}
+		if changed {
+			doc[key], _ = json.Marshal(records)
+		}
+	}
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// provTypes returns the prov:type values of a record, which PROV-JSON may
+// give as a string, a typed value or a list of either.
+func provTypes(attrs ProvAttrs) []string {
+	var out []string
+	var add func(interface{})
+	add = func(v interface{}) {
+		switch v := v.(type) {
+		case string:
+			out = append(out, v)
+		case map[string]interface{}:
+			if s, ok := v["$"].(string); ok {
+				out = append(out, s)
+			}
+		case []interface{}:
+			for _, e := range v {
+				add(e)
+			}
+		}
+	}
+	add(attrs["prov:type"])
+	return out
+}
+
+// cwlprovExpand expands a qualified name with the document's prefixes.
+func cwlprovExpand(d *ProvDocument, qname string) string {
+	prefix, local, ok := strings.Cut(qname, ":")
+	if ns, declared := d.Prefix[prefix]; ok && declared {
+		return ns + local
+	}
+	return qname
+}
+
+// cwlprovLocal returns the local part of a CWLProv identifier such as
+// "id:5e4d3c2b-…", the UUID that cwltool gives each run.
+func cwlprovLocal(qname string) string {
+	if _, local, ok := strings.Cut(qname, ":"); ok {
+		return local
+	}
+	return qname
+}
+
+// cwlprovTime converts the time of a wasStartedBy or wasEndedBy relation,
+// or else the activity's own prov:startTime or prov:endTime, to RFC 3339.
+func cwlprovTime(rel string, attr interface{}) (string, error) {
+	s := rel
+	if s == "" {
+		switch v := attr.(type) {
+		case string:
+			s = v
+		case map[string]interface{}:
+			s, _ = v["$"].(string)
+		}
+	}
+	if s == "" {
+		return "", nil
+	}
+	for _, layout := range cwlprovTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t.Format(time.RFC3339Nano), nil
+		}
+	}
+	return "", fmt.Errorf("unrecognised timestamp %q", s)
+}
@@ -0,0 +1,152 @@
+package logschema_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+func TestImportCWLProv(t *testing.T) {
+	run, err := logschema.ImportCWLProv("testdata/cwlprov/revsort")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkImportedRun(t, run)
+	if run.RunID != "a8b9c0d1-e2f3-4a5b-8c6d-7e8f9a0b1c2d" || run.State != "COMPLETE" {
+		t.Errorf("run: %s %s", run.RunID, run.State)
+	}
+	if run.Request["workflow_type"] != "CWL" || run.Request["workflow_type_version"] != "v1.0" ||
+		run.Request["workflow_url"] != "workflow/packed.cwl" || run.Request["workflow_engine"] != "cwltool" {
+		t.Errorf("request: %v", run.Request)
+	}
+	if _, ok := run.Outputs["output"]; !ok {
+		t.Errorf("outputs: %v", run.Outputs)
+	}
+	rl := run.RunLog
+	if rl.LogSchema.Format != logschema.FormatOPM || rl.StartTime != "2024-05-01T10:00:00.105312Z" || rl.EndTime != "2024-05-01T10:00:09.860101Z" {
+		t.Errorf("run log: %+v", rl)
+	}
+	doc, err := logschema.ParseProv(rl.StructuredLog)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := doc.Check(); err != nil {
+		t.Errorf("run graph: %v", err)
+	}
+	if doc.Entity["data:b9214658cc453331b62c2282b772a5c063dbd284"]["prov:label"] != "whale.txt" {
+		t.Errorf("repeated entity not merged: %v", doc.Entity["data:b9214658cc453331b62c2282b772a5c063dbd284"])
+	}
+	if len(doc.WasEndedBy) != 3 {
+		t.Errorf("repeated relations not split: %v", doc.WasEndedBy)
+	}
+	if !strings.Contains(rl.StructuredLog, `"specializationOf"`) {
+		t.Error("relations outside the PROV model were dropped")
+	}
+
+	if len(run.TaskLogs) != 2 {
+		t.Fatalf("got %d task logs, want 2", len(run.TaskLogs))
+	}
+	for i, want := range []struct{ id, name, start, end, used, generated string }{
+		{"0f9e8d7c-6b5a-4f3e-9d2c-1b0a9f8e7d6c", "main/rev", "2024-05-01T10:00:00.512004Z", "2024-05-01T10:00:03.220918Z",
+			"id:b1e4c7a0-2d3f-4b6e-9a8c-7d5e3f1a2b4c", "id:c2f5d8b1-3e4a-4c7f-8b9d-8e6f4a2b3c5d"},
+		{"5e4d3c2b-1a0f-4e9d-8c7b-6a5f4e3d2c1b", "main/sorted", "2024-05-01T10:00:03.301445Z", "2024-05-01T10:00:06.004213Z",
+			"id:c2f5d8b1-3e4a-4c7f-8b9d-8e6f4a2b3c5d", "id:d3a6e9c2-4f5b-4d8a-9cae-9f7a5b3c4d6e"},
+	} {
+		tl := run.TaskLogs[i]
+		if tl.ID != want.id || tl.Name != want.name || tl.StartTime != want.start || tl.EndTime != want.end {
+			t.Errorf("task %d: %+v", i, tl)
+		}
+		if tl.LogSchema != nil || tl.Metadata["cwlprov.plan"] != "wf:"+want.name {
+			t.Errorf("task %d: schema %v, metadata %v", i, tl.LogSchema, tl.Metadata)
+		}
+		step, err := logschema.ParseProv(tl.StructuredLog)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := step.Check(); err != nil {
+			t.Errorf("task %d slice: %v", i, err)
+		}
+		if len(step.Used) != 1 || len(step.WasGeneratedBy) != 1 || step.Entity[want.used] == nil || step.Entity[want.generated] == nil {
+			t.Errorf("task %d slice: %s", i, tl.StructuredLog)
+		}
+		if step.Entity["wf:"+want.name] == nil || len(step.Activity) != 2 || len(step.Agent) != 1 {
+			t.Errorf("task %d slice is missing its plan, workflow run or engine: %s", i, tl.StructuredLog)
+		}
+	}
+
+	dir := t.TempDir()
+	if _, err := logschema.ImportCWLProv(dir); err == nil {
+		t.Error("ImportCWLProv succeeded without a manifest")
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "metadata", "provenance"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"manifest.json":                   `{"id": "/"}`,
+		"provenance/primary.cwlprov.json": `{"prefix": {}, "activity": {"id:x": {"prov:type": "wfprov:ProcessRun"}}}`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, "metadata", name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := logschema.ImportCWLProv(dir); err == nil || !strings.Contains(err.Error(), "WorkflowRun") {
+		t.Errorf("ImportCWLProv without a workflow run: %v", err)
+	}
+}
+
+func TestImportCWLProv_Nested(t *testing.T) {
+	write := func(t *testing.T, dir string, files map[string]string) {
+		t.Helper()
+		for name, content := range files {
+			p := filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	dir := t.TempDir()
+	write(t, dir, map[string]string{
+		"metadata/manifest.json": `{"id": "/"}`,
+		"metadata/provenance/primary.cwlprov.json": `{"prefix": {"id": "urn:uuid:"},
+			"activity": {
+				"id:main": {"prov:type": "wfprov:WorkflowRun"},
+				"id:align": {"prov:type": "wfprov:ProcessRun", "prov:label": "Run of workflow/packed.cwl#main/align"},
+				"id:sub": {"prov:type": "wfprov:WorkflowRun"},
+				"id:inner": {"prov:type": "wfprov:ProcessRun", "prov:label": "Run of workflow/packed.cwl#qc/fastqc"}},
+			"wasStartedBy": {
+				"_:s1": {"prov:activity": "id:align", "prov:starter": "id:main", "prov:time": "2024-05-01T10:00:01"},
+				"_:s2": {"prov:activity": "id:sub", "prov:starter": "id:main", "prov:time": "2024-05-01T10:00:02"},
+				"_:s3": {"prov:activity": "id:inner", "prov:starter": "id:sub", "prov:time": "2024-05-01T10:00:03"}}}`,
+	})
+	run, err := logschema.ImportCWLProv(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if run.RunID != "main" || len(run.TaskLogs) != 2 {
+		t.Fatalf("run %s with task logs %+v", run.RunID, run.TaskLogs)
+	}
+	if tl := run.TaskLogs[0]; tl.ID != "align" || tl.Metadata["cwlprov.parent"] != "" {
+		t.Errorf("top-level step: %+v", tl)
+	}
+	if tl := run.TaskLogs[1]; tl.ID != "inner" || tl.Name != "workflow/packed.cwl#qc/fastqc" || tl.Metadata["cwlprov.parent"] != "sub" {
+		t.Errorf("nested step: %+v", tl)
+	}
+
+	escape := t.TempDir()
+	write(t, escape, map[string]string{
+		"metadata/manifest.json": `{"annotations": [{"about": "urn:uuid:x",
+			"oa:motivatedBy": {"@id": "http://www.w3.org/ns/prov#has_provenance"},
+			"content": "../../outside.cwlprov.json"}]}`,
+		"outside.cwlprov.json": `{"activity": {"id:x": {"prov:type": "wfprov:WorkflowRun"}}}`,
+	})
+	if _, err := logschema.ImportCWLProv(escape); err == nil || !strings.Contains(err.Error(), "outside the metadata directory") {
+		t.Errorf("provenance path escaping metadata/: %v", err)
+	}
+}
@@ -0,0 +1,236 @@
+package logschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SchemaURIOTLP identifies OpenTelemetry protocol (OTLP/JSON) payloads.
+const SchemaURIOTLP = "https://opentelemetry.io/docs/specs/otlp/"
+
+// Detection is a candidate LogSchema for a structured log.
+type Detection struct {
+	Schema     *LogSchema  `json:"log_schema"`
+	Kind       ContentKind `json:"kind"`
+	Confidence float64     `json:"confidence"` // in [0, 1]
+	Reason     string      `json:"reason"`
+}
+
+// provJSONKeys are the top-level keys of a PROV-JSON document.
+var provJSONKeys = []string{"entity", "activity", "agent", "wasGeneratedBy", "used",
+	"wasAssociatedWith", "wasDerivedFrom", "wasAttributedTo", "actedOnBehalfOf",
+	"wasInformedBy", "wasStartedBy", "wasEndedBy"}
+
+var roCrateVersion = regexp.MustCompile(`w3id\.org/ro/crate/(\d+\.\d+)`)
+
+// Detect inspects content and proposes LogSchemas that describe it, most
+// likely first. It returns nil when content does not look structured.
+// It recognises RO-Crate context URLs, PROV-JSON and PROV-N, OTLP resource
+// blocks, JSON Schema "$schema" keys, other JSON-LD, and NDJSON.
+func Detect(content []byte) []Detection {
+	trimmed := strings.TrimSpace(string(content))
+	if trimmed == "" {
+		return nil
+	}
+
+	var out []Detection
+	add := func(kind ContentKind, confidence float64, reason string, schema LogSchema) {
+		out = append(out, Detection{Schema: &schema, Kind: kind, Confidence: confidence, Reason: reason})
+	}
+
+	if strings.HasPrefix(trimmed, "document") && strings.HasSuffix(trimmed, "endDocument") {
+		add(ContentPROV, 0.9, "PROV-N document/endDocument block",
+			LogSchema{SchemaURI: SchemaURIPROV, Format: FormatOPM, MediaType: mediaTypePROVN})
+		return out
+	}
+
+	if (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid([]byte(trimmed)) {
+		var doc map[string]json.RawMessage
+		if json.Unmarshal([]byte(trimmed), &doc) != nil {
+			add(ContentJSON, 0.2, "JSON array with no schema hints",
+				LogSchema{Format: FormatCustom, MediaType: "application/json"})
+			return out
+		}
+		detectJSONObject(doc, add)
+		sort.SliceStable(out, func(i, j int) bool { return out[i].Confidence > out[j].Confidence })
+		return out
+	}
+
+	lines := strings.Split(trimmed, "\n")
+	if len(lines) < 2 {
+		return nil
+	}
+	otlp := true
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		var rec map[string]json.RawMessage
+		if line[0] != '{' || json.Unmarshal([]byte(line), &rec) != nil {
+			return nil
+		}
+		if !hasAny(rec, "resourceLogs", "resourceSpans", "resourceMetrics") {
+			otlp = false
+		}
+	}
+	if otlp {
+		add(ContentNDJSON, 0.85, "NDJSON of OTLP resource blocks",
+			LogSchema{SchemaURI: SchemaURIOTLP, Format: FormatCustom, MediaType: "application/x-ndjson"})
+	}
+	add(ContentNDJSON, 0.6, "every line is a JSON object",
+		LogSchema{Format: FormatCustom, MediaType: "application/x-ndjson"})
+	return out
+}
+
+// detectJSONObject adds candidates for a single JSON object.
+func detectJSONObject(doc map[string]json.RawMessage, add func(ContentKind, float64, string, LogSchema)) {
+	if ctx, ok := doc["@context"]; ok {
+		if m := roCrateVersion.FindStringSubmatch(string(ctx)); m != nil {
+			confidence := 0.8
+			if _, ok := doc["@graph"]; ok {
+				confidence = 0.95
+			}
+			add(ContentJSONLD, confidence, "@context references the RO-Crate "+m[1]+" context",
+				LogSchema{SchemaURI: "https://w3id.org/ro/crate/" + m[1], Format: FormatROCrate, MediaType: "application/ld+json", SchemaVersion: m[1]})
+		} else {
+			var uri string
+			json.Unmarshal(ctx, &uri)
+			confidence := 0.5
+			if isHTTPURI(uri) {
+				confidence = 0.6
+			}
+			add(ContentJSONLD, confidence, "JSON-LD document with a non-RO-Crate @context",
+				LogSchema{SchemaURI: uri, Format: FormatCustom, MediaType: "application/ld+json"})
+			if _, ok := doc["@graph"]; ok {
+				add(ContentJSONLD, 0.3, "JSON-LD @graph without an RO-Crate context",
+					LogSchema{SchemaURI: SchemaURIROCrate, Format: FormatROCrate, MediaType: "application/ld+json"})
+			}
+		}
+	}
+
+	var provKeys []string
+	for _, k := range provJSONKeys {
+		if _, ok := doc[k]; ok {
+			provKeys = append(provKeys, k)
+		}
+	}
+	if len(provKeys) > 0 {
+		confidence := 0.6 + 0.05*float64(len(provKeys))
+		reason := "PROV-JSON keys: " + strings.Join(provKeys, ", ")
+		if prefix, ok := doc["prefix"]; ok {
+			confidence += 0.15
+			reason += "; prefix block"
+			if strings.Contains(string(prefix), "www.w3.org/ns/prov") {
+				confidence += 0.05
+			}
+		}
+		if confidence > 0.95 {
+			confidence = 0.95
+		}
+		add(ContentPROV, confidence, reason,
+			LogSchema{SchemaURI: SchemaURIPROV, Format: FormatOPM, MediaType: "application/json"})
+	}
+
+	if otlpKeys := presentKeys(doc, "resourceLogs", "resourceSpans", "resourceMetrics"); len(otlpKeys) > 0 {
+		add(ContentJSON, 0.9, "OTLP resource blocks: "+strings.Join(otlpKeys, ", "),
+			LogSchema{SchemaURI: SchemaURIOTLP, Format: FormatCustom, MediaType: "application/json"})
+	}
+
+	if raw, ok := doc["$schema"]; ok {
+		var uri string
+		json.Unmarshal(raw, &uri)
+		confidence := 0.5
+		if isHTTPURI(uri) {
+			confidence = 0.85
+		}
+		add(ContentJSON, confidence, fmt.Sprintf("$schema key %q", uri),
+			LogSchema{SchemaURI: uri, Format: FormatJSONSchema, MediaType: "application/json"})
+	}
+
+	add(ContentJSON, 0.2, "JSON object with no schema hints",
+		LogSchema{Format: FormatCustom, MediaType: "application/json"})
+}
+
+// DetectSchema returns the most likely Detection for content, or nil.
+func DetectSchema(content []byte) *Detection {
+	ds := Detect(content)
+	if len(ds) == 0 {
+		return nil
+	}
+	return &ds[0]
+}
+
+func hasAny(doc map[string]json.RawMessage, keys ...string) bool {
+	return len(presentKeys(doc, keys...)) > 0
+}
+
+func presentKeys(doc map[string]json.RawMessage, keys ...string) []string {
+	var out []string
+	for _, k := range keys {
+		if _, ok := doc[k]; ok {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// SchemaFix records a log_schema filled in by FixSchemas.
+type SchemaFix struct {
+	Location  string    `json:"location"`
+	Detection Detection `json:"detection"`
+}
+
+// FixSchemas fills in missing log_schema declarations from detection. A
+// structured_log gets an explicit log_schema when it has none to inherit,
+// or when its inherited schema has a different format than the one
+// detected. Only detections with a schema_uri and at least minConfidence
+// are applied. It returns the fixes made and the locations that still
+// lack a schema.
+func FixSchemas(rl *RunLog, tasks []TaskLog, minConfidence float64) (fixes []SchemaFix, unresolved []string) {
+	try := func(location, content string, declared, inherited *LogSchema) *LogSchema {
+		if content == "" || declared != nil || isLogURI(content) {
+			return nil
+		}
+		d := DetectSchema([]byte(content))
+		usable := d != nil && d.Confidence >= minConfidence && d.Schema.SchemaURI != ""
+		if inherited != nil && (!usable || d.Schema.Format == inherited.Format) {
+			return nil
+		}
+		if !usable {
+			unresolved = append(unresolved, location)
+			return nil
+		}
+		fixes = append(fixes, SchemaFix{Location: location, Detection: *d})
+		return d.Schema
+	}
+
+	var parent *LogSchema
+	if rl != nil {
+		if s := try("run", rl.StructuredLog, rl.LogSchema, nil); s != nil {
+			rl.LogSchema = s
+		}
+		parent = rl.LogSchema
+	}
+	for i := range tasks {
+		tl := &tasks[i]
+		loc := taskLocation(tl, i)
+		if s := try(loc, tl.StructuredLog, tl.LogSchema, parent); s != nil {
+			tl.LogSchema = s
+		}
+		taskSchema := tl.LogSchema
+		if taskSchema == nil {
+			taskSchema = parent
+		}
+		for j := range tl.Logs {
+			a := &tl.Logs[j]
+			if s := try(fmt.Sprintf("%s attempt %d", loc, j), a.StructuredLog, a.LogSchema, taskSchema); s != nil {
+				a.LogSchema = s
+			}
+		}
+	}
+	return fixes, unresolved
+}
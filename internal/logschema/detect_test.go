@@ -0,0 +1,132 @@
+package logschema_test
+
+import (
+	"testing"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		wantFormat    logschema.Format
+		wantURI       string
+		minConfidence float64
+	}{
+		{"RO-Crate 1.1 with graph", `{"@context": "https://w3id.org/ro/crate/1.1/context", "@graph": []}`,
+			logschema.FormatROCrate, "https://w3id.org/ro/crate/1.1", 0.9},
+		{"RO-Crate 1.2 context array", `{"@context": ["https://w3id.org/ro/crate/1.2/context", {"x": "y"}]}`,
+			logschema.FormatROCrate, "https://w3id.org/ro/crate/1.2", 0.7},
+		{"PROV-JSON with prefix", `{"prefix": {"prov": "http://www.w3.org/ns/prov#"}, "entity": {}, "activity": {}}`,
+			logschema.FormatOPM, logschema.SchemaURIPROV, 0.85},
+		{"PROV-N", "document\nprefix ex <http://example.org/>\nentity(ex:a)\nendDocument\n",
+			logschema.FormatOPM, logschema.SchemaURIPROV, 0.85},
+		{"OTLP logs", `{"resourceLogs": [{"resource": {"attributes": []}, "scopeLogs": []}]}`,
+			logschema.FormatCustom, logschema.SchemaURIOTLP, 0.85},
+		{"OTLP NDJSON", "{\"resourceSpans\": []}\n{\"resourceSpans\": []}\n",
+			logschema.FormatCustom, logschema.SchemaURIOTLP, 0.8},
+		{"JSON Schema", `{"$schema": "https://example.com/events.schema.json", "events": []}`,
+			logschema.FormatJSONSchema, "https://example.com/events.schema.json", 0.8},
+		{"plain NDJSON", "{\"a\": 1}\n{\"a\": 2}", logschema.FormatCustom, "", 0.5},
+		{"plain JSON", `{"a": 1}`, logschema.FormatCustom, "", 0.1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := logschema.DetectSchema([]byte(tt.content))
+			if d == nil {
+				t.Fatal("nothing detected")
+			}
+			if d.Schema.Format != tt.wantFormat || d.Schema.SchemaURI != tt.wantURI {
+				t.Errorf("detected %q %q, want %q %q", d.Schema.Format, d.Schema.SchemaURI, tt.wantFormat, tt.wantURI)
+			}
+			if d.Confidence < tt.minConfidence || d.Confidence > 1 {
+				t.Errorf("confidence %.2f, want >= %.2f", d.Confidence, tt.minConfidence)
+			}
+		})
+	}
+
+	if ds := logschema.Detect([]byte("just some text\n")); ds != nil {
+		t.Errorf("plain text detected as %+v", ds)
+	}
+}
+
+// TestFixSchemas_ValidatesWhatItApplies checks that every schema the
+// detector can propose for fix mode is one the validator accepts.
+func TestFixSchemas_ValidatesWhatItApplies(t *testing.T) {
+	for _, tt := range []struct{ name, content string }{
+		{"PROV-N", "document\nprefix ex <http://example.org/>\nentity(ex:a)\nendDocument\n"},
+		{"RO-Crate with graph", `{"@context": "https://w3id.org/ro/crate/1.1/context", "@graph": []}`},
+		{"RO-Crate context without graph", `{"@context": ["https://w3id.org/ro/crate/1.2/context"], "@graph": [{"@id": "./"}]}`},
+		{"other JSON-LD", `{"@context": "https://schema.org/", "@graph": [], "name": "x"}`},
+		{"PROV-JSON", `{"prefix": {"prov": "http://www.w3.org/ns/prov#"}, "entity": {}, "activity": {}}`},
+		{"OTLP", `{"resourceLogs": []}`},
+		{"OTLP NDJSON", "{\"resourceSpans\": []}\n{\"resourceSpans\": []}\n"},
+		{"JSON Schema", `{"$schema": "https://example.com/events.schema.json", "events": []}`},
+		{"NDJSON", "{\"a\": 1}\n{\"a\": 2}"},
+		{"JSON object", `{"a": 1}`},
+		{"JSON array", `[1, 2]`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := &logschema.RunLog{StructuredLog: tt.content}
+			logschema.FixSchemas(rl, nil, 0)
+			if rl.LogSchema == nil {
+				return
+			}
+			res, err := (&logschema.Validator{}).ValidateRunLog(rl)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !res.Valid {
+				t.Errorf("fixed schema %+v does not validate: %v", rl.LogSchema, res.Errors)
+			}
+		})
+	}
+}
+
+func TestValidateRunLog_SuggestsSchema(t *testing.T) {
+	v := &logschema.Validator{}
+	result, err := v.ValidateRunLog(&logschema.RunLog{StructuredLog: `{"wasGeneratedBy": {"id": "run-002"}}`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Valid || result.Suggestion == nil || result.Suggestion.Schema.Format != logschema.FormatOPM {
+		t.Errorf("expected invalid result with an OPM suggestion, got %+v", result)
+	}
+}
+
+func TestFixSchemas(t *testing.T) {
+	crate := `{"@context": "https://w3id.org/ro/crate/1.1/context", "@graph": []}`
+	rl := &logschema.RunLog{StructuredLog: crate}
+	tasks := []logschema.TaskLog{
+		{ID: "inherits", StructuredLog: crate},
+		{ID: "prov", StructuredLog: `{"prefix": {}, "entity": {}, "used": {}}`},
+		{ID: "opaque", StructuredLog: `{"a": 1}`},
+	}
+
+	fixes, unresolved := logschema.FixSchemas(rl, tasks, 0.5)
+	if rl.LogSchema == nil || rl.LogSchema.Format != logschema.FormatROCrate {
+		t.Fatalf("run schema not filled: %+v", rl.LogSchema)
+	}
+	if tasks[0].LogSchema != nil {
+		t.Errorf("task with matching inherited schema should stay implicit, got %+v", tasks[0].LogSchema)
+	}
+	if tasks[1].LogSchema == nil || tasks[1].LogSchema.Format != logschema.FormatOPM {
+		t.Errorf("PROV task should get an explicit override, got %+v", tasks[1].LogSchema)
+	}
+	if len(fixes) != 2 {
+		t.Errorf("expected 2 fixes, got %+v", fixes)
+	}
+	if len(unresolved) != 0 {
+		t.Errorf("opaque task inherits a schema and is not unresolved, got %v", unresolved)
+	}
+
+	res, err := (&logschema.Validator{}).ValidateRun(rl, tasks[:2])
+	if err != nil || !res.Valid() {
+		t.Errorf("fixed run should validate: %+v %v", res, err)
+	}
+
+	if _, unresolved := logschema.FixSchemas(nil, []logschema.TaskLog{{ID: "x", StructuredLog: `{"a": 1}`}}, 0.5); len(unresolved) != 1 {
+		t.Errorf("expected opaque orphan task to be unresolved, got %v", unresolved)
+	}
+}
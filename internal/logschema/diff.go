@@ -0,0 +1,562 @@
+package logschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ChangeKind says whether something was added, removed or changed.
+type ChangeKind string
+
+const (
+	ChangeAdded   ChangeKind = "added"
+	ChangeRemoved ChangeKind = "removed"
+	ChangeChanged ChangeKind = "changed"
+)
+
+// Aspects group changes by what they mean for the run.
+const (
+	AspectLog     = "log"     // a task, attempt or structured_log appeared or vanished
+	AspectEntity  = "entity"  // an entity or PROV record appeared or vanished
+	AspectInputs  = "inputs"  // object / used
+	AspectOutputs = "outputs" // result / wasGeneratedBy
+	AspectTiming  = "timing"  // start and end times
+	AspectOther   = "property"
+)
+
+// Change is one difference between two runs.
+type Change struct {
+	Location string      `json:"location"` // "run", "task <id>", "task <id> attempt <n>"
+	Kind     ChangeKind  `json:"kind"`
+	Aspect   string      `json:"aspect"`
+	ID       string      `json:"id,omitempty"` // entity or record; empty for log fields
+	Property string      `json:"property,omitempty"`
+	Old      interface{} `json:"old,omitempty"`
+	New      interface{} `json:"new,omitempty"`
+	Added    []string    `json:"added,omitempty"`   // for reference sets
+	Removed  []string    `json:"removed,omitempty"` // for reference sets
+}
+
+func (c Change) String() string {
+	target := c.ID
+	if c.Property != "" {
+		if target != "" {
+			target += "."
+		}
+		target += c.Property
+	}
+	switch {
+	case target == "":
+		return fmt.Sprintf("%s %s", map[ChangeKind]string{ChangeAdded: "+", ChangeRemoved: "-"}[c.Kind], c.Kind)
+	case c.Added != nil || c.Removed != nil:
+		var parts []string
+		for _, a := range c.Added {
+			parts = append(parts, "+"+a)
+		}
+		for _, r := range c.Removed {
+			parts = append(parts, "-"+r)
+		}
+		return fmt.Sprintf("~ %s: %s", target, strings.Join(parts, " "))
+	case c.Kind == ChangeAdded:
+		return fmt.Sprintf("+ %s%s", target, describeValue(c.New))
+	case c.Kind == ChangeRemoved:
+		return fmt.Sprintf("- %s%s", target, describeValue(c.Old))
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", target, jsonText(c.Old), jsonText(c.New))
+}
+
+func describeValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return " " + jsonText(v)
+}
+
+func jsonText(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// RunDiff is the semantic difference between two runs.
+type RunDiff struct {
+	Changes []Change `json:"changes"`
+	// Notes records comparisons that could not be made exactly, such as
+	// structured logs that had to be converted to a common format.
+	Notes []string `json:"notes,omitempty"`
+}
+
+// Empty reports whether the runs are equivalent.
+func (d *RunDiff) Empty() bool {
+	return len(d.Changes) == 0
+}
+
+// WriteText writes the diff grouped by location.
+func (d *RunDiff) WriteText(w io.Writer) error {
+	if d.Empty() {
+		_, err := fmt.Fprintln(w, "no differences")
+		return err
+	}
+	last := ""
+	for _, c := range d.Changes {
+		if c.Location != last {
+			if _, err := fmt.Fprintln(w, c.Location); err != nil {
+				return err
+			}
+			last = c.Location
+		}
+		if _, err := fmt.Fprintf(w, "  %s\n", c); err != nil {
+			return err
+		}
+	}
+	for _, n := range d.Notes {
+		if _, err := fmt.Fprintf(w, "note: %s\n", n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DiffRuns compares two runs: their state, the run and task log fields,
+// and their structured logs. RO-Crate entities are matched by @id and PROV
+// records by identifier; ordering, blank-node relation identifiers and the
+// run ID embedded in run-level identifiers are ignored. Tasks are matched
+// by ID (or position) and attempts by position. Structured logs in
+// different formats are compared as RO-Crate.
+func DiffRuns(a, b *Run) (*RunDiff, error) {
+	d := &differ{diff: &RunDiff{}, oldRun: a.RunID, newRun: b.RunID}
+	d.field("run", "state", a.State, b.State)
+
+	oldRL, newRL := a.RunLog, b.RunLog
+	if oldRL == nil {
+		oldRL = &RunLog{}
+	}
+	if newRL == nil {
+		newRL = &RunLog{}
+	}
+	d.field("run", "start_time", oldRL.StartTime, newRL.StartTime)
+	d.field("run", "end_time", oldRL.EndTime, newRL.EndTime)
+	d.field("run", "exit_code", oldRL.ExitCode, newRL.ExitCode)
+	if err := d.logs("run", oldRL.StructuredLog, newRL.StructuredLog, oldRL.LogSchema, newRL.LogSchema); err != nil {
+		return nil, err
+	}
+	oldSchema, newSchema := oldRL.LogSchema, newRL.LogSchema
+
+	oldTasks, newTasks := indexTasks(a.TaskLogs), indexTasks(b.TaskLogs)
+	for _, key := range unionKeys(oldTasks, newTasks) {
+		ot, nt := oldTasks[key], newTasks[key]
+		loc := "task " + key
+		switch {
+		case ot == nil:
+			d.add(Change{Location: loc, Kind: ChangeAdded, Aspect: AspectLog})
+			continue
+		case nt == nil:
+			d.add(Change{Location: loc, Kind: ChangeRemoved, Aspect: AspectLog})
+			continue
+		}
+		d.field(loc, "start_time", ot.StartTime, nt.StartTime)
+		d.field(loc, "end_time", ot.EndTime, nt.EndTime)
+		d.field(loc, "exit_code", ot.ExitCode, nt.ExitCode)
+		oldTaskSchema, newTaskSchema := inherit(ot.LogSchema, oldSchema), inherit(nt.LogSchema, newSchema)
+		if err := d.logs(loc, ot.StructuredLog, nt.StructuredLog, oldTaskSchema, newTaskSchema); err != nil {
+			return nil, err
+		}
+		for j := 0; j < len(ot.Logs) || j < len(nt.Logs); j++ {
+			aloc := fmt.Sprintf("%s attempt %d", loc, j)
+			switch {
+			case j >= len(ot.Logs):
+				d.add(Change{Location: aloc, Kind: ChangeAdded, Aspect: AspectLog})
+			case j >= len(nt.Logs):
+				d.add(Change{Location: aloc, Kind: ChangeRemoved, Aspect: AspectLog})
+			default:
+				oa, na := &ot.Logs[j], &nt.Logs[j]
+				d.field(aloc, "start_time", oa.StartTime, na.StartTime)
+				d.field(aloc, "end_time", oa.EndTime, na.EndTime)
+				d.field(aloc, "exit_code", oa.ExitCode, na.ExitCode)
+				if err := d.logs(aloc, oa.StructuredLog, na.StructuredLog, inherit(oa.LogSchema, oldTaskSchema), inherit(na.LogSchema, newTaskSchema)); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return d.diff, nil
+}
+
+func inherit(declared, parent *LogSchema) *LogSchema {
+	if declared != nil {
+		return declared
+	}
+	return parent
+}
+
+func indexTasks(tasks []TaskLog) map[string]*TaskLog {
+	out := map[string]*TaskLog{}
+	for i := range tasks {
+		out[crateTaskFromLog(&tasks[i], i).ID] = &tasks[i]
+	}
+	return out
+}
+
+func unionKeys[V any](a, b map[string]V) []string {
+	set := map[string]bool{}
+	for k := range a {
+		set[k] = true
+	}
+	for k := range b {
+		set[k] = true
+	}
+	return sortedKeys(set)
+}
+
+type differ struct {
+	diff           *RunDiff
+	oldRun, newRun string
+}
+
+func (d *differ) add(c Change) {
+	d.diff.Changes = append(d.diff.Changes, c)
+}
+
+// field compares a log field such as start_time.
+func (d *differ) field(loc, name string, old, new interface{}) {
+	if jsonEqual(old, new) {
+		return
+	}
+	aspect := AspectOther
+	if strings.HasSuffix(name, "_time") {
+		aspect = AspectTiming
+	}
+	d.add(Change{Location: loc, Kind: ChangeChanged, Aspect: aspect, Property: name, Old: old, New: new})
+}
+
+// logs compares two structured logs.
+func (d *differ) logs(loc, old, new string, oldSchema, newSchema *LogSchema) error {
+	switch {
+	case old == "" && new == "":
+		return nil
+	case old == "":
+		d.add(Change{Location: loc, Kind: ChangeAdded, Aspect: AspectLog, Property: "structured_log"})
+		return nil
+	case new == "":
+		d.add(Change{Location: loc, Kind: ChangeRemoved, Aspect: AspectLog, Property: "structured_log"})
+		return nil
+	case isLogURI(old) || isLogURI(new):
+		d.field(loc, "structured_log", old, new)
+		return nil
+	}
+	old, oldSchema, err := DecodeStructuredLog(old, oldSchema)
+	if err != nil {
+		return fmt.Errorf("%s (old): %w", loc, err)
+	}
+	new, newSchema, err = DecodeStructuredLog(new, newSchema)
+	if err != nil {
+		return fmt.Errorf("%s (new): %w", loc, err)
+	}
+	oldGraph, err := d.normalize(loc, old, oldSchema, d.oldRun, newSchema)
+	if err != nil {
+		return fmt.Errorf("%s (old): %w", loc, err)
+	}
+	newGraph, err := d.normalize(loc, new, newSchema, d.newRun, oldSchema)
+	if err != nil {
+		return fmt.Errorf("%s (new): %w", loc, err)
+	}
+	if oldGraph == nil || newGraph == nil {
+		// Not a graph format: compare the JSON documents as a whole.
+		var ov, nv interface{}
+		if json.Unmarshal([]byte(old), &ov) != nil || json.Unmarshal([]byte(new), &nv) != nil || !jsonEqual(ov, nv) {
+			d.add(Change{Location: loc, Kind: ChangeChanged, Aspect: AspectLog, Property: "structured_log"})
+		}
+		return nil
+	}
+	for _, id := range unionKeys(oldGraph, newGraph) {
+		o, n := oldGraph[id], newGraph[id]
+		switch {
+		case o == nil:
+			d.add(Change{Location: loc, Kind: ChangeAdded, Aspect: AspectEntity, ID: id, New: n["@type"]})
+			continue
+		case n == nil:
+			d.add(Change{Location: loc, Kind: ChangeRemoved, Aspect: AspectEntity, ID: id, Old: o["@type"]})
+			continue
+		}
+		for _, prop := range unionKeys(o, n) {
+			ov, nv := o[prop], n[prop]
+			if jsonEqual(ov, nv) {
+				continue
+			}
+			c := Change{Location: loc, Kind: ChangeChanged, Aspect: propertyAspect(prop), ID: id, Property: prop}
+			oldSet, oldIsSet := ov.(idSet)
+			newSet, newIsSet := nv.(idSet)
+			if (oldIsSet || ov == nil) && (newIsSet || nv == nil) {
+				c.Added, c.Removed = newSet.minus(oldSet), oldSet.minus(newSet)
+				d.add(c)
+				continue
+			}
+			switch {
+			case ov == nil:
+				c.Kind = ChangeAdded
+			case nv == nil:
+				c.Kind = ChangeRemoved
+			}
+			c.Old, c.New = ov, nv
+			d.add(c)
+		}
+	}
+	return nil
+}
+
+// propertyAspect classifies a normalised property.
+func propertyAspect(prop string) string {
+	switch prop {
+	case "object", "used":
+		return AspectInputs
+	case "result", "generated":
+		return AspectOutputs
+	case "startTime", "endTime", "prov:startTime", "prov:endTime":
+		return AspectTiming
+	}
+	return AspectOther
+}
+
+// idSet is a sorted set of identifiers.
+type idSet []string
+
+func (s idSet) minus(other idSet) []string {
+	have := map[string]bool{}
+	for _, x := range other {
+		have[x] = true
+	}
+	var out []string
+	for _, x := range s {
+		if !have[x] {
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+func newIDSet(ids []string) idSet {
+	set := map[string]bool{}
+	for _, id := range ids {
+		set[id] = true
+	}
+	return idSet(sortedKeys(set))
+}
+
+// normalize turns a structured log into id -> property -> value, with
+// reference sets as idSet, scalar arrays sorted, and the run ID stripped
+// from run-level identifiers. It returns nil for non-graph formats. When
+// the other side is in a different graph format, the log is compared as
+// RO-Crate.
+func (d *differ) normalize(loc, content string, schema *LogSchema, runID string, other *LogSchema) (map[string]map[string]interface{}, error) {
+	if schema == nil {
+		if det := DetectSchema([]byte(content)); det != nil {
+			schema = det.Schema
+		}
+	}
+	if schema == nil || (schema.Format != FormatROCrate && schema.Format != FormatOPM) {
+		return nil, nil
+	}
+	format := schema.Format
+	if other != nil && other.Format != format && (other.Format == FormatROCrate || other.Format == FormatOPM) {
+		converted, _, losses, err := ConvertStructuredLog(content, schema, FormatROCrate)
+		if err != nil {
+			return nil, err
+		}
+		content, format = converted, FormatROCrate
+		if len(losses) > 0 {
+			d.diff.Notes = append(d.diff.Notes, fmt.Sprintf("%s: compared as RO-Crate; %d PROV details not comparable", loc, len(losses)))
+		}
+	}
+	rename := func(id string) string {
+		if runID == "" {
+			return id
+		}
+		switch id {
+		case RunEntityID(runID):
+			return RunEntityID("")
+		case ProvWESPrefix + ":" + strings.TrimPrefix(RunEntityID(runID), "#"):
+			return ProvWESPrefix + ":" + strings.TrimPrefix(RunEntityID(""), "#")
+		}
+		return id
+	}
+
+	out := map[string]map[string]interface{}{}
+	if format == FormatROCrate {
+		c, err := ParseCrate(content)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range c.Graph {
+			props := map[string]interface{}{}
+			for k, v := range e {
+				if k == "@id" {
+					continue
+				}
+				if k == "@type" {
+					props[k] = newIDSet(e.Types())
+					continue
+				}
+				if isRefList(v) {
+					var ids []string
+					for _, r := range e.Refs(k) {
+						ids = append(ids, rename(r))
+					}
+					props[k] = newIDSet(ids)
+					continue
+				}
+				props[k] = sortedValue(v)
+			}
+			out[rename(e.ID())] = props
+		}
+		return relabelBlankNodes(out), nil
+	}
+
+	doc, err := ParseProv(content)
+	if err != nil {
+		return nil, err
+	}
+	for kind, records := range map[string]map[string]ProvAttrs{"entity": doc.Entity, "activity": doc.Activity, "agent": doc.Agent} {
+		for id, attrs := range records {
+			props := map[string]interface{}{"@type": idSet{"prov:" + kind}}
+			for k, v := range attrs {
+				props[k] = sortedValue(v)
+			}
+			out[rename(id)] = props
+		}
+	}
+	// Relations are folded into their subject record, so blank-node
+	// relation identifiers do not matter. wasGeneratedBy is folded into the
+	// activity as "generated".
+	related := map[string]map[string][]string{}
+	fold := func(subject, prop, object string) {
+		if related[subject] == nil {
+			related[subject] = map[string][]string{}
+		}
+		related[subject][prop] = append(related[subject][prop], object)
+	}
+	for _, rel := range provRelations {
+		for _, attrs := range doc.relations(rel.name, false) {
+			s, o := rename(provString(attrs[rel.args[0]])), rename(provString(attrs[rel.args[1]]))
+			var extra []string
+			for _, k := range sortedKeys(attrs) {
+				if k != rel.args[0] && k != rel.args[1] {
+					extra = append(extra, k+"="+jsonText(attrs[k]))
+				}
+			}
+			suffix := ""
+			if len(extra) > 0 {
+				suffix = " [" + strings.Join(extra, ", ") + "]"
+			}
+			if rel.name == "wasGeneratedBy" {
+				fold(o, "generated", s+suffix)
+				continue
+			}
+			fold(s, rel.name, o+suffix)
+		}
+	}
+	for subject, props := range related {
+		if out[subject] == nil {
+			out[subject] = map[string]interface{}{}
+		}
+		for prop, ids := range props {
+			out[subject][prop] = newIDSet(ids)
+		}
+	}
+	return out, nil
+}
+
+// relabelBlankNodes renames the "_:" entities of a normalised crate after
+// their content, so that two crates that differ only in blank node labels
+// compare equal. References between blank nodes are resolved by hashing
+// repeatedly, each round with the labels of the previous one, until the
+// labels stop telling more entities apart. Entities whose content is
+// identical share a hash and are told apart by a counter.
+func relabelBlankNodes(out map[string]map[string]interface{}) map[string]map[string]interface{} {
+	var blanks []string
+	for id := range out {
+		if strings.HasPrefix(id, "_:") {
+			blanks = append(blanks, id)
+		}
+	}
+	if len(blanks) == 0 {
+		return out
+	}
+	sort.Strings(blanks)
+	relabel := func(props map[string]interface{}, label map[string]string) map[string]interface{} {
+		cp := make(map[string]interface{}, len(props))
+		for k, v := range props {
+			ids, ok := v.(idSet)
+			if !ok {
+				cp[k] = v
+				continue
+			}
+			var mapped []string
+			for _, id := range ids {
+				if l, ok := label[id]; ok {
+					id = l
+				}
+				mapped = append(mapped, id)
+			}
+			cp[k] = newIDSet(mapped)
+		}
+		return cp
+	}
+	distinct := func(label map[string]string) int {
+		seen := map[string]bool{}
+		for _, l := range label {
+			seen[l] = true
+		}
+		return len(seen)
+	}
+
+	label := map[string]string{}
+	for _, b := range blanks {
+		label[b] = "_:"
+	}
+	for round := 0; round <= len(blanks); round++ {
+		next := map[string]string{}
+		for _, b := range blanks {
+			next[b] = "_:" + sha256Hex(jsonText(relabel(out[b], label)))[:16]
+		}
+		more := distinct(next) > distinct(label)
+		label = next
+		if !more && round > 0 {
+			break
+		}
+	}
+	count := map[string]int{}
+	for _, b := range blanks {
+		l := label[b]
+		if count[l]++; count[l] > 1 {
+			label[b] = fmt.Sprintf("%s-%d", l, count[l]-1)
+		}
+	}
+
+	renamed := make(map[string]map[string]interface{}, len(out))
+	for id, props := range out {
+		if l, ok := label[id]; ok {
+			id = l
+		}
+		renamed[id] = relabel(props, label)
+	}
+	return renamed
+}
+
+// sortedValue sorts arrays of scalars so that ordering is ignored.
+func sortedValue(v interface{}) interface{} {
+	arr, ok := v.([]interface{})
+	if !ok {
+		return v
+	}
+	cp := append([]interface{}{}, arr...)
+	sort.SliceStable(cp, func(i, j int) bool { return jsonText(cp[i]) < jsonText(cp[j]) })
+	return cp
+}
@@ -0,0 +1,155 @@
+package logschema_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+func diffRun(t *testing.T, runID string, b *logschema.CrateBuilder, tasks ...logschema.TaskLog) *logschema.Run {
+	t.Helper()
+	rl := &logschema.RunLog{StartTime: "2024-01-01T10:00:00Z"}
+	if err := b.ApplyTo(rl); err != nil {
+		t.Fatal(err)
+	}
+	return &logschema.Run{RunID: runID, State: "COMPLETE", RunLog: rl, TaskLogs: tasks}
+}
+
+func TestDiffRuns(t *testing.T) {
+	old := diffRun(t, "run-001", variantCallingCrate(), logschema.TaskLog{ID: "bwa", EndTime: "2024-01-01T10:30:00Z"})
+
+	t.Run("identical runs with different run IDs", func(t *testing.T) {
+		same := diffRun(t, "run-002", variantCallingCrateFor("run-002"), logschema.TaskLog{ID: "bwa", EndTime: "2024-01-01T10:30:00Z"})
+		d, err := logschema.DiffRuns(old, same)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !d.Empty() {
+			t.Errorf("expected no differences, got %v", d.Changes)
+		}
+	})
+
+	t.Run("changed provenance", func(t *testing.T) {
+		changed := logschema.NewCrateBuilder("run-002", "variant-calling-pipeline").
+			Workflow("main.nf", "variant calling", "nextflow").
+			Times("2024-01-01T10:00:00Z", "2024-01-01T12:00:00Z").
+			Agent(logschema.CrateAgent{ID: "https://orcid.org/0000-0002-1825-0097", Name: "Josiah Carberry"}).
+			Input(logschema.CrateFile{ID: "reads.fastq", EncodingFormat: "text/plain"}).
+			Input(logschema.CrateFile{ID: "ref.fa"}).
+			File(logschema.CrateFile{ID: "aligned.bam"}).
+			Output(logschema.CrateFile{ID: "calls.vcf", ContentSize: 1024}).
+			Task(logschema.CrateTask{
+				ID: "bwa", Tool: "bwa-mem2",
+				StartTime: "2024-01-01T10:00:00Z", EndTime: "2024-01-01T10:30:00Z",
+				Inputs: []string{"ref.fa", "reads.fastq"}, Outputs: []string{"aligned.bam"},
+			}).
+			Task(logschema.CrateTask{
+				ID: "gatk", Tool: "gatk HaplotypeCaller",
+				StartTime: "2024-01-01T10:30:00Z", EndTime: "2024-01-01T12:00:00Z",
+				Inputs: []string{"aligned.bam"},
+			})
+		new := diffRun(t, "run-002", changed, logschema.TaskLog{ID: "bwa", EndTime: "2024-01-01T10:45:00Z"}, logschema.TaskLog{ID: "extra"})
+		new.State = "EXECUTOR_ERROR"
+
+		d, err := logschema.DiffRuns(old, new)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := d.WriteText(&buf); err != nil {
+			t.Fatal(err)
+		}
+		text := buf.String()
+		for _, want := range []string{
+			"~ state: COMPLETE -> EXECUTOR_ERROR",
+			"+ ref.fa [\"File\"]",
+			"~ #task-bwa.object: +ref.fa",
+			"~ #task-gatk.result: -calls.vcf",
+			"~ #run.object: +ref.fa",
+			"task bwa\n  ~ end_time: 2024-01-01T10:30:00Z -> 2024-01-01T10:45:00Z",
+			"task extra\n  + added\n",
+		} {
+			if !strings.Contains(text, want) {
+				t.Errorf("diff missing %q:\n%s", want, text)
+			}
+		}
+		aspects := map[string]int{}
+		for _, c := range d.Changes {
+			aspects[c.Aspect]++
+		}
+		if aspects[logschema.AspectInputs] != 2 || aspects[logschema.AspectOutputs] != 1 || aspects[logschema.AspectTiming] != 1 {
+			t.Errorf("unexpected aspects %v:\n%s", aspects, text)
+		}
+	})
+}
+
+func TestDiffRuns_Prov(t *testing.T) {
+	prov := func(content string) *logschema.Run {
+		return &logschema.Run{RunLog: &logschema.RunLog{StructuredLog: content, LogSchema: logschema.ProvLogSchema()}}
+	}
+	a := prov(`{"activity": {"ex:a": {}}, "entity": {"ex:in": {}, "ex:out": {}},
+		"used": {"_:u1": {"prov:activity": "ex:a", "prov:entity": "ex:in"}},
+		"wasGeneratedBy": {"_:g1": {"prov:entity": "ex:out", "prov:activity": "ex:a"}}}`)
+	reordered := prov(`{"wasGeneratedBy": {"_:x9": {"prov:activity": "ex:a", "prov:entity": "ex:out"}},
+		"used": {"_:b7": {"prov:entity": "ex:in", "prov:activity": "ex:a"}},
+		"entity": {"ex:out": {}, "ex:in": {}}, "activity": {"ex:a": {}}}`)
+	d, err := logschema.DiffRuns(a, reordered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Empty() {
+		t.Errorf("ordering and blank nodes should be ignored: %v", d.Changes)
+	}
+
+	timed := prov(`{"activity": {"ex:a": {"prov:endTime": "2024-01-01T10:00:00Z"}}, "entity": {"ex:in": {}},
+		"used": {"_:u1": {"prov:activity": "ex:a", "prov:entity": "ex:in"}}}`)
+	d, err = logschema.DiffRuns(a, timed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]bool{}
+	for _, c := range d.Changes {
+		got[c.String()] = true
+	}
+	for _, want := range []string{"- ex:out [\"prov:entity\"]", "~ ex:a.generated: -ex:out", "+ ex:a.prov:endTime 2024-01-01T10:00:00Z"} {
+		if !got[want] {
+			t.Errorf("missing change %q in %v", want, d.Changes)
+		}
+	}
+}
+
+func TestDiffRuns_CrateBlankNodes(t *testing.T) {
+	crate := func(content string) *logschema.Run {
+		return &logschema.Run{RunLog: &logschema.RunLog{StructuredLog: content, LogSchema: logschema.ROCrateLogSchema()}}
+	}
+	a := crate(`{"@context": "https://w3id.org/ro/crate/1.1/context", "@graph": [
+		{"@id": "ro-crate-metadata.json", "@type": "CreativeWork", "about": {"@id": "./"}},
+		{"@id": "./", "@type": "Dataset", "mentions": [{"@id": "#run"}]},
+		{"@id": "#run", "@type": "CreateAction", "object": [{"@id": "_:b0"}, {"@id": "_:b1"}]},
+		{"@id": "_:b0", "@type": "PropertyValue", "name": "threads", "value": 4, "unitOf": {"@id": "_:b1"}},
+		{"@id": "_:b1", "@type": "PropertyValue", "name": "memory", "value": "8G"}]}`)
+	relabelled := crate(`{"@context": "https://w3id.org/ro/crate/1.1/context", "@graph": [
+		{"@id": "ro-crate-metadata.json", "@type": "CreativeWork", "about": {"@id": "./"}},
+		{"@id": "./", "@type": "Dataset", "mentions": [{"@id": "#run"}]},
+		{"@id": "#run", "@type": "CreateAction", "object": [{"@id": "_:x"}, {"@id": "_:b7"}]},
+		{"@id": "_:x", "@type": "PropertyValue", "name": "memory", "value": "8G"},
+		{"@id": "_:b7", "@type": "PropertyValue", "name": "threads", "value": 4, "unitOf": {"@id": "_:x"}}]}`)
+	d, err := logschema.DiffRuns(a, relabelled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Empty() {
+		t.Errorf("blank node labels should be ignored: %v", d.Changes)
+	}
+
+	changed := crate(strings.Replace(a.RunLog.StructuredLog, `"value": "8G"`, `"value": "16G"`, 1))
+	d, err = logschema.DiffRuns(a, changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Empty() {
+		t.Error("a changed blank node should be reported")
+	}
+}
@@ -0,0 +1,304 @@
+package logschema
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// Canonicalization names how structured_log content is normalised before
+// it is hashed.
+type Canonicalization string
+
+const (
+	CanonicalizationNone      Canonicalization = "none"      // the content bytes as served
+	CanonicalizationJCS       Canonicalization = "jcs"       // RFC 8785 JSON Canonicalization Scheme
+	CanonicalizationURDNA2015 Canonicalization = "urdna2015" // URDNA2015 canonical N-Quads of the RDF dataset
+)
+
+// DigestAlgorithm names a hash function for structured_log digests.
+type DigestAlgorithm string
+
+const (
+	DigestSHA256 DigestAlgorithm = "sha-256"
+	DigestSHA384 DigestAlgorithm = "sha-384"
+	DigestSHA512 DigestAlgorithm = "sha-512"
+)
+
+// Digest is a content hash of a structured_log, recorded next to it as
+// structured_log_digest. It is kept out of LogSchema because schemas are
+// inherited by tasks and attempts while a digest only ever describes one
+// payload.
+type Digest struct {
+	// Algorithm is the hash function, e.g. "sha-256".
+	Algorithm DigestAlgorithm `json:"algorithm"`
+
+	// Canonicalization is applied to the content before hashing. Defaults
+	// to "none", the content bytes as served.
+	Canonicalization Canonicalization `json:"canonicalization,omitempty"`
+
+	// Value is the lowercase hex encoding of the hash.
+	Value string `json:"value"`
+}
+
+// Validate checks that the digest names a known algorithm and
+// canonicalisation and that its value has the right length.
+func (d *Digest) Validate() error {
+	h, err := d.Algorithm.hash()
+	if err != nil {
+		return err
+	}
+	switch d.Canonicalization {
+	case CanonicalizationNone, CanonicalizationJCS, CanonicalizationURDNA2015, "":
+	default:
+		return fmt.Errorf("structured_log_digest.canonicalization %q is not a recognised value", d.Canonicalization)
+	}
+	if b, err := hex.DecodeString(d.Value); err != nil || len(b) != h.Size() {
+		return fmt.Errorf("structured_log_digest.value must be %d hex characters for %s", 2*h.Size(), d.Algorithm)
+	}
+	return nil
+}
+
+func (a DigestAlgorithm) hash() (hash.Hash, error) {
+	switch a {
+	case DigestSHA256:
+		return sha256.New(), nil
+	case DigestSHA384:
+		return sha512.New384(), nil
+	case DigestSHA512:
+		return sha512.New(), nil
+	case "":
+		return nil, fmt.Errorf("structured_log_digest.algorithm is required")
+	}
+	return nil, fmt.Errorf("structured_log_digest.algorithm %q is not supported", a)
+}
+
+// DefaultCanonicalization picks the canonicalisation for content described
+// by schema: URDNA2015 for N-Quads, JCS for JSON, JSON-LD (including
+// RO-Crate) and line-delimited JSON, and none for anything else. JSON-LD
+// defaults to JCS because URDNA2015 needs its contexts, which may not be
+// reachable where the digest is checked; ask for urdna2015 explicitly to
+// make a digest independent of the JSON-LD serialisation.
+func DefaultCanonicalization(schema *LogSchema) Canonicalization {
+	if schema == nil {
+		return CanonicalizationJCS
+	}
+	mediaType := schema.MediaTypeOrDefault()
+	switch {
+	case mediaType == mediaTypeNQuads:
+		return CanonicalizationURDNA2015
+	case schema.Format == FormatROCrate, mediaType == "application/ld+json",
+		mediaType == "application/json", isLineDelimited(mediaType):
+		return CanonicalizationJCS
+	}
+	return CanonicalizationNone
+}
+
+// Canonicalize normalises content with c. For line-delimited media types,
+// JCS is applied to each non-blank line. URDNA2015 reads N-Quads when
+// mediaType is application/n-quads and JSON-LD otherwise, fetching its
+// contexts with load, which may be nil.
+func Canonicalize(content []byte, c Canonicalization, mediaType string, load ContextLoader) ([]byte, error) {
+	switch c {
+	case CanonicalizationNone, "":
+		return content, nil
+	case CanonicalizationJCS:
+		if !isLineDelimited(mediaType) {
+			return CanonicalizeJSON(content)
+		}
+		var out []byte
+		for i, line := range strings.Split(string(content), "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			canon, err := CanonicalizeJSON([]byte(line))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			out = append(append(out, canon...), '\n')
+		}
+		return out, nil
+	case CanonicalizationURDNA2015:
+		if mediaType == mediaTypeNQuads {
+			return CanonicalizeNQuads(content)
+		}
+		return CanonicalizeJSONLD(content, load)
+	}
+	return nil, fmt.Errorf("unknown canonicalization %q", c)
+}
+
+// ComputeDigest canonicalises content as described by schema and hashes
+// it. An empty c selects DefaultCanonicalization(schema) and an empty alg
+// selects SHA-256. Remote JSON-LD contexts cannot be loaded; use
+// Validator.ComputeDigest to resolve them.
+func ComputeDigest(content []byte, schema *LogSchema, c Canonicalization, alg DigestAlgorithm) (*Digest, error) {
+	return computeDigest(content, schema, c, alg, nil)
+}
+
+// ComputeDigest is like the package-level ComputeDigest, but resolves
+// remote JSON-LD contexts through the Validator's schema directory and
+// network settings.
+func (v *Validator) ComputeDigest(content []byte, schema *LogSchema, c Canonicalization, alg DigestAlgorithm) (*Digest, error) {
+	return computeDigest(content, schema, c, alg, v.loadContext)
+}
+
+func computeDigest(content []byte, schema *LogSchema, c Canonicalization, alg DigestAlgorithm, load ContextLoader) (*Digest, error) {
+	if c == "" {
+		c = DefaultCanonicalization(schema)
+	}
+	if alg == "" {
+		alg = DigestSHA256
+	}
+	h, err := alg.hash()
+	if err != nil {
+		return nil, err
+	}
+	canon, err := Canonicalize(content, c, mediaTypeOf(schema), load)
+	if err != nil {
+		return nil, fmt.Errorf("%s canonicalization failed: %w", c, err)
+	}
+	h.Write(canon)
+	return &Digest{Algorithm: alg, Canonicalization: c, Value: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// VerifyDigest checks that the structured_log content matches d. A
+// structured_log that is a URI is fetched first, so the digest
+// then vouches for the document behind the reference; encoded inline
+// content is decoded first.
+func (v *Validator) VerifyDigest(content string, schema *LogSchema, d *Digest) error {
+	body, err := v.payload(content, schema)
+	if err != nil {
+		return fmt.Errorf("cannot verify the digest of a remote structured_log: %w", err)
+	}
+	return v.verifyDigest(body, schema, d)
+}
+
+func (v *Validator) verifyDigest(body []byte, schema *LogSchema, d *Digest) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	got, err := v.ComputeDigest(body, schema, d.Canonicalization, d.Algorithm)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(got.Value, d.Value) {
+		return fmt.Errorf("%s digest mismatch: structured_log hashes to %s, structured_log_digest records %s",
+			d.Algorithm, got.Value, d.Value)
+	}
+	return nil
+}
+
+// loadContext resolves a JSON-LD context like a schema_uri: from SchemaDir
+// first, then from the network unless Offline.
+func (v *Validator) loadContext(uri string) ([]byte, error) {
+	return v.FetchRemoteSchema(&LogSchema{SchemaURI: uri})
+}
+
+// contextLoader returns loadContext, or nil for a nil Validator.
+func (v *Validator) contextLoader() ContextLoader {
+	if v == nil {
+		return nil
+	}
+	return v.loadContext
+}
+
+// payload returns the bytes a structured_log stands for: the decoded
+// content, or the document behind a URI.
+func (v *Validator) payload(content string, schema *LogSchema) ([]byte, error) {
+	if isLogURI(content) {
+		return v.FetchURI(content)
+	}
+	out, _, err := v.decodeLog(content, schema)
+	return []byte(out), err
+}
+
+// dereference is payload for a possibly nil Validator, which cannot
+// dereference URIs.
+func (v *Validator) dereference(content string, schema *LogSchema) ([]byte, error) {
+	if v == nil && isLogURI(content) {
+		return nil, fmt.Errorf("structured_log is a reference")
+	}
+	return v.payload(content, schema)
+}
+
+func mediaTypeOf(schema *LogSchema) string {
+	if schema == nil {
+		return "application/json"
+	}
+	return schema.MediaTypeOrDefault()
+}
+
+// RecordDigests computes a structured_log_digest for every structured_log
+// in a run that has none, using each log's effective (possibly inherited)
+// schema. Logs given by URI are fetched with v; when v is nil they are
+// skipped. It returns the locations that got a digest and, for the others,
+// why they were skipped.
+func RecordDigests(v *Validator, rl *RunLog, tasks []TaskLog, c Canonicalization, alg DigestAlgorithm) (recorded, skipped []string) {
+	compute := ComputeDigest
+	if v != nil {
+		compute = v.ComputeDigest
+	}
+	walkStructuredLogs(rl, tasks, func(ref structuredLogRef) {
+		if *ref.digest != nil {
+			return
+		}
+		body, err := v.dereference(ref.content, ref.schema)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: %v", ref.location, err))
+			return
+		}
+		d, err := compute(body, ref.schema, c, alg)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: %v", ref.location, err))
+			return
+		}
+		*ref.digest = d
+		recorded = append(recorded, ref.location)
+	})
+	return recorded, skipped
+}
+
+// structuredLogRef points at one structured_log of a run, its effective
+// schema and the fields that vouch for its content.
+type structuredLogRef struct {
+	location   string
+	content    string
+	schema     *LogSchema
+	digest     **Digest
+	signatures *[]Signature
+}
+
+// walkStructuredLogs calls fn for every non-empty structured_log of a run,
+// its tasks and their attempts, applying schema inheritance.
+func walkStructuredLogs(rl *RunLog, tasks []TaskLog, fn func(structuredLogRef)) {
+	visit := func(ref structuredLogRef) {
+		if ref.content != "" {
+			fn(ref)
+		}
+	}
+	var runSchema *LogSchema
+	if rl != nil {
+		runSchema = rl.LogSchema
+		visit(structuredLogRef{"run", rl.StructuredLog, runSchema, &rl.StructuredLogDigest, &rl.StructuredLogSignatures})
+	}
+	for i := range tasks {
+		tl := &tasks[i]
+		loc := taskLocation(tl, i)
+		taskSchema := tl.LogSchema
+		if taskSchema == nil {
+			taskSchema = runSchema
+		}
+		visit(structuredLogRef{loc, tl.StructuredLog, taskSchema, &tl.StructuredLogDigest, &tl.StructuredLogSignatures})
+		for j := range tl.Logs {
+			a := &tl.Logs[j]
+			schema := a.LogSchema
+			if schema == nil {
+				schema = taskSchema
+			}
+			visit(structuredLogRef{fmt.Sprintf("%s attempt %d", loc, j), a.StructuredLog, schema, &a.StructuredLogDigest, &a.StructuredLogSignatures})
+		}
+	}
+}
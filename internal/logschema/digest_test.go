@@ -0,0 +1,211 @@
+package logschema_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+func TestComputeDigest(t *testing.T) {
+	crate, err := variantCallingCrate().Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	compact, err := json.Marshal(crate)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	reorderedCrate := *crate
+	reorderedCrate.Graph = append([]logschema.Entity(nil), crate.Graph...)
+	for i, j := 0, len(reorderedCrate.Graph)-1; i < j; i, j = i+1, j-1 {
+		reorderedCrate.Graph[i], reorderedCrate.Graph[j] = reorderedCrate.Graph[j], reorderedCrate.Graph[i]
+	}
+	pretty, err := json.MarshalIndent(crate, "", "    ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	reordered, err := json.MarshalIndent(&reorderedCrate, "", "    ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	schema := logschema.ROCrateLogSchema()
+	a, err := logschema.ComputeDigest(compact, schema, "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a.Canonicalization != logschema.CanonicalizationJCS || a.Algorithm != logschema.DigestSHA256 || len(a.Value) != 64 {
+		t.Fatalf("unexpected defaults: %+v", a)
+	}
+	b, err := logschema.ComputeDigest(pretty, schema, "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a.Value != b.Value {
+		t.Errorf("reformatted crate has a different digest: %s != %s", a.Value, b.Value)
+	}
+	raw, err := logschema.ComputeDigest(pretty, schema, logschema.CanonicalizationNone, logschema.DigestSHA512)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(raw.Value) != 128 || raw.Value == a.Value {
+		t.Errorf("unexpected raw SHA-512 digest %+v", raw)
+	}
+
+	// URDNA2015 also ignores the order of the @graph, but needs the
+	// RO-Crate context.
+	if _, err := logschema.ComputeDigest(compact, schema, logschema.CanonicalizationURDNA2015, ""); err == nil {
+		t.Error("urdna2015 without the RO-Crate context should fail")
+	}
+	v := &logschema.Validator{SchemaDir: roCrateSchemaDir(t), Offline: true}
+	c, err := v.ComputeDigest(compact, schema, logschema.CanonicalizationURDNA2015, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d, err := v.ComputeDigest(reordered, schema, logschema.CanonicalizationURDNA2015, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Value != d.Value || c.Value == a.Value {
+		t.Errorf("reordered crate has a different urdna2015 digest: %s != %s", c.Value, d.Value)
+	}
+
+	nquads := &logschema.LogSchema{SchemaURI: "https://example.org/rdf", Format: logschema.FormatCustom, MediaType: "application/n-quads"}
+	x, _ := logschema.ComputeDigest([]byte("_:a <http://ex.org/p> \"x\" .\n"), nquads, "", "")
+	y, _ := logschema.ComputeDigest([]byte("_:b   <http://ex.org/p> \"x\".\n"), nquads, "", "")
+	if x == nil || y == nil || x.Canonicalization != logschema.CanonicalizationURDNA2015 || x.Value != y.Value {
+		t.Errorf("N-Quads digests should match under urdna2015: %+v %+v", x, y)
+	}
+
+	prov := logschema.ProvLogSchema()
+	x, _ = logschema.ComputeDigest([]byte(`{"used": {}, "entity": {"ex:a": {"prov:label": "a"}}}`), prov, "", "")
+	y, _ = logschema.ComputeDigest([]byte("{\n \"entity\": {\"ex:a\": {\"prov:label\": \"a\"}},\n \"used\": {}\n}"), prov, "", "")
+	if x == nil || y == nil || x.Canonicalization != logschema.CanonicalizationJCS || x.Value != y.Value {
+		t.Errorf("PROV-JSON digests should match under JCS: %+v %+v", x, y)
+	}
+}
+
+func TestDigest_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		d    logschema.Digest
+		want string
+	}{
+		{"missing algorithm", logschema.Digest{Value: strings.Repeat("0", 64)}, "algorithm is required"},
+		{"unknown algorithm", logschema.Digest{Algorithm: "md5", Value: strings.Repeat("0", 32)}, "not supported"},
+		{"unknown canonicalization", logschema.Digest{Algorithm: logschema.DigestSHA256, Canonicalization: "c14n", Value: strings.Repeat("0", 64)}, "canonicalization"},
+		{"short value", logschema.Digest{Algorithm: logschema.DigestSHA256, Value: "abcd"}, "64 hex characters"},
+		{"valid", logschema.Digest{Algorithm: logschema.DigestSHA384, Value: strings.Repeat("a", 96)}, ""},
+		{"urdna2015", logschema.Digest{Algorithm: logschema.DigestSHA256, Canonicalization: "urdna2015", Value: strings.Repeat("0", 64)}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.d.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() error = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidator_Digest(t *testing.T) {
+	const content = `{"used": {"_:u1": {"prov:activity": "ex:run", "prov:entity": "ex:reads"}}}`
+	schema := logschema.ProvLogSchema()
+	digest, err := logschema.ComputeDigest([]byte(content), schema, "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/prov.json":
+			w.Write([]byte("{\"used\":\n  {\"_:u1\": {\"prov:entity\": \"ex:reads\", \"prov:activity\": \"ex:run\"}}}"))
+		case "/tampered.json":
+			w.Write([]byte(`{"used": {"_:u1": {"prov:activity": "ex:run", "prov:entity": "ex:other"}}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		v       *logschema.Validator
+		content string
+		stage   string
+	}{
+		{"inline match", &logschema.Validator{}, content, ""},
+		{"inline tampered", &logschema.Validator{}, strings.Replace(content, "reads", "other", 1), logschema.StageDigest},
+		{"remote match", &logschema.Validator{}, srv.URL + "/prov.json", ""},
+		{"remote tampered", &logschema.Validator{}, srv.URL + "/tampered.json", logschema.StageDigest},
+		{"remote missing", &logschema.Validator{}, srv.URL + "/gone.json", logschema.StageDigest},
+		{"remote offline", &logschema.Validator{Offline: true}, srv.URL + "/prov.json", logschema.StageDigest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := &logschema.RunLog{StructuredLog: tt.content, LogSchema: schema, StructuredLogDigest: digest}
+			result, err := tt.v.ValidateRunLog(rl)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Stage != tt.stage {
+				t.Errorf("Stage = %q, want %q (%v)", result.Stage, tt.stage, result.Errors)
+			}
+		})
+	}
+}
+
+func TestRecordDigests(t *testing.T) {
+	rl := &logschema.RunLog{}
+	if err := variantCallingCrate().ApplyTo(rl); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tasks := []logschema.TaskLog{
+		{ID: "bwa", StructuredLog: rl.StructuredLog},
+		{ID: "gatk", StructuredLog: "https://example.org/gatk.json", Logs: []logschema.Log{{
+			StructuredLog: "{\"event\":\"start\"}\n{\"event\":\"end\"}\n",
+			LogSchema:     &logschema.LogSchema{SchemaURI: "https://example.org/events", Format: logschema.FormatCustom, MediaType: "application/x-ndjson"},
+		}}},
+	}
+
+	recorded, skipped := logschema.RecordDigests(nil, rl, tasks, "", "")
+	if got := strings.Join(recorded, ","); got != "run,task bwa,task gatk attempt 0" {
+		t.Errorf("recorded = %q", got)
+	}
+	if len(skipped) != 1 || !strings.HasPrefix(skipped[0], "task gatk:") {
+		t.Errorf("skipped = %q", skipped)
+	}
+	if rl.StructuredLogDigest.Value != tasks[0].StructuredLogDigest.Value {
+		t.Errorf("same content, different digests")
+	}
+	if c := tasks[1].Logs[0].StructuredLogDigest.Canonicalization; c != logschema.CanonicalizationJCS {
+		t.Errorf("NDJSON canonicalization = %q", c)
+	}
+
+	tasks[1].StructuredLog = ""
+	res, err := (&logschema.Validator{}).ValidateRun(rl, tasks)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !res.Valid() {
+		t.Errorf("recorded digests do not verify: %+v", res)
+	}
+
+	// Rewriting the content drops the now stale digest.
+	if _, err := logschema.ConvertRun(rl, tasks, logschema.FormatOPM); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rl.StructuredLogDigest != nil || tasks[0].StructuredLogDigest != nil {
+		t.Errorf("ConvertRun kept stale digests")
+	}
+}
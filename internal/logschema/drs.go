@@ -0,0 +1,311 @@
+package logschema
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DRSObject is a GA4GH Data Repository Service object, as returned by
+// GET /objects/{object_id}.
+type DRSObject struct {
+	ID            string            `json:"id"`
+	Name          string            `json:"name,omitempty"`
+	SelfURI       string            `json:"self_uri"`
+	Size          int64             `json:"size"`
+	MimeType      string            `json:"mime_type,omitempty"`
+	Checksums     []DRSChecksum     `json:"checksums"`
+	AccessMethods []DRSAccessMethod `json:"access_methods,omitempty"`
+	// Contents is only set for bundles, which cannot be fetched as a log.
+	Contents []json.RawMessage `json:"contents,omitempty"`
+}
+
+// DRSChecksum is one checksum of a DRS object, e.g. type "sha-256".
+type DRSChecksum struct {
+	Checksum string `json:"checksum"`
+	Type     string `json:"type"`
+}
+
+// DRSAccessMethod is one way of fetching the bytes of a DRS object:
+// either directly through AccessURL or, with AccessID, through the
+// object's /access/{access_id} endpoint.
+type DRSAccessMethod struct {
+	Type      string        `json:"type"`
+	AccessURL *DRSAccessURL `json:"access_url,omitempty"`
+	AccessID  string        `json:"access_id,omitempty"`
+	Region    string        `json:"region,omitempty"`
+}
+
+// DRSAccessURL is a URL to fetch object bytes from, with the headers, in
+// "Name: value" form, that the request needs.
+type DRSAccessURL struct {
+	URL     string   `json:"url"`
+	Headers []string `json:"headers,omitempty"`
+}
+
+// DefaultDRSAccessTypes is the access method preference of a DRSResolver.
+var DefaultDRSAccessTypes = []string{"https", "http", "s3", "file"}
+
+// DRSResolver dereferences drs:// URIs through the GA4GH DRS API. It
+// understands hostname-based URIs (drs://host/object_id), served from
+// https://host/ga4gh/drs/v1, and compact identifiers (drs://prefix:id)
+// whose prefix is configured in Prefixes.
+type DRSResolver struct {
+	// HTTPClient defaults to a client with a 30s timeout if nil.
+	HTTPClient *http.Client
+
+	// Prefixes maps compact identifier prefixes, such as "drs.anv0", to the
+	// DRS API root serving them, e.g. "https://drs.example.org/ga4gh/drs/v1".
+	Prefixes map[string]string
+
+	// AccessTypes orders the access method types to use. Defaults to
+	// DefaultDRSAccessTypes.
+	AccessTypes []string
+
+	// Token is sent as a bearer token to the DRS API, not to access URLs,
+	// which carry their own headers.
+	Token string
+
+	// Store reads access URLs that are not HTTP(S), such as s3:// URLs,
+	// when it owns them.
+	Store LogStore
+
+	// MaxSize bounds the bytes read from an access URL. Zero selects
+	// DefaultMaxDecodedSize.
+	MaxSize int64
+}
+
+// isDRSURI reports whether s is a drs:// URI.
+func isDRSURI(s string) bool {
+	return strings.HasPrefix(s, "drs://")
+}
+
+func (r *DRSResolver) httpClient() *http.Client {
+	if r.HTTPClient != nil {
+		return r.HTTPClient
+	}
+	return &http.Client{Timeout: 30 * time.Second}
+}
+
+// objectEndpoint returns the DRS API URL of the object a drs:// URI names.
+func (r *DRSResolver) objectEndpoint(uri string) (string, error) {
+	rest, ok := strings.CutPrefix(uri, "drs://")
+	if !ok || rest == "" {
+		return "", fmt.Errorf("%q is not a DRS URI", uri)
+	}
+	var base, id string
+	if host, path, ok := strings.Cut(rest, "/"); ok {
+		// Hostname-based: drs://host[:port]/object_id.
+		if host == "" || path == "" {
+			return "", fmt.Errorf("malformed DRS URI %q", uri)
+		}
+		var err error
+		if id, err = url.PathUnescape(path); err != nil {
+			return "", fmt.Errorf("malformed DRS URI %q: %w", uri, err)
+		}
+		base = "https://" + host + "/ga4gh/drs/v1"
+	} else {
+		// Compact identifier: drs://prefix:accession.
+		prefix, accession, ok := strings.Cut(rest, ":")
+		if !ok || prefix == "" || accession == "" {
+			return "", fmt.Errorf("malformed DRS URI %q", uri)
+		}
+		for p, root := range r.Prefixes {
+			if strings.EqualFold(p, prefix) {
+				base = root
+			}
+		}
+		if base == "" {
+			return "", fmt.Errorf("DRS URI %q: no server configured for prefix %q", uri, prefix)
+		}
+		var err error
+		if id, err = url.PathUnescape(accession); err != nil {
+			return "", fmt.Errorf("malformed DRS URI %q: %w", uri, err)
+		}
+	}
+	return strings.TrimSuffix(base, "/") + "/objects/" + url.PathEscape(id), nil
+}
+
+// getJSON GETs a DRS API endpoint into out.
+func (r *DRSResolver) getJSON(endpoint string, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if r.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.Token)
+	}
+	resp, err := r.httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %q: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Msg string `json:"msg"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&e)
+		if e.Msg != "" {
+			return fmt.Errorf("%q returned HTTP %d: %s", endpoint, resp.StatusCode, e.Msg)
+		}
+		return fmt.Errorf("%q returned HTTP %d", endpoint, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding %q: %w", endpoint, err)
+	}
+	return nil
+}
+
+// Object looks up the DRS object a drs:// URI names.
+func (r *DRSResolver) Object(uri string) (*DRSObject, error) {
+	endpoint, err := r.objectEndpoint(uri)
+	if err != nil {
+		return nil, err
+	}
+	var obj DRSObject
+	if err := r.getJSON(endpoint, &obj); err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+// Resolve looks up the object a drs:// URI names and selects an access
+// method in AccessTypes order, calling the access endpoint when the method
+// only has an access_id. Bundles cannot be resolved.
+func (r *DRSResolver) Resolve(uri string) (*DRSObject, *DRSAccessURL, error) {
+	obj, err := r.Object(uri)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(obj.Contents) > 0 {
+		return nil, nil, fmt.Errorf("DRS object %q is a bundle, not a single log", uri)
+	}
+	types := r.AccessTypes
+	if len(types) == 0 {
+		types = DefaultDRSAccessTypes
+	}
+	for _, typ := range types {
+		for _, m := range obj.AccessMethods {
+			if !strings.EqualFold(m.Type, typ) {
+				continue
+			}
+			if m.AccessURL != nil && m.AccessURL.URL != "" {
+				return obj, m.AccessURL, nil
+			}
+			if m.AccessID != "" {
+				endpoint, err := r.objectEndpoint(uri)
+				if err != nil {
+					return nil, nil, err
+				}
+				var access DRSAccessURL
+				if err := r.getJSON(endpoint+"/access/"+url.PathEscape(m.AccessID), &access); err != nil {
+					return nil, nil, err
+				}
+				return obj, &access, nil
+			}
+		}
+	}
+	var offered []string
+	for _, m := range obj.AccessMethods {
+		offered = append(offered, m.Type)
+	}
+	return nil, nil, fmt.Errorf("DRS object %q has no usable access method (offers %s; accepts %s)",
+		uri, strings.Join(offered, ", "), strings.Join(types, ", "))
+}
+
+// Fetch returns the bytes of the object a drs:// URI names, checked
+// against its size and checksums. Objects larger than MaxSize fail with
+// ErrContentTooLarge, as do access URLs serving more than the declared
+// size.
+func (r *DRSResolver) Fetch(uri string) ([]byte, error) {
+	obj, access, err := r.Resolve(uri)
+	if err != nil {
+		return nil, err
+	}
+	limit := r.MaxSize
+	if limit <= 0 {
+		limit = DefaultMaxDecodedSize
+	}
+	if obj.Size > limit {
+		return nil, fmt.Errorf("DRS object %q declares %d bytes: %w of %d bytes", uri, obj.Size, ErrContentTooLarge, limit)
+	}
+	if obj.Size > 0 {
+		limit = obj.Size
+	}
+	var body []byte
+	switch {
+	case isHTTPURI(access.URL):
+		body, err = r.fetchAccessURL(access, limit)
+	case r.Store != nil && r.Store.Owns(access.URL):
+		body, err = r.Store.Get(access.URL)
+	default:
+		err = fmt.Errorf("cannot fetch access URL %q: unsupported URI scheme", access.URL)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("DRS object %q: %w", uri, err)
+	}
+	if err := obj.verify(body); err != nil {
+		return nil, fmt.Errorf("DRS object %q: %w", uri, err)
+	}
+	return body, nil
+}
+
+// fetchAccessURL reads at most limit bytes from an access URL.
+func (r *DRSResolver) fetchAccessURL(access *DRSAccessURL, limit int64) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, access.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range access.Headers {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			return nil, fmt.Errorf("malformed access URL header %q", h)
+		}
+		req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	resp, err := r.httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch access URL: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("access URL returned HTTP %d", resp.StatusCode)
+	}
+	return readLimited(resp.Body, limit)
+}
+
+// verify checks body against the object's size and the checksums whose
+// type is known.
+func (o *DRSObject) verify(body []byte) error {
+	if o.Size > 0 && int64(len(body)) != o.Size {
+		return fmt.Errorf("size is %d bytes, DRS object declares %d", len(body), o.Size)
+	}
+	for _, c := range o.Checksums {
+		var h hash.Hash
+		switch strings.ToLower(c.Type) {
+		case "sha-256", "sha256":
+			h = sha256.New()
+		case "sha-512", "sha512":
+			h = sha512.New()
+		case "md5":
+			h = md5.New()
+		default:
+			continue
+		}
+		h.Write(body)
+		if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, c.Checksum) {
+			return fmt.Errorf("%s checksum mismatch: got %s, DRS object declares %s", c.Type, got, c.Checksum)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package logschema_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+func TestDRSResolver_Fetch(t *testing.T) {
+	m := logschema.NewMockDRS()
+	defer m.Close()
+	m.Token = "drs-token"
+
+	content := []byte(`{"@context": "https://w3id.org/ro/crate/1.1/context", "@graph": []}`)
+	uri := m.AddObject("run/1 log", content, "application/ld+json")
+	m.Put(logschema.DRSObject{ID: "bundle", Contents: []json.RawMessage{json.RawMessage(`{"name": "a"}`)}}, nil)
+	m.Put(logschema.DRSObject{
+		ID:            "tampered",
+		Checksums:     []logschema.DRSChecksum{{Type: "sha-256", Checksum: strings.Repeat("0", 64)}},
+		AccessMethods: []logschema.DRSAccessMethod{{Type: "https", AccessID: "https"}},
+	}, content)
+	m.Put(logschema.DRSObject{
+		ID:            "oversized",
+		Size:          10,
+		AccessMethods: []logschema.DRSAccessMethod{{Type: "https", AccessID: "https"}},
+	}, content)
+	m.Put(logschema.DRSObject{
+		ID:            "gs-only",
+		AccessMethods: []logschema.DRSAccessMethod{{Type: "gs", AccessURL: &logschema.DRSAccessURL{URL: "gs://b/o"}}},
+	}, content)
+
+	r := m.Resolver()
+	got, err := r.Fetch(uri)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got) != string(content) {
+		t.Errorf("Fetch = %q", got)
+	}
+
+	host := strings.TrimPrefix(m.URL, "https://")
+	compact := m.Resolver()
+	compact.Prefixes = map[string]string{"mock.drs": m.URL + "/ga4gh/drs/v1"}
+	if got, err := compact.Fetch("drs://MOCK.DRS:run%2F1 log"); err != nil || string(got) != string(content) {
+		t.Errorf("compact identifier: %q, %v", got, err)
+	}
+
+	tests := []struct {
+		name string
+		r    *logschema.DRSResolver
+		uri  string
+		want string
+	}{
+		{"wrong token", &logschema.DRSResolver{HTTPClient: m.Client(), Token: "nope"}, uri, "HTTP 401"},
+		{"unknown object", r, "drs://" + host + "/missing", "object missing not found"},
+		{"bundle", r, "drs://" + host + "/bundle", "is a bundle"},
+		{"checksum mismatch", r, "drs://" + host + "/tampered", "sha-256 checksum mismatch"},
+		{"more than the declared size", r, "drs://" + host + "/oversized", "exceeds the size limit of 10 bytes"},
+		{"larger than MaxSize", &logschema.DRSResolver{HTTPClient: m.Client(), Token: m.Token, MaxSize: 16}, uri, "exceeds the size limit of 16 bytes"},
+		{"no usable access method", r, "drs://" + host + "/gs-only", "offers gs"},
+		{"unknown prefix", r, "drs://other:abc", `no server configured for prefix "other"`},
+		{"malformed", r, "drs://" + host + "/", "malformed DRS URI"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.r.Fetch(tt.uri)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidator_DRS(t *testing.T) {
+	m := logschema.NewMockDRS()
+	defer m.Close()
+
+	crate := []byte(`{"@context": "https://w3id.org/ro/crate/1.1/context", "@graph": []}`)
+	schema := &logschema.LogSchema{
+		SchemaURI: m.AddObject("ro-crate-schema", []byte(`{"type": "object"}`), "application/schema+json"),
+		Format:    logschema.FormatROCrate,
+	}
+	digest, err := logschema.ComputeDigest(crate, schema, "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	good := m.AddObject("good", crate, "application/ld+json")
+	bad := m.AddObject("bad", []byte(`{"@context": "https://w3id.org/ro/crate/1.1/context"}`), "application/ld+json")
+
+	tests := []struct {
+		name    string
+		v       *logschema.Validator
+		content string
+		stage   string
+	}{
+		{"fetched and valid", &logschema.Validator{DRS: m.Resolver(), ResolveSchemas: true}, good, ""},
+		{"fetched and invalid", &logschema.Validator{DRS: m.Resolver()}, bad, logschema.StageFormat},
+		{"unknown object", &logschema.Validator{DRS: m.Resolver()}, m.URI("missing"), logschema.StageFetch},
+		{"schema_uri unresolvable", &logschema.Validator{DRS: m.Resolver(), ResolveSchemas: true}, good, logschema.StageResolve},
+		{"no resolver: accepted, digest unverifiable", &logschema.Validator{}, good, logschema.StageDigest},
+		{"offline: not fetched", &logschema.Validator{DRS: m.Resolver(), Offline: true}, bad, logschema.StageDigest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := *schema
+			if tt.stage == logschema.StageResolve {
+				s.SchemaURI = m.URI("no-such-schema")
+			}
+			res, err := tt.v.ValidateRunLog(&logschema.RunLog{StructuredLog: tt.content, LogSchema: &s, StructuredLogDigest: digest})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if res.Stage != tt.stage {
+				t.Errorf("Stage = %q, want %q (%v)", res.Stage, tt.stage, res.Errors)
+			}
+		})
+	}
+}
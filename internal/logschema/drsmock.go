@@ -0,0 +1,141 @@
+package logschema
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// MockDRS is a GA4GH DRS server on an httptest TLS listener, for embedding
+// in Go tests. Object bytes are served from /data/{object_id} and need the
+// header that the object's access endpoint hands out.
+type MockDRS struct {
+	*httptest.Server
+
+	// Token, if set, is required as a bearer token on the DRS API.
+	Token string
+
+	mu      sync.Mutex
+	objects map[string]mockDRSObject
+}
+
+type mockDRSObject struct {
+	obj  DRSObject
+	body []byte
+}
+
+// NewMockDRS starts an empty mock DRS server.
+func NewMockDRS() *MockDRS {
+	m := &MockDRS{objects: map[string]mockDRSObject{}}
+	m.Server = httptest.NewTLSServer(m)
+	return m
+}
+
+// Resolver returns a DRSResolver that trusts the server's certificate and
+// knows its token.
+func (m *MockDRS) Resolver() *DRSResolver {
+	return &DRSResolver{HTTPClient: m.Client(), Token: m.Token}
+}
+
+// URI returns the hostname-based drs:// URI of an object ID.
+func (m *MockDRS) URI(id string) string {
+	return "drs://" + strings.TrimPrefix(m.URL, "https://") + "/" + url.PathEscape(id)
+}
+
+// AddObject serves content as a DRS object with a sha-256 checksum, a gs
+// access method the resolver cannot use and an https one behind an
+// access_id, and returns its drs:// URI.
+func (m *MockDRS) AddObject(id string, content []byte, mimeType string) string {
+	sum := sha256.Sum256(content)
+	return m.Put(DRSObject{
+		ID:        id,
+		Size:      int64(len(content)),
+		MimeType:  mimeType,
+		Checksums: []DRSChecksum{{Checksum: hex.EncodeToString(sum[:]), Type: "sha-256"}},
+		AccessMethods: []DRSAccessMethod{
+			{Type: "gs", AccessURL: &DRSAccessURL{URL: "gs://mock-drs/" + id}},
+			{Type: "https", AccessID: "https"},
+		},
+	}, content)
+}
+
+// Put serves obj, as given, with content behind it and returns its drs://
+// URI. Use it for bundles or objects with wrong checksums.
+func (m *MockDRS) Put(obj DRSObject, content []byte) string {
+	obj.SelfURI = m.URI(obj.ID)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[obj.ID] = mockDRSObject{obj: obj, body: content}
+	return obj.SelfURI
+}
+
+// ServeHTTP implements http.Handler.
+func (m *MockDRS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var segs []string
+	for _, seg := range strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/") {
+		s, err := url.PathUnescape(seg)
+		if err != nil {
+			drsError(w, http.StatusBadRequest, "malformed path")
+			return
+		}
+		segs = append(segs, s)
+	}
+	if r.Method != http.MethodGet {
+		drsError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if len(segs) == 2 && segs[0] == "data" {
+		m.mu.Lock()
+		o, ok := m.objects[segs[1]]
+		m.mu.Unlock()
+		if !ok || r.Header.Get("Authorization") != "Bearer data-"+segs[1] {
+			drsError(w, http.StatusForbidden, "access denied")
+			return
+		}
+		w.Write(o.body)
+		return
+	}
+
+	if len(segs) < 5 || strings.Join(segs[:4], "/") != "ga4gh/drs/v1/objects" {
+		drsError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if m.Token != "" && r.Header.Get("Authorization") != "Bearer "+m.Token {
+		drsError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+		return
+	}
+	m.mu.Lock()
+	o, ok := m.objects[segs[4]]
+	m.mu.Unlock()
+	if !ok {
+		drsError(w, http.StatusNotFound, "object "+segs[4]+" not found")
+		return
+	}
+	switch {
+	case len(segs) == 5:
+		drsJSON(w, http.StatusOK, o.obj)
+	case len(segs) == 7 && segs[5] == "access" && segs[6] == "https":
+		drsJSON(w, http.StatusOK, DRSAccessURL{
+			URL:     m.URL + "/data/" + url.PathEscape(o.obj.ID),
+			Headers: []string{"Authorization: Bearer data-" + o.obj.ID},
+		})
+	default:
+		drsError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func drsJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func drsError(w http.ResponseWriter, status int, msg string) {
+	drsJSON(w, status, map[string]interface{}{"msg": msg, "status_code": status})
+}
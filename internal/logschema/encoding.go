@@ -0,0 +1,352 @@
+package logschema
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Content encodings for inline structured_log values, declared in
+// LogSchema.ContentEncoding. Other "<compression>+base64" encodings become
+// available through RegisterCompression.
+const (
+	EncodingIdentity   = "identity"    // the content as is (the default)
+	EncodingBase64     = "base64"      // standard base64 of the content
+	EncodingGzipBase64 = "gzip+base64" // standard base64 of gzip-compressed content
+)
+
+// DefaultMaxDecodedSize bounds the decoded size of an encoded
+// structured_log when no other limit is configured.
+const DefaultMaxDecodedSize = 16 << 20
+
+// ErrContentTooLarge is returned when decoding or fetching a
+// structured_log would exceed the configured size limit, e.g. for a
+// decompression bomb or an endless HTTP response.
+var ErrContentTooLarge = errors.New("structured_log content exceeds the size limit")
+
+// Compression is a compression scheme for "<name>+base64" content
+// encodings. NewWriter may be nil for schemes that are only decoded.
+type Compression struct {
+	NewReader func(io.Reader) (io.ReadCloser, error)
+	NewWriter func(io.Writer) (io.WriteCloser, error)
+}
+
+var (
+	compressionsMu sync.RWMutex
+	compressions   = map[string]Compression{
+		"gzip": {
+			NewReader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+			NewWriter: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriterLevel(w, gzip.BestCompression) },
+		},
+	}
+)
+
+// RegisterCompression makes "<name>+base64" usable as a content encoding,
+// replacing any earlier registration. gzip is built in; until a scheme is
+// registered, "<name>+base64" fails LogSchema.Validate like any other
+// unknown encoding.
+func RegisterCompression(name string, c Compression) {
+	compressionsMu.Lock()
+	defer compressionsMu.Unlock()
+	compressions[name] = c
+}
+
+func compression(name string) (Compression, bool) {
+	compressionsMu.RLock()
+	defer compressionsMu.RUnlock()
+	c, ok := compressions[name]
+	return c, ok
+}
+
+// ContentEncodings lists the content encodings that can currently be
+// decoded, sorted.
+func ContentEncodings() []string {
+	compressionsMu.RLock()
+	defer compressionsMu.RUnlock()
+	out := []string{EncodingIdentity, EncodingBase64}
+	for name := range compressions {
+		out = append(out, name+"+base64")
+	}
+	sort.Strings(out)
+	return out
+}
+
+// parseContentEncoding splits an encoding into its compression scheme
+// (empty for none) and whether the content is base64-wrapped.
+func parseContentEncoding(encoding string) (scheme string, wrapped bool, err error) {
+	switch encoding {
+	case "", EncodingIdentity:
+		return "", false, nil
+	case EncodingBase64:
+		return "", true, nil
+	}
+	scheme, ok := strings.CutSuffix(encoding, "+base64")
+	if !ok || scheme == "" {
+		return "", false, fmt.Errorf("log_schema.content_encoding %q is not a recognised value", encoding)
+	}
+	if _, ok := compression(scheme); !ok {
+		return "", false, fmt.Errorf("log_schema.content_encoding %q is not supported (supported: %s)", encoding, strings.Join(ContentEncodings(), ", "))
+	}
+	return scheme, true, nil
+}
+
+// DecodeContent reverses a content encoding. The decoded content may be at
+// most limit bytes; a limit of zero or less selects DefaultMaxDecodedSize.
+// Whitespace inside base64 is ignored.
+func DecodeContent(content, encoding string, limit int64) ([]byte, error) {
+	scheme, wrapped, err := parseContentEncoding(encoding)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = DefaultMaxDecodedSize
+	}
+	if !wrapped {
+		if int64(len(content)) > limit {
+			return nil, fmt.Errorf("%w of %d bytes", ErrContentTooLarge, limit)
+		}
+		return []byte(content), nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(content), ""))
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid base64: %w", encoding, err)
+	}
+	if scheme == "" {
+		if int64(len(raw)) > limit {
+			return nil, fmt.Errorf("%w of %d bytes", ErrContentTooLarge, limit)
+		}
+		return raw, nil
+	}
+	c, ok := compression(scheme)
+	if !ok || c.NewReader == nil {
+		return nil, fmt.Errorf("%s: no %s decoder is registered (see RegisterCompression)", encoding, scheme)
+	}
+	r, err := c.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", encoding, err)
+	}
+	defer r.Close()
+	out, err := readLimited(r, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", encoding, err)
+	}
+	return out, nil
+}
+
+// readLimited reads r to the end, failing with ErrContentTooLarge once
+// more than limit bytes have been read.
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	out, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(out)) > limit {
+		return nil, fmt.Errorf("%w of %d bytes", ErrContentTooLarge, limit)
+	}
+	return out, nil
+}
+
+// EncodeContent applies a content encoding, for producers of structured
+// logs. Use it together with a LogSchema whose ContentEncoding matches.
+func EncodeContent(content []byte, encoding string) (string, error) {
+	scheme, wrapped, err := parseContentEncoding(encoding)
+	if err != nil {
+		return "", err
+	}
+	if !wrapped {
+		return string(content), nil
+	}
+	if scheme == "" {
+		return base64.StdEncoding.EncodeToString(content), nil
+	}
+	c, ok := compression(scheme)
+	if !ok || c.NewWriter == nil {
+		return "", fmt.Errorf("%s: no %s encoder is registered (see RegisterCompression)", encoding, scheme)
+	}
+	var buf bytes.Buffer
+	w, err := c.NewWriter(&buf)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", encoding, err)
+	}
+	if _, err := w.Write(content); err != nil {
+		return "", fmt.Errorf("%s: %w", encoding, err)
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("%s: %w", encoding, err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// DecodeStructuredLog returns an inline structured_log decoded according
+// to schema's content encoding, with the default size limit, together with
+// a copy of schema that declares no encoding. Content that is a URI, or
+// has no encoding, is returned unchanged.
+func DecodeStructuredLog(content string, schema *LogSchema) (string, *LogSchema, error) {
+	return (*Validator)(nil).decodeLog(content, schema)
+}
+
+// maxDecodedSize returns the Validator's limit; it is nil-safe.
+func (v *Validator) maxDecodedSize() int64 {
+	if v == nil {
+		return 0
+	}
+	return v.MaxDecodedSize
+}
+
+// maxFetchSize returns the limit on content read from a URI:
+// MaxDecodedSize, or DefaultMaxDecodedSize when it is not set.
+func (v *Validator) maxFetchSize() int64 {
+	if n := v.maxDecodedSize(); n > 0 {
+		return n
+	}
+	return DefaultMaxDecodedSize
+}
+
+// decodeLog is DecodeStructuredLog with the Validator's size limit.
+func (v *Validator) decodeLog(content string, schema *LogSchema) (string, *LogSchema, error) {
+	if schema == nil || !isEncoded(schema) || isLogURI(content) {
+		return content, schema, nil
+	}
+	out, err := DecodeContent(content, schema.ContentEncoding, v.maxDecodedSize())
+	if err != nil {
+		return "", nil, err
+	}
+	return string(out), decodedSchema(schema), nil
+}
+
+// decodedSchema returns schema without its content encoding, which
+// describes transport rather than the log itself.
+func decodedSchema(schema *LogSchema) *LogSchema {
+	if !isEncoded(schema) {
+		return schema
+	}
+	plain := *schema
+	plain.ContentEncoding = ""
+	return &plain
+}
+
+// isEncoded reports whether schema declares a content encoding other than
+// identity.
+func isEncoded(schema *LogSchema) bool {
+	return schema != nil && schema.ContentEncoding != "" && schema.ContentEncoding != EncodingIdentity
+}
+
+// EncodeStructuredLogs encodes every inline structured_log of at least
+// minSize bytes that is not encoded yet, declaring the encoding on its
+// log_schema. Schemas are copied, never modified, and log_schema
+// declarations are adjusted so that no log inherits an encoding that does
+// not apply to it. Logs without a schema cannot declare an encoding and
+// are skipped. Digests and signatures cover the decoded content and stay
+// valid. It returns the locations encoded and, for the others, why they
+// were skipped.
+func EncodeStructuredLogs(rl *RunLog, tasks []TaskLog, encoding string, minSize int) (encoded, skipped []string) {
+	if _, _, err := parseContentEncoding(encoding); err != nil {
+		return nil, []string{err.Error()}
+	}
+	skipped = transcodeRun(rl, tasks, func(pos logPosition, content *string, schema *LogSchema) (string, error) {
+		if isEncoded(schema) || len(*content) < minSize {
+			return schemaEncoding(schema), nil
+		}
+		if schema == nil {
+			return "", fmt.Errorf("%s: no log_schema to declare the content_encoding on", pos.location)
+		}
+		out, err := EncodeContent([]byte(*content), encoding)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", pos.location, err)
+		}
+		*content = out
+		encoded = append(encoded, pos.location)
+		return encoding, nil
+	})
+	return encoded, skipped
+}
+
+// DecodeStructuredLogs decodes every encoded inline structured_log,
+// using v's size limit (v may be nil), and declares it unencoded. It
+// returns the locations decoded and, for the others, why they were
+// skipped.
+func DecodeStructuredLogs(v *Validator, rl *RunLog, tasks []TaskLog) (decoded, skipped []string) {
+	skipped = transcodeRun(rl, tasks, func(pos logPosition, content *string, schema *LogSchema) (string, error) {
+		if !isEncoded(schema) {
+			return schemaEncoding(schema), nil
+		}
+		out, _, err := v.decodeLog(*content, schema)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", pos.location, err)
+		}
+		*content = out
+		decoded = append(decoded, pos.location)
+		return "", nil
+	})
+	return decoded, skipped
+}
+
+func schemaEncoding(schema *LogSchema) string {
+	if !isEncoded(schema) {
+		return ""
+	}
+	return schema.ContentEncoding
+}
+
+// logPosition identifies one structured_log of a run.
+type logPosition struct {
+	location string // as reported, e.g. "task bwa attempt 0"
+	task     string // task ID, name or index; empty for the run
+	attempt  int    // attempt index, or -1 for a run or task log
+}
+
+// transcodeRun calls fn for every inline structured_log with its effective
+// schema. fn rewrites the content and returns the encoding that now
+// applies to it; transcodeRun then fixes up log_schema declarations like
+// ConvertRun does. Errors from fn are collected in skipped and leave the
+// log unchanged.
+func transcodeRun(rl *RunLog, tasks []TaskLog, fn func(pos logPosition, content *string, schema *LogSchema) (string, error)) (skipped []string) {
+	level := func(pos logPosition, content *string, declared **LogSchema, oldParent, newParent *LogSchema) (oldEff, newEff *LogSchema) {
+		oldEff = *declared
+		if oldEff == nil {
+			oldEff = oldParent
+		}
+		newEff = oldEff
+		if *content == "" || isLogURI(*content) {
+			if *declared == nil {
+				newEff = newParent
+			}
+		} else if enc, err := fn(pos, content, oldEff); err != nil {
+			skipped = append(skipped, err.Error())
+		} else if enc != schemaEncoding(oldEff) {
+			s := *oldEff
+			s.ContentEncoding = enc
+			newEff = &s
+		}
+		if !sameSchema(newEff, oldEff) || !sameSchema(oldParent, newParent) {
+			*declared = newEff
+			if sameSchema(newEff, newParent) {
+				*declared = nil
+			}
+		}
+		return oldEff, newEff
+	}
+
+	var oldRun, newRun *LogSchema
+	if rl != nil {
+		oldRun, newRun = level(logPosition{"run", "", -1}, &rl.StructuredLog, &rl.LogSchema, nil, nil)
+	}
+	for i := range tasks {
+		tl := &tasks[i]
+		task := logPosition{taskLocation(tl, i), taskKey(tl, i), -1}
+		oldTask, newTask := level(task, &tl.StructuredLog, &tl.LogSchema, oldRun, newRun)
+		for j := range tl.Logs {
+			a := &tl.Logs[j]
+			attempt := logPosition{fmt.Sprintf("%s attempt %d", task.location, j), task.task, j}
+			level(attempt, &a.StructuredLog, &a.LogSchema, oldTask, newTask)
+		}
+	}
+	return skipped
+}
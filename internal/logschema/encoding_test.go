@@ -0,0 +1,202 @@
+package logschema_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+func TestEncodeContent_RoundTrip(t *testing.T) {
+	content := []byte(strings.Repeat(`{"event": "start"}`+"\n", 100))
+	for _, enc := range []string{logschema.EncodingIdentity, logschema.EncodingBase64, logschema.EncodingGzipBase64} {
+		t.Run(enc, func(t *testing.T) {
+			encoded, err := logschema.EncodeContent(content, enc)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if enc != logschema.EncodingIdentity {
+				// Line-wrapped base64 is accepted too.
+				encoded = strings.Join(chunk(encoded, 76), "\n")
+			}
+			decoded, err := logschema.DecodeContent(encoded, enc, 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !bytes.Equal(decoded, content) {
+				t.Errorf("round trip changed the content")
+			}
+		})
+	}
+}
+
+func TestDecodeContent_Errors(t *testing.T) {
+	var bomb bytes.Buffer
+	zw := gzip.NewWriter(&bomb)
+	zw.Write(make([]byte, 1<<20))
+	zw.Close()
+
+	tests := []struct {
+		name     string
+		content  string
+		encoding string
+		limit    int64
+		tooLarge bool
+	}{
+		{"decompression bomb", base64.StdEncoding.EncodeToString(bomb.Bytes()), logschema.EncodingGzipBase64, 4096, true},
+		{"base64 over limit", base64.StdEncoding.EncodeToString(make([]byte, 100)), logschema.EncodingBase64, 10, true},
+		{"invalid base64", "not base64!", logschema.EncodingBase64, 0, false},
+		{"not gzip", base64.StdEncoding.EncodeToString([]byte("plain")), logschema.EncodingGzipBase64, 0, false},
+		{"unknown encoding", "x", "brotli+base64", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := logschema.DecodeContent(tt.content, tt.encoding, tt.limit)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if got := errors.Is(err, logschema.ErrContentTooLarge); got != tt.tooLarge {
+				t.Errorf("errors.Is(%v, ErrContentTooLarge) = %t", err, got)
+			}
+		})
+	}
+}
+
+func TestValidator_ContentEncoding(t *testing.T) {
+	plain := logschema.ROCrateLogSchema()
+	content := variantCallingCrate()
+	rl := &logschema.RunLog{}
+	if err := content.ApplyTo(rl); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	digest, err := logschema.ComputeDigest([]byte(rl.StructuredLog), plain, "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	encoded, err := logschema.EncodeContent([]byte(rl.StructuredLog), logschema.EncodingGzipBase64)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	schema := *plain
+	schema.ContentEncoding = logschema.EncodingGzipBase64
+
+	tests := []struct {
+		name    string
+		v       *logschema.Validator
+		content string
+		schema  logschema.LogSchema
+		stage   string
+	}{
+		{"decoded before validation", &logschema.Validator{}, encoded, schema, ""},
+		{"over the size limit", &logschema.Validator{MaxDecodedSize: 64}, encoded, schema, logschema.StageEncoding},
+		{"not encoded as declared", &logschema.Validator{}, rl.StructuredLog, schema, logschema.StageEncoding},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := tt.v.ValidateRunLog(&logschema.RunLog{StructuredLog: tt.content, LogSchema: &tt.schema, StructuredLogDigest: digest})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if res.Stage != tt.stage {
+				t.Errorf("Stage = %q, want %q (%v)", res.Stage, tt.stage, res.Errors)
+			}
+		})
+	}
+
+	for _, enc := range []string{"lz4", "lz4+base64"} {
+		bad := schema
+		bad.ContentEncoding = enc
+		if err := bad.Validate(); err == nil {
+			t.Errorf("LogSchema.Validate accepted %q without a decoder", enc)
+		}
+	}
+}
+
+func TestRegisterCompression(t *testing.T) {
+	schema := logschema.LogSchema{SchemaURI: "https://example.org/log.json", Format: logschema.FormatCustom, ContentEncoding: "stored+base64"}
+	if err := schema.Validate(); err == nil {
+		t.Fatal("LogSchema.Validate accepted an unregistered compression")
+	}
+	logschema.RegisterCompression("stored", logschema.Compression{
+		NewReader: func(r io.Reader) (io.ReadCloser, error) { return io.NopCloser(r), nil },
+	})
+	if err := schema.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	got, err := logschema.DecodeContent(base64.StdEncoding.EncodeToString([]byte("{}")), schema.ContentEncoding, 0)
+	if err != nil || string(got) != "{}" {
+		t.Errorf("DecodeContent = %q, %v", got, err)
+	}
+}
+
+func TestEncodeStructuredLogs(t *testing.T) {
+	rl := &logschema.RunLog{}
+	if err := variantCallingCrate().ApplyTo(rl); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	original := rl.StructuredLog
+	tasks := []logschema.TaskLog{
+		{ID: "bwa", StructuredLog: `{"@context": "https://w3id.org/ro/crate/1.1/context", "@graph": []}`},
+		{ID: "gatk", StructuredLog: "https://example.org/gatk.json"},
+		{ID: "tabix", Logs: []logschema.Log{{
+			StructuredLog: strings.Repeat("{\"event\":\"start\"}\n", 20),
+			LogSchema:     &logschema.LogSchema{SchemaURI: "https://example.org/events", Format: logschema.FormatCustom, MediaType: "application/x-ndjson"},
+		}}},
+	}
+	recorded, _ := logschema.RecordDigests(nil, rl, tasks[:1], "", "")
+	if len(recorded) != 2 {
+		t.Fatalf("recorded = %q", recorded)
+	}
+
+	encoded, skipped := logschema.EncodeStructuredLogs(rl, tasks, logschema.EncodingGzipBase64, 200)
+	if got := strings.Join(encoded, ","); got != "run,task tabix attempt 0" {
+		t.Errorf("encoded = %q", got)
+	}
+	if len(skipped) != 0 {
+		t.Errorf("skipped = %q", skipped)
+	}
+	if rl.LogSchema.ContentEncoding != logschema.EncodingGzipBase64 {
+		t.Errorf("run log_schema = %+v", rl.LogSchema)
+	}
+	// The small task log no longer inherits the run's schema unchanged.
+	if s := tasks[0].LogSchema; s == nil || s.ContentEncoding != "" || s.Format != logschema.FormatROCrate {
+		t.Errorf("task bwa log_schema = %+v", s)
+	}
+	if tasks[1].LogSchema != nil {
+		t.Errorf("task gatk log_schema = %+v", tasks[1].LogSchema)
+	}
+
+	tasks[1].StructuredLog = ""
+	res, err := (&logschema.Validator{}).ValidateRun(rl, tasks)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !res.Valid() {
+		t.Errorf("encoded run does not validate: %+v %+v %+v", res.Run, res.Tasks, res.Attempts)
+	}
+
+	decoded, skipped := logschema.DecodeStructuredLogs(nil, rl, tasks)
+	if strings.Join(decoded, ",") != "run,task tabix attempt 0" || len(skipped) != 0 {
+		t.Errorf("decoded = %q, skipped = %q", decoded, skipped)
+	}
+	if rl.StructuredLog != original || rl.LogSchema.ContentEncoding != "" {
+		t.Errorf("decoding did not restore the run log")
+	}
+	if tasks[0].LogSchema != nil {
+		t.Errorf("task bwa log_schema not folded back into the run's: %+v", tasks[0].LogSchema)
+	}
+}
+
+func chunk(s string, n int) []string {
+	var out []string
+	for len(s) > n {
+		out = append(out, s[:n])
+		s = s[n:]
+	}
+	return append(out, s)
+}
@@ -0,0 +1,49 @@
+package logschema
+
+import (
+	"fmt"
+	"time"
+)
+
+// setImportedLog stores crate as the run-level structured_log of an
+// imported run: as RO-Crate, or for FormatOPM as PROV converted from it.
+func setImportedLog(rl *RunLog, crate *Crate, to Format) error {
+	content, err := crate.Marshal()
+	if err != nil {
+		return err
+	}
+	switch to {
+	case FormatROCrate, "":
+		if err := validateROCrate(content); err != nil {
+			return fmt.Errorf("imported RO-Crate: %w", err)
+		}
+		rl.StructuredLog, rl.LogSchema = content, ROCrateLogSchema()
+	case FormatOPM:
+		out, schema, _, err := ConvertStructuredLog(content, ROCrateLogSchema(), FormatOPM)
+		if err != nil {
+			return err
+		}
+		rl.StructuredLog, rl.LogSchema = out, schema
+	default:
+		return fmt.Errorf("%w: imported runs can be %s or %s, not %s", ErrUnsupportedConversion, FormatROCrate, FormatOPM, to)
+	}
+	rl.StructuredLogDigest, rl.StructuredLogSignatures = nil, nil
+	return nil
+}
+
+// spanTimes returns the earliest start and latest end of RFC 3339 times,
+// ignoring empty and unparseable ones.
+func spanTimes(starts, ends []string) (start, end string) {
+	var s, e time.Time
+	for _, v := range starts {
+		if t, err := time.Parse(time.RFC3339, v); err == nil && (s.IsZero() || t.Before(s)) {
+			s, start = t, v
+		}
+	}
+	for _, v := range ends {
+		if t, err := time.Parse(time.RFC3339, v); err == nil && (e.IsZero() || t.After(e)) {
+			e, end = t, v
+		}
+	}
+	return start, end
+}
@@ -0,0 +1,629 @@
+package logschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ContextLoader fetches a remote JSON-LD context document by URI.
+type ContextLoader func(uri string) ([]byte, error)
+
+// JSONLDBase is the base IRI against which relative @id values are
+// resolved when a structured_log is converted to RDF, the "base" option of
+// the JSON-LD toRdf algorithm. RO-Crate identifiers such as "./" and
+// "#run-001" are relative to the crate root, which has no URL of its own
+// in a WES response; a JSON-LD processor reproduces the canonical form of
+// a crate when given the same base.
+const JSONLDBase = ProvCrateNamespace
+
+// jsonldContext is an active context of the JSON-LD subset handled by
+// jsonldToRDF.
+type jsonldContext struct {
+	vocab string
+	base  string
+	terms map[string]jsonldTerm
+}
+
+// jsonldTerm is a term definition: its IRI (empty for a term defined as
+// null), optional type coercion ("@id", "@vocab" or a datatype IRI) and
+// whether it may be used as the prefix of a compact IRI.
+type jsonldTerm struct {
+	id     string
+	typ    string
+	prefix bool
+}
+
+func (ctx *jsonldContext) clone() *jsonldContext {
+	c := &jsonldContext{vocab: ctx.vocab, base: ctx.base, terms: make(map[string]jsonldTerm, len(ctx.terms))}
+	for k, v := range ctx.terms {
+		c.terms[k] = v
+	}
+	return c
+}
+
+// jsonldToRDF converts a JSON-LD document (decoded with UseNumber) to RDF
+// quads following the JSON-LD 1.1 expansion and toRdf algorithms, with
+// JSONLDBase as the base IRI. It covers the single-graph documents that
+// RO-Crate and other structured logs use: term, prefix, @vocab and @base
+// definitions, keyword aliases, type coercion to @id, @vocab and
+// datatypes, @type, @value with @type or @language, nested node objects
+// and arrays. Contexts, including the RO-Crate ones, are fetched with
+// load. Terms the context does not define are dropped and statements with
+// relative IRIs are left out, as a JSON-LD processor does. @list,
+// @reverse, named graphs, scoped contexts and the other features outside
+// the subset fail with an error rather than producing a different dataset.
+func jsonldToRDF(doc interface{}, load ContextLoader) ([]rdfQuad, error) {
+	top, ok := doc.(map[string]interface{})
+	if !ok {
+		if _, isList := doc.([]interface{}); isList {
+			return nil, fmt.Errorf("not JSON-LD: top-level arrays need a @context on each node, which is not supported")
+		}
+		return nil, fmt.Errorf("not JSON-LD: expected an object")
+	}
+	if _, ok := top["@context"]; !ok {
+		return nil, fmt.Errorf("not JSON-LD: no @context")
+	}
+	conv := &rdfConverter{load: load, blanks: newIDIssuer("b"), seen: map[string]bool{}}
+	ctx, err := conv.context(&jsonldContext{base: JSONLDBase, terms: map[string]jsonldTerm{}}, top["@context"], 0)
+	if err != nil {
+		return nil, err
+	}
+	var graph interface{}
+	hasGraph := false
+	for k, v := range top {
+		if ctx.keyword(k) == "@graph" {
+			graph, hasGraph = v, true
+		}
+	}
+	if !hasGraph {
+		if _, err := conv.node(ctx, top); err != nil {
+			return nil, err
+		}
+		return conv.quads, nil
+	}
+	for k := range top {
+		if kw := ctx.keyword(k); kw != "@context" && kw != "@graph" {
+			return nil, fmt.Errorf("unsupported JSON-LD: named graph (%q next to @graph)", k)
+		}
+	}
+	for i, n := range asList(graph) {
+		obj, ok := n.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("@graph[%d] is not a node object", i)
+		}
+		if _, err := conv.node(ctx, obj); err != nil {
+			return nil, fmt.Errorf("@graph[%d]: %w", i, err)
+		}
+	}
+	return conv.quads, nil
+}
+
+// rdfConverter accumulates the quads of one document. An RDF dataset is a
+// set, so a statement made twice, e.g. by two copies of an entity, is
+// kept once.
+type rdfConverter struct {
+	load   ContextLoader
+	blanks *idIssuer
+	quads  []rdfQuad
+	seen   map[string]bool
+}
+
+// emit adds a quad unless it repeats an earlier one or has an IRI that is
+// not absolute, which toRdf skips.
+func (conv *rdfConverter) emit(q rdfQuad) {
+	for _, t := range []rdfTerm{q.s, q.p, q.o} {
+		if t.kind == rdfIRI && !isAbsoluteIRI(t.value) {
+			return
+		}
+	}
+	if key := q.nquad(nil); !conv.seen[key] {
+		conv.seen[key] = true
+		conv.quads = append(conv.quads, q)
+	}
+}
+
+const maxContextDepth = 8
+
+// context applies a local context (a URI, object, array or null) to ctx.
+func (conv *rdfConverter) context(ctx *jsonldContext, local interface{}, depth int) (*jsonldContext, error) {
+	if depth > maxContextDepth {
+		return nil, fmt.Errorf("JSON-LD contexts nested more than %d deep", maxContextDepth)
+	}
+	switch c := local.(type) {
+	case nil:
+		return &jsonldContext{base: JSONLDBase, terms: map[string]jsonldTerm{}}, nil
+	case []interface{}:
+		for _, e := range c {
+			var err error
+			if ctx, err = conv.context(ctx, e, depth); err != nil {
+				return nil, err
+			}
+		}
+		return ctx, nil
+	case string:
+		if conv.load == nil {
+			return nil, fmt.Errorf("remote JSON-LD context %q cannot be loaded", c)
+		}
+		body, err := conv.load(c)
+		if err != nil {
+			return nil, fmt.Errorf("loading JSON-LD context %q: %w", c, err)
+		}
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		var remote map[string]interface{}
+		if err := dec.Decode(&remote); err != nil {
+			return nil, fmt.Errorf("JSON-LD context %q is not a JSON object: %w", c, err)
+		}
+		inner, ok := remote["@context"]
+		if !ok {
+			return nil, fmt.Errorf("JSON-LD context %q has no @context", c)
+		}
+		return conv.context(ctx, inner, depth+1)
+	case map[string]interface{}:
+		return contextObject(ctx, c)
+	}
+	return nil, fmt.Errorf("invalid @context of type %T", local)
+}
+
+// contextObject applies an inline context definition to ctx.
+func contextObject(ctx *jsonldContext, c map[string]interface{}) (*jsonldContext, error) {
+	out := ctx.clone()
+	if v, ok := c["@base"]; ok {
+		switch s := v.(type) {
+		case nil:
+			out.base = ""
+		case string:
+			out.base = out.resolve(s)
+		default:
+			return nil, fmt.Errorf("invalid @base")
+		}
+	}
+	if v, ok := c["@vocab"]; ok {
+		switch s := v.(type) {
+		case nil:
+			out.vocab = ""
+		case string:
+			iri, err := out.expandIRI(s, true, true, nil, nil)
+			if err != nil {
+				return nil, err
+			}
+			out.vocab = iri
+		default:
+			return nil, fmt.Errorf("invalid @vocab")
+		}
+	}
+	defined := map[string]bool{}
+	for _, term := range sortedKeys(c) {
+		switch term {
+		case "@base", "@vocab", "@version", "@protected":
+			continue
+		}
+		if strings.HasPrefix(term, "@") {
+			return nil, fmt.Errorf("unsupported JSON-LD context keyword %q", term)
+		}
+		if err := out.define(c, term, defined); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// define creates the definition of term from the local context c, first
+// defining the terms it depends on, as the JSON-LD "create term
+// definition" algorithm does. defined tracks terms in progress (false) and
+// done (true) to detect cycles.
+func (ctx *jsonldContext) define(c map[string]interface{}, term string, defined map[string]bool) error {
+	if done, ok := defined[term]; ok {
+		if !done {
+			return fmt.Errorf("cyclic JSON-LD term definition %q", term)
+		}
+		return nil
+	}
+	defined[term] = false
+	def := jsonldTerm{}
+	var spec map[string]interface{}
+	simple := false
+	switch d := c[term].(type) {
+	case nil:
+		ctx.terms[term] = def // explicitly unmapped, even with @vocab
+		defined[term] = true
+		return nil
+	case string:
+		spec, simple = map[string]interface{}{"@id": d}, true
+	case map[string]interface{}:
+		spec = d
+	default:
+		return fmt.Errorf("invalid definition of term %q", term)
+	}
+	for _, k := range sortedKeys(spec) {
+		switch k {
+		case "@id", "@type", "@container", "@prefix", "@protected":
+		default:
+			return fmt.Errorf("unsupported JSON-LD term definition key %q on term %q", k, term)
+		}
+	}
+
+	if v, ok := spec["@id"]; ok {
+		switch s := v.(type) {
+		case nil:
+			ctx.terms[term] = def
+			defined[term] = true
+			return nil
+		case string:
+			iri, err := ctx.expandIRI(s, true, false, c, defined)
+			if err != nil {
+				return err
+			}
+			def.id = iri
+		default:
+			return fmt.Errorf("invalid @id on term %q", term)
+		}
+	} else if prefix, suffix, ok := strings.Cut(term, ":"); ok && prefix != "" {
+		if _, local := c[prefix]; local {
+			if err := ctx.define(c, prefix, defined); err != nil {
+				return err
+			}
+		}
+		def.id = term
+		if p, ok := ctx.terms[prefix]; ok && p.prefix {
+			def.id = p.id + suffix
+		}
+	} else if ctx.vocab != "" {
+		def.id = ctx.vocab + term
+	} else {
+		return fmt.Errorf("JSON-LD term %q has no IRI mapping", term)
+	}
+	switch {
+	case !strings.HasPrefix(def.id, "@"):
+	case def.id == "@id", def.id == "@type", def.id == "@value", def.id == "@language", def.id == "@graph":
+	default:
+		return fmt.Errorf("unsupported JSON-LD keyword alias %q for %q", def.id, term)
+	}
+
+	if v, ok := spec["@type"]; ok {
+		s, _ := v.(string)
+		switch s {
+		case "@id", "@vocab":
+			def.typ = s
+		case "":
+			return fmt.Errorf("invalid @type on term %q", term)
+		default:
+			iri, err := ctx.expandIRI(s, true, false, c, defined)
+			if err != nil {
+				return err
+			}
+			if !isAbsoluteIRI(iri) {
+				return fmt.Errorf("unsupported JSON-LD type mapping %q on term %q", s, term)
+			}
+			def.typ = iri
+		}
+	}
+	if v, ok := spec["@container"]; ok {
+		if l, isList := v.([]interface{}); isList && len(l) == 1 {
+			v = l[0]
+		}
+		if v != "@set" {
+			return fmt.Errorf("unsupported JSON-LD container %v on term %q", v, term)
+		}
+	}
+	if v, ok := spec["@prefix"]; ok {
+		b, isBool := v.(bool)
+		if !isBool {
+			return fmt.Errorf("invalid @prefix on term %q", term)
+		}
+		def.prefix = b
+	} else if simple && !strings.ContainsAny(term, ":/") && def.id != "" {
+		def.prefix = strings.ContainsAny(def.id[len(def.id)-1:], ":/?#[]@")
+	}
+	ctx.terms[term] = def
+	defined[term] = true
+	return nil
+}
+
+// expandIRI is the JSON-LD IRI expansion algorithm. vocab expands terms
+// and vocabulary-relative IRIs, as for property names and @type values;
+// docRelative resolves against the base, as for @id values. Terms of the
+// local context c that are used before being defined are defined first.
+// A term defined as null expands to "".
+func (ctx *jsonldContext) expandIRI(s string, vocab, docRelative bool, c map[string]interface{}, defined map[string]bool) (string, error) {
+	if strings.HasPrefix(s, "@") {
+		return s, nil
+	}
+	if c != nil {
+		if _, ok := c[s]; ok {
+			if err := ctx.define(c, s, defined); err != nil {
+				return "", err
+			}
+		}
+	}
+	if t, ok := ctx.terms[s]; ok && vocab {
+		return t.id, nil
+	}
+	if prefix, suffix, ok := strings.Cut(s, ":"); ok && prefix != "" {
+		if prefix == "_" || strings.HasPrefix(suffix, "//") {
+			return s, nil
+		}
+		if c != nil {
+			if _, ok := c[prefix]; ok {
+				if err := ctx.define(c, prefix, defined); err != nil {
+					return "", err
+				}
+			}
+		}
+		if t, ok := ctx.terms[prefix]; ok && t.prefix {
+			return t.id + suffix, nil
+		}
+		if isAbsoluteIRI(s) {
+			return s, nil
+		}
+	}
+	if vocab && ctx.vocab != "" {
+		return ctx.vocab + s, nil
+	}
+	if docRelative {
+		return ctx.resolve(s), nil
+	}
+	return s, nil
+}
+
+// expand is expandIRI outside context processing, where it cannot fail.
+func (ctx *jsonldContext) expand(s string, vocab, docRelative bool) string {
+	iri, _ := ctx.expandIRI(s, vocab, docRelative, nil, nil)
+	return iri
+}
+
+// keyword returns the keyword key stands for, directly or through an
+// alias, or "".
+func (ctx *jsonldContext) keyword(key string) string {
+	if strings.HasPrefix(key, "@") {
+		return key
+	}
+	if t, ok := ctx.terms[key]; ok && strings.HasPrefix(t.id, "@") {
+		return t.id
+	}
+	return ""
+}
+
+// isAbsoluteIRI reports whether s starts with an IRI scheme.
+func isAbsoluteIRI(s string) bool {
+	scheme, _, ok := strings.Cut(s, ":")
+	if !ok || scheme == "" {
+		return false
+	}
+	for i, r := range scheme {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case i > 0 && (r >= '0' && r <= '9' || r == '+' || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (ctx *jsonldContext) resolve(ref string) string {
+	if ctx.base == "" {
+		return ref
+	}
+	base, err := url.Parse(ctx.base)
+	if err != nil {
+		return ref
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return ctx.base + ref
+	}
+	return base.ResolveReference(r).String()
+}
+
+// subject turns an expanded @id into an IRI or blank node term.
+func (conv *rdfConverter) subject(iri string) rdfTerm {
+	if label, ok := strings.CutPrefix(iri, "_:"); ok {
+		return rdfTerm{kind: rdfBlank, value: conv.blanks.issue("_:" + label)}
+	}
+	return rdfTerm{kind: rdfIRI, value: iri}
+}
+
+// node emits the quads of a node object and returns its subject.
+func (conv *rdfConverter) node(ctx *jsonldContext, obj map[string]interface{}) (rdfTerm, error) {
+	if local, ok := obj["@context"]; ok {
+		var err error
+		if ctx, err = conv.context(ctx, local, 0); err != nil {
+			return rdfTerm{}, err
+		}
+	}
+	var subj rdfTerm
+	hasID := false
+	for key, id := range obj {
+		if ctx.keyword(key) != "@id" {
+			continue
+		}
+		s, ok := id.(string)
+		if !ok {
+			return rdfTerm{}, fmt.Errorf("@id must be a string")
+		}
+		subj, hasID = conv.subject(ctx.expand(s, false, true)), true
+	}
+	if !hasID {
+		subj = rdfTerm{kind: rdfBlank, value: conv.blanks.issue(fmt.Sprintf("anonymous %d", len(conv.blanks.order)))}
+	}
+
+	for _, key := range sortedKeys(obj) {
+		val := obj[key]
+		switch ctx.keyword(key) {
+		case "@context", "@id":
+			continue
+		case "@type":
+			for _, t := range asList(val) {
+				s, ok := t.(string)
+				if !ok {
+					return rdfTerm{}, fmt.Errorf("@type must be a string")
+				}
+				conv.emit(rdfQuad{s: subj, p: rdfTerm{kind: rdfIRI, value: rdfType}, o: conv.subject(ctx.expand(s, true, true))})
+			}
+			continue
+		case "":
+		default:
+			return rdfTerm{}, fmt.Errorf("unsupported JSON-LD keyword %q", key)
+		}
+		pred := ctx.expand(key, true, false)
+		if !isAbsoluteIRI(pred) || strings.HasPrefix(pred, "_:") {
+			continue // not mapped to an IRI by the context: JSON-LD drops it
+		}
+		term := ctx.terms[key]
+		for _, v := range flatten(val) {
+			obj, ok, err := conv.value(ctx, term.typ, v)
+			if err != nil {
+				return rdfTerm{}, fmt.Errorf("%s: %w", key, err)
+			}
+			if ok {
+				conv.emit(rdfQuad{s: subj, p: rdfTerm{kind: rdfIRI, value: pred}, o: obj})
+			}
+		}
+	}
+	return subj, nil
+}
+
+// value converts one property value to an RDF term, with coerce the type
+// mapping of its term. ok is false for null.
+func (conv *rdfConverter) value(ctx *jsonldContext, coerce string, v interface{}) (rdfTerm, bool, error) {
+	datatype := coerce
+	if coerce == "@id" || coerce == "@vocab" {
+		datatype = ""
+	}
+	switch x := v.(type) {
+	case nil:
+		return rdfTerm{}, false, nil
+	case string:
+		switch coerce {
+		case "@id":
+			return conv.subject(ctx.expand(x, false, true)), true, nil
+		case "@vocab":
+			return conv.subject(ctx.expand(x, true, true)), true, nil
+		case "":
+			return rdfTerm{kind: rdfLiteral, value: x, datatype: xsdString}, true, nil
+		}
+		return rdfTerm{kind: rdfLiteral, value: x, datatype: datatype}, true, nil
+	case bool:
+		if datatype == "" {
+			datatype = xsdBoolean
+		}
+		return rdfTerm{kind: rdfLiteral, value: strconv.FormatBool(x), datatype: datatype}, true, nil
+	case json.Number:
+		t, err := numberLiteral(x, datatype)
+		return t, err == nil, err
+	case map[string]interface{}:
+		kws := map[string]interface{}{}
+		for k, e := range x {
+			if kw := ctx.keyword(k); kw != "" {
+				kws[kw] = e
+			}
+		}
+		if val, ok := kws["@value"]; ok {
+			return literalObject(ctx, x, kws, val)
+		}
+		for _, kw := range []string{"@list", "@set", "@graph", "@reverse"} {
+			if _, ok := kws[kw]; ok {
+				return rdfTerm{}, false, fmt.Errorf("unsupported JSON-LD %s object", kw)
+			}
+		}
+		t, err := conv.node(ctx, x)
+		return t, err == nil, err
+	}
+	return rdfTerm{}, false, fmt.Errorf("unexpected value of type %T", v)
+}
+
+// literalObject converts a value object ({"@value": ...}) whose keyword
+// entries, aliases resolved, are kws.
+func literalObject(ctx *jsonldContext, obj, kws map[string]interface{}, val interface{}) (rdfTerm, bool, error) {
+	if len(kws) != len(obj) {
+		return rdfTerm{}, false, fmt.Errorf("value object with non-keyword keys")
+	}
+	for k := range kws {
+		switch k {
+		case "@value", "@type", "@language":
+		default:
+			return rdfTerm{}, false, fmt.Errorf("unsupported key %q in value object", k)
+		}
+	}
+	dt, _ := kws["@type"].(string)
+	if dt != "" {
+		if dt == "@json" {
+			return rdfTerm{}, false, fmt.Errorf("unsupported JSON-LD @json literal")
+		}
+		if dt = ctx.expand(dt, true, true); !isAbsoluteIRI(dt) {
+			return rdfTerm{}, false, fmt.Errorf("invalid typed value: datatype %q is not an absolute IRI", kws["@type"])
+		}
+	}
+	switch x := val.(type) {
+	case nil:
+		return rdfTerm{}, false, nil
+	case string:
+		if lang, _ := kws["@language"].(string); lang != "" {
+			return rdfTerm{kind: rdfLiteral, value: x, datatype: rdfLangStr, language: strings.ToLower(lang)}, true, nil
+		}
+		if dt == "" {
+			dt = xsdString
+		}
+		return rdfTerm{kind: rdfLiteral, value: x, datatype: dt}, true, nil
+	case bool:
+		if dt == "" {
+			dt = xsdBoolean
+		}
+		return rdfTerm{kind: rdfLiteral, value: strconv.FormatBool(x), datatype: dt}, true, nil
+	case json.Number:
+		t, err := numberLiteral(x, dt)
+		return t, err == nil, err
+	}
+	return rdfTerm{}, false, fmt.Errorf("@value must be a string, number or boolean")
+}
+
+// numberLiteral converts a JSON number to an xsd:integer or xsd:double
+// literal in JSON-LD's canonical lexical form (e.g. "5", "1.5E0").
+func numberLiteral(n json.Number, dt string) (rdfTerm, error) {
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil {
+		return rdfTerm{}, fmt.Errorf("number %s cannot be represented as an IEEE 754 double", n)
+	}
+	if isIntegral(f) && dt != xsdDouble {
+		if dt == "" {
+			dt = xsdInteger
+		}
+		return rdfTerm{kind: rdfLiteral, value: strconv.FormatFloat(f, 'f', -1, 64), datatype: dt}, nil
+	}
+	if dt == "" {
+		dt = xsdDouble
+	}
+	mant, exp, _ := strings.Cut(strconv.FormatFloat(f, 'e', -1, 64), "e")
+	if !strings.Contains(mant, ".") {
+		mant += ".0"
+	}
+	e, _ := strconv.Atoi(exp)
+	return rdfTerm{kind: rdfLiteral, value: mant + "E" + strconv.Itoa(e), datatype: dt}, nil
+}
+
+// asList returns v as a list, wrapping single values.
+func asList(v interface{}) []interface{} {
+	if l, ok := v.([]interface{}); ok {
+		return l
+	}
+	return []interface{}{v}
+}
+
+// flatten returns the values of v, flattening nested arrays as JSON-LD
+// expansion does.
+func flatten(v interface{}) []interface{} {
+	l, ok := v.([]interface{})
+	if !ok {
+		return []interface{}{v}
+	}
+	var out []interface{}
+	for _, e := range l {
+		out = append(out, flatten(e)...)
+	}
+	return out
+}
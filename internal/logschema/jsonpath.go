@@ -0,0 +1,373 @@
+package logschema
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// JSONPath is a compiled JSONPath expression. The supported subset is:
+//
+//	$            the document root
+//	.name        child (also ['name'] or ["name"]; names may start with @)
+//	.* [*]       every child of an object or array
+//	..name ..*   recursive descent
+//	[n]          array index, negative from the end
+//	[?(@.p)]     children with property p
+//	[?(@.p op v)] children whose p compares to a literal with ==, !=, <,
+//	             <=, > or >=; when p is an array, any element may match
+type JSONPath struct {
+	expr  string
+	steps []pathStep
+}
+
+type pathStep struct {
+	recursive bool
+	wildcard  bool
+	name      string
+	index     *int
+	filter    *pathFilter
+}
+
+type pathFilter struct {
+	path  []string
+	op    string
+	value interface{}
+}
+
+// CompileJSONPath parses a JSONPath expression.
+func CompileJSONPath(expr string) (*JSONPath, error) {
+	p := &pathParser{s: strings.TrimSpace(expr)}
+	if !strings.HasPrefix(p.s, "$") {
+		return nil, fmt.Errorf("jsonpath %q: must start with $", expr)
+	}
+	p.i = 1
+	var steps []pathStep
+	for p.i < len(p.s) {
+		step, err := p.step()
+		if err != nil {
+			return nil, fmt.Errorf("jsonpath %q: %w", expr, err)
+		}
+		steps = append(steps, step)
+	}
+	return &JSONPath{expr: expr, steps: steps}, nil
+}
+
+func (p *JSONPath) String() string { return p.expr }
+
+// Eval returns the values selected from doc, a decoded JSON value.
+func (p *JSONPath) Eval(doc interface{}) []interface{} {
+	nodes := []interface{}{doc}
+	for _, step := range p.steps {
+		var next []interface{}
+		for _, n := range nodes {
+			candidates := []interface{}{n}
+			if step.recursive {
+				candidates = descendants(n, nil)
+			}
+			for _, c := range candidates {
+				next = append(next, step.apply(c)...)
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+func (s pathStep) apply(n interface{}) []interface{} {
+	switch {
+	case s.wildcard:
+		return children(n)
+	case s.index != nil:
+		arr, ok := n.([]interface{})
+		if !ok {
+			return nil
+		}
+		i := *s.index
+		if i < 0 {
+			i += len(arr)
+		}
+		if i < 0 || i >= len(arr) {
+			return nil
+		}
+		return []interface{}{arr[i]}
+	case s.filter != nil:
+		var out []interface{}
+		for _, c := range children(n) {
+			if s.filter.match(c) {
+				out = append(out, c)
+			}
+		}
+		return out
+	}
+	if m, ok := n.(map[string]interface{}); ok {
+		if v, ok := m[s.name]; ok {
+			return []interface{}{v}
+		}
+	}
+	return nil
+}
+
+func (f *pathFilter) match(n interface{}) bool {
+	vals := []interface{}{n}
+	for _, name := range f.path {
+		var next []interface{}
+		for _, v := range vals {
+			if m, ok := v.(map[string]interface{}); ok {
+				if c, ok := m[name]; ok {
+					next = append(next, c)
+				}
+			}
+		}
+		vals = next
+	}
+	if f.op == "" {
+		return len(vals) > 0
+	}
+	for _, v := range vals {
+		for _, x := range asSlice(v) {
+			if compareJSON(x, f.op, f.value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// compareJSON compares a JSON value with a literal. Values of different
+// kinds are only ever unequal.
+func compareJSON(a interface{}, op string, b interface{}) bool {
+	var c int
+	switch x := a.(type) {
+	case float64:
+		y, ok := b.(float64)
+		if !ok {
+			return op == "!="
+		}
+		switch {
+		case x < y:
+			c = -1
+		case x > y:
+			c = 1
+		}
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return op == "!="
+		}
+		c = strings.Compare(x, y)
+	default:
+		eq := a == b
+		switch op {
+		case "==":
+			return eq
+		case "!=":
+			return !eq
+		}
+		return false
+	}
+	switch op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// children returns an object's values (by key) or an array's elements.
+func children(n interface{}) []interface{} {
+	switch t := n.(type) {
+	case []interface{}:
+		return t
+	case map[string]interface{}:
+		out := make([]interface{}, 0, len(t))
+		for _, k := range sortedKeys(t) {
+			out = append(out, t[k])
+		}
+		return out
+	}
+	return nil
+}
+
+// descendants returns n and everything below it, in document order.
+func descendants(n interface{}, out []interface{}) []interface{} {
+	out = append(out, n)
+	for _, c := range children(n) {
+		out = descendants(c, out)
+	}
+	return out
+}
+
+type pathParser struct {
+	s string
+	i int
+}
+
+func (p *pathParser) step() (pathStep, error) {
+	var step pathStep
+	switch {
+	case strings.HasPrefix(p.s[p.i:], ".."):
+		p.i += 2
+		step.recursive = true
+		if p.i < len(p.s) && p.s[p.i] == '[' {
+			return p.bracket(step)
+		}
+		return p.dotName(step)
+	case p.s[p.i] == '.':
+		p.i++
+		return p.dotName(step)
+	case p.s[p.i] == '[':
+		return p.bracket(step)
+	}
+	return step, fmt.Errorf("unexpected %q at offset %d", p.s[p.i], p.i)
+}
+
+func (p *pathParser) dotName(step pathStep) (pathStep, error) {
+	start := p.i
+	for p.i < len(p.s) && p.s[p.i] != '.' && p.s[p.i] != '[' {
+		p.i++
+	}
+	name := p.s[start:p.i]
+	switch name {
+	case "":
+		return step, fmt.Errorf("empty name at offset %d", start)
+	case "*":
+		step.wildcard = true
+	default:
+		step.name = name
+	}
+	return step, nil
+}
+
+func (p *pathParser) bracket(step pathStep) (pathStep, error) {
+	end := p.closing()
+	if end < 0 {
+		return step, fmt.Errorf("unterminated [ at offset %d", p.i)
+	}
+	inner := strings.TrimSpace(p.s[p.i+1 : end])
+	p.i = end + 1
+	switch {
+	case inner == "*":
+		step.wildcard = true
+	case strings.HasPrefix(inner, "?(") && strings.HasSuffix(inner, ")"):
+		f, err := parseFilter(strings.TrimSpace(inner[2 : len(inner)-1]))
+		if err != nil {
+			return step, err
+		}
+		step.filter = f
+	case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+		step.name = inner[1 : len(inner)-1]
+	default:
+		n, err := strconv.Atoi(inner)
+		if err != nil {
+			return step, fmt.Errorf("unsupported selector [%s]", inner)
+		}
+		step.index = &n
+	}
+	return step, nil
+}
+
+// closing returns the index of the ] matching the [ at p.i, skipping
+// quoted strings and nested brackets.
+func (p *pathParser) closing() int {
+	var quote byte
+	depth := 0
+	for j := p.i; j < len(p.s); j++ {
+		c := p.s[j]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			if depth--; depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// filterOps is ordered so that two-character operators match first.
+var filterOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+func parseFilter(s string) (*pathFilter, error) {
+	f := &pathFilter{}
+	lhs := s
+	for _, op := range filterOps {
+		if i := indexOutsideQuotes(s, op); i >= 0 {
+			f.op = op
+			lhs = strings.TrimSpace(s[:i])
+			lit := strings.TrimSpace(s[i+len(op):])
+			v, err := parseLiteral(lit)
+			if err != nil {
+				return nil, err
+			}
+			f.value = v
+			break
+		}
+	}
+	if !strings.HasPrefix(lhs, "@") {
+		return nil, fmt.Errorf("filter %q must start with @", s)
+	}
+	sub, err := CompileJSONPath("$" + lhs[1:])
+	if err != nil {
+		return nil, err
+	}
+	for _, st := range sub.steps {
+		if st.recursive || st.wildcard || st.index != nil || st.filter != nil {
+			return nil, fmt.Errorf("filter %q: only property names are supported after @", s)
+		}
+		f.path = append(f.path, st.name)
+	}
+	return f, nil
+}
+
+func indexOutsideQuotes(s, sub string) int {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case strings.HasPrefix(s[i:], sub):
+			return i
+		}
+	}
+	return -1
+}
+
+func parseLiteral(s string) (interface{}, error) {
+	switch {
+	case len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0]:
+		return s[1 : len(s)-1], nil
+	case s == "true":
+		return true, nil
+	case s == "false":
+		return false, nil
+	case s == "null":
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported literal %q", s)
+	}
+	return f, nil
+}
@@ -0,0 +1,54 @@
+package logschema_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+func TestJSONPath(t *testing.T) {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(`{
+		"@graph": [
+			{"@id": "./", "@type": "Dataset"},
+			{"@id": "#task-bwa", "@type": "CreateAction", "exitCode": 0, "object": [{"@id": "reads.fastq"}]},
+			{"@id": "#task-gatk", "@type": ["CreateAction", "Thing"], "exitCode": 2},
+			{"@id": "reads.fastq", "@type": "File", "contentSize": "10"}
+		]
+	}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"$['@graph'][0]['@id']", `["./"]`},
+		{"$.@graph[-1].@id", `["reads.fastq"]`},
+		{"$['@graph'][?(@['@type'] == 'CreateAction')]['@id']", `["#task-bwa","#task-gatk"]`},
+		{"$['@graph'][?(@.exitCode > 0)]['@id']", `["#task-gatk"]`},
+		{"$['@graph'][?(@.contentSize)]['@id']", `["reads.fastq"]`},
+		{"$..object[*]['@id']", `["reads.fastq"]`},
+		{"$['@graph'][*].exitCode", `[0,2]`},
+		{"$.missing", `null`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			p, err := logschema.CompileJSONPath(tt.expr)
+			if err != nil {
+				t.Fatalf("compile: %v", err)
+			}
+			got, _ := json.Marshal(p.Eval(doc))
+			if string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	for _, bad := range []string{"graph", "$[", "$[1:2]", "$[?(x == 1)]", "$.."} {
+		if _, err := logschema.CompileJSONPath(bad); err == nil {
+			t.Errorf("CompileJSONPath(%q): expected error", bad)
+		}
+	}
+}
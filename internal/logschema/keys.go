@@ -0,0 +1,179 @@
+package logschema
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUnknownKey is returned by a KeyProvider that has no key with the
+// requested ID.
+var ErrUnknownKey = errors.New("unknown key")
+
+// KeyProvider gives access to the keys used to sign and verify structured
+// logs. Implementations may wrap a KMS or HSM; Signer is only needed for
+// signing and may fail for verification-only providers.
+type KeyProvider interface {
+	// Signer returns the private key with the given ID.
+	Signer(keyID string) (crypto.Signer, error)
+
+	// PublicKey returns the verification key with the given ID.
+	PublicKey(keyID string) (crypto.PublicKey, error)
+}
+
+// Key algorithms accepted by GenerateKey.
+const (
+	KeyEd25519 = "ed25519"
+	KeyES256   = "es256" // ECDSA on P-256
+	KeyES384   = "es384" // ECDSA on P-384
+)
+
+// GenerateKey creates a new Ed25519 or ECDSA signing key.
+func GenerateKey(alg string) (crypto.Signer, error) {
+	switch strings.ToLower(alg) {
+	case KeyEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	case KeyES256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyES384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	}
+	return nil, fmt.Errorf("unsupported key algorithm %q (want %s, %s or %s)", alg, KeyEd25519, KeyES256, KeyES384)
+}
+
+// KeyRing is an in-memory KeyProvider. The zero value is empty and ready
+// to use.
+type KeyRing struct {
+	signers map[string]crypto.Signer
+	public  map[string]crypto.PublicKey
+}
+
+// AddSigner adds a private key, which also serves as its own public key.
+func (r *KeyRing) AddSigner(keyID string, key crypto.Signer) {
+	if r.signers == nil {
+		r.signers = map[string]crypto.Signer{}
+	}
+	r.signers[keyID] = key
+	r.AddPublicKey(keyID, key.Public())
+}
+
+// AddPublicKey adds a verification-only key.
+func (r *KeyRing) AddPublicKey(keyID string, key crypto.PublicKey) {
+	if r.public == nil {
+		r.public = map[string]crypto.PublicKey{}
+	}
+	r.public[keyID] = key
+}
+
+// Signer implements KeyProvider.
+func (r *KeyRing) Signer(keyID string) (crypto.Signer, error) {
+	if s, ok := r.signers[keyID]; ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+}
+
+// PublicKey implements KeyProvider.
+func (r *KeyRing) PublicKey(keyID string) (crypto.PublicKey, error) {
+	if k, ok := r.public[keyID]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+}
+
+// FileKeyProvider loads PEM keys from a local directory: <Dir>/<keyID>.pem
+// holds a PKCS #8 private key and <Dir>/<keyID>.pub.pem a PKIX public key.
+// Verifiers only need the public key file; when it is missing, the public
+// key is derived from the private one. It is meant for tests and small
+// deployments, not for guarding production keys.
+type FileKeyProvider struct {
+	Dir string
+}
+
+// Signer implements KeyProvider.
+func (p *FileKeyProvider) Signer(keyID string) (crypto.Signer, error) {
+	block, err := p.read(keyID, ".pem")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", keyID, err)
+	}
+	s, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("key %q: %T cannot sign", keyID, key)
+	}
+	return s, nil
+}
+
+// PublicKey implements KeyProvider.
+func (p *FileKeyProvider) PublicKey(keyID string) (crypto.PublicKey, error) {
+	block, err := p.read(keyID, ".pub.pem")
+	if errors.Is(err, ErrUnknownKey) {
+		s, serr := p.Signer(keyID)
+		if serr != nil {
+			return nil, err
+		}
+		return s.Public(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", keyID, err)
+	}
+	return key, nil
+}
+
+func (p *FileKeyProvider) read(keyID, suffix string) (*pem.Block, error) {
+	if keyID == "" || keyID != filepath.Base(keyID) || strings.HasPrefix(keyID, ".") {
+		return nil, fmt.Errorf("invalid key ID %q", keyID)
+	}
+	data, err := os.ReadFile(filepath.Join(p.Dir, keyID+suffix))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w %q in %s", ErrUnknownKey, keyID, p.Dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %q: no PEM data in %s", keyID, keyID+suffix)
+	}
+	return block, nil
+}
+
+// WriteKeyFiles stores key as <dir>/<keyID>.pem (mode 0600) and its public
+// half as <dir>/<keyID>.pub.pem, in the layout read by FileKeyProvider.
+func WriteKeyFiles(dir, keyID string, key crypto.Signer) error {
+	if keyID == "" || keyID != filepath.Base(keyID) || strings.HasPrefix(keyID, ".") {
+		return fmt.Errorf("invalid key ID %q", keyID)
+	}
+	priv, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	pub, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, keyID+".pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: priv}), 0o600); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, keyID+".pub.pem"), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}), 0o644)
+}
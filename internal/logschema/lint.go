@@ -0,0 +1,150 @@
+package logschema
+
+import "fmt"
+
+// ContentKind classifies structured data found where plain text belongs.
+type ContentKind string
+
+const (
+	ContentJSON   ContentKind = "json"    // a JSON document
+	ContentJSONLD ContentKind = "json-ld" // a JSON-LD document (has @context)
+	ContentNDJSON ContentKind = "ndjson"  // newline-delimited JSON records
+	ContentPROV   ContentKind = "prov"    // PROV-JSON or PROV-N
+)
+
+// SniffContent reports whether content is structured data rather than plain
+// text. For structured content it returns its kind and the LogSchema that
+// Detect considers most likely, for use once it moves to structured_log.
+func SniffContent(content []byte) (kind ContentKind, suggested *LogSchema, structured bool) {
+	d := DetectSchema(content)
+	if d == nil {
+		return "", nil, false
+	}
+	return d.Kind, d.Schema, true
+}
+
+// StreamFinding is structured data found in a stdout or stderr field.
+type StreamFinding struct {
+	Location     string      `json:"location"` // "run", "task <id>" or "task <id> attempt <n>"
+	Field        string      `json:"field"`    // "stdout" or "stderr"
+	Value        string      `json:"value"`    // the URL, or the inline value (truncated)
+	Dereferenced bool        `json:"dereferenced"`
+	Kind         ContentKind `json:"kind"`
+	Suggested    *LogSchema  `json:"suggested_log_schema,omitempty"`
+}
+
+// String returns a human-readable description of the finding.
+func (f StreamFinding) String() string {
+	where := "inline value"
+	if f.Dereferenced {
+		where = "content at " + f.Value
+	}
+	msg := fmt.Sprintf("%s %s: %s holds %s data; stdout/stderr are for plain text only, move it to structured_log",
+		f.Location, f.Field, where, f.Kind)
+	if f.Suggested != nil {
+		msg += fmt.Sprintf(" (suggested log_schema: format=%q media_type=%q", f.Suggested.Format, f.Suggested.MediaType)
+		if f.Suggested.SchemaURI != "" {
+			msg += fmt.Sprintf(" schema_uri=%q", f.Suggested.SchemaURI)
+		}
+		msg += ")"
+	}
+	return msg
+}
+
+// LintReport is the outcome of linting a run's plain-text streams.
+type LintReport struct {
+	Findings []StreamFinding `json:"findings,omitempty"`
+
+	// Unreachable lists stream URLs that could not be dereferenced.
+	Unreachable []string `json:"unreachable,omitempty"`
+}
+
+// StreamLinter detects structured data smuggled into stdout/stderr, which
+// the proposal reserves for plain text.
+type StreamLinter struct {
+	// Validator dereferences stream URLs. Defaults to a zero Validator.
+	Validator *Validator
+
+	// Dereference fetches stdout/stderr URLs and inspects their content.
+	// Without it only inline (non-URL) values are inspected.
+	Dereference bool
+}
+
+func (l *StreamLinter) validator() *Validator {
+	if l.Validator != nil {
+		return l.Validator
+	}
+	return &Validator{}
+}
+
+// LintRun inspects the stdout/stderr of the run, each task and each attempt.
+func (l *StreamLinter) LintRun(rl *RunLog, tasks []TaskLog) *LintReport {
+	rep := &LintReport{}
+	if rl != nil {
+		l.lintStreams(rep, "run", rl.Stdout, rl.Stderr)
+	}
+	for i, tl := range tasks {
+		loc := taskLocation(&tl, i)
+		l.lintStreams(rep, loc, tl.Stdout, tl.Stderr)
+		for j, a := range tl.Logs {
+			l.lintStreams(rep, fmt.Sprintf("%s attempt %d", loc, j), a.Stdout, a.Stderr)
+		}
+	}
+	return rep
+}
+
+// LintValue inspects a single stdout/stderr value. It returns nil if the
+// value is plain text, or was a URL that could not be dereferenced (in
+// which case unreachable is true).
+func (l *StreamLinter) LintValue(location, field, value string) (finding *StreamFinding, unreachable bool) {
+	if value == "" {
+		return nil, false
+	}
+	content := []byte(value)
+	deref := false
+	if isHTTPURI(value) {
+		if !l.Dereference {
+			return nil, false
+		}
+		b, err := l.validator().FetchURI(value)
+		if err != nil {
+			return nil, true
+		}
+		content, deref = b, true
+	}
+	kind, suggested, structured := SniffContent(content)
+	if !structured {
+		return nil, false
+	}
+	shown := value
+	if !deref && len(shown) > 80 {
+		shown = shown[:77] + "..."
+	}
+	return &StreamFinding{
+		Location: location, Field: field, Value: shown,
+		Dereferenced: deref, Kind: kind, Suggested: suggested,
+	}, false
+}
+
+func (l *StreamLinter) lintStreams(rep *LintReport, location, stdout, stderr string) {
+	for _, s := range []struct{ field, value string }{{"stdout", stdout}, {"stderr", stderr}} {
+		f, unreachable := l.LintValue(location, s.field, s.value)
+		if unreachable {
+			rep.Unreachable = append(rep.Unreachable, s.value)
+		}
+		if f != nil {
+			rep.Findings = append(rep.Findings, *f)
+		}
+	}
+}
+
+// taskLocation names a task for reports, preferring its ID.
+func taskLocation(tl *TaskLog, i int) string {
+	switch {
+	case tl.ID != "":
+		return "task " + tl.ID
+	case tl.Name != "":
+		return "task " + tl.Name
+	}
+	return fmt.Sprintf("task #%d", i)
+}
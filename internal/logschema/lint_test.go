@@ -0,0 +1,84 @@
+package logschema_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+func TestSniffContent(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		structured bool
+		kind       logschema.ContentKind
+		format     logschema.Format
+	}{
+		{"plain text", "Starting alignment\nDone in 3.2s\n", false, "", ""},
+		{"single brace line is text", "{ not json", false, "", ""},
+		{"RO-Crate", `{"@context": "https://w3id.org/ro/crate/1.1/context", "@graph": []}`, true, logschema.ContentJSONLD, logschema.FormatROCrate},
+		{"other JSON-LD", `{"@context": "https://schema.org/", "@type": "Thing"}`, true, logschema.ContentJSONLD, logschema.FormatCustom},
+		{"PROV-JSON", `{"entity": {"ex:a": {}}}`, true, logschema.ContentPROV, logschema.FormatOPM},
+		{"PROV-N", "document\n  entity(ex:a)\nendDocument", true, logschema.ContentPROV, logschema.FormatOPM},
+		{"JSON with $schema", `{"$schema": "https://example.com/s.json", "x": 1}`, true, logschema.ContentJSON, logschema.FormatJSONSchema},
+		{"plain JSON", `{"level": "info"}`, true, logschema.ContentJSON, logschema.FormatCustom},
+		{"NDJSON", "{\"a\":1}\n{\"a\":2}\n", true, logschema.ContentNDJSON, logschema.FormatCustom},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, suggested, structured := logschema.SniffContent([]byte(tt.content))
+			if structured != tt.structured || kind != tt.kind {
+				t.Fatalf("SniffContent = (%q, %v), want (%q, %v)", kind, structured, tt.kind, tt.structured)
+			}
+			if structured && suggested.Format != tt.format {
+				t.Errorf("suggested format = %q, want %q", suggested.Format, tt.format)
+			}
+		})
+	}
+}
+
+func TestStreamLinter_LintRun(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/prov.log":
+			w.Write([]byte(`{"wasGeneratedBy": {}}`))
+		case "/plain.log":
+			w.Write([]byte("all good\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	rl := &logschema.RunLog{Stdout: srv.URL + "/plain.log", Stderr: srv.URL + "/prov.log"}
+	tasks := []logschema.TaskLog{{
+		ID:     "align",
+		Stdout: `{"@context": "https://w3id.org/ro/crate/1.1/context", "@graph": []}`,
+		Logs:   []logschema.Log{{Stderr: srv.URL + "/gone.log"}},
+	}}
+
+	t.Run("inline values only by default", func(t *testing.T) {
+		rep := (&logschema.StreamLinter{}).LintRun(rl, tasks)
+		if len(rep.Findings) != 1 || rep.Findings[0].Location != "task align" || rep.Findings[0].Field != "stdout" {
+			t.Fatalf("unexpected findings: %+v", rep.Findings)
+		}
+		if rep.Findings[0].Suggested.Format != logschema.FormatROCrate {
+			t.Errorf("expected RO-Crate suggestion, got %+v", rep.Findings[0].Suggested)
+		}
+	})
+
+	t.Run("dereferenced URLs", func(t *testing.T) {
+		rep := (&logschema.StreamLinter{Dereference: true}).LintRun(rl, tasks)
+		if len(rep.Findings) != 2 {
+			t.Fatalf("expected 2 findings, got %+v", rep.Findings)
+		}
+		if f := rep.Findings[0]; f.Location != "run" || f.Field != "stderr" || !f.Dereferenced || f.Kind != logschema.ContentPROV {
+			t.Errorf("unexpected run finding: %+v", f)
+		}
+		if len(rep.Unreachable) != 1 {
+			t.Errorf("expected the missing attempt log to be unreachable, got %v", rep.Unreachable)
+		}
+	})
+}
@@ -0,0 +1,318 @@
+package logschema
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NextflowRecords are the files a Nextflow run leaves behind. Trace or
+// Report is required; the others are optional.
+type NextflowRecords struct {
+	// Trace is the trace.txt written with -with-trace: tab-separated, with
+	// a header naming the fields.
+	Trace []byte
+
+	// Report is the report.html written with -with-report, or the JSON
+	// object it embeds as window.data. Its task records are used when
+	// there is no Trace.
+	Report []byte
+
+	// Provenance is the Workflow Run RO-Crate (ro-crate-metadata.json)
+	// written by the nf-prov plugin. When present it becomes the run's
+	// structured_log instead of a crate built from the trace.
+	Provenance []byte
+
+	// Script names the workflow that was run, such as "main.nf" or a
+	// pipeline URL, for the crate built from the trace.
+	Script string
+
+	// Location interprets trace timestamps, which carry no time zone.
+	// Defaults to UTC.
+	Location *time.Location
+}
+
+// nextflowTask is one trace record: a single attempt at a process task.
+type nextflowTask map[string]string
+
+// nextflowTimeLayouts are the formats of Nextflow trace timestamps.
+var nextflowTimeLayouts = []string{"2006-01-02 15:04:05.000", "2006-01-02 15:04:05"}
+
+// ImportNextflow converts the trace, report and nf-prov output of a Nextflow
+// run into a WES run. Each process task (a trace "name" such as
+// "ALIGN (sample1)") becomes one TaskLog, with one Log per attempt, so
+// retried tasks keep their failed attempts. The trace fields of the last
+// attempt are kept in Metadata under "nextflow.<field>". The run-level
+// structured_log is the nf-prov crate when there is one and otherwise a
+// Workflow Run Crate built from the tasks, in format to: FormatROCrate or,
+// converted, FormatOPM.
+func ImportNextflow(runID string, rec NextflowRecords, to Format) (*Run, error) {
+	loc := rec.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	var records []nextflowTask
+	var err error
+	switch {
+	case len(rec.Trace) > 0:
+		records, err = parseNextflowTrace(rec.Trace)
+	case len(rec.Report) > 0:
+		records, err = parseNextflowReport(rec.Report)
+	default:
+		return nil, errors.New("importing Nextflow run: a trace or an execution report is required")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("importing Nextflow run: %w", err)
+	}
+
+	// Group attempts by task name, in order of first submission.
+	var names []string
+	attempts := map[string][]nextflowTask{}
+	for _, r := range records {
+		name := r["name"]
+		if name == "" {
+			name = r["task_id"]
+		}
+		if _, ok := attempts[name]; !ok {
+			names = append(names, name)
+		}
+		attempts[name] = append(attempts[name], r)
+	}
+
+	run := &Run{RunID: runID, State: "COMPLETE", Request: map[string]interface{}{"workflow_type": "NEXTFLOW"}}
+	rl := &RunLog{Name: "Nextflow run " + runID}
+	b := NewCrateBuilder(runID, rl.Name)
+	if rec.Script != "" {
+		b.Workflow(rec.Script, rec.Script, "nextflow")
+	}
+	var starts, ends []string
+	for _, name := range names {
+		as := attempts[name]
+		sort.SliceStable(as, func(i, j int) bool { return atoi(as[i]["attempt"]) < atoi(as[j]["attempt"]) })
+		tl := TaskLog{Name: name}
+		for _, a := range as {
+			l, err := a.log(loc)
+			if err != nil {
+				return nil, fmt.Errorf("importing Nextflow task %q: %w", name, err)
+			}
+			tl.Logs = append(tl.Logs, l)
+		}
+		last := as[len(as)-1]
+		tl.ID = last["task_id"]
+		if tl.ID == "" {
+			tl.ID = last["hash"]
+		}
+		tl.StartTime, tl.EndTime = tl.Logs[0].StartTime, tl.Logs[len(tl.Logs)-1].EndTime
+		tl.ExitCode = tl.Logs[len(tl.Logs)-1].ExitCode
+		tl.Metadata = map[string]string{}
+		for k, v := range last {
+			if v != "" && v != "-" {
+				tl.Metadata["nextflow."+k] = v
+			}
+		}
+		if last["status"] == "FAILED" || last["status"] == "ABORTED" {
+			run.State = "EXECUTOR_ERROR"
+			if rl.ExitCode == 0 {
+				rl.ExitCode = tl.ExitCode
+			}
+			if rl.ExitCode == 0 {
+				rl.ExitCode = 1
+			}
+		}
+		starts, ends = append(starts, tl.StartTime), append(ends, tl.EndTime)
+		run.TaskLogs = append(run.TaskLogs, tl)
+
+		ct := crateTaskFromLog(&tl, len(run.TaskLogs)-1)
+		ct.Tool = last["process"]
+		if ct.Tool == "" {
+			ct.Tool, _, _ = strings.Cut(name, " (")
+		}
+		b.Task(ct)
+	}
+	rl.StartTime, rl.EndTime = spanTimes(starts, ends)
+	b.Times(rl.StartTime, rl.EndTime)
+	if run.State != "COMPLETE" {
+		b.Status(ActionFailed)
+	}
+
+	var crate *Crate
+	if len(rec.Provenance) > 0 {
+		if crate, err = ParseCrate(string(rec.Provenance)); err != nil {
+			return nil, fmt.Errorf("importing nf-prov crate: %w", err)
+		}
+	} else if crate, err = b.Build(); err != nil {
+		return nil, fmt.Errorf("importing Nextflow run: %w", err)
+	}
+	if err := setImportedLog(rl, crate, to); err != nil {
+		return nil, fmt.Errorf("importing Nextflow run: %w", err)
+	}
+	run.RunLog = rl
+	return run, nil
+}
+
+// log converts one trace record into an attempt Log. Times come from the
+// start and complete fields or, failing that, from submit and duration.
+func (t nextflowTask) log(loc *time.Location) (Log, error) {
+	var l Log
+	submit, err := nextflowTime(t["submit"], loc)
+	if err != nil {
+		return l, err
+	}
+	start, err := nextflowTime(t["start"], loc)
+	if err != nil {
+		return l, err
+	}
+	end, err := nextflowTime(t["complete"], loc)
+	if err != nil {
+		return l, err
+	}
+	if start.IsZero() {
+		start = submit
+	}
+	if end.IsZero() && !submit.IsZero() {
+		d, err := nextflowDuration(t["duration"])
+		if err != nil {
+			return l, err
+		}
+		if d > 0 {
+			end = submit.Add(d)
+		}
+	}
+	if !start.IsZero() {
+		l.StartTime = start.Format(time.RFC3339Nano)
+	}
+	if !end.IsZero() {
+		l.EndTime = end.Format(time.RFC3339Nano)
+	}
+	if exit := t["exit"]; exit != "" && exit != "-" {
+		if l.ExitCode, err = strconv.Atoi(exit); err != nil {
+			return l, fmt.Errorf("exit status %q is not a number", exit)
+		}
+	}
+	return l, nil
+}
+
+// parseNextflowTrace reads a tab-separated trace file.
+func parseNextflowTrace(data []byte) ([]nextflowTask, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = '\t'
+	r.LazyQuotes = true
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading trace header: %w", err)
+	}
+	if !contains(header, "name") && !contains(header, "task_id") {
+		return nil, errors.New("trace has neither a name nor a task_id field")
+	}
+	var out []nextflowTask
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading trace: %w", err)
+		}
+		t := nextflowTask{}
+		for i, field := range header {
+			if i < len(row) {
+				t[field] = strings.TrimSpace(row[i])
+			}
+		}
+		out = append(out, t)
+	}
+}
+
+// parseNextflowReport reads the task records of an execution report, from
+// the window.data object embedded in report.html or given as JSON.
+func parseNextflowReport(data []byte) ([]nextflowTask, error) {
+	if i := bytes.Index(data, []byte("window.data")); i >= 0 {
+		data = data[i:]
+		j := bytes.IndexByte(data, '{')
+		if j < 0 {
+			return nil, errors.New("report has no window.data object")
+		}
+		data = data[j:]
+	}
+	var report struct {
+		Trace []map[string]interface{} `json:"trace"`
+	}
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&report); err != nil {
+		return nil, fmt.Errorf("decoding report data: %w", err)
+	}
+	out := make([]nextflowTask, len(report.Trace))
+	for i, rec := range report.Trace {
+		out[i] = nextflowTask{}
+		for k, v := range rec {
+			switch v := v.(type) {
+			case string:
+				out[i][k] = v
+			case float64:
+				out[i][k] = strconv.FormatFloat(v, 'f', -1, 64)
+			case nil:
+			default:
+				b, _ := json.Marshal(v)
+				out[i][k] = string(b)
+			}
+		}
+	}
+	return out, nil
+}
+
+// nextflowTime parses a trace timestamp: a local date-time, or epoch
+// milliseconds as in raw traces and reports. "-" and "" are zero.
+func nextflowTime(s string, loc *time.Location) (time.Time, error) {
+	if s == "" || s == "-" {
+		return time.Time{}, nil
+	}
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.UnixMilli(ms).UTC(), nil
+	}
+	for _, layout := range nextflowTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised timestamp %q", s)
+}
+
+// nextflowDuration parses a trace duration such as "1h 2m 3s", "3.5s" or
+// "250ms", or milliseconds as in raw traces and reports.
+func nextflowDuration(s string) (time.Duration, error) {
+	if s == "" || s == "-" {
+		return 0, nil
+	}
+	if ms, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(ms * float64(time.Millisecond)), nil
+	}
+	var total time.Duration
+	for _, part := range strings.Fields(s) {
+		if days, ok := strings.CutSuffix(part, "d"); ok {
+			n, err := strconv.ParseFloat(days, 64)
+			if err != nil {
+				return 0, fmt.Errorf("unrecognised duration %q", s)
+			}
+			total += time.Duration(n * float64(24*time.Hour))
+			continue
+		}
+		d, err := time.ParseDuration(part)
+		if err != nil {
+			return 0, fmt.Errorf("unrecognised duration %q", s)
+		}
+		total += d
+	}
+	return total, nil
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
@@ -0,0 +1,123 @@
+package logschema_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+func readTestdata(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func checkImportedRun(t *testing.T, run *logschema.Run) {
+	t.Helper()
+	res, err := (&logschema.Validator{Offline: true}).ValidateRun(run.RunLog, run.TaskLogs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !res.Valid() {
+		t.Errorf("imported run does not validate: %+v %+v %+v", res.Run, res.Tasks, res.Attempts)
+	}
+}
+
+func TestImportNextflow(t *testing.T) {
+	trace := readTestdata(t, "nextflow/trace.txt")
+	report := readTestdata(t, "nextflow/report.html")
+
+	for _, tt := range []struct {
+		name string
+		rec  logschema.NextflowRecords
+	}{
+		{"trace", logschema.NextflowRecords{Trace: trace, Report: report, Script: "main.nf"}},
+		{"report", logschema.NextflowRecords{Report: report}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			run, err := logschema.ImportNextflow("nostalgic_curie", tt.rec, logschema.FormatROCrate)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			checkImportedRun(t, run)
+			if run.State != "COMPLETE" || run.RunLog.ExitCode != 0 || run.RunLog.LogSchema.Format != logschema.FormatROCrate {
+				t.Errorf("run: %s %+v", run.State, run.RunLog)
+			}
+
+			var align *logschema.TaskLog
+			for i := range run.TaskLogs {
+				if run.TaskLogs[i].Name == "ALIGN (sample1)" {
+					align = &run.TaskLogs[i]
+				}
+			}
+			if align == nil || align.ID != "3" || len(align.Logs) != 2 {
+				t.Fatalf("ALIGN task: %+v", align)
+			}
+			if align.Logs[0].ExitCode != 137 || align.Logs[1].ExitCode != 0 || align.ExitCode != 0 {
+				t.Errorf("attempt exit codes: %+v", align.Logs)
+			}
+			if align.StartTime != align.Logs[0].StartTime || align.EndTime != "2024-05-01T10:07:50.5Z" {
+				t.Errorf("ALIGN times: %s - %s", align.StartTime, align.EndTime)
+			}
+			if align.Metadata["nextflow.hash"] != "51/aa77c2" || align.Metadata["nextflow.status"] != "COMPLETED" {
+				t.Errorf("ALIGN metadata: %v", align.Metadata)
+			}
+
+			crate, err := logschema.ParseCrate(run.RunLog.StructuredLog)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if task := crate.Get(logschema.TaskEntityID("3")); task == nil || task.Refs("instrument")[0] != "#tool-align" {
+				t.Errorf("ALIGN action: %v", task)
+			}
+		})
+	}
+
+	run, err := logschema.ImportNextflow("nostalgic_curie", logschema.NextflowRecords{Trace: trace}, logschema.FormatOPM)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkImportedRun(t, run)
+	if run.RunLog.LogSchema.Format != logschema.FormatOPM || len(run.TaskLogs) != 3 {
+		t.Errorf("PROV import: %+v, %d tasks", run.RunLog.LogSchema, len(run.TaskLogs))
+	}
+	if multiqc := run.TaskLogs[2]; multiqc.StartTime != "2024-04-30T18:20:00Z" || multiqc.EndTime != "2024-04-30T18:20:12Z" || multiqc.Metadata["nextflow.native_id"] != "" {
+		t.Errorf("MULTIQC: %+v", multiqc)
+	}
+
+	prov := readTestdata(t, "nextflow/ro-crate-metadata.json")
+	run, err = logschema.ImportNextflow("nostalgic_curie", logschema.NextflowRecords{Trace: trace, Provenance: prov}, logschema.FormatROCrate)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkImportedRun(t, run)
+	if !strings.Contains(run.RunLog.StructuredLog, "nf-core/demo") {
+		t.Errorf("nf-prov crate not used: %s", run.RunLog.StructuredLog)
+	}
+
+	failed := strings.Replace(string(trace), "3\t51/aa77c2\t4107\tALIGN (sample1)\tCOMPLETED\t0", "3\t51/aa77c2\t4107\tALIGN (sample1)\tFAILED\t1", 1)
+	run, err = logschema.ImportNextflow("r", logschema.NextflowRecords{Trace: []byte(failed)}, logschema.FormatROCrate)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkImportedRun(t, run)
+	if run.State != "EXECUTOR_ERROR" || run.RunLog.ExitCode != 1 {
+		t.Errorf("failed run: %s, exit %d", run.State, run.RunLog.ExitCode)
+	}
+
+	for _, bad := range []logschema.NextflowRecords{
+		{},
+		{Trace: []byte("foo\tbar\n1\t2\n")},
+		{Trace: []byte("name\tsubmit\nx\tyesterday\n")},
+		{Trace: trace, Provenance: []byte(`{"@graph": []}`)},
+	} {
+		if _, err := logschema.ImportNextflow("r", bad, logschema.FormatROCrate); err == nil {
+			t.Errorf("ImportNextflow(%q) succeeded", bad.Trace)
+		}
+	}
+}
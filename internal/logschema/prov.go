@@ -0,0 +1,311 @@
+package logschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ProvNamespace is the W3C PROV namespace.
+const ProvNamespace = "http://www.w3.org/ns/prov#"
+
+// provQualifiedName is the PROV-JSON datatype of qualified-name values.
+const provQualifiedName = "prov:QUALIFIED_NAME"
+
+// ProvQName returns a PROV-JSON attribute value holding the qualified name
+// qname, e.g. ProvQName("prov:SoftwareAgent") for a prov:type.
+func ProvQName(qname string) map[string]interface{} {
+	return map[string]interface{}{"$": qname, "type": provQualifiedName}
+}
+
+// ProvAttrs holds the attributes of a PROV record, keyed by qualified
+// name (e.g. "prov:startTime", "prov:label", "ex:size").
+type ProvAttrs map[string]interface{}
+
+// ProvDocument is a W3C PROV-JSON document. Each record map is keyed by
+// the record's identifier; relation identifiers are usually blank nodes
+// ("_:u1").
+type ProvDocument struct {
+	Prefix map[string]string `json:"prefix,omitempty"`
+
+	Entity   map[string]ProvAttrs `json:"entity,omitempty"`
+	Activity map[string]ProvAttrs `json:"activity,omitempty"`
+	Agent    map[string]ProvAttrs `json:"agent,omitempty"`
+
+	Used              map[string]ProvAttrs `json:"used,omitempty"`
+	WasGeneratedBy    map[string]ProvAttrs `json:"wasGeneratedBy,omitempty"`
+	WasAssociatedWith map[string]ProvAttrs `json:"wasAssociatedWith,omitempty"`
+	WasDerivedFrom    map[string]ProvAttrs `json:"wasDerivedFrom,omitempty"`
+	WasAttributedTo   map[string]ProvAttrs `json:"wasAttributedTo,omitempty"`
+	WasInformedBy     map[string]ProvAttrs `json:"wasInformedBy,omitempty"`
+	WasStartedBy      map[string]ProvAttrs `json:"wasStartedBy,omitempty"`
+	WasEndedBy        map[string]ProvAttrs `json:"wasEndedBy,omitempty"`
+	ActedOnBehalfOf   map[string]ProvAttrs `json:"actedOnBehalfOf,omitempty"`
+}
+
+// provRelation describes one PROV relation type: its PROV-JSON key and the
+// attribute names of its positional arguments, in PROV-N order.
+type provRelation struct {
+	name string
+	args []string
+}
+
+// provRelations lists the supported relation types in PROV-N output order.
+var provRelations = []provRelation{
+	{"used", []string{"prov:activity", "prov:entity", "prov:time"}},
+	{"wasGeneratedBy", []string{"prov:entity", "prov:activity", "prov:time"}},
+	{"wasStartedBy", []string{"prov:activity", "prov:trigger", "prov:starter", "prov:time"}},
+	{"wasEndedBy", []string{"prov:activity", "prov:trigger", "prov:ender", "prov:time"}},
+	{"wasInformedBy", []string{"prov:informed", "prov:informant"}},
+	{"wasAssociatedWith", []string{"prov:activity", "prov:agent", "prov:plan"}},
+	{"wasAttributedTo", []string{"prov:entity", "prov:agent"}},
+	{"actedOnBehalfOf", []string{"prov:delegate", "prov:responsible", "prov:activity"}},
+	{"wasDerivedFrom", []string{"prov:generatedEntity", "prov:usedEntity", "prov:activity"}},
+}
+
+// clone returns a copy of d that shares no maps with it. Attribute values
+// are not copied.
+func (d *ProvDocument) clone() *ProvDocument {
+	c := &ProvDocument{}
+	if d.Prefix != nil {
+		c.Prefix = make(map[string]string, len(d.Prefix))
+		for k, v := range d.Prefix {
+			c.Prefix[k] = v
+		}
+	}
+	c.Entity, c.Activity, c.Agent = cloneRecords(d.Entity), cloneRecords(d.Activity), cloneRecords(d.Agent)
+	for _, r := range provRelations {
+		if records := d.relations(r.name, false); records != nil {
+			dst := c.relations(r.name, true)
+			for id, attrs := range cloneRecords(records) {
+				dst[id] = attrs
+			}
+		}
+	}
+	return c
+}
+
+func cloneRecords(records map[string]ProvAttrs) map[string]ProvAttrs {
+	if records == nil {
+		return nil
+	}
+	out := make(map[string]ProvAttrs, len(records))
+	for id, attrs := range records {
+		a := make(ProvAttrs, len(attrs))
+		for k, v := range attrs {
+			a[k] = v
+		}
+		out[id] = a
+	}
+	return out
+}
+
+// relations returns the record map for a relation type, creating it if
+// create is set.
+func (d *ProvDocument) relations(name string, create bool) map[string]ProvAttrs {
+	var p *map[string]ProvAttrs
+	switch name {
+	case "used":
+		p = &d.Used
+	case "wasGeneratedBy":
+		p = &d.WasGeneratedBy
+	case "wasAssociatedWith":
+		p = &d.WasAssociatedWith
+	case "wasDerivedFrom":
+		p = &d.WasDerivedFrom
+	case "wasAttributedTo":
+		p = &d.WasAttributedTo
+	case "wasInformedBy":
+		p = &d.WasInformedBy
+	case "wasStartedBy":
+		p = &d.WasStartedBy
+	case "wasEndedBy":
+		p = &d.WasEndedBy
+	case "actedOnBehalfOf":
+		p = &d.ActedOnBehalfOf
+	default:
+		return nil
+	}
+	if *p == nil && create {
+		*p = map[string]ProvAttrs{}
+	}
+	return *p
+}
+
+// ParseProv parses a PROV-JSON document.
+func ParseProv(content string) (*ProvDocument, error) {
+	if err := validateOPM(content); err != nil {
+		return nil, err
+	}
+	var d ProvDocument
+	if err := json.Unmarshal([]byte(content), &d); err != nil {
+		return nil, fmt.Errorf("not a PROV-JSON document: %w", err)
+	}
+	return &d, nil
+}
+
+// JSON serialises the document as PROV-JSON.
+func (d *ProvDocument) JSON() (string, error) {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Check verifies that relations only reference declared entities,
+// activities and agents, and that qualified names use declared prefixes.
+func (d *ProvDocument) Check() error {
+	declared := map[string]string{}
+	for kind, records := range map[string]map[string]ProvAttrs{"entity": d.Entity, "activity": d.Activity, "agent": d.Agent} {
+		for id := range records {
+			if prev, ok := declared[id]; ok && prev != kind {
+				return fmt.Errorf("%q is declared as both %s and %s", id, prev, kind)
+			}
+			declared[id] = kind
+		}
+	}
+	var problems []string
+	check := func(id string) {
+		if i := strings.Index(id, ":"); i > 0 {
+			p := id[:i]
+			if _, ok := d.Prefix[p]; !ok && p != "prov" && p != "xsd" && p != "_" {
+				problems = append(problems, fmt.Sprintf("undeclared prefix %q in %q", p, id))
+			}
+		}
+	}
+	for id := range declared {
+		check(id)
+	}
+	for _, rel := range provRelations {
+		for rid, attrs := range d.relations(rel.name, false) {
+			for _, arg := range rel.args {
+				ref, _ := attrs[arg].(string)
+				if ref == "" || arg == "prov:time" {
+					continue
+				}
+				if _, ok := declared[ref]; !ok {
+					problems = append(problems, fmt.Sprintf("%s %s: %s %q is not declared", rel.name, rid, arg, ref))
+				}
+			}
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// ProvN serialises the document in PROV-N notation. Blank-node relation
+// identifiers are omitted, as PROV-N has no syntax for them.
+func (d *ProvDocument) ProvN() string {
+	var b strings.Builder
+	b.WriteString("document\n")
+	for _, p := range sortedKeys(d.Prefix) {
+		fmt.Fprintf(&b, "  prefix %s <%s>\n", p, d.Prefix[p])
+	}
+	for _, id := range sortedKeys(d.Entity) {
+		fmt.Fprintf(&b, "  entity(%s%s)\n", id, provNAttrs(d.Entity[id], nil))
+	}
+	for _, id := range sortedKeys(d.Activity) {
+		attrs := d.Activity[id]
+		fmt.Fprintf(&b, "  activity(%s, %s, %s%s)\n", id, provNTime(attrs["prov:startTime"]), provNTime(attrs["prov:endTime"]),
+			provNAttrs(attrs, []string{"prov:startTime", "prov:endTime"}))
+	}
+	for _, id := range sortedKeys(d.Agent) {
+		fmt.Fprintf(&b, "  agent(%s%s)\n", id, provNAttrs(d.Agent[id], nil))
+	}
+	for _, rel := range provRelations {
+		records := d.relations(rel.name, false)
+		for _, rid := range sortedKeys(records) {
+			attrs := records[rid]
+			args := make([]string, len(rel.args))
+			for i, a := range rel.args {
+				args[i] = "-"
+				if v, _ := attrs[a].(string); v != "" {
+					args[i] = v
+				}
+			}
+			// Trailing optional arguments may be dropped, but never the first two.
+			for len(args) > 2 && args[len(args)-1] == "-" {
+				args = args[:len(args)-1]
+			}
+			prefix := ""
+			if !strings.HasPrefix(rid, "_:") {
+				prefix = rid + "; "
+			}
+			fmt.Fprintf(&b, "  %s(%s%s%s)\n", rel.name, prefix, strings.Join(args, ", "), provNAttrs(attrs, rel.args))
+		}
+	}
+	b.WriteString("endDocument\n")
+	return b.String()
+}
+
+func provNTime(v interface{}) string {
+	if s, ok := v.(string); ok && s != "" {
+		return s
+	}
+	return "-"
+}
+
+// provNAttrs renders the attributes not listed in skip as ", [k=v, ...]".
+func provNAttrs(attrs ProvAttrs, skip []string) string {
+	skipped := map[string]bool{}
+	for _, s := range skip {
+		skipped[s] = true
+	}
+	var parts []string
+	for _, k := range sortedKeys(attrs) {
+		if skipped[k] {
+			continue
+		}
+		parts = append(parts, k+"="+provNLiteral(attrs[k]))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return ", [" + strings.Join(parts, ", ") + "]"
+}
+
+func provNLiteral(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return strconv.Quote(t)
+	case bool:
+		return fmt.Sprintf("%q %%%% xsd:boolean", strconv.FormatBool(t))
+	case float64:
+		if t == float64(int64(t)) {
+			return fmt.Sprintf("%q %%%% xsd:long", strconv.FormatInt(int64(t), 10))
+		}
+		return fmt.Sprintf("%q %%%% xsd:double", strconv.FormatFloat(t, 'g', -1, 64))
+	case int:
+		return fmt.Sprintf("%q %%%% xsd:long", strconv.Itoa(t))
+	case map[string]interface{}:
+		// PROV-JSON typed literal: {"$": "...", "type": "xsd:..."}
+		if val, ok := t["$"].(string); ok {
+			typ, _ := t["type"].(string)
+			switch typ {
+			case "":
+				return strconv.Quote(val)
+			case provQualifiedName:
+				return "'" + val + "'"
+			}
+			return fmt.Sprintf("%q %%%% %s", val, typ)
+		}
+	}
+	b, _ := json.Marshal(v)
+	return strconv.Quote(string(b))
+}
+
+// sortedKeys returns the keys of a string-keyed map in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,328 @@
+package logschema
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ProvWESPrefix is the PROV prefix under which ProvBuilderFromRun declares
+// the run's records.
+const ProvWESPrefix = "wes"
+
+// ProvRunNamespace is the namespace bound to ProvWESPrefix for a run. Local
+// names are chosen to match the crate @ids of CrateBuilder, so "wes:task-x"
+// corresponds to TaskEntityID("x").
+func ProvRunNamespace(runID string) string {
+	if runID == "" {
+		return "urn:ga4gh:wes:run#"
+	}
+	return "urn:ga4gh:wes:run:" + runID + "#"
+}
+
+// ProvBuilder assembles a W3C PROV document. Methods record their arguments
+// and return the builder for chaining; all checks happen in Build.
+type ProvBuilder struct {
+	doc  ProvDocument
+	n    int
+	errs []string
+}
+
+// NewProvBuilder starts a document whose identifiers live under prefix,
+// bound to namespace. Additional prefixes can be declared with Prefix.
+func NewProvBuilder(prefix, namespace string) *ProvBuilder {
+	b := &ProvBuilder{}
+	if prefix != "" {
+		b.Prefix(prefix, namespace)
+	}
+	return b
+}
+
+// Prefix declares a namespace prefix.
+func (b *ProvBuilder) Prefix(prefix, namespace string) *ProvBuilder {
+	if b.doc.Prefix == nil {
+		b.doc.Prefix = map[string]string{}
+	}
+	b.doc.Prefix[prefix] = namespace
+	return b
+}
+
+// Entity adds an entity, merging attrs into any existing record with the
+// same identifier.
+func (b *ProvBuilder) Entity(id string, attrs ProvAttrs) *ProvBuilder {
+	b.doc.Entity = b.record(b.doc.Entity, id, attrs)
+	return b
+}
+
+// Activity adds an activity with optional start and end times (RFC 3339).
+func (b *ProvBuilder) Activity(id, start, end string, attrs ProvAttrs) *ProvBuilder {
+	if err := checkTimes("activity "+id, start, end); err != nil {
+		b.errs = append(b.errs, err.Error())
+	}
+	all := ProvAttrs{}
+	for k, v := range attrs {
+		all[k] = v
+	}
+	if start != "" {
+		all["prov:startTime"] = start
+	}
+	if end != "" {
+		all["prov:endTime"] = end
+	}
+	b.doc.Activity = b.record(b.doc.Activity, id, all)
+	return b
+}
+
+// Agent adds an agent.
+func (b *ProvBuilder) Agent(id string, attrs ProvAttrs) *ProvBuilder {
+	b.doc.Agent = b.record(b.doc.Agent, id, attrs)
+	return b
+}
+
+// Used records that activity used entity, optionally at time.
+func (b *ProvBuilder) Used(activity, entity, time string) *ProvBuilder {
+	return b.relation("used", ProvAttrs{"prov:activity": activity, "prov:entity": entity}, time)
+}
+
+// WasGeneratedBy records that entity was generated by activity, optionally
+// at time.
+func (b *ProvBuilder) WasGeneratedBy(entity, activity, time string) *ProvBuilder {
+	return b.relation("wasGeneratedBy", ProvAttrs{"prov:entity": entity, "prov:activity": activity}, time)
+}
+
+// WasAssociatedWith records that agent was responsible for activity,
+// optionally following plan (an entity).
+func (b *ProvBuilder) WasAssociatedWith(activity, agent, plan string) *ProvBuilder {
+	attrs := ProvAttrs{"prov:activity": activity, "prov:agent": agent}
+	if plan != "" {
+		attrs["prov:plan"] = plan
+	}
+	return b.relation("wasAssociatedWith", attrs, "")
+}
+
+// WasDerivedFrom records that generated was derived from used.
+func (b *ProvBuilder) WasDerivedFrom(generated, used string) *ProvBuilder {
+	return b.relation("wasDerivedFrom", ProvAttrs{"prov:generatedEntity": generated, "prov:usedEntity": used}, "")
+}
+
+// WasAttributedTo records that entity is attributed to agent.
+func (b *ProvBuilder) WasAttributedTo(entity, agent string) *ProvBuilder {
+	return b.relation("wasAttributedTo", ProvAttrs{"prov:entity": entity, "prov:agent": agent}, "")
+}
+
+// WasInformedBy records that informed used something generated by informant.
+func (b *ProvBuilder) WasInformedBy(informed, informant string) *ProvBuilder {
+	return b.relation("wasInformedBy", ProvAttrs{"prov:informed": informed, "prov:informant": informant}, "")
+}
+
+// WasStartedBy records that activity was started by the starter activity,
+// optionally at time.
+func (b *ProvBuilder) WasStartedBy(activity, starter, time string) *ProvBuilder {
+	return b.relation("wasStartedBy", ProvAttrs{"prov:activity": activity, "prov:starter": starter}, time)
+}
+
+// ActedOnBehalfOf records that delegate acted on behalf of responsible.
+func (b *ProvBuilder) ActedOnBehalfOf(delegate, responsible string) *ProvBuilder {
+	return b.relation("actedOnBehalfOf", ProvAttrs{"prov:delegate": delegate, "prov:responsible": responsible}, "")
+}
+
+func (b *ProvBuilder) record(records map[string]ProvAttrs, id string, attrs ProvAttrs) map[string]ProvAttrs {
+	if id == "" {
+		b.errs = append(b.errs, "record without identifier")
+		return records
+	}
+	if records == nil {
+		records = map[string]ProvAttrs{}
+	}
+	r := records[id]
+	if r == nil {
+		r = ProvAttrs{}
+	}
+	for k, v := range attrs {
+		r[k] = v
+	}
+	records[id] = r
+	return records
+}
+
+func (b *ProvBuilder) relation(name string, attrs ProvAttrs, t string) *ProvBuilder {
+	if t != "" {
+		if _, err := time.Parse(time.RFC3339, t); err != nil {
+			b.errs = append(b.errs, fmt.Sprintf("%s: time %q is not RFC 3339", name, t))
+		}
+		attrs["prov:time"] = t
+	}
+	b.n++
+	b.doc.relations(name, true)[fmt.Sprintf("_:%s%d", name, b.n)] = attrs
+	return b
+}
+
+// Build checks and returns the document. The result always passes the
+// package's OPM validation and has no dangling references. It is a copy,
+// so the builder can be extended and built again without changing it.
+func (b *ProvBuilder) Build() (*ProvDocument, error) {
+	if len(b.errs) > 0 {
+		return nil, fmt.Errorf("building PROV document: %s", strings.Join(b.errs, "; "))
+	}
+	doc := b.doc.clone()
+	if err := doc.Check(); err != nil {
+		return nil, fmt.Errorf("building PROV document: %w", err)
+	}
+	content, err := doc.JSON()
+	if err != nil {
+		return nil, err
+	}
+	if err := validateOPM(content); err != nil {
+		return nil, fmt.Errorf("building PROV document: %w", err)
+	}
+	return doc, nil
+}
+
+// ApplyTo builds the document and stores it in rl.StructuredLog, declaring
+// the matching PROV LogSchema.
+func (b *ProvBuilder) ApplyTo(rl *RunLog) error {
+	content, err := b.content()
+	if err != nil {
+		return err
+	}
+	rl.StructuredLog = content
+	rl.LogSchema = ProvLogSchema()
+	rl.StructuredLogDigest, rl.StructuredLogSignatures = nil, nil
+	return nil
+}
+
+// ApplyToTask is ApplyTo for a TaskLog. The task's LogSchema is left unset
+// when the parent already declares the PROV schema, so it is inherited.
+func (b *ProvBuilder) ApplyToTask(tl *TaskLog, parent *LogSchema) error {
+	content, err := b.content()
+	if err != nil {
+		return err
+	}
+	tl.StructuredLog = content
+	tl.LogSchema = nil
+	tl.StructuredLogDigest, tl.StructuredLogSignatures = nil, nil
+	if parent == nil || parent.Format != FormatOPM || parent.SchemaURI != SchemaURIPROV {
+		tl.LogSchema = ProvLogSchema()
+	}
+	return nil
+}
+
+func (b *ProvBuilder) content() (string, error) {
+	doc, err := b.Build()
+	if err != nil {
+		return "", err
+	}
+	return doc.JSON()
+}
+
+// ProvLogSchema returns the LogSchema that describes PROV-JSON documents
+// produced by this package.
+func ProvLogSchema() *LogSchema {
+	return &LogSchema{
+		SchemaURI: SchemaURIPROV,
+		Format:    FormatOPM,
+		MediaType: "application/json",
+	}
+}
+
+// ProvBuilderFromRun seeds a builder with a baseline provenance graph for a
+// run: the WES engine as software agent, the run and each task as
+// activities started by the run, and stdout/stderr as entities generated by
+// the activity that wrote them. Task ordering is inferred from timings: a
+// task was informed by the task(s) that finished last before it started.
+func ProvBuilderFromRun(runID string, rl *RunLog, tasks []TaskLog) *ProvBuilder {
+	b := NewProvBuilder(ProvWESPrefix, ProvRunNamespace(runID))
+	q := func(local string) string { return ProvWESPrefix + ":" + local }
+
+	engine := q("engine")
+	run := q(strings.TrimPrefix(RunEntityID(runID), "#"))
+	b.Agent(engine, ProvAttrs{"prov:type": ProvQName("prov:SoftwareAgent"), "prov:label": "WES engine"})
+	runAttrs := ProvAttrs{"prov:label": "WES run " + runID}
+	var runStart, runEnd string
+	if rl != nil {
+		if rl.Name != "" {
+			runAttrs["prov:label"] = rl.Name
+		}
+		if rl.EndTime != "" {
+			runAttrs[q("exitCode")] = rl.ExitCode
+		}
+		runStart, runEnd = rl.StartTime, rl.EndTime
+	}
+	b.Activity(run, runStart, runEnd, runAttrs)
+	b.WasAssociatedWith(run, engine, "")
+	if rl != nil {
+		b.streams(run, "run", rl.Stdout, rl.Stderr, rl.EndTime)
+	}
+
+	ids := make([]string, len(tasks))
+	for i, tl := range tasks {
+		id := tl.ID
+		if id == "" {
+			id = fmt.Sprintf("%d", i)
+		}
+		ids[i] = q(strings.TrimPrefix(TaskEntityID(id), "#"))
+		attrs := ProvAttrs{"prov:label": tl.Name}
+		if tl.Name == "" {
+			attrs["prov:label"] = id
+		}
+		if tl.EndTime != "" {
+			attrs[q("exitCode")] = tl.ExitCode
+		}
+		b.Activity(ids[i], tl.StartTime, tl.EndTime, attrs)
+		b.WasStartedBy(ids[i], run, tl.StartTime)
+		b.WasAssociatedWith(ids[i], engine, "")
+		b.streams(ids[i], "task-"+id, tl.Stdout, tl.Stderr, tl.EndTime)
+	}
+	for i, informant := range predecessors(tasks) {
+		for _, j := range informant {
+			b.WasInformedBy(ids[i], ids[j])
+		}
+	}
+	return b
+}
+
+// streams adds stdout/stderr entities generated by activity.
+func (b *ProvBuilder) streams(activity, local, stdout, stderr, end string) {
+	for _, s := range []struct{ name, url string }{{"stdout", stdout}, {"stderr", stderr}} {
+		if s.url == "" {
+			continue
+		}
+		id := ProvWESPrefix + ":" + local + "-" + s.name
+		b.Entity(id, ProvAttrs{"prov:label": s.name, "prov:location": s.url})
+		b.WasGeneratedBy(id, activity, end)
+	}
+}
+
+// predecessors returns, for each task, the indexes of the tasks with the
+// latest end time at or before its start. Tasks with unparseable or missing
+// timestamps have no predecessors and are nobody's predecessor.
+func predecessors(tasks []TaskLog) [][]int {
+	parse := func(s string) (time.Time, bool) {
+		t, err := time.Parse(time.RFC3339, s)
+		return t, err == nil
+	}
+	out := make([][]int, len(tasks))
+	for i, tl := range tasks {
+		start, ok := parse(tl.StartTime)
+		if !ok {
+			continue
+		}
+		var latest time.Time
+		for j, other := range tasks {
+			end, ok := parse(other.EndTime)
+			if j == i || !ok || end.After(start) {
+				continue
+			}
+			switch {
+			case len(out[i]) == 0 || end.After(latest):
+				latest = end
+				out[i] = []int{j}
+			case end.Equal(latest):
+				out[i] = append(out[i], j)
+			}
+		}
+		sort.Ints(out[i])
+	}
+	return out
+}
@@ -0,0 +1,188 @@
+package logschema_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+func alignmentProv() *logschema.ProvBuilder {
+	return logschema.NewProvBuilder("ex", "https://example.org/").
+		Entity("ex:reads", logschema.ProvAttrs{"prov:label": "reads.fastq"}).
+		Entity("ex:bam", nil).
+		Activity("ex:align", "2024-01-01T10:00:00Z", "2024-01-01T10:30:00Z", nil).
+		Agent("ex:researcher", logschema.ProvAttrs{"prov:type": logschema.ProvQName("prov:Person")}).
+		Used("ex:align", "ex:reads", "").
+		WasGeneratedBy("ex:bam", "ex:align", "2024-01-01T10:30:00Z").
+		WasAssociatedWith("ex:align", "ex:researcher", "").
+		WasDerivedFrom("ex:bam", "ex:reads")
+}
+
+func TestProvBuilder_Build(t *testing.T) {
+	doc, err := alignmentProv().Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(doc.Used) != 1 || len(doc.WasGeneratedBy) != 1 || len(doc.WasDerivedFrom) != 1 {
+		t.Errorf("unexpected relations: %+v", doc)
+	}
+	if doc.Activity["ex:align"]["prov:startTime"] != "2024-01-01T10:00:00Z" {
+		t.Errorf("activity times not recorded: %v", doc.Activity["ex:align"])
+	}
+
+	content, err := doc.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := logschema.ParseProv(content)
+	if err != nil {
+		t.Fatalf("round trip: %v", err)
+	}
+	if len(parsed.Entity) != 2 || parsed.Prefix["ex"] != "https://example.org/" {
+		t.Errorf("round trip lost records: %+v", parsed)
+	}
+}
+
+func TestProvBuilder_BuildTwice(t *testing.T) {
+	b := alignmentProv()
+	first, err := b.Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b.Entity("ex:extra", nil).Activity("ex:align", "", "", logschema.ProvAttrs{"prov:label": "changed"})
+	if _, err := b.Build(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(first.Entity) != 2 || first.Activity["ex:align"]["prov:label"] != nil {
+		t.Errorf("first document changed by later builder calls: %+v", first)
+	}
+
+	first.Entity["ex:mutated"] = logschema.ProvAttrs{}
+	second, err := b.Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if second.Entity["ex:mutated"] != nil {
+		t.Errorf("builder changed through a built document: %+v", second.Entity)
+	}
+}
+
+func TestProvBuilder_BuildErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		b    *logschema.ProvBuilder
+	}{
+		{"empty document", logschema.NewProvBuilder("ex", "https://example.org/")},
+		{"dangling reference", alignmentProv().Used("ex:align", "ex:missing", "")},
+		{"undeclared prefix", alignmentProv().Entity("other:x", nil)},
+		{"bad time", alignmentProv().Activity("ex:sort", "yesterday", "", nil)},
+		{"entity and activity share id", alignmentProv().Entity("ex:align", nil)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.b.Build(); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestProvDocument_ProvN(t *testing.T) {
+	doc, err := alignmentProv().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := doc.ProvN()
+	for _, want := range []string{
+		"document\n",
+		"  prefix ex <https://example.org/>\n",
+		`  entity(ex:reads, [prov:label="reads.fastq"])`,
+		"  activity(ex:align, 2024-01-01T10:00:00Z, 2024-01-01T10:30:00Z)\n",
+		"  agent(ex:researcher, [prov:type='prov:Person'])\n",
+		"  used(ex:align, ex:reads)\n",
+		"  wasGeneratedBy(ex:bam, ex:align, 2024-01-01T10:30:00Z)\n",
+		"  wasDerivedFrom(ex:bam, ex:reads)\n",
+		"endDocument\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("PROV-N missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestProvBuilder_ApplyTo(t *testing.T) {
+	v := &logschema.Validator{}
+
+	rl := &logschema.RunLog{}
+	if err := alignmentProv().ApplyTo(rl); err != nil {
+		t.Fatal(err)
+	}
+	res, err := v.ValidateRunLog(rl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Valid || rl.LogSchema.Format != logschema.FormatOPM {
+		t.Errorf("run log: %v %v", res, res.Errors)
+	}
+
+	t.Run("task inherits PROV schema from run", func(t *testing.T) {
+		tl := &logschema.TaskLog{}
+		if err := alignmentProv().ApplyToTask(tl, rl.LogSchema); err != nil {
+			t.Fatal(err)
+		}
+		if tl.LogSchema != nil {
+			t.Errorf("task should inherit the run schema, got %+v", tl.LogSchema)
+		}
+		if res, _ := v.ValidateTaskLog(tl, rl.LogSchema); !res.Valid {
+			t.Errorf("task log: %v", res.Errors)
+		}
+	})
+
+	t.Run("task declares PROV schema under an RO-Crate run", func(t *testing.T) {
+		tl := &logschema.TaskLog{}
+		if err := alignmentProv().ApplyToTask(tl, logschema.ROCrateLogSchema()); err != nil {
+			t.Fatal(err)
+		}
+		if tl.LogSchema == nil || tl.LogSchema.Format != logschema.FormatOPM {
+			t.Errorf("task should declare its own schema, got %+v", tl.LogSchema)
+		}
+	})
+}
+
+func TestProvBuilderFromRun(t *testing.T) {
+	rl := &logschema.RunLog{
+		Name: "variant-calling", StartTime: "2024-01-01T10:00:00Z", EndTime: "2024-01-01T12:00:00Z",
+		Stdout: "https://storage.example.com/run/stdout.txt",
+	}
+	tasks := []logschema.TaskLog{
+		{ID: "bwa", StartTime: "2024-01-01T10:00:00Z", EndTime: "2024-01-01T10:30:00Z", Stderr: "https://storage.example.com/bwa/stderr.txt"},
+		{ID: "index", StartTime: "2024-01-01T10:00:00Z", EndTime: "2024-01-01T10:20:00Z"},
+		{ID: "gatk", StartTime: "2024-01-01T10:30:00Z", EndTime: "2024-01-01T12:00:00Z"},
+		{ID: "untimed"},
+	}
+	doc, err := logschema.ProvBuilderFromRun("run-001", rl, tasks).Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if doc.Prefix[logschema.ProvWESPrefix] != logschema.ProvRunNamespace("run-001") {
+		t.Errorf("prefix = %v", doc.Prefix)
+	}
+	if len(doc.Activity) != 5 {
+		t.Errorf("expected run + 4 task activities, got %d", len(doc.Activity))
+	}
+	if len(doc.WasStartedBy) != 4 || len(doc.WasAssociatedWith) != 5 {
+		t.Errorf("tasks not linked to run and engine: %+v", doc)
+	}
+	if _, ok := doc.Entity["wes:task-bwa-stderr"]; !ok {
+		t.Errorf("missing stderr entity: %v", doc.Entity)
+	}
+
+	var informed []string
+	for _, r := range doc.WasInformedBy {
+		informed = append(informed, r["prov:informed"].(string)+"<-"+r["prov:informant"].(string))
+	}
+	if len(informed) != 1 || informed[0] != "wes:task-gatk<-wes:task-bwa" {
+		t.Errorf("wasInformedBy = %v, want only gatk informed by bwa", informed)
+	}
+}
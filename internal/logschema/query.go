@@ -0,0 +1,426 @@
+package logschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Triple is one edge of a provenance graph. Object is an @id, a PROV
+// identifier or a literal rendered as text.
+type Triple struct {
+	Subject   string `json:"subject"`
+	Predicate string `json:"predicate"`
+	Object    string `json:"object"`
+}
+
+// Graph is a structured log viewed as triples. RO-Crate and PROV graphs
+// share the predicates "a" (type), used/object, wasGeneratedBy (entity to
+// activity), result (activity to entity) and wasAssociatedWith/agent, so
+// the same query works on either format.
+type Graph struct {
+	Triples []Triple `json:"triples"`
+}
+
+func (g *Graph) add(s, p, o string) {
+	g.Triples = append(g.Triples, Triple{s, p, o})
+}
+
+// crateAliases maps action properties to the PROV-style predicates added
+// alongside them.
+var crateAliases = map[string]string{"object": "used", "agent": "wasAssociatedWith"}
+
+// CrateGraph returns the triples of a crate: one per @type, per reference
+// and per scalar property value.
+func CrateGraph(c *Crate) *Graph {
+	g := &Graph{}
+	for _, e := range c.Graph {
+		id := e.ID()
+		for _, t := range e.Types() {
+			g.add(id, "a", t)
+		}
+		action := isAction(e)
+		for _, prop := range sortedKeys(e) {
+			if prop == "@id" || prop == "@type" {
+				continue
+			}
+			for _, v := range asSlice(e[prop]) {
+				target, isRef := refID(v)
+				if !isRef {
+					if lit, ok := literal(v); ok {
+						g.add(id, prop, lit)
+					}
+					continue
+				}
+				g.add(id, prop, target)
+				if !action {
+					continue
+				}
+				if alias, ok := crateAliases[prop]; ok {
+					g.add(id, alias, target)
+				}
+				if prop == "result" {
+					g.add(target, "wasGeneratedBy", id)
+				}
+			}
+		}
+	}
+	return g
+}
+
+// ProvGraph returns the triples of a PROV document: record kinds and
+// prov:type values as "a", scalar attributes, and each relation from its
+// first to its second argument.
+func ProvGraph(d *ProvDocument) *Graph {
+	g := &Graph{}
+	for kind, records := range map[string]map[string]ProvAttrs{"prov:Entity": d.Entity, "prov:Activity": d.Activity, "prov:Agent": d.Agent} {
+		for _, id := range sortedKeys(records) {
+			g.add(id, "a", kind)
+			attrs := records[id]
+			for _, k := range sortedKeys(attrs) {
+				for _, v := range asSlice(attrs[k]) {
+					if s := provString(v); s != "" {
+						if k == "prov:type" {
+							g.add(id, "a", s)
+						} else {
+							g.add(id, k, s)
+						}
+					} else if lit, ok := literal(v); ok {
+						g.add(id, k, lit)
+					}
+				}
+			}
+		}
+	}
+	aliases := map[string]string{"used": "object", "wasAssociatedWith": "agent"}
+	for _, rel := range provRelations {
+		records := d.relations(rel.name, false)
+		for _, rid := range relationIDs(records) {
+			attrs := records[rid]
+			s, o := provString(attrs[rel.args[0]]), provString(attrs[rel.args[1]])
+			if s == "" || o == "" {
+				continue
+			}
+			g.add(s, rel.name, o)
+			if alias, ok := aliases[rel.name]; ok {
+				g.add(s, alias, o)
+			}
+			if rel.name == "wasGeneratedBy" {
+				g.add(o, "result", s)
+			}
+		}
+	}
+	sort.SliceStable(g.Triples, func(i, j int) bool { return g.Triples[i].Subject < g.Triples[j].Subject })
+	return g
+}
+
+// refID returns the @id of a JSON-LD reference.
+func refID(v interface{}) (string, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	id, ok := m["@id"].(string)
+	return id, ok
+}
+
+// literal renders a scalar JSON value as text.
+func literal(v interface{}) (string, bool) {
+	switch t := v.(type) {
+	case string:
+		return t, true
+	case bool, float64, int, int64:
+		return fmt.Sprint(t), true
+	}
+	return "", false
+}
+
+// Query evaluates a graph pattern: one or more "subject predicate object"
+// patterns separated by " . ", where any term may be a ?variable and terms
+// containing spaces are quoted. It returns one binding per distinct match.
+//
+//	?task used reads.fastq
+//	calls.vcf wasGeneratedBy ?step . ?step agent ?who
+func (g *Graph) Query(q string) ([]map[string]string, error) {
+	patterns, err := parseGraphQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	bindings := []map[string]string{{}}
+	for _, pat := range patterns {
+		var next []map[string]string
+		for _, b := range bindings {
+			for _, t := range g.Triples {
+				if nb, ok := matchTriple(pat, t, b); ok {
+					next = append(next, nb)
+				}
+			}
+		}
+		bindings = next
+	}
+	seen := map[string]bool{}
+	var out []map[string]string
+	for _, b := range bindings {
+		key, _ := json.Marshal(b)
+		if !seen[string(key)] {
+			seen[string(key)] = true
+			out = append(out, b)
+		}
+	}
+	return out, nil
+}
+
+func matchTriple(pat [3]string, t Triple, b map[string]string) (map[string]string, bool) {
+	nb := b
+	for i, v := range []string{t.Subject, t.Predicate, t.Object} {
+		term := pat[i]
+		if !strings.HasPrefix(term, "?") {
+			if term != v {
+				return nil, false
+			}
+			continue
+		}
+		if bound, ok := nb[term[1:]]; ok {
+			if bound != v {
+				return nil, false
+			}
+			continue
+		}
+		if len(nb) == len(b) {
+			nb = make(map[string]string, len(b)+1)
+			for k, x := range b {
+				nb[k] = x
+			}
+		}
+		nb[term[1:]] = v
+	}
+	return nb, true
+}
+
+func parseGraphQuery(q string) ([][3]string, error) {
+	var patterns [][3]string
+	var terms []string
+	flush := func() error {
+		if len(terms) == 0 {
+			return nil
+		}
+		if len(terms) != 3 {
+			return fmt.Errorf("graph query: pattern %q must have subject, predicate and object", strings.Join(terms, " "))
+		}
+		patterns = append(patterns, [3]string{terms[0], terms[1], terms[2]})
+		terms = nil
+		return nil
+	}
+	for i := 0; i < len(q); {
+		switch c := q[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(q[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("graph query: unterminated quote")
+			}
+			terms = append(terms, q[i+1:i+1+end])
+			i += end + 2
+		default:
+			j := i
+			for j < len(q) && q[j] != ' ' && q[j] != '\t' && q[j] != '\n' {
+				j++
+			}
+			if tok := q[i:j]; tok == "." {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+			} else {
+				terms = append(terms, tok)
+			}
+			i = j
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("graph query: empty query")
+	}
+	return patterns, nil
+}
+
+// LogDocument is one decoded structured log of a run.
+type LogDocument struct {
+	Location string      `json:"location"` // "run", "task <id>", "task <id> attempt <n>"
+	Schema   *LogSchema  `json:"log_schema,omitempty"`
+	Value    interface{} `json:"-"` // decoded JSON; NDJSON is an array of lines
+	Graph    *Graph      `json:"-"` // nil unless RO-Crate or PROV
+}
+
+// LogSet holds every inline structured log of a run, for querying run and
+// task levels through one interface.
+type LogSet struct {
+	Documents []LogDocument
+	// Skipped lists logs that were not loaded, with the reason.
+	Skipped []string
+}
+
+// QueryResult is one match, tagged with the log it came from.
+type QueryResult struct {
+	Location string            `json:"location"`
+	Value    interface{}       `json:"value,omitempty"`
+	Bindings map[string]string `json:"bindings,omitempty"`
+}
+
+// NewLogSet decodes the run's, tasks' and attempts' structured logs. When
+// v is non-nil the run is validated first and only valid logs are loaded.
+// Logs given by reference are skipped.
+func NewLogSet(v *Validator, rl *RunLog, tasks []TaskLog) (*LogSet, error) {
+	valid := map[string]*ValidationResult{}
+	if v != nil {
+		res, err := v.ValidateRun(rl, tasks)
+		if err != nil {
+			return nil, err
+		}
+		valid["run"] = res.Run
+		for i, r := range res.Tasks {
+			loc := taskLocation(&tasks[i], i)
+			valid[loc] = r
+			if res.Attempts != nil {
+				for j, a := range res.Attempts[i] {
+					valid[fmt.Sprintf("%s attempt %d", loc, j)] = a
+				}
+			}
+		}
+	}
+
+	set := &LogSet{}
+	load := func(location, content string, schema *LogSchema) {
+		if content == "" {
+			return
+		}
+		if r := valid[location]; v != nil && r != nil && !r.Valid {
+			set.Skipped = append(set.Skipped, fmt.Sprintf("%s: invalid: %s", location, strings.Join(r.Errors, "; ")))
+			return
+		}
+		if isLogURI(content) {
+			set.Skipped = append(set.Skipped, location+": structured_log is a reference")
+			return
+		}
+		content, schema, err := v.decodeLog(content, schema)
+		if err != nil {
+			set.Skipped = append(set.Skipped, fmt.Sprintf("%s: %v", location, err))
+			return
+		}
+		if schema == nil {
+			if d := DetectSchema([]byte(content)); d != nil {
+				schema = d.Schema
+			}
+		}
+		doc, err := decodeLogDocument(location, content, schema)
+		if err != nil {
+			set.Skipped = append(set.Skipped, fmt.Sprintf("%s: %v", location, err))
+			return
+		}
+		set.Documents = append(set.Documents, *doc)
+	}
+
+	var runSchema *LogSchema
+	if rl != nil {
+		runSchema = rl.LogSchema
+		load("run", rl.StructuredLog, runSchema)
+	}
+	for i := range tasks {
+		tl := &tasks[i]
+		loc := taskLocation(tl, i)
+		taskSchema := tl.LogSchema
+		if taskSchema == nil {
+			taskSchema = runSchema
+		}
+		load(loc, tl.StructuredLog, taskSchema)
+		for j := range tl.Logs {
+			a := &tl.Logs[j]
+			schema := a.LogSchema
+			if schema == nil {
+				schema = taskSchema
+			}
+			load(fmt.Sprintf("%s attempt %d", loc, j), a.StructuredLog, schema)
+		}
+	}
+	return set, nil
+}
+
+func decodeLogDocument(location, content string, schema *LogSchema) (*LogDocument, error) {
+	doc := &LogDocument{Location: location, Schema: schema}
+	if schema != nil && isLineDelimited(schema.MediaTypeOrDefault()) {
+		var lines []interface{}
+		for _, line := range strings.Split(content, "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			var v interface{}
+			if err := json.Unmarshal([]byte(line), &v); err != nil {
+				return nil, err
+			}
+			lines = append(lines, v)
+		}
+		doc.Value = lines
+		return doc, nil
+	}
+	if err := json.Unmarshal([]byte(content), &doc.Value); err != nil {
+		return nil, fmt.Errorf("not JSON: %w", err)
+	}
+	if schema == nil {
+		return doc, nil
+	}
+	switch schema.Format {
+	case FormatROCrate:
+		c, err := ParseCrate(content)
+		if err != nil {
+			return nil, err
+		}
+		doc.Graph = CrateGraph(c)
+	case FormatOPM:
+		d, err := ParseProv(content)
+		if err != nil {
+			return nil, err
+		}
+		doc.Graph = ProvGraph(d)
+	}
+	return doc, nil
+}
+
+// JSONPath evaluates expr against every document.
+func (s *LogSet) JSONPath(expr string) ([]QueryResult, error) {
+	p, err := CompileJSONPath(expr)
+	if err != nil {
+		return nil, err
+	}
+	var out []QueryResult
+	for _, d := range s.Documents {
+		for _, v := range p.Eval(d.Value) {
+			out = append(out, QueryResult{Location: d.Location, Value: v})
+		}
+	}
+	return out, nil
+}
+
+// GraphQuery evaluates a graph pattern (see Graph.Query) against every
+// RO-Crate and PROV document.
+func (s *LogSet) GraphQuery(q string) ([]QueryResult, error) {
+	if _, err := parseGraphQuery(q); err != nil {
+		return nil, err
+	}
+	var out []QueryResult
+	for _, d := range s.Documents {
+		if d.Graph == nil {
+			continue
+		}
+		bindings, err := d.Graph.Query(q)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range bindings {
+			out = append(out, QueryResult{Location: d.Location, Bindings: b})
+		}
+	}
+	return out, nil
+}
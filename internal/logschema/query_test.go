@@ -0,0 +1,98 @@
+package logschema_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+func queryRun(t *testing.T) *logschema.LogSet {
+	t.Helper()
+	rl := &logschema.RunLog{}
+	if err := variantCallingCrate().ApplyTo(rl); err != nil {
+		t.Fatal(err)
+	}
+	tasks := []logschema.TaskLog{
+		{ID: "qc", StructuredLog: `{"prefix": {"ex": "https://example.org/"},
+			"activity": {"ex:fastqc": {}}, "entity": {"ex:reads": {}, "ex:report": {}},
+			"used": {"_:u1": {"prov:activity": "ex:fastqc", "prov:entity": "ex:reads"}},
+			"wasGeneratedBy": {"_:g1": {"prov:entity": "ex:report", "prov:activity": "ex:fastqc"}}}`,
+			LogSchema: logschema.ProvLogSchema(),
+			Logs: []logschema.Log{{StructuredLog: "{\"level\":\"warn\"}\n{\"level\":\"info\"}\n",
+				LogSchema: &logschema.LogSchema{SchemaURI: "https://example.com/events", Format: logschema.FormatCustom, MediaType: "application/x-ndjson"}}}},
+		{ID: "broken", StructuredLog: `{"no": "graph"}`},
+		{ID: "remote", StructuredLog: "https://storage.example.com/crate.json"},
+	}
+	set, err := logschema.NewLogSet(&logschema.Validator{}, rl, tasks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return set
+}
+
+func TestLogSet_Load(t *testing.T) {
+	set := queryRun(t)
+	var locations []string
+	for _, d := range set.Documents {
+		locations = append(locations, d.Location)
+	}
+	if got := strings.Join(locations, ","); got != "run,task qc,task qc attempt 0" {
+		t.Errorf("loaded %q", got)
+	}
+	if len(set.Skipped) != 2 {
+		t.Errorf("expected the invalid and the by-reference task to be skipped: %v", set.Skipped)
+	}
+}
+
+func TestLogSet_GraphQuery(t *testing.T) {
+	set := queryRun(t)
+	tests := []struct {
+		query string
+		want  []string // location: bindings
+	}{
+		{"?task used reads.fastq", []string{"run: task=#run-run-001", "run: task=#task-bwa"}},
+		{"calls.vcf wasGeneratedBy ?step", []string{"run: step=#run-run-001", "run: step=#task-gatk"}},
+		{"?a used ?in", []string{
+			"run: a=#run-run-001 in=reads.fastq", "run: a=#task-bwa in=reads.fastq", "run: a=#task-gatk in=aligned.bam",
+			"task qc: a=ex:fastqc in=ex:reads"}},
+		{"?x result ex:report . ?x a prov:Activity", []string{"task qc: x=ex:fastqc"}},
+		{"#task-bwa instrument ?tool . ?tool name ?name", []string{"run: name=bwa-mem2 tool=#tool-bwa-mem2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			results, err := set.GraphQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range results {
+				var parts []string
+				for _, k := range []string{"a", "in", "name", "step", "task", "tool", "x"} {
+					if v, ok := r.Bindings[k]; ok {
+						parts = append(parts, k+"="+v)
+					}
+				}
+				got = append(got, r.Location+": "+strings.Join(parts, " "))
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+
+	if _, err := set.GraphQuery("?x used"); err == nil {
+		t.Error("expected error for incomplete pattern")
+	}
+}
+
+func TestLogSet_JSONPath(t *testing.T) {
+	set := queryRun(t)
+	results, err := set.JSONPath("$..level")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Location != "task qc attempt 0" || results[0].Value != "warn" {
+		t.Errorf("NDJSON attempt should be queryable line by line: %+v", results)
+	}
+}
@@ -0,0 +1,627 @@
+package logschema
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultRedactionReplacement is written in place of redacted values.
+const DefaultRedactionReplacement = "[REDACTED]"
+
+// RedactionRule selects values to redact. Exactly one of Pattern, Pointer
+// and Property is set.
+type RedactionRule struct {
+	// Name identifies the rule in reports. Defaults to the selector, e.g.
+	// "pointer:/@graph/*/patient".
+	Name string `json:"name,omitempty"`
+
+	// Pattern is a regular expression. Matches are replaced in the command
+	// line, stdout/stderr URLs, task metadata values, structured_log URIs
+	// and every string value of a structured_log payload. The replacement
+	// may refer to submatches as ${1}.
+	Pattern string `json:"pattern,omitempty"`
+
+	// Pointer is an RFC 6901 JSON Pointer into JSON and NDJSON
+	// structured_log payloads (applied to each NDJSON record). The value
+	// it points to is replaced as a whole. A "*" segment matches every
+	// member or element.
+	Pointer string `json:"pointer,omitempty"`
+
+	// Property is a property name, as written in the document. Its value
+	// is replaced on every RO-Crate entity (any JSON object of a
+	// structured_log payload) and in task metadata.
+	Property string `json:"property,omitempty"`
+
+	// Replacement is written in place of the redacted value. Defaults to
+	// DefaultRedactionReplacement.
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// DefaultRedactionRules returns patterns for common credentials: bearer
+// tokens, signed-URL query parameters, credentials in URLs, and cloud and
+// GitHub access keys. Identifiers such as patient IDs are site-specific
+// and need their own rules.
+func DefaultRedactionRules() []RedactionRule {
+	return []RedactionRule{
+		{Name: "bearer-token", Pattern: `(?i)\bbearer\s+[A-Za-z0-9._~+/=-]+`, Replacement: "Bearer " + DefaultRedactionReplacement},
+		{Name: "signed-url", Pattern: `(?i)([?&](?:x-amz-signature|x-amz-credential|x-amz-security-token|x-goog-signature|x-goog-credential|sig|signature|token|access_token)=)[^&#\s"]+`, Replacement: "${1}" + DefaultRedactionReplacement},
+		{Name: "url-credentials", Pattern: `(://[^/\s:@]+:)[^/\s@]+@`, Replacement: "${1}" + DefaultRedactionReplacement + "@"},
+		{Name: "aws-access-key", Pattern: `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`},
+		{Name: "github-token", Pattern: `\bgh[pousr]_[A-Za-z0-9]{36,}\b`},
+		{Name: "secret-assignment", Pattern: `(?i)\b(password|passwd|secret|api[_-]?key)=[^\s&"]+`, Replacement: "${1}=" + DefaultRedactionReplacement},
+	}
+}
+
+// LoadRedactionRules reads a JSON array of RedactionRule from a file.
+func LoadRedactionRules(path string) ([]RedactionRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []RedactionRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("decoding redaction rules %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// LoadPseudonymKey reads a Redactor.PseudonymKey from a file. A trailing
+// newline is not part of the key.
+func LoadPseudonymKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key := bytes.TrimRight(data, "\r\n")
+	if len(key) < MinPseudonymKeySize {
+		return nil, fmt.Errorf("pseudonym key %s is %d bytes, need at least %d", path, len(key), MinPseudonymKeySize)
+	}
+	return key, nil
+}
+
+// Redaction records values replaced by one rule in one place. It never
+// holds the redacted value itself.
+type Redaction struct {
+	Location string `json:"location"`       // "run", "task <id>" or "task <id> attempt <n>"
+	Field    string `json:"field"`          // "cmd[<i>]", "stdout", "stderr", "metadata.<key>" or "structured_log"
+	Line     int    `json:"line,omitempty"` // NDJSON line, 1-based
+	Path     string `json:"path,omitempty"` // JSON Pointer within the structured_log payload
+	Rule     string `json:"rule"`
+	Count    int    `json:"count"` // values or matches replaced
+}
+
+// String returns a human-readable description of the redaction.
+func (r Redaction) String() string {
+	where := r.Location + " " + r.Field
+	if r.Line > 0 {
+		where += fmt.Sprintf(" line %d", r.Line)
+	}
+	if r.Path != "" {
+		where += " " + r.Path
+	}
+	return fmt.Sprintf("%s: redacted %d value(s) (rule %s)", where, r.Count, r.Rule)
+}
+
+// RedactionReport lists what a Redactor changed.
+type RedactionReport struct {
+	Redactions []Redaction `json:"redactions,omitempty"`
+
+	// Invalidated lists the locations whose structured_log_digest and
+	// signatures were dropped because the content changed.
+	Invalidated []string `json:"invalidated,omitempty"`
+
+	// Remote lists the locations whose structured_log is a URI. Only the
+	// URI itself was redacted; Pointer and Property rules could not apply.
+	Remote []string `json:"remote,omitempty"`
+}
+
+// Count returns the total number of values or matches replaced.
+func (r *RedactionReport) Count() int {
+	n := 0
+	for _, red := range r.Redactions {
+		n += red.Count
+	}
+	return n
+}
+
+// Redactor removes secrets and personal data from run and task logs
+// before they are served or exported.
+//
+// String values are rewritten in place; keys and the shape of JSON
+// payloads are never changed, so a redacted structured_log still parses
+// as its log_schema's media type and passes the format checks. JSON-LD
+// @context and @type values are left alone, and Pattern matches in @id
+// values are replaced by a stable pseudonym so that references between
+// entities stay consistent.
+type Redactor struct {
+	// Validator checks redacted payloads against their log_schema.
+	// Defaults to a zero Validator.
+	Validator *Validator
+
+	// PseudonymKey is the secret that keys the HMAC-SHA-256 pseudonyms of
+	// @id matches. It must be at least MinPseudonymKeySize bytes and kept
+	// private: anyone holding it can test guesses against a pseudonym.
+	// Without it, a structured_log with a matching @id cannot be redacted.
+	PseudonymKey []byte
+
+	rules []redactionRule
+}
+
+type redactionRule struct {
+	RedactionRule
+	re      *regexp.Regexp
+	pointer []string
+}
+
+// MinPseudonymKeySize is the shortest accepted Redactor.PseudonymKey.
+const MinPseudonymKeySize = 16
+
+// NewRedactor compiles rules into a Redactor.
+func NewRedactor(rules []RedactionRule) (*Redactor, error) {
+	r := &Redactor{}
+	for i, rule := range rules {
+		cr := redactionRule{RedactionRule: rule}
+		set := 0
+		for _, s := range []string{rule.Pattern, rule.Pointer, rule.Property} {
+			if s != "" {
+				set++
+			}
+		}
+		if set != 1 {
+			return nil, fmt.Errorf("redaction rule %d: exactly one of pattern, pointer and property must be set", i)
+		}
+		switch {
+		case rule.Pattern != "":
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("redaction rule %d: %w", i, err)
+			}
+			cr.re = re
+			if cr.Name == "" {
+				cr.Name = "pattern:" + rule.Pattern
+			}
+		case rule.Pointer != "":
+			segs, err := parseRedactionPointer(rule.Pointer)
+			if err != nil {
+				return nil, fmt.Errorf("redaction rule %d: %w", i, err)
+			}
+			cr.pointer = segs
+			if cr.Name == "" {
+				cr.Name = "pointer:" + rule.Pointer
+			}
+		default:
+			if strings.HasPrefix(rule.Property, "@") {
+				return nil, fmt.Errorf("redaction rule %d: JSON-LD keyword %q cannot be redacted", i, rule.Property)
+			}
+			if cr.Name == "" {
+				cr.Name = "property:" + rule.Property
+			}
+		}
+		if cr.Replacement == "" {
+			cr.Replacement = DefaultRedactionReplacement
+		}
+		r.rules = append(r.rules, cr)
+	}
+	return r, nil
+}
+
+// parseRedactionPointer splits a JSON Pointer into unescaped segments. It
+// rejects pointers to the whole document and to JSON-LD keywords other
+// than a @graph being traversed, since replacing those would break the
+// payload's structure.
+func parseRedactionPointer(p string) ([]string, error) {
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("JSON Pointer %q must start with /", p)
+	}
+	segs := strings.Split(p[1:], "/")
+	for i, s := range segs {
+		s = strings.ReplaceAll(strings.ReplaceAll(s, "~1", "/"), "~0", "~")
+		if strings.HasPrefix(s, "@") && (s != "@graph" || i == len(segs)-1) {
+			return nil, fmt.Errorf("JSON Pointer %q targets the JSON-LD keyword %s", p, s)
+		}
+		segs[i] = s
+	}
+	return segs, nil
+}
+
+func (r *Redactor) validator() *Validator {
+	if r.Validator != nil {
+		return r.Validator
+	}
+	return &Validator{}
+}
+
+// RedactRun redacts the run, each task and each attempt in place: the
+// command line, stdout/stderr, task metadata and structured_log, whose
+// effective (possibly inherited) schema decides how it is parsed. A
+// structured_log that changes loses its digest and signatures. RedactRun
+// fails, possibly after modifying some logs, if a payload that passed its
+// media type and format checks would no longer pass them; the logs must
+// then not be served.
+func (r *Redactor) RedactRun(rl *RunLog, tasks []TaskLog) (*RedactionReport, error) {
+	if len(r.PseudonymKey) > 0 && len(r.PseudonymKey) < MinPseudonymKeySize {
+		return nil, fmt.Errorf("pseudonym key is %d bytes, need at least %d", len(r.PseudonymKey), MinPseudonymKeySize)
+	}
+	rep := &RedactionReport{}
+	var runSchema *LogSchema
+	if rl != nil {
+		runSchema = rl.LogSchema
+		for i := range rl.Cmd {
+			r.redactText(rep, "run", fmt.Sprintf("cmd[%d]", i), &rl.Cmd[i])
+		}
+		r.redactText(rep, "run", "stdout", &rl.Stdout)
+		r.redactText(rep, "run", "stderr", &rl.Stderr)
+		if err := r.redactLog(rep, "run", &rl.StructuredLog, runSchema, &rl.StructuredLogDigest, &rl.StructuredLogSignatures); err != nil {
+			return nil, err
+		}
+	}
+	for i := range tasks {
+		tl := &tasks[i]
+		loc := taskLocation(tl, i)
+		taskSchema := tl.LogSchema
+		if taskSchema == nil {
+			taskSchema = runSchema
+		}
+		r.redactMetadata(rep, loc, tl.Metadata)
+		r.redactText(rep, loc, "stdout", &tl.Stdout)
+		r.redactText(rep, loc, "stderr", &tl.Stderr)
+		if err := r.redactLog(rep, loc, &tl.StructuredLog, taskSchema, &tl.StructuredLogDigest, &tl.StructuredLogSignatures); err != nil {
+			return nil, err
+		}
+		for j := range tl.Logs {
+			a := &tl.Logs[j]
+			aloc := fmt.Sprintf("%s attempt %d", loc, j)
+			schema := a.LogSchema
+			if schema == nil {
+				schema = taskSchema
+			}
+			r.redactText(rep, aloc, "stdout", &a.Stdout)
+			r.redactText(rep, aloc, "stderr", &a.Stderr)
+			if err := r.redactLog(rep, aloc, &a.StructuredLog, schema, &a.StructuredLogDigest, &a.StructuredLogSignatures); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return rep, nil
+}
+
+// redactText applies the Pattern rules to a plain string field.
+func (r *Redactor) redactText(rep *RedactionReport, location, field string, s *string) bool {
+	changed := false
+	for i := range r.rules {
+		rule := &r.rules[i]
+		if rule.re == nil || *s == "" {
+			continue
+		}
+		if out, n := rule.replace(*s, nil); n > 0 {
+			*s = out
+			rep.Redactions = append(rep.Redactions, Redaction{Location: location, Field: field, Rule: rule.Name, Count: n})
+			changed = true
+		}
+	}
+	return changed
+}
+
+// redactMetadata replaces metadata values whose key matches a Property
+// rule and applies the Pattern rules to the others.
+func (r *Redactor) redactMetadata(rep *RedactionReport, location string, md map[string]string) {
+	keys := make([]string, 0, len(md))
+	for k := range md {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		field := "metadata." + k
+		if rule := r.propertyRule(k); rule != nil {
+			if md[k] != rule.Replacement {
+				md[k] = rule.Replacement
+				rep.Redactions = append(rep.Redactions, Redaction{Location: location, Field: field, Rule: rule.Name, Count: 1})
+			}
+			continue
+		}
+		v := md[k]
+		if r.redactText(rep, location, field, &v) {
+			md[k] = v
+		}
+	}
+}
+
+func (r *Redactor) propertyRule(name string) *redactionRule {
+	for i := range r.rules {
+		if r.rules[i].Property == name {
+			return &r.rules[i]
+		}
+	}
+	return nil
+}
+
+// redactLog redacts one structured_log and drops its digest and
+// signatures if the content changed.
+func (r *Redactor) redactLog(rep *RedactionReport, location string, content *string, schema *LogSchema, digest **Digest, sigs *[]Signature) error {
+	if *content == "" {
+		return nil
+	}
+	if isLogURI(*content) {
+		r.redactText(rep, location, "structured_log", content)
+		for _, rule := range r.rules {
+			if rule.re == nil {
+				rep.Remote = append(rep.Remote, location)
+				break
+			}
+		}
+		return nil
+	}
+
+	// Encoded logs are redacted in their decoded form and re-encoded.
+	plain, plainSchema, err := r.validator().decodeLog(*content, schema)
+	if err != nil {
+		return fmt.Errorf("%s: cannot decode structured_log: %w", location, err)
+	}
+	before := len(rep.Redactions)
+	out, err := r.redactPayload(rep, location, plain, mediaTypeOf(plainSchema))
+	if err != nil {
+		return fmt.Errorf("%s: %w", location, err)
+	}
+	if len(rep.Redactions) == before {
+		return nil
+	}
+	if r.checkPayload(plain, plainSchema) == nil {
+		if err := r.checkPayload(out, plainSchema); err != nil {
+			return fmt.Errorf("%s: redacted structured_log no longer validates: %w", location, err)
+		}
+	}
+	if isEncoded(schema) {
+		if out, err = EncodeContent([]byte(out), schema.ContentEncoding); err != nil {
+			return fmt.Errorf("%s: cannot re-encode structured_log: %w", location, err)
+		}
+	}
+	*content = out
+	if *digest != nil || len(*sigs) > 0 {
+		*digest, *sigs = nil, nil
+		rep.Invalidated = append(rep.Invalidated, location)
+	}
+	return nil
+}
+
+// checkPayload runs the media type and format checks of the validator.
+func (r *Redactor) checkPayload(content string, schema *LogSchema) error {
+	v := r.validator()
+	if err := v.validateMediaType(content, mediaTypeOf(schema)); err != nil {
+		return err
+	}
+	if schema != nil {
+		return v.validateByFormat(content, schema.Format, mediaTypeOf(schema))
+	}
+	return nil
+}
+
+// redactPayload redacts a structured_log payload. JSON documents and
+// NDJSON records are redacted value by value; anything else, including
+// JSON that does not parse, is treated as text.
+func (r *Redactor) redactPayload(rep *RedactionReport, location, content, mediaType string) (string, error) {
+	switch {
+	case isLineDelimited(mediaType):
+		lines := strings.Split(content, "\n")
+		for i, line := range lines {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			s := &redactionScope{rep: rep, location: location, line: i + 1, key: r.PseudonymKey}
+			out, ok := r.redactJSON(s, line)
+			switch {
+			case s.err != nil:
+				return "", s.err
+			case ok:
+				lines[i] = out
+			default:
+				r.redactText(rep, location, "structured_log", &lines[i])
+			}
+		}
+		return strings.Join(lines, "\n"), nil
+	case mediaType == "application/json", strings.HasSuffix(mediaType, "+json"):
+		s := &redactionScope{rep: rep, location: location, key: r.PseudonymKey}
+		out, ok := r.redactJSON(s, content)
+		if s.err != nil {
+			return "", s.err
+		}
+		if ok {
+			return out, nil
+		}
+	}
+	r.redactText(rep, location, "structured_log", &content)
+	return content, nil
+}
+
+// redactionScope records redactions within one JSON document.
+type redactionScope struct {
+	rep      *RedactionReport
+	location string
+	line     int
+	key      []byte // PseudonymKey
+	err      error  // first value that could not be redacted
+}
+
+func (s *redactionScope) add(path string, rule *redactionRule, n int) {
+	s.rep.Redactions = append(s.rep.Redactions, Redaction{
+		Location: s.location, Field: "structured_log", Line: s.line, Path: path, Rule: rule.Name, Count: n,
+	})
+}
+
+// redactJSON applies all rules to a JSON document and re-encodes it if
+// anything changed. It reports false if content is not JSON.
+func (r *Redactor) redactJSON(s *redactionScope, content string) (string, bool) {
+	dec := json.NewDecoder(strings.NewReader(content))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil || dec.More() {
+		return "", false
+	}
+	before := len(s.rep.Redactions)
+	for i := range r.rules {
+		rule := &r.rules[i]
+		switch {
+		case rule.pointer != nil:
+			doc = redactPointer(s, rule, doc, rule.pointer, "")
+		case rule.Property != "":
+			redactProperty(s, rule, doc, "")
+		default:
+			doc = redactStrings(s, rule, doc, "", false)
+		}
+	}
+	if len(s.rep.Redactions) == before {
+		return content, true
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if strings.Contains(strings.TrimSpace(content), "\n") {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(doc); err != nil {
+		return "", false
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), true
+}
+
+// redactPointer replaces the values selected by the pointer segments.
+func redactPointer(s *redactionScope, rule *redactionRule, n interface{}, segs []string, path string) interface{} {
+	if len(segs) == 0 {
+		if str, ok := n.(string); ok && str == rule.Replacement {
+			return n
+		}
+		s.add(path, rule, 1)
+		return rule.Replacement
+	}
+	seg, rest := segs[0], segs[1:]
+	switch n := n.(type) {
+	case map[string]interface{}:
+		for _, k := range sortedKeys(n) {
+			if seg == "*" && strings.HasPrefix(k, "@") || seg != "*" && k != seg {
+				continue
+			}
+			n[k] = redactPointer(s, rule, n[k], rest, path+"/"+escapePointer(k))
+		}
+	case []interface{}:
+		for i := range n {
+			if seg == "*" || seg == strconv.Itoa(i) {
+				n[i] = redactPointer(s, rule, n[i], rest, path+"/"+strconv.Itoa(i))
+			}
+		}
+	}
+	return n
+}
+
+// redactProperty replaces the value of a property on every object outside
+// @context.
+func redactProperty(s *redactionScope, rule *redactionRule, n interface{}, path string) {
+	switch n := n.(type) {
+	case map[string]interface{}:
+		for _, k := range sortedKeys(n) {
+			p := path + "/" + escapePointer(k)
+			switch {
+			case k == "@context":
+			case k == rule.Property:
+				if str, ok := n[k].(string); !ok || str != rule.Replacement {
+					n[k] = rule.Replacement
+					s.add(p, rule, 1)
+				}
+			default:
+				redactProperty(s, rule, n[k], p)
+			}
+		}
+	case []interface{}:
+		for i, e := range n {
+			redactProperty(s, rule, e, path+"/"+strconv.Itoa(i))
+		}
+	}
+}
+
+// redactStrings applies a Pattern rule to every string value outside
+// @context and @type. Matches in @id values become pseudonyms.
+func redactStrings(s *redactionScope, rule *redactionRule, n interface{}, path string, isID bool) interface{} {
+	switch v := n.(type) {
+	case string:
+		var pseudonymize func(string) string
+		if isID {
+			if len(s.key) == 0 {
+				if rule.re.MatchString(v) && s.err == nil {
+					s.err = fmt.Errorf("structured_log %s matches rule %s, but no pseudonym key is configured", path, rule.Name)
+				}
+				return v
+			}
+			pseudonymize = func(match string) string { return pseudonym(s.key, match) }
+		}
+		out, matches := rule.replace(v, pseudonymize)
+		if matches > 0 {
+			s.add(path, rule, matches)
+		}
+		return out
+	case map[string]interface{}:
+		for _, k := range sortedKeys(v) {
+			switch k {
+			case "@context", "@type", "@language", "@direction", "@vocab", "@base":
+				continue
+			}
+			v[k] = redactStrings(s, rule, v[k], path+"/"+escapePointer(k), k == "@id")
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redactStrings(s, rule, v[i], path+"/"+strconv.Itoa(i), isID)
+		}
+	}
+	return n
+}
+
+// replace substitutes the rule's replacement, or the result of
+// pseudonymize if it is not nil, for each match of its pattern in s.
+// Matches that are already redacted are left alone and not counted, so
+// redacting twice changes nothing.
+func (rule *redactionRule) replace(s string, pseudonymize func(string) string) (string, int) {
+	var b strings.Builder
+	n, last := 0, 0
+	for _, m := range rule.re.FindAllStringSubmatchIndex(s, -1) {
+		match := s[m[0]:m[1]]
+		var repl string
+		if pseudonymize != nil {
+			repl = pseudonymize(match)
+		} else {
+			repl = string(rule.re.ExpandString(nil, rule.Replacement, s, m))
+		}
+		if repl == match {
+			continue
+		}
+		b.WriteString(s[last:m[0]])
+		b.WriteString(repl)
+		last = m[1]
+		n++
+	}
+	if n == 0 {
+		return s, 0
+	}
+	b.WriteString(s[last:])
+	return b.String(), n
+}
+
+// pseudonym replaces an identifier fragment by a stable token, so that
+// equal identifiers stay equal after redaction. The token is the first
+// 128 bits of an HMAC-SHA-256 keyed with key: without the key, it can
+// neither be inverted by hashing guesses nor linked across keys.
+func pseudonym(key []byte, match string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(match))
+	return "redacted-" + hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func escapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
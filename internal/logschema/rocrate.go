@@ -0,0 +1,196 @@
+package logschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RO-Crate and Workflow Run Crate identifiers.
+const (
+	ROCrateContext          = "https://w3id.org/ro/crate/1.1/context"
+	ROCrateMetadataID       = "ro-crate-metadata.json"
+	ProfileProcessRunCrate  = "https://w3id.org/ro/wfrun/process/0.5"
+	ProfileWorkflowRunCrate = "https://w3id.org/ro/wfrun/workflow/0.5"
+	ProfileWorkflowROCrate  = "https://w3id.org/workflowhub/workflow-ro-crate/1.0"
+)
+
+// Entity is one node of an RO-Crate @graph.
+type Entity map[string]interface{}
+
+// ID returns the entity's @id.
+func (e Entity) ID() string {
+	s, _ := e["@id"].(string)
+	return s
+}
+
+// Types returns the entity's @type values.
+func (e Entity) Types() []string {
+	return stringsOf(e["@type"])
+}
+
+// HasType reports whether the entity has the given @type.
+func (e Entity) HasType(t string) bool {
+	for _, have := range e.Types() {
+		if have == t {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns a string-valued property, or "".
+func (e Entity) String(prop string) string {
+	s, _ := e[prop].(string)
+	return s
+}
+
+// Refs returns the @id values referenced by a property, which may hold a
+// single {"@id": ...} object or an array of them.
+func (e Entity) Refs(prop string) []string {
+	var out []string
+	for _, v := range asSlice(e[prop]) {
+		if m, ok := v.(map[string]interface{}); ok {
+			if id, ok := m["@id"].(string); ok {
+				out = append(out, id)
+			}
+		}
+	}
+	return out
+}
+
+// Crate is a parsed RO-Crate metadata document: a JSON-LD context and a
+// flattened @graph.
+type Crate struct {
+	Context interface{} `json:"@context"`
+	Graph   []Entity    `json:"@graph"`
+}
+
+// ParseCrate parses RO-Crate JSON-LD content.
+func ParseCrate(content string) (*Crate, error) {
+	if err := validateROCrate(content); err != nil {
+		return nil, err
+	}
+	var c Crate
+	if err := json.Unmarshal([]byte(content), &c); err != nil {
+		return nil, fmt.Errorf("'@graph' must be an array of objects: %w", err)
+	}
+	return &c, nil
+}
+
+// Get returns the entity with the given @id, or nil.
+func (c *Crate) Get(id string) Entity {
+	for _, e := range c.Graph {
+		if e.ID() == id {
+			return e
+		}
+	}
+	return nil
+}
+
+// Root returns the root data entity named by the metadata descriptor,
+// falling back to "./".
+func (c *Crate) Root() Entity {
+	if md := c.Get(ROCrateMetadataID); md != nil {
+		if about := md.Refs("about"); len(about) == 1 {
+			if root := c.Get(about[0]); root != nil {
+				return root
+			}
+		}
+	}
+	return c.Get("./")
+}
+
+// OfType returns every entity with the given @type, in graph order.
+func (c *Crate) OfType(t string) []Entity {
+	var out []Entity
+	for _, e := range c.Graph {
+		if e.HasType(t) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Marshal serialises the crate as compact JSON-LD.
+func (c *Crate) Marshal() (string, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// CheckReferences verifies that @ids are unique and that every reference
+// to a crate-local entity (a "#fragment" or relative path) resolves to an
+// entity in the graph. References to absolute URIs are not checked.
+func (c *Crate) CheckReferences() error {
+	seen := map[string]bool{}
+	for _, e := range c.Graph {
+		id := e.ID()
+		if id == "" {
+			return fmt.Errorf("entity without @id in @graph")
+		}
+		if seen[id] {
+			return fmt.Errorf("duplicate @id %q", id)
+		}
+		seen[id] = true
+	}
+	var dangling []string
+	for _, e := range c.Graph {
+		for prop := range e {
+			for _, ref := range e.Refs(prop) {
+				if isLocalRef(ref) && !seen[ref] {
+					dangling = append(dangling, fmt.Sprintf("%s.%s -> %s", e.ID(), prop, ref))
+				}
+			}
+		}
+	}
+	if len(dangling) > 0 {
+		sort.Strings(dangling)
+		return fmt.Errorf("dangling references: %s", strings.Join(dangling, ", "))
+	}
+	return nil
+}
+
+// isLocalRef reports whether an @id names an entity inside the crate.
+func isLocalRef(id string) bool {
+	return !strings.Contains(id, ":")
+}
+
+// ref builds a JSON-LD {"@id": id} reference.
+func ref(id string) map[string]interface{} {
+	return map[string]interface{}{"@id": id}
+}
+
+// refs builds a list of JSON-LD references.
+func refs(ids []string) []interface{} {
+	out := make([]interface{}, len(ids))
+	for i, id := range ids {
+		out[i] = ref(id)
+	}
+	return out
+}
+
+// asSlice returns v as a slice, wrapping single values.
+func asSlice(v interface{}) []interface{} {
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return t
+	}
+	return []interface{}{v}
+}
+
+// stringsOf returns the string values of a single value or array.
+func stringsOf(v interface{}) []string {
+	var out []string
+	for _, x := range asSlice(v) {
+		if s, ok := x.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,520 @@
+package logschema
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ActionStatus is a schema.org ActionStatusType.
+type ActionStatus string
+
+const (
+	ActionCompleted ActionStatus = "http://schema.org/CompletedActionStatus"
+	ActionFailed    ActionStatus = "http://schema.org/FailedActionStatus"
+	ActionActive    ActionStatus = "http://schema.org/ActiveActionStatus"
+	ActionPotential ActionStatus = "http://schema.org/PotentialActionStatus"
+)
+
+// AgentType is the @type of an agent entity.
+type AgentType string
+
+const (
+	AgentPerson       AgentType = "Person"
+	AgentOrganization AgentType = "Organization"
+	AgentSoftware     AgentType = "SoftwareApplication"
+)
+
+// CrateFile is a data entity: a workflow input, output or intermediate.
+type CrateFile struct {
+	ID             string // relative path or absolute URL
+	Name           string
+	EncodingFormat string // MIME type or PRONOM identifier
+	ContentSize    int64
+	SHA256         string
+}
+
+// CrateAgent is a person, organisation or software that ran the workflow.
+type CrateAgent struct {
+	ID   string // e.g. an ORCID URL; defaults to "#agent-<name>"
+	Name string
+	Type AgentType
+}
+
+// CrateTask is one executed workflow step.
+type CrateTask struct {
+	ID        string // task identifier; the entity @id is "#task-<ID>"
+	Name      string
+	Tool      string // name of the tool that ran; becomes a SoftwareApplication
+	StartTime string // ISO 8601
+	EndTime   string // ISO 8601
+	ExitCode  int
+	Status    ActionStatus // defaults from ExitCode
+	Inputs    []string     // CrateFile IDs consumed
+	Outputs   []string     // CrateFile IDs produced
+	Agent     string       // CrateAgent ID, if different from the run agent
+}
+
+// TaskEntityID is the @id given to a task's CreateAction.
+func TaskEntityID(taskID string) string {
+	return "#task-" + taskID
+}
+
+// RunEntityID is the @id given to the run's CreateAction.
+func RunEntityID(runID string) string {
+	if runID == "" {
+		return "#run"
+	}
+	return "#run-" + runID
+}
+
+// workflowLanguages maps short language names to ComputerLanguage entities.
+var workflowLanguages = map[string][2]string{
+	"cwl":       {"https://w3id.org/workflowhub/workflow-ro-crate#cwl", "Common Workflow Language"},
+	"nextflow":  {"https://w3id.org/workflowhub/workflow-ro-crate#nextflow", "Nextflow"},
+	"snakemake": {"https://w3id.org/workflowhub/workflow-ro-crate#snakemake", "Snakemake"},
+	"wdl":       {"https://w3id.org/workflowhub/workflow-ro-crate#wdl", "Workflow Description Language"},
+	"galaxy":    {"https://w3id.org/workflowhub/workflow-ro-crate#galaxy", "Galaxy"},
+}
+
+// CrateBuilder assembles a Workflow Run Crate from WES concepts. Methods
+// record their arguments and return the builder for chaining; all checks
+// happen in Build.
+type CrateBuilder struct {
+	runID     string
+	name      string
+	startTime string
+	endTime   string
+	status    ActionStatus
+	err       string
+
+	workflowID   string
+	workflowName string
+	language     string
+
+	agent  string
+	agents []CrateAgent
+	files  []CrateFile
+	inputs []string
+	output []string
+	tasks  []CrateTask
+}
+
+// NewCrateBuilder starts a crate for the WES run runID.
+func NewCrateBuilder(runID, name string) *CrateBuilder {
+	return &CrateBuilder{runID: runID, name: name}
+}
+
+// CrateBuilderFromRun seeds a builder from a RunLog and its TaskLogs: run
+// name, timestamps and status, and one task per TaskLog. Build fails if two
+// TaskLogs share an ID, including a task without one whose index equals
+// another task's ID.
+func CrateBuilderFromRun(runID string, rl *RunLog, tasks []TaskLog) *CrateBuilder {
+	b := NewCrateBuilder(runID, "")
+	if rl != nil {
+		b.name = rl.Name
+		b.Times(rl.StartTime, rl.EndTime)
+		b.status = statusFromExit(rl.ExitCode, rl.EndTime)
+	}
+	for i := range tasks {
+		b.Task(crateTaskFromLog(&tasks[i], i))
+	}
+	return b
+}
+
+// crateTaskFromLog describes the i-th TaskLog as a CrateTask, identified by
+// its ID or, failing that, its index.
+func crateTaskFromLog(tl *TaskLog, i int) CrateTask {
+	id := tl.ID
+	if id == "" {
+		id = fmt.Sprintf("%d", i)
+	}
+	return CrateTask{
+		ID:        id,
+		Name:      tl.Name,
+		StartTime: tl.StartTime,
+		EndTime:   tl.EndTime,
+		ExitCode:  tl.ExitCode,
+	}
+}
+
+// Workflow sets the workflow definition that was run. language is a short
+// name such as "cwl", "nextflow", "snakemake" or "wdl".
+func (b *CrateBuilder) Workflow(id, name, language string) *CrateBuilder {
+	b.workflowID, b.workflowName, b.language = id, name, strings.ToLower(language)
+	return b
+}
+
+// Times sets the run's start and end timestamps (ISO 8601).
+func (b *CrateBuilder) Times(start, end string) *CrateBuilder {
+	b.startTime, b.endTime = start, end
+	return b
+}
+
+// Status sets the run's action status. It defaults to completed when an
+// end time is set and active otherwise.
+func (b *CrateBuilder) Status(s ActionStatus) *CrateBuilder {
+	b.status = s
+	return b
+}
+
+// Error sets the run's error, a description of why it failed.
+func (b *CrateBuilder) Error(msg string) *CrateBuilder {
+	b.err = msg
+	return b
+}
+
+// Agent adds an agent and makes it the agent of the run.
+func (b *CrateBuilder) Agent(a CrateAgent) *CrateBuilder {
+	a = b.addAgent(a)
+	b.agent = a.ID
+	return b
+}
+
+// AddAgent adds an agent without associating it with the run, for use by
+// tasks.
+func (b *CrateBuilder) AddAgent(a CrateAgent) *CrateBuilder {
+	b.addAgent(a)
+	return b
+}
+
+func (b *CrateBuilder) addAgent(a CrateAgent) CrateAgent {
+	if a.ID == "" {
+		a.ID = "#agent-" + slug(a.Name)
+	}
+	if a.Type == "" {
+		a.Type = AgentPerson
+	}
+	b.agents = append(b.agents, a)
+	return a
+}
+
+// Input adds a workflow input (an object of the run).
+func (b *CrateBuilder) Input(f CrateFile) *CrateBuilder {
+	b.files = append(b.files, f)
+	b.inputs = append(b.inputs, f.ID)
+	return b
+}
+
+// Output adds a workflow output (a result of the run).
+func (b *CrateBuilder) Output(f CrateFile) *CrateBuilder {
+	b.files = append(b.files, f)
+	b.output = append(b.output, f.ID)
+	return b
+}
+
+// File adds an intermediate file exchanged between tasks.
+func (b *CrateBuilder) File(f CrateFile) *CrateBuilder {
+	b.files = append(b.files, f)
+	return b
+}
+
+// Task adds an executed step. Task IDs must be unique; Build reports a
+// task added twice rather than dropping either.
+func (b *CrateBuilder) Task(t CrateTask) *CrateBuilder {
+	b.tasks = append(b.tasks, t)
+	return b
+}
+
+// Build assembles and checks the crate. The result always passes the
+// package's RO-Crate validation and has no dangling local references.
+func (b *CrateBuilder) Build() (*Crate, error) {
+	if err := b.check(); err != nil {
+		return nil, err
+	}
+
+	runID := RunEntityID(b.runID)
+	name := b.name
+	if name == "" {
+		name = "WES run " + b.runID
+	}
+
+	// A Workflow Run Crate, and the Workflow RO-Crate it extends, need
+	// the workflow as mainEntity; without one the crate is a Process Run
+	// Crate only.
+	profiles := []string{ProfileProcessRunCrate}
+	if b.workflowID != "" {
+		profiles = append(profiles, ProfileWorkflowRunCrate, ProfileWorkflowROCrate)
+	}
+	root := Entity{
+		"@id":        "./",
+		"@type":      "Dataset",
+		"name":       name,
+		"conformsTo": refs(profiles),
+		"mentions":   []interface{}{ref(runID)},
+	}
+	if b.endTime != "" {
+		root["datePublished"] = b.endTime
+	}
+	graph := []Entity{
+		{
+			"@id":        ROCrateMetadataID,
+			"@type":      "CreativeWork",
+			"conformsTo": ref(SchemaURIROCrate),
+			"about":      ref("./"),
+		},
+		root,
+	}
+	var parts []string
+
+	run := Entity{"@id": runID, "@type": "CreateAction", "name": name}
+	if b.workflowID != "" {
+		parts = append(parts, b.workflowID)
+		root["mainEntity"] = ref(b.workflowID)
+		run["instrument"] = ref(b.workflowID)
+		wf := Entity{
+			"@id":   b.workflowID,
+			"@type": []interface{}{"File", "SoftwareSourceCode", "ComputationalWorkflow"},
+			"name":  b.workflowName,
+		}
+		if lang, ok := workflowLanguages[b.language]; ok {
+			wf["programmingLanguage"] = ref(lang[0])
+			graph = append(graph, wf, Entity{"@id": lang[0], "@type": "ComputerLanguage", "name": lang[1]})
+		} else {
+			if b.language != "" {
+				wf["programmingLanguage"] = b.language
+			}
+			graph = append(graph, wf)
+		}
+	}
+	setTimes(run, b.startTime, b.endTime)
+	run["actionStatus"] = string(b.runStatus())
+	if b.err != "" {
+		run["error"] = b.err
+	}
+	if len(b.inputs) > 0 {
+		run["object"] = refs(b.inputs)
+	}
+	if len(b.output) > 0 {
+		run["result"] = refs(b.output)
+	}
+	if b.agent != "" {
+		run["agent"] = ref(b.agent)
+	}
+	graph = append(graph, run)
+
+	// Tools are identified by "#tool-<slug>". Distinct tools whose slugs
+	// collide, such as "ALIGN" and "align", get a numeric suffix in the
+	// order they first appear.
+	toolIDs := map[string]string{}
+	usedIDs := map[string]bool{}
+	for _, t := range b.tasks {
+		task := t.entity()
+		if t.Tool != "" {
+			toolID, ok := toolIDs[t.Tool]
+			if !ok {
+				toolID = "#tool-" + slug(t.Tool)
+				for n := 2; usedIDs[toolID]; n++ {
+					toolID = fmt.Sprintf("#tool-%s-%d", slug(t.Tool), n)
+				}
+				toolIDs[t.Tool], usedIDs[toolID] = toolID, true
+				graph = append(graph, Entity{"@id": toolID, "@type": "SoftwareApplication", "name": t.Tool})
+			}
+			task["instrument"] = ref(toolID)
+		}
+		graph = append(graph, task)
+		root["mentions"] = append(root["mentions"].([]interface{}), ref(TaskEntityID(t.ID)))
+	}
+
+	for _, a := range b.agents {
+		graph = append(graph, Entity{"@id": a.ID, "@type": string(a.Type), "name": a.Name})
+	}
+	for _, f := range b.files {
+		e := Entity{"@id": f.ID, "@type": "File"}
+		if f.Name != "" {
+			e["name"] = f.Name
+		}
+		if f.EncodingFormat != "" {
+			e["encodingFormat"] = f.EncodingFormat
+		}
+		if f.ContentSize > 0 {
+			e["contentSize"] = fmt.Sprintf("%d", f.ContentSize)
+		}
+		if f.SHA256 != "" {
+			e["sha256"] = f.SHA256
+		}
+		graph = append(graph, e)
+		parts = append(parts, f.ID)
+	}
+	if len(parts) > 0 {
+		root["hasPart"] = refs(parts)
+	}
+
+	crate := &Crate{Context: ROCrateContext, Graph: graph}
+	if err := crate.CheckReferences(); err != nil {
+		return nil, fmt.Errorf("building RO-Crate: %w", err)
+	}
+	content, err := crate.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	if err := validateROCrate(content); err != nil {
+		return nil, fmt.Errorf("building RO-Crate: %w", err)
+	}
+	return crate, nil
+}
+
+// ApplyTo builds the crate and stores it in rl.StructuredLog, declaring the
+// matching RO-Crate LogSchema.
+func (b *CrateBuilder) ApplyTo(rl *RunLog) error {
+	crate, err := b.Build()
+	if err != nil {
+		return err
+	}
+	content, err := crate.Marshal()
+	if err != nil {
+		return err
+	}
+	rl.StructuredLog = content
+	rl.LogSchema = ROCrateLogSchema()
+	rl.StructuredLogDigest, rl.StructuredLogSignatures = nil, nil
+	return nil
+}
+
+// ROCrateLogSchema returns the LogSchema that describes crates produced by
+// this package.
+func ROCrateLogSchema() *LogSchema {
+	return &LogSchema{
+		SchemaURI:     SchemaURIROCrate,
+		Format:        FormatROCrate,
+		MediaType:     "application/ld+json",
+		SchemaVersion: "1.1",
+	}
+}
+
+// check validates the builder's inputs before assembly.
+func (b *CrateBuilder) check() error {
+	if err := checkTimes("run", b.startTime, b.endTime); err != nil {
+		return err
+	}
+	files := map[string]bool{}
+	for _, f := range b.files {
+		if f.ID == "" {
+			return fmt.Errorf("file without ID")
+		}
+		if files[f.ID] {
+			return fmt.Errorf("file %q added twice", f.ID)
+		}
+		files[f.ID] = true
+	}
+	agents := map[string]bool{}
+	for _, a := range b.agents {
+		if agents[a.ID] {
+			return fmt.Errorf("agent %q added twice", a.ID)
+		}
+		agents[a.ID] = true
+	}
+	tasks := map[string]bool{}
+	for _, t := range b.tasks {
+		if t.ID == "" {
+			return fmt.Errorf("task without ID")
+		}
+		if tasks[t.ID] {
+			return fmt.Errorf("task %q added twice", t.ID)
+		}
+		tasks[t.ID] = true
+		if err := checkTimes("task "+t.ID, t.StartTime, t.EndTime); err != nil {
+			return err
+		}
+		for _, id := range append(append([]string{}, t.Inputs...), t.Outputs...) {
+			if !files[id] {
+				return fmt.Errorf("task %s references unknown file %q; add it with Input, Output or File", t.ID, id)
+			}
+		}
+		if t.Agent != "" && !agents[t.Agent] {
+			return fmt.Errorf("task %s references unknown agent %q", t.ID, t.Agent)
+		}
+	}
+	return nil
+}
+
+// entity returns the task's CreateAction. The caller adds the tool, as
+// instrument and as a SoftwareApplication.
+func (t CrateTask) entity() Entity {
+	task := Entity{"@id": TaskEntityID(t.ID), "@type": "CreateAction", "name": t.Name}
+	if t.Name == "" {
+		task["name"] = t.ID
+	}
+	setTimes(task, t.StartTime, t.EndTime)
+	status := t.Status
+	if status == "" {
+		status = statusFromExit(t.ExitCode, t.EndTime)
+	}
+	task["actionStatus"] = string(status)
+	if t.ExitCode != 0 {
+		task["exitCode"] = t.ExitCode
+	}
+	if len(t.Inputs) > 0 {
+		task["object"] = refs(t.Inputs)
+	}
+	if len(t.Outputs) > 0 {
+		task["result"] = refs(t.Outputs)
+	}
+	if t.Agent != "" {
+		task["agent"] = ref(t.Agent)
+	}
+	return task
+}
+
+func (b *CrateBuilder) runStatus() ActionStatus {
+	if b.status != "" {
+		return b.status
+	}
+	if b.endTime != "" {
+		return ActionCompleted
+	}
+	return ActionActive
+}
+
+func statusFromExit(exitCode int, endTime string) ActionStatus {
+	switch {
+	case exitCode != 0:
+		return ActionFailed
+	case endTime != "":
+		return ActionCompleted
+	}
+	return ActionActive
+}
+
+func setTimes(e Entity, start, end string) {
+	if start != "" {
+		e["startTime"] = start
+	}
+	if end != "" {
+		e["endTime"] = end
+	}
+}
+
+// checkTimes verifies ISO 8601 (RFC 3339) timestamps in the right order.
+func checkTimes(what, start, end string) error {
+	var s, e time.Time
+	var err error
+	if start != "" {
+		if s, err = time.Parse(time.RFC3339, start); err != nil {
+			return fmt.Errorf("%s: start time %q is not ISO 8601: %w", what, start, err)
+		}
+	}
+	if end != "" {
+		if e, err = time.Parse(time.RFC3339, end); err != nil {
+			return fmt.Errorf("%s: end time %q is not ISO 8601: %w", what, end, err)
+		}
+	}
+	if start != "" && end != "" && e.Before(s) {
+		return fmt.Errorf("%s: end time %s is before start time %s", what, end, start)
+	}
+	return nil
+}
+
+// slug turns a name into a fragment-safe identifier.
+func slug(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('-')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,150 @@
+package logschema_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+func variantCallingCrate() *logschema.CrateBuilder {
+	return variantCallingCrateFor("run-001")
+}
+
+func variantCallingCrateFor(runID string) *logschema.CrateBuilder {
+	return logschema.NewCrateBuilder(runID, "variant-calling-pipeline").
+		Workflow("main.nf", "variant calling", "nextflow").
+		Times("2024-01-01T10:00:00Z", "2024-01-01T12:00:00Z").
+		Agent(logschema.CrateAgent{ID: "https://orcid.org/0000-0002-1825-0097", Name: "Josiah Carberry"}).
+		Input(logschema.CrateFile{ID: "reads.fastq", EncodingFormat: "text/plain"}).
+		File(logschema.CrateFile{ID: "aligned.bam"}).
+		Output(logschema.CrateFile{ID: "calls.vcf", ContentSize: 1024}).
+		Task(logschema.CrateTask{
+			ID: "bwa", Tool: "bwa-mem2",
+			StartTime: "2024-01-01T10:00:00Z", EndTime: "2024-01-01T10:30:00Z",
+			Inputs: []string{"reads.fastq"}, Outputs: []string{"aligned.bam"},
+		}).
+		Task(logschema.CrateTask{
+			ID: "gatk", Tool: "gatk HaplotypeCaller",
+			StartTime: "2024-01-01T10:30:00Z", EndTime: "2024-01-01T12:00:00Z",
+			Inputs: []string{"aligned.bam"}, Outputs: []string{"calls.vcf"},
+		})
+}
+
+func TestCrateBuilder_Build(t *testing.T) {
+	crate, err := variantCallingCrate().Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	run := crate.Get(logschema.RunEntityID("run-001"))
+	if run == nil || !run.HasType("CreateAction") {
+		t.Fatalf("missing run CreateAction")
+	}
+	if run.String("actionStatus") != string(logschema.ActionCompleted) {
+		t.Errorf("actionStatus = %q", run.String("actionStatus"))
+	}
+	if got := strings.Join(run.Refs("result"), ","); got != "calls.vcf" {
+		t.Errorf("run result = %q", got)
+	}
+	if wf := crate.Get("main.nf"); !wf.HasType("ComputationalWorkflow") {
+		t.Errorf("workflow entity: %v", wf)
+	}
+	bwa := crate.Get(logschema.TaskEntityID("bwa"))
+	if got := bwa.Refs("instrument"); len(got) != 1 || crate.Get(got[0]) == nil {
+		t.Errorf("task instrument not linked: %v", bwa)
+	}
+	if len(crate.Root().Refs("mentions")) != 3 {
+		t.Errorf("root should mention the run and both tasks: %v", crate.Root())
+	}
+	if got := len(crate.Root().Refs("conformsTo")); got != 3 {
+		t.Errorf("crate with a workflow should claim all three profiles: %v", crate.Root())
+	}
+}
+
+func TestCrateBuilder_NoWorkflow(t *testing.T) {
+	crate, err := logschema.NewCrateBuilder("run-001", "imported").
+		Task(logschema.CrateTask{ID: "a", Tool: "bwa mem"}).
+		Task(logschema.CrateTask{ID: "b", Tool: "bwa-mem"}).
+		Task(logschema.CrateTask{ID: "c", Tool: "ALIGN"}).
+		Task(logschema.CrateTask{ID: "d", Tool: "align"}).
+		Task(logschema.CrateTask{ID: "e", Tool: "bwa mem"}).
+		Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.Join(crate.Root().Refs("conformsTo"), ","); got != logschema.ProfileProcessRunCrate {
+		t.Errorf("conformsTo = %q, want only the Process Run Crate profile", got)
+	}
+
+	tools := map[string]string{}
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		tool := crate.Get(crate.Get(logschema.TaskEntityID(id)).Refs("instrument")[0])
+		tools[id] = tool.ID() + "=" + tool.String("name")
+	}
+	want := map[string]string{
+		"a": "#tool-bwa-mem=bwa mem", "b": "#tool-bwa-mem-2=bwa-mem",
+		"c": "#tool-align=ALIGN", "d": "#tool-align-2=align", "e": "#tool-bwa-mem=bwa mem",
+	}
+	for id, w := range want {
+		if tools[id] != w {
+			t.Errorf("task %s tool = %q, want %q", id, tools[id], w)
+		}
+	}
+}
+
+func TestCrateBuilder_ApplyToValidates(t *testing.T) {
+	rl := &logschema.RunLog{Name: "variant-calling-pipeline"}
+	if err := variantCallingCrate().ApplyTo(rl); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	result, err := (&logschema.Validator{}).ValidateRunLog(rl)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Valid || result.Format != logschema.FormatROCrate {
+		t.Errorf("built crate does not validate: %v", result)
+	}
+}
+
+func TestCrateBuilder_FromRun(t *testing.T) {
+	rl := &logschema.RunLog{Name: "wf", StartTime: "2024-01-01T10:00:00Z", EndTime: "2024-01-01T11:00:00Z", ExitCode: 1}
+	tasks := []logschema.TaskLog{
+		{ID: "a", StartTime: "2024-01-01T10:00:00Z", EndTime: "2024-01-01T10:10:00Z"},
+		{ID: "b", ExitCode: 2},
+	}
+	crate, err := logschema.CrateBuilderFromRun("r1", rl, tasks).Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s := crate.Get(logschema.RunEntityID("r1")).String("actionStatus"); s != string(logschema.ActionFailed) {
+		t.Errorf("run status = %q, want failed", s)
+	}
+	if s := crate.Get(logschema.TaskEntityID("b")).String("actionStatus"); s != string(logschema.ActionFailed) {
+		t.Errorf("task b status = %q, want failed", s)
+	}
+}
+
+func TestCrateBuilder_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		b    *logschema.CrateBuilder
+		want string
+	}{
+		{"unknown task input", logschema.NewCrateBuilder("r", "").Task(logschema.CrateTask{ID: "t", Inputs: []string{"x"}}), "unknown file"},
+		{"bad timestamp", logschema.NewCrateBuilder("r", "").Times("yesterday", ""), "ISO 8601"},
+		{"end before start", logschema.NewCrateBuilder("r", "").Times("2024-01-02T00:00:00Z", "2024-01-01T00:00:00Z"), "before start"},
+		{"duplicate file", logschema.NewCrateBuilder("r", "").Input(logschema.CrateFile{ID: "a"}).Output(logschema.CrateFile{ID: "a"}), "added twice"},
+		{"duplicate task", logschema.NewCrateBuilder("r", "").Task(logschema.CrateTask{ID: "t"}).Task(logschema.CrateTask{ID: "t"}), `task "t" added twice`},
+		{"task index colliding with an ID", logschema.CrateBuilderFromRun("r", nil, []logschema.TaskLog{{ID: "1"}, {Name: "unnamed"}}), `task "1" added twice`},
+		{"unknown task agent", logschema.NewCrateBuilder("r", "").Task(logschema.CrateTask{ID: "t", Agent: "#nobody"}), "unknown agent"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.b.Build()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Build() error = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package logschema_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+func TestParseCrate(t *testing.T) {
+	crate, err := logschema.ParseCrate(`{
+		"@context": "https://w3id.org/ro/crate/1.1/context",
+		"@graph": [
+			{"@id": "ro-crate-metadata.json", "@type": "CreativeWork", "about": {"@id": "./"}},
+			{"@id": "./", "@type": "Dataset", "mentions": [{"@id": "#run"}]},
+			{"@id": "#run", "@type": ["CreateAction"], "object": {"@id": "in.txt"}, "instrument": {"@id": "https://example.org/wf"}},
+			{"@id": "in.txt", "@type": "File"}
+		]
+	}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if root := crate.Root(); root.ID() != "./" {
+		t.Errorf("Root() = %v", root)
+	}
+	run := crate.Get("#run")
+	if !run.HasType("CreateAction") || strings.Join(run.Refs("object"), ",") != "in.txt" {
+		t.Errorf("unexpected run entity: %v", run)
+	}
+	if err := crate.CheckReferences(); err != nil {
+		t.Errorf("absolute instrument URI should not dangle: %v", err)
+	}
+
+	crate.Graph = crate.Graph[:3]
+	if err := crate.CheckReferences(); err == nil || !strings.Contains(err.Error(), "in.txt") {
+		t.Errorf("expected dangling reference to in.txt, got %v", err)
+	}
+
+	if _, err := logschema.ParseCrate(`{"@context": "x", "@graph": "nope"}`); err == nil {
+		t.Error("expected error for non-array @graph")
+	}
+}
@@ -0,0 +1,100 @@
+package logschema
+
+// Run mirrors the WES response envelope returned by GET /runs/{run_id}.
+// Its run_log is this package's RunLog, and its task_logs carry the
+// task-level structured logs that inherit the run's log_schema.
+type Run struct {
+	RunID       string                 `json:"run_id,omitempty"`
+	State       string                 `json:"state,omitempty"`
+	Request     map[string]interface{} `json:"request,omitempty"`
+	RunLog      *RunLog                `json:"run_log,omitempty"`
+	TaskLogsURL string                 `json:"task_logs_url,omitempty"`
+	TaskLogs    []TaskLog              `json:"task_logs,omitempty"`
+	Outputs     map[string]interface{} `json:"outputs,omitempty"`
+}
+
+// RunResult aggregates the validation results for a whole run.
+type RunResult struct {
+	// Run is the result for the run-level structured_log, or nil if the
+	// run has none.
+	Run *ValidationResult `json:"run,omitempty"`
+
+	// Tasks holds one entry per task log, in the same order. An entry is
+	// nil when that task has no structured_log.
+	Tasks []*ValidationResult `json:"tasks,omitempty"`
+
+	// Attempts holds the attempt-level results, indexed like Tasks and then
+	// like each TaskLog's Logs. It is nil when no attempt carries a
+	// structured_log.
+	Attempts [][]*ValidationResult `json:"attempts,omitempty"`
+}
+
+// Valid reports whether every validated log in the run passed.
+func (r *RunResult) Valid() bool {
+	return r.Failures() == 0
+}
+
+// Failures returns how many validated logs in the run failed.
+func (r *RunResult) Failures() int {
+	n := 0
+	if r.Run != nil && !r.Run.Valid {
+		n++
+	}
+	for _, t := range r.Tasks {
+		if t != nil && !t.Valid {
+			n++
+		}
+	}
+	for _, attempts := range r.Attempts {
+		for _, a := range attempts {
+			if a != nil && !a.Valid {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// ValidateRun validates the run-level structured_log, every task's
+// structured_log and every attempt's structured_log, applying schema
+// inheritance from the run to its tasks and from each task to its attempts.
+func (v *Validator) ValidateRun(rl *RunLog, tasks []TaskLog) (*RunResult, error) {
+	out := &RunResult{}
+	var parent *LogSchema
+	if rl != nil {
+		res, err := v.ValidateRunLog(rl)
+		if err != nil {
+			return nil, err
+		}
+		out.Run = res
+		parent = rl.LogSchema
+	}
+	attempts := make([][]*ValidationResult, len(tasks))
+	hasAttempts := false
+	for i := range tasks {
+		res, err := v.ValidateTaskLog(&tasks[i], parent)
+		if err != nil {
+			return nil, err
+		}
+		out.Tasks = append(out.Tasks, res)
+
+		taskSchema := tasks[i].LogSchema
+		if taskSchema == nil {
+			taskSchema = parent
+		}
+		for j := range tasks[i].Logs {
+			ar, err := v.ValidateLog(&tasks[i].Logs[j], taskSchema)
+			if err != nil {
+				return nil, err
+			}
+			if ar != nil {
+				hasAttempts = true
+			}
+			attempts[i] = append(attempts[i], ar)
+		}
+	}
+	if hasAttempts {
+		out.Attempts = attempts
+	}
+	return out, nil
+}
@@ -0,0 +1,91 @@
+package logschema_test
+
+import (
+	"testing"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+func TestValidator_ValidateRun(t *testing.T) {
+	v := &logschema.Validator{}
+
+	runSchema := &logschema.LogSchema{
+		SchemaURI: "https://w3id.org/ro/crate/1.1",
+		Format:    logschema.FormatROCrate,
+	}
+	crate := `{"@context": "https://w3id.org/ro/crate/1.1/context", "@graph": []}`
+
+	t.Run("tasks inherit the run schema", func(t *testing.T) {
+		rl := &logschema.RunLog{StructuredLog: crate, LogSchema: runSchema}
+		tasks := []logschema.TaskLog{
+			{ID: "t1", StructuredLog: crate},
+			{ID: "t2"}, // nothing to validate
+		}
+		res, err := v.ValidateRun(rl, tasks)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !res.Valid() {
+			t.Fatalf("expected valid run, got %+v", res)
+		}
+		if len(res.Tasks) != 2 || res.Tasks[0] == nil || res.Tasks[1] != nil {
+			t.Errorf("unexpected task results: %+v", res.Tasks)
+		}
+	})
+
+	t.Run("one invalid task makes the run invalid", func(t *testing.T) {
+		rl := &logschema.RunLog{StructuredLog: crate, LogSchema: runSchema}
+		tasks := []logschema.TaskLog{{StructuredLog: `{"@context": "x"}`}}
+		res, err := v.ValidateRun(rl, tasks)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if res.Valid() {
+			t.Error("expected invalid run when a task crate lacks @graph")
+		}
+	})
+
+	t.Run("nil run log validates tasks without a parent schema", func(t *testing.T) {
+		res, err := v.ValidateRun(nil, []logschema.TaskLog{{StructuredLog: crate}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if res.Run != nil || res.Valid() {
+			t.Errorf("expected invalid task without schema, got %+v", res)
+		}
+	})
+}
+
+func TestValidator_ValidateRun_Attempts(t *testing.T) {
+	v := &logschema.Validator{}
+	runSchema := &logschema.LogSchema{SchemaURI: "https://w3id.org/ro/crate/1.1", Format: logschema.FormatROCrate}
+	provSchema := &logschema.LogSchema{SchemaURI: "https://www.w3.org/TR/prov-o/", Format: logschema.FormatOPM}
+
+	tasks := []logschema.TaskLog{
+		{
+			ID:        "t1",
+			LogSchema: provSchema,
+			Logs: []logschema.Log{
+				{ExitCode: 1},                       // no structured_log
+				{StructuredLog: `{"activity": {}}`}, // inherits the task's PROV schema
+			},
+		},
+		{
+			ID:   "t2",
+			Logs: []logschema.Log{{StructuredLog: `{"activity": {}}`}}, // inherits run RO-Crate schema
+		},
+	}
+	res, err := v.ValidateRun(&logschema.RunLog{LogSchema: runSchema}, tasks)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(res.Attempts) != 2 || res.Attempts[0][0] != nil || !res.Attempts[0][1].Valid {
+		t.Fatalf("unexpected attempt results: %+v", res.Attempts)
+	}
+	if a := res.Attempts[1][0]; a.Valid || a.Level != "attempt" {
+		t.Errorf("expected invalid attempt-level result for PROV content under RO-Crate schema, got %+v", a)
+	}
+	if res.Failures() != 1 {
+		t.Errorf("Failures() = %d, want 1", res.Failures())
+	}
+}
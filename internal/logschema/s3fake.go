@@ -0,0 +1,212 @@
+package logschema
+
+import (
+	"crypto/hmac"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeS3 is an in-memory, S3-compatible server on an httptest listener, for
+// testing S3LogStore without MinIO. It implements path-style PutObject,
+// GetObject and ListObjectsV2 and rejects requests and presigned URLs whose
+// Signature Version 4 does not verify.
+type FakeS3 struct {
+	*httptest.Server
+
+	// Credentials the server accepts.
+	AccessKeyID     string
+	SecretAccessKey string
+	Region          string
+
+	// PageSize caps the keys per ListObjectsV2 page. Defaults to 1000.
+	PageSize int
+
+	mu      sync.Mutex
+	buckets map[string]map[string]fakeObject
+}
+
+type fakeObject struct {
+	body     []byte
+	modified time.Time
+}
+
+// NewFakeS3 starts a fake S3 server with the given, empty, buckets.
+func NewFakeS3(buckets ...string) *FakeS3 {
+	f := &FakeS3{
+		AccessKeyID:     "AKIAFAKES3EXAMPLE",
+		SecretAccessKey: "fake-s3-secret",
+		Region:          "us-east-1",
+		buckets:         map[string]map[string]fakeObject{},
+	}
+	for _, b := range buckets {
+		f.buckets[b] = map[string]fakeObject{}
+	}
+	f.Server = httptest.NewServer(f)
+	return f
+}
+
+// Store returns an S3LogStore for bucket on this server.
+func (f *FakeS3) Store(bucket string) *S3LogStore {
+	return &S3LogStore{
+		Endpoint:        f.URL,
+		Region:          f.Region,
+		Bucket:          bucket,
+		AccessKeyID:     f.AccessKeyID,
+		SecretAccessKey: f.SecretAccessKey,
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (f *FakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		fakeS3Error(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	if code, msg := f.authenticate(r, body); code != "" {
+		fakeS3Error(w, http.StatusForbidden, code, msg)
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	objects, ok := f.buckets[bucket]
+	if !ok {
+		fakeS3Error(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+	switch {
+	case key == "" && r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		f.list(w, r.URL.Query(), objects)
+	case key != "" && r.Method == http.MethodPut:
+		objects[key] = fakeObject{body: body, modified: time.Now().UTC().Truncate(time.Millisecond)}
+	case key != "" && r.Method == http.MethodGet:
+		obj, ok := objects[key]
+		if !ok {
+			fakeS3Error(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		w.Write(obj.body)
+	default:
+		fakeS3Error(w, http.StatusNotImplemented, "NotImplemented", r.Method+" is not implemented by FakeS3")
+	}
+}
+
+// list answers ListObjectsV2; continuation tokens are the last key sent.
+func (f *FakeS3) list(w http.ResponseWriter, q url.Values, objects map[string]fakeObject) {
+	pageSize := f.PageSize
+	if pageSize <= 0 {
+		pageSize = 1000
+	}
+	var keys []string
+	for k := range objects {
+		if strings.HasPrefix(k, q.Get("prefix")) && k > q.Get("continuation-token") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	type content struct {
+		Key          string `xml:"Key"`
+		LastModified string `xml:"LastModified"`
+		Size         int    `xml:"Size"`
+	}
+	res := struct {
+		XMLName               xml.Name  `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+		Prefix                string    `xml:"Prefix"`
+		KeyCount              int       `xml:"KeyCount"`
+		IsTruncated           bool      `xml:"IsTruncated"`
+		NextContinuationToken string    `xml:"NextContinuationToken,omitempty"`
+		Contents              []content `xml:"Contents"`
+	}{Prefix: q.Get("prefix")}
+	if len(keys) > pageSize {
+		keys = keys[:pageSize]
+		res.IsTruncated = true
+		res.NextContinuationToken = keys[len(keys)-1]
+	}
+	for _, k := range keys {
+		obj := objects[k]
+		res.Contents = append(res.Contents, content{Key: k, LastModified: obj.modified.Format(time.RFC3339Nano), Size: len(obj.body)})
+	}
+	res.KeyCount = len(keys)
+	w.Header().Set("Content-Type", "application/xml")
+	io.WriteString(w, xml.Header)
+	xml.NewEncoder(w).Encode(res)
+}
+
+// authenticate verifies the SigV4 Authorization header or presigned query
+// of r and returns an S3 error code if it does not verify.
+func (f *FakeS3) authenticate(r *http.Request, body []byte) (code, msg string) {
+	q := r.URL.Query()
+	var credential, signedHeaders, signature, amzDate, payloadHash string
+	expires := 15 * time.Minute
+	if q.Get("X-Amz-Signature") != "" {
+		credential, signedHeaders, signature = q.Get("X-Amz-Credential"), q.Get("X-Amz-SignedHeaders"), q.Get("X-Amz-Signature")
+		amzDate, payloadHash = q.Get("X-Amz-Date"), sigV4Unsigned
+		secs, err := strconv.Atoi(q.Get("X-Amz-Expires"))
+		if err != nil || secs <= 0 || time.Duration(secs)*time.Second > sigV4MaxExpiry {
+			return "AuthorizationQueryParametersError", "invalid X-Amz-Expires"
+		}
+		expires = time.Duration(secs) * time.Second
+		q.Del("X-Amz-Signature")
+	} else {
+		auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), sigV4Algorithm+" ")
+		if !ok {
+			return "AccessDenied", "missing Signature Version 4 authorization"
+		}
+		for _, part := range strings.Split(auth, ",") {
+			k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+			switch k {
+			case "Credential":
+				credential = v
+			case "SignedHeaders":
+				signedHeaders = v
+			case "Signature":
+				signature = v
+			}
+		}
+		amzDate, payloadHash = r.Header.Get("X-Amz-Date"), r.Header.Get("X-Amz-Content-Sha256")
+		if payloadHash != sigV4Unsigned && payloadHash != hexSHA256(body) {
+			return "XAmzContentSHA256Mismatch", "the payload does not match X-Amz-Content-Sha256"
+		}
+	}
+
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 || parts[0] != f.AccessKeyID || parts[4] != "aws4_request" {
+		return "InvalidAccessKeyId", "unknown access key or malformed credential scope"
+	}
+	t, err := time.Parse(amzDateFormat, amzDate)
+	if err != nil || parts[1] != t.Format(amzShortFormat) || parts[2] != f.Region {
+		return "AuthorizationHeaderMalformed", "bad date or region in credential scope"
+	}
+	if now := time.Now(); now.Before(t.Add(-15*time.Minute)) || now.After(t.Add(expires)) {
+		return "AccessDenied", "request has expired"
+	}
+	signed := strings.Split(signedHeaders, ";")
+	if !sort.StringsAreSorted(signed) || !slices.Contains(signed, "host") {
+		return "AuthorizationHeaderMalformed", "SignedHeaders must be sorted and include host"
+	}
+	sv := sigV4{accessKey: f.AccessKeyID, secret: f.SecretAccessKey, region: f.Region, service: parts[3]}
+	canon := canonicalRequest(r.Method, r.URL.Path, q, r.Header, r.Host, signed, payloadHash)
+	if !hmac.Equal([]byte(signature), []byte(sv.signature(parts[1], amzDate, canon))) {
+		return "SignatureDoesNotMatch", "the request signature does not match"
+	}
+	return "", ""
+}
+
+func fakeS3Error(w http.ResponseWriter, status int, code, msg string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "%s<Error><Code>%s</Code><Message>%s</Message></Error>", xml.Header, code, msg)
+}
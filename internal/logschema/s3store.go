@@ -0,0 +1,402 @@
+package logschema
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3LogStore is a LogStore in a bucket of an S3-compatible object store,
+// such as AWS S3 or MinIO, addressed by s3://<bucket>/<key> URIs. Requests
+// are signed with AWS Signature Version 4.
+type S3LogStore struct {
+	// Endpoint is the service root, e.g. "https://s3.eu-west-1.amazonaws.com"
+	// or "http://localhost:9000".
+	Endpoint string
+
+	// Region is the signing region. Defaults to us-east-1.
+	Region string
+
+	Bucket string
+
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken accompanies temporary credentials.
+	SessionToken string
+
+	// VirtualHosted addresses the bucket as a subdomain of Endpoint, as AWS
+	// prefers. By default the bucket is the first path segment, which MinIO
+	// and most stand-ins expect.
+	VirtualHosted bool
+
+	// HTTPClient defaults to a client with a 30s timeout if nil.
+	HTTPClient *http.Client
+
+	// Clock returns the signing time. Defaults to time.Now.
+	Clock func() time.Time
+
+	// MaxSize bounds the size of an object read by Get. Zero selects
+	// DefaultMaxDecodedSize.
+	MaxSize int64
+}
+
+const (
+	sigV4Algorithm = "AWS4-HMAC-SHA256"
+	sigV4Unsigned  = "UNSIGNED-PAYLOAD"
+	sigV4MaxExpiry = 7 * 24 * time.Hour
+	amzDateFormat  = "20060102T150405Z"
+	amzShortFormat = "20060102"
+	s3ListMaxPages = 1000 // bounds ListObjectsV2 paging
+)
+
+func (s *S3LogStore) httpClient() *http.Client {
+	if s.HTTPClient != nil {
+		return s.HTTPClient
+	}
+	return &http.Client{Timeout: 30 * time.Second}
+}
+
+func (s *S3LogStore) now() time.Time {
+	if s.Clock != nil {
+		return s.Clock().UTC()
+	}
+	return time.Now().UTC()
+}
+
+func (s *S3LogStore) signer() sigV4 {
+	region := s.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	return sigV4{accessKey: s.AccessKeyID, secret: s.SecretAccessKey, region: region, service: "s3"}
+}
+
+func (s *S3LogStore) uri(key string) string {
+	return "s3://" + s.Bucket + "/" + key
+}
+
+// key returns the key an s3:// URI refers to.
+func (s *S3LogStore) key(uri string) (string, bool) {
+	key, ok := strings.CutPrefix(uri, "s3://"+s.Bucket+"/")
+	if !ok || checkKey(key) != nil {
+		return "", false
+	}
+	return key, true
+}
+
+// objectURL returns the HTTP(S) URL of key, or of the bucket if key is
+// empty.
+func (s *S3LogStore) objectURL(key string) (*url.URL, error) {
+	u, err := url.Parse(s.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", s.Endpoint)
+	}
+	if s.Bucket == "" {
+		return nil, fmt.Errorf("no S3 bucket configured")
+	}
+	base := strings.TrimSuffix(u.Path, "/")
+	if s.VirtualHosted {
+		u.Host = s.Bucket + "." + u.Host
+		u.Path = base + "/" + key
+	} else {
+		u.Path = base + "/" + s.Bucket + "/" + key
+	}
+	u.RawPath = awsEscapePath(u.Path)
+	u.RawQuery = ""
+	return u, nil
+}
+
+// do sends a signed request and returns the response for status 200.
+func (s *S3LogStore) do(method string, u *url.URL, body []byte, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	t := s.now()
+	req.Header.Set("X-Amz-Date", t.Format(amzDateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", hexSHA256(body))
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+	var signed []string
+	for k := range req.Header {
+		if k := strings.ToLower(k); k == "content-type" || strings.HasPrefix(k, "x-amz-") {
+			signed = append(signed, k)
+		}
+	}
+	signed = append(signed, "host")
+	sort.Strings(signed)
+
+	sv := s.signer()
+	date := t.Format(amzShortFormat)
+	canon := canonicalRequest(method, u.Path, u.Query(), req.Header, u.Host, signed, hexSHA256(body))
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, sv.accessKey, sv.scope(date), strings.Join(signed, ";"), sv.signature(date, t.Format(amzDateFormat), canon)))
+
+	resp, err := s.httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 %s %s: %w", method, u.Redacted(), err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, s3Failure(resp)
+	}
+	return resp, nil
+}
+
+// Owns implements LogStore.
+func (s *S3LogStore) Owns(uri string) bool {
+	_, ok := s.key(uri)
+	return ok
+}
+
+// Put implements LogStore.
+func (s *S3LogStore) Put(key string, content []byte, mediaType string) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	u, err := s.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+	header := http.Header{}
+	if mediaType != "" {
+		header.Set("Content-Type", mediaType)
+	}
+	resp, err := s.do(http.MethodPut, u, content, header)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return s.uri(key), nil
+}
+
+// Get implements LogStore.
+func (s *S3LogStore) Get(uri string) ([]byte, error) {
+	key, ok := s.key(uri)
+	if !ok {
+		return nil, fmt.Errorf("%q is not in log store s3://%s", uri, s.Bucket)
+	}
+	u, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(http.MethodGet, u, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	limit := s.MaxSize
+	if limit <= 0 {
+		limit = DefaultMaxDecodedSize
+	}
+	if resp.ContentLength > limit {
+		return nil, fmt.Errorf("%s is %d bytes: %w of %d bytes", uri, resp.ContentLength, ErrContentTooLarge, limit)
+	}
+	body, err := readLimited(resp.Body, limit)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", uri, err)
+	}
+	return body, nil
+}
+
+// s3ListResult is a ListObjectsV2 response.
+type s3ListResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+}
+
+// List implements LogStore with ListObjectsV2.
+func (s *S3LogStore) List(prefix string) ([]StoredLog, error) {
+	u, err := s.objectURL("")
+	if err != nil {
+		return nil, err
+	}
+	var out []StoredLog
+	token := ""
+	for page := 0; page < s3ListMaxPages; page++ {
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		u.RawQuery = awsQuery(q)
+		resp, err := s.do(http.MethodGet, u, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var res s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decoding ListObjectsV2 response: %w", err)
+		}
+		for _, c := range res.Contents {
+			out = append(out, StoredLog{Key: c.Key, URI: s.uri(c.Key), Size: c.Size, Modified: c.LastModified})
+		}
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+			return out, nil
+		}
+		token = res.NextContinuationToken
+	}
+	return nil, fmt.Errorf("listing s3://%s/%s: too many pages", s.Bucket, prefix)
+}
+
+// Presign implements LogStore with a SigV4 query-string signature. ttl is
+// at most seven days.
+func (s *S3LogStore) Presign(uri string, ttl time.Duration) (string, error) {
+	if ttl < time.Second || ttl > sigV4MaxExpiry {
+		return "", fmt.Errorf("presigned URL lifetime must be between 1s and %s, got %s", sigV4MaxExpiry, ttl)
+	}
+	key, ok := s.key(uri)
+	if !ok {
+		return "", fmt.Errorf("%q is not in log store s3://%s", uri, s.Bucket)
+	}
+	u, err := s.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+	sv := s.signer()
+	t := s.now()
+	date := t.Format(amzShortFormat)
+	q := url.Values{
+		"X-Amz-Algorithm":     {sigV4Algorithm},
+		"X-Amz-Credential":    {sv.accessKey + "/" + sv.scope(date)},
+		"X-Amz-Date":          {t.Format(amzDateFormat)},
+		"X-Amz-Expires":       {strconv.Itoa(int(ttl / time.Second))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	if s.SessionToken != "" {
+		q.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+	canon := canonicalRequest(http.MethodGet, u.Path, q, nil, u.Host, []string{"host"}, sigV4Unsigned)
+	u.RawQuery = awsQuery(q) + "&X-Amz-Signature=" + sv.signature(date, t.Format(amzDateFormat), canon)
+	return u.String(), nil
+}
+
+// s3Failure turns an S3 error response into an error, wrapping
+// ErrLogNotFound for missing keys.
+func s3Failure(resp *http.Response) error {
+	var e struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	xml.Unmarshal(body, &e)
+	where := resp.Request.Method + " " + resp.Request.URL.Path
+	if e.Code == "NoSuchKey" || (e.Code == "" && resp.StatusCode == http.StatusNotFound) {
+		return fmt.Errorf("%w: s3 %s", ErrLogNotFound, where)
+	}
+	if e.Code == "" {
+		return fmt.Errorf("s3 %s returned HTTP %d", where, resp.StatusCode)
+	}
+	return fmt.Errorf("s3 %s returned HTTP %d: %s: %s", where, resp.StatusCode, e.Code, e.Message)
+}
+
+// sigV4 computes AWS Signature Version 4 signatures.
+type sigV4 struct {
+	accessKey, secret, region, service string
+}
+
+func (s sigV4) scope(date string) string {
+	return date + "/" + s.region + "/" + s.service + "/aws4_request"
+}
+
+// signature signs a canonical request made at amzDate.
+func (s sigV4) signature(date, amzDate, canonicalRequest string) string {
+	toSign := sigV4Algorithm + "\n" + amzDate + "\n" + s.scope(date) + "\n" + hexSHA256([]byte(canonicalRequest))
+	k := hmacSHA256([]byte("AWS4"+s.secret), date)
+	k = hmacSHA256(k, s.region)
+	k = hmacSHA256(k, s.service)
+	k = hmacSHA256(k, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(k, toSign))
+}
+
+// canonicalRequest builds the SigV4 canonical request. path is unescaped;
+// query must not contain X-Amz-Signature.
+func canonicalRequest(method, path string, query url.Values, header http.Header, host string, signed []string, payloadHash string) string {
+	var b strings.Builder
+	b.WriteString(method + "\n")
+	b.WriteString(awsEscapePath(path) + "\n")
+	b.WriteString(awsQuery(query) + "\n")
+	for _, name := range signed {
+		value := host
+		if name != "host" {
+			value = strings.Join(strings.Fields(strings.Join(header.Values(name), ",")), " ")
+		}
+		b.WriteString(name + ":" + value + "\n")
+	}
+	b.WriteString("\n" + strings.Join(signed, ";") + "\n")
+	b.WriteString(payloadHash)
+	return b.String()
+}
+
+// awsQuery encodes a query string the way SigV4 canonicalises it.
+func awsQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vs := append([]string(nil), q[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsEscapePath escapes each segment of a path with awsEscape.
+func awsEscapePath(path string) string {
+	segs := strings.Split(path, "/")
+	for i, seg := range segs {
+		segs[i] = awsEscape(seg)
+	}
+	return strings.Join(segs, "/")
+}
+
+// awsEscape percent-encodes everything but RFC 3986 unreserved characters.
+func awsEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hexSHA256(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
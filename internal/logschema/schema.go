@@ -6,8 +6,10 @@ package logschema
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 )
@@ -22,6 +24,12 @@ const (
 	FormatCustom     Format = "custom"      // Any other format
 )
 
+// Well-known schema URIs for the built-in formats.
+const (
+	SchemaURIROCrate = "https://w3id.org/ro/crate/1.1"
+	SchemaURIPROV    = "https://www.w3.org/TR/prov-o/"
+)
+
 // LogSchema describes the shape of structured log content.
 type LogSchema struct {
 	// SchemaURI is a resolvable URI pointing to the schema definition.
@@ -37,6 +45,11 @@ type LogSchema struct {
 
 	// SchemaVersion allows clients to handle backward-incompatible changes.
 	SchemaVersion string `json:"schema_version,omitempty"`
+
+	// ContentEncoding is how an inline structured_log is encoded, e.g.
+	// "gzip+base64". MediaType describes the decoded content. A
+	// structured_log URI is fetched as is. Defaults to "identity".
+	ContentEncoding string `json:"content_encoding,omitempty"`
 }
 
 // Validate performs basic structural validation of the LogSchema itself.
@@ -44,9 +57,8 @@ func (ls *LogSchema) Validate() error {
 	if ls.SchemaURI == "" {
 		return fmt.Errorf("log_schema.schema_uri is required")
 	}
-	if !strings.HasPrefix(ls.SchemaURI, "http://") &&
-		!strings.HasPrefix(ls.SchemaURI, "https://") {
-		return fmt.Errorf("log_schema.schema_uri must be an absolute HTTP/HTTPS URI, got: %q", ls.SchemaURI)
+	if !isHTTPURI(ls.SchemaURI) && !isDRSURI(ls.SchemaURI) {
+		return fmt.Errorf("log_schema.schema_uri must be an absolute HTTP/HTTPS or DRS URI, got: %q", ls.SchemaURI)
 	}
 	switch ls.Format {
 	case FormatOPM, FormatROCrate, FormatJSONSchema, FormatCustom, "":
@@ -54,6 +66,9 @@ func (ls *LogSchema) Validate() error {
 	default:
 		return fmt.Errorf("log_schema.format %q is not a recognised value", ls.Format)
 	}
+	if _, _, err := parseContentEncoding(ls.ContentEncoding); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -81,6 +96,13 @@ type RunLog struct {
 
 	// LogSchema describes the shape of StructuredLog.
 	LogSchema *LogSchema `json:"log_schema,omitempty"`
+
+	// StructuredLogDigest is an optional content hash of StructuredLog.
+	StructuredLogDigest *Digest `json:"structured_log_digest,omitempty"`
+
+	// StructuredLogSignatures are optional detached signatures over
+	// StructuredLog.
+	StructuredLogSignatures []Signature `json:"structured_log_signatures,omitempty"`
 }
 
 // Log is the per-executor attempt log.
@@ -90,10 +112,28 @@ type Log struct {
 	Stdout    string `json:"stdout,omitempty"`
 	Stderr    string `json:"stderr,omitempty"`
 	ExitCode  int    `json:"exit_code,omitempty"`
+
+	// StructuredLog is the attempt-level structured log, if any.
+	StructuredLog string `json:"structured_log,omitempty"`
+
+	// LogSchema describes the shape of StructuredLog. If absent, it is
+	// inherited from the TaskLog (and transitively from the RunLog).
+	LogSchema *LogSchema `json:"log_schema,omitempty"`
+
+	// StructuredLogDigest is an optional content hash of StructuredLog.
+	// Unlike LogSchema it is never inherited.
+	StructuredLogDigest *Digest `json:"structured_log_digest,omitempty"`
+
+	// StructuredLogSignatures are optional detached signatures over
+	// StructuredLog.
+	StructuredLogSignatures []Signature `json:"structured_log_signatures,omitempty"`
 }
 
 // TaskLog mirrors the WES TaskLog with structured logging support.
 type TaskLog struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+
 	Logs      []Log             `json:"logs,omitempty"`
 	Metadata  map[string]string `json:"metadata,omitempty"`
 	StartTime string            `json:"start_time,omitempty"`
@@ -109,20 +149,56 @@ type TaskLog struct {
 	// LogSchema describes the shape of StructuredLog. If absent,
 	// it should be inherited from the parent RunLog.
 	LogSchema *LogSchema `json:"log_schema,omitempty"`
+
+	// StructuredLogDigest is an optional content hash of StructuredLog.
+	// Unlike LogSchema it is never inherited.
+	StructuredLogDigest *Digest `json:"structured_log_digest,omitempty"`
+
+	// StructuredLogSignatures are optional detached signatures over
+	// StructuredLog.
+	StructuredLogSignatures []Signature `json:"structured_log_signatures,omitempty"`
 }
 
-// Validator checks structured log payloads against schemas.
+// Validation stages, reported in ValidationResult.Stage when a check fails.
+const (
+	StageMissingSchema = "missing_schema"   // no log_schema declared or inherited
+	StageSchema        = "log_schema"       // the log_schema itself is malformed
+	StageResolve       = "schema_resolve"   // schema_uri could not be fetched
+	StageEncoding      = "content_encoding" // inline content cannot be decoded
+	StageFetch         = "fetch"            // content in a LogStore or behind a DRS URI cannot be read
+	StageMediaType     = "media_type"       // content does not parse as media_type
+	StageFormat        = "format"           // format-specific structure is wrong
+	StageDigest        = "digest"           // structured_log_digest does not match the content
+	StageSignature     = "signature"        // a signature is invalid, or a required one is missing
+)
+
+// ValidationResult is the outcome of validating one structured_log.
 type ValidationResult struct {
-	Valid   bool
-	Level   string // "workflow" or "task"
-	Format  Format
-	Errors  []string
-	Elapsed time.Duration
+	Valid   bool          `json:"valid"`
+	Level   string        `json:"level"` // "workflow", "task" or "attempt"
+	Format  Format        `json:"format,omitempty"`
+	Stage   string        `json:"stage,omitempty"` // failing stage; empty when valid
+	Errors  []string      `json:"errors,omitempty"`
+	Elapsed time.Duration `json:"elapsed_ns"`
+
+	// Suggestion is the detected schema for a structured_log that has no
+	// log_schema (Stage == StageMissingSchema), if one could be inferred.
+	Suggestion *Detection `json:"suggestion,omitempty"`
+
+	// Signatures reports the check of each structured_log signature.
+	Signatures []SignatureStatus `json:"signatures,omitempty"`
 }
 
 // String returns a human-readable summary of the validation result.
 func (v *ValidationResult) String() string {
 	if v.Valid {
+		var signed []string
+		for _, s := range v.Signatures {
+			signed = append(signed, fmt.Sprintf("%s %s", s.KeyID, s.State))
+		}
+		if len(signed) > 0 {
+			return fmt.Sprintf("[%s/%s] ✓ valid (%s), signatures: %s", v.Level, v.Format, v.Elapsed, strings.Join(signed, ", "))
+		}
 		return fmt.Sprintf("[%s/%s] ✓ valid (%s)", v.Level, v.Format, v.Elapsed)
 	}
 	return fmt.Sprintf("[%s/%s] ✗ invalid: %s", v.Level, v.Format, strings.Join(v.Errors, "; "))
@@ -133,6 +209,44 @@ type Validator struct {
 	// HTTPClient is used to resolve external schema URIs.
 	// Defaults to a client with a 10s timeout if nil.
 	HTTPClient *http.Client
+
+	// SchemaDir is a local directory of schema documents that is consulted
+	// before the network. A schema_uri such as "https://w3id.org/ro/crate/1.1"
+	// maps to SchemaDir/w3id.org/ro/crate/1.1 (optionally with a ".json"
+	// suffix, or an index.json inside that directory).
+	SchemaDir string
+
+	// Offline disables all network access. Schemas are then resolved from
+	// SchemaDir only.
+	Offline bool
+
+	// ResolveSchemas makes validation fail when the declared schema_uri
+	// cannot be fetched. By default schema URIs are only checked for shape.
+	ResolveSchemas bool
+
+	// Keys verifies structured_log signatures. Without it signatures are
+	// reported as unchecked.
+	Keys KeyProvider
+
+	// RequireSignatures makes validation fail for a structured_log without
+	// at least one verified signature. Invalid signatures always fail.
+	RequireSignatures bool
+
+	// MaxDecodedSize bounds the decoded size of a structured_log with a
+	// content_encoding, and the size of anything fetched from a URI:
+	// remote structured logs, schemas and JSON-LD contexts. Zero selects
+	// DefaultMaxDecodedSize.
+	MaxDecodedSize int64
+
+	// Store holds externalised structured logs. A structured_log whose URI
+	// belongs to Store is read through it, even when Offline, and then
+	// validated like inline content.
+	Store LogStore
+
+	// DRS resolves drs:// structured_log and schema_uri values. A
+	// structured_log behind a DRS URI is then fetched and validated like
+	// inline content. Without it DRS URIs are accepted but not fetched.
+	DRS *DRSResolver
 }
 
 func (v *Validator) httpClient() *http.Client {
@@ -151,13 +265,9 @@ func (v *Validator) ValidateRunLog(rl *RunLog) (*ValidationResult, error) {
 	}
 	if rl.LogSchema == nil {
 		// structured_log is present but no schema declared — warn but don't error.
-		return &ValidationResult{
-			Valid:  false,
-			Level:  "workflow",
-			Errors: []string{"structured_log is set but log_schema is missing — clients cannot determine log shape"},
-		}, nil
+		return missingSchema("workflow", rl.StructuredLog, "structured_log is set but log_schema is missing — clients cannot determine log shape"), nil
 	}
-	return v.validate("workflow", rl.StructuredLog, rl.LogSchema)
+	return v.validate("workflow", rl.StructuredLog, rl.LogSchema, rl.StructuredLogDigest, rl.StructuredLogSignatures)
 }
 
 // ValidateTaskLog validates the structured_log of a TaskLog.
@@ -174,17 +284,50 @@ func (v *Validator) ValidateTaskLog(tl *TaskLog, parentSchema *LogSchema) (*Vali
 		schema = parentSchema
 	}
 	if schema == nil {
-		return &ValidationResult{
-			Valid:  false,
-			Level:  "task",
-			Errors: []string{"structured_log is set but no log_schema found (neither on task nor inherited from run)"},
-		}, nil
+		return missingSchema("task", tl.StructuredLog, "structured_log is set but no log_schema found (neither on task nor inherited from run)"), nil
+	}
+	return v.validate("task", tl.StructuredLog, schema, tl.StructuredLogDigest, tl.StructuredLogSignatures)
+}
+
+// ValidateLog validates the structured_log of a single task attempt.
+// parentSchema is the effective schema of the owning TaskLog.
+func (v *Validator) ValidateLog(l *Log, parentSchema *LogSchema) (*ValidationResult, error) {
+	if l.StructuredLog == "" {
+		return nil, nil
+	}
+
+	schema := l.LogSchema
+	if schema == nil {
+		schema = parentSchema
+	}
+	if schema == nil {
+		return missingSchema("attempt", l.StructuredLog, "structured_log is set but no log_schema found (neither on attempt nor inherited from task or run)"), nil
+	}
+	return v.validate("attempt", l.StructuredLog, schema, l.StructuredLogDigest, l.StructuredLogSignatures)
+}
+
+// missingSchema builds the result for a structured_log without any schema,
+// suggesting one detected from the content when possible.
+func missingSchema(level, content, msg string) *ValidationResult {
+	result := &ValidationResult{
+		Valid:  false,
+		Level:  level,
+		Stage:  StageMissingSchema,
+		Errors: []string{msg},
+	}
+	if !isLogURI(content) {
+		if d := DetectSchema([]byte(content)); d != nil && d.Schema.SchemaURI != "" {
+			result.Suggestion = d
+			result.Errors = append(result.Errors, fmt.Sprintf("content looks like %s (schema_uri %q, confidence %.2f)",
+				d.Schema.Format, d.Schema.SchemaURI, d.Confidence))
+		}
 	}
-	return v.validate("task", tl.StructuredLog, schema)
+	return result
 }
 
 // validate is the shared core validation logic.
-func (v *Validator) validate(level, content string, schema *LogSchema) (*ValidationResult, error) {
+// digest and sigs, if any, are checked against the content last.
+func (v *Validator) validate(level, content string, schema *LogSchema, digest *Digest, sigs []Signature) (*ValidationResult, error) {
 	start := time.Now()
 	result := &ValidationResult{
 		Level:  level,
@@ -193,36 +336,124 @@ func (v *Validator) validate(level, content string, schema *LogSchema) (*Validat
 
 	// Step 1: validate the LogSchema itself is well-formed.
 	if err := schema.Validate(); err != nil {
+		result.Stage = StageSchema
 		result.Errors = append(result.Errors, fmt.Sprintf("invalid log_schema: %v", err))
 		result.Elapsed = time.Since(start)
 		return result, nil
 	}
 
+	// Step 1b: optionally check that the schema_uri actually resolves.
+	if v.ResolveSchemas {
+		if _, err := v.FetchRemoteSchema(schema); err != nil {
+			result.Stage = StageResolve
+			result.Errors = append(result.Errors, fmt.Sprintf("unresolvable log_schema: %v", err))
+			result.Elapsed = time.Since(start)
+			return result, nil
+		}
+	}
+
+	// Step 1c: decode inline content declared with a content_encoding.
+	content, schema, err := v.decodeLog(content, schema)
+	if err != nil {
+		result.Stage = StageEncoding
+		result.Errors = append(result.Errors, fmt.Sprintf("cannot decode structured_log: %v", err))
+		result.Elapsed = time.Since(start)
+		return result, nil
+	}
+
+	// Step 1d: read content kept in the log store or behind a DRS URI, so
+	// that it is validated like inline content.
+	if v.dereferences(content) {
+		body, err := v.FetchURI(content)
+		if err != nil {
+			result.Stage = StageFetch
+			result.Errors = append(result.Errors, fmt.Sprintf("cannot read structured_log: %v", err))
+			result.Elapsed = time.Since(start)
+			return result, nil
+		}
+		content, schema = string(body), decodedSchema(schema)
+	}
+
 	// Step 2: validate the content is parseable as its declared media type.
 	mediaType := schema.MediaTypeOrDefault()
 	if err := v.validateMediaType(content, mediaType); err != nil {
+		result.Stage = StageMediaType
 		result.Errors = append(result.Errors, fmt.Sprintf("content does not match media_type %q: %v", mediaType, err))
 		result.Elapsed = time.Since(start)
 		return result, nil
 	}
 
 	// Step 3: format-specific structural validation.
-	if err := v.validateByFormat(content, schema.Format); err != nil {
+	if err := v.validateByFormat(content, schema.Format, mediaType); err != nil {
+		result.Stage = StageFormat
 		result.Errors = append(result.Errors, fmt.Sprintf("format validation failed: %v", err))
 		result.Elapsed = time.Since(start)
 		return result, nil
 	}
 
+	// Step 4: check the recorded digest and signatures, fetching remote
+	// content if needed.
+	if digest != nil || len(sigs) > 0 {
+		body, err := v.payload(content, schema)
+		if err != nil {
+			result.Stage = StageDigest
+			if digest == nil {
+				result.Stage = StageSignature
+			}
+			result.Errors = append(result.Errors, fmt.Sprintf("cannot fetch structured_log to verify it: %v", err))
+			result.Elapsed = time.Since(start)
+			return result, nil
+		}
+		if digest != nil {
+			if err := v.verifyDigest(body, schema, digest); err != nil {
+				result.Stage = StageDigest
+				result.Errors = append(result.Errors, fmt.Sprintf("structured_log_digest: %v", err))
+				result.Elapsed = time.Since(start)
+				return result, nil
+			}
+		}
+		result.Signatures = v.VerifySignatures(body, schema, sigs)
+	}
+	if err := signatureFailure(result.Signatures, v.RequireSignatures); err != nil {
+		result.Stage = StageSignature
+		result.Errors = append(result.Errors, fmt.Sprintf("structured_log_signatures: %v", err))
+		result.Elapsed = time.Since(start)
+		return result, nil
+	}
+
 	result.Valid = true
 	result.Elapsed = time.Since(start)
 	return result, nil
 }
 
+// Line-delimited JSON media types.
+const (
+	mediaTypeNDJSON = "application/x-ndjson"
+	mediaTypeJSONL  = "application/jsonl"
+)
+
+// mediaTypePROVN is the media type of PROV-N, the W3C PROV notation.
+const mediaTypePROVN = "text/provenance-notation"
+
+// mediaTypeNQuads is the media type of N-Quads, an RDF dataset one
+// statement per line.
+const mediaTypeNQuads = "application/n-quads"
+
+// provNStatements are the PROV-N statements, one of which a document must
+// contain; they match the PROV-JSON keys validateOPM looks for.
+var provNStatements = []string{"wasGeneratedBy", "used", "wasAssociatedWith",
+	"entity", "activity", "agent"}
+
+// isLineDelimited reports whether a media type holds one JSON value per line.
+func isLineDelimited(mediaType string) bool {
+	return mediaType == mediaTypeNDJSON || mediaType == mediaTypeJSONL
+}
+
 // validateMediaType checks that content is parseable for the declared type.
 // Supports both inline content and resource URIs.
 func (v *Validator) validateMediaType(content, mediaType string) error {
 	// If content is a URI, skip structural validation of the string itself.
-	if strings.HasPrefix(content, "http://") || strings.HasPrefix(content, "https://") {
+	if isLogURI(content) {
 		return nil
 	}
 
@@ -232,19 +463,41 @@ func (v *Validator) validateMediaType(content, mediaType string) error {
 		if err := json.Unmarshal([]byte(content), &raw); err != nil {
 			return fmt.Errorf("not valid JSON: %w", err)
 		}
+	case mediaTypeNDJSON, mediaTypeJSONL:
+		for i, line := range strings.Split(content, "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if !json.Valid([]byte(line)) {
+				return fmt.Errorf("line %d is not valid JSON", i+1)
+			}
+		}
+	case mediaTypeNQuads:
+		if _, err := parseNQuads(content); err != nil {
+			return fmt.Errorf("not valid N-Quads: %w", err)
+		}
+	case mediaTypePROVN:
+		trimmed := strings.TrimSpace(content)
+		if !strings.HasPrefix(trimmed, "document") || !strings.HasSuffix(trimmed, "endDocument") {
+			return fmt.Errorf("not a PROV-N document: expected a document ... endDocument block")
+		}
 	}
 	return nil
 }
 
-// validateByFormat does light structural checks for known formats.
-func (v *Validator) validateByFormat(content string, format Format) error {
+// validateByFormat does light structural checks for known formats. PROV
+// may be PROV-JSON or, declared with its media type, PROV-N.
+func (v *Validator) validateByFormat(content string, format Format, mediaType string) error {
 	// Cannot validate structure if content is a remote URI.
-	if strings.HasPrefix(content, "http://") || strings.HasPrefix(content, "https://") {
+	if isLogURI(content) {
 		return nil
 	}
 
 	switch format {
 	case FormatOPM:
+		if mediaType == mediaTypePROVN {
+			return validateProvN(content)
+		}
 		return validateOPM(content)
 	case FormatROCrate:
 		return validateROCrate(content)
@@ -271,6 +524,21 @@ func validateOPM(content string) error {
 		strings.Join(provKeys, ", "))
 }
 
+// validateProvN checks that a PROV-N document makes at least one of the
+// statements validateOPM requires of PROV-JSON.
+func validateProvN(content string) error {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		for _, st := range provNStatements {
+			if strings.HasPrefix(line, st+"(") {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("no W3C PROV statements found (expected at least one of: %s)",
+		strings.Join(provNStatements, ", "))
+}
+
 // validateROCrate checks for minimum required RO-Crate fields.
 // A valid RO-Crate metadata file must have @context and @graph.
 func validateROCrate(content string) error {
@@ -289,20 +557,114 @@ func validateROCrate(content string) error {
 
 // FetchRemoteSchema fetches and returns the raw schema content from the
 // declared schema_uri. Useful for clients that want to do full validation.
+// SchemaDir is consulted first; the network is only used when not Offline.
 func (v *Validator) FetchRemoteSchema(schema *LogSchema) ([]byte, error) {
-	resp, err := v.httpClient().Get(schema.SchemaURI)
+	if v.SchemaDir != "" {
+		body, err := v.readLocalSchema(schema.SchemaURI)
+		if err == nil {
+			return body, nil
+		}
+		if v.Offline {
+			return nil, err
+		}
+	}
+	if v.Offline {
+		return nil, fmt.Errorf("schema %q not available offline (no schema directory configured)", schema.SchemaURI)
+	}
+
+	body, err := v.FetchURI(schema.SchemaURI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch schema: %w", err)
+	}
+	return body, nil
+}
+
+// FetchURI dereferences an HTTP(S) URI found in a log field, such as a
+// structured_log or stdout URL, a DRS URI through the DRS resolver, or a
+// URI that belongs to Store. Only the latter can be fetched when the
+// Validator is Offline. HTTP bodies larger than MaxDecodedSize fail with
+// ErrContentTooLarge.
+func (v *Validator) FetchURI(uri string) ([]byte, error) {
+	if v.Store != nil && v.Store.Owns(uri) {
+		return v.Store.Get(uri)
+	}
+	if v.Offline {
+		return nil, fmt.Errorf("cannot fetch %q: offline", uri)
+	}
+	if isDRSURI(uri) {
+		if v.DRS == nil {
+			return nil, fmt.Errorf("cannot fetch %q: no DRS resolver configured", uri)
+		}
+		r := *v.DRS
+		if r.HTTPClient == nil {
+			r.HTTPClient = v.HTTPClient
+		}
+		if r.Store == nil {
+			r.Store = v.Store
+		}
+		if r.MaxSize == 0 {
+			r.MaxSize = v.maxFetchSize()
+		}
+		return r.Fetch(uri)
+	}
+	if !isHTTPURI(uri) {
+		return nil, fmt.Errorf("cannot fetch %q: unsupported URI scheme", uri)
+	}
+	resp, err := v.httpClient().Get(uri)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch schema from %q: %w", schema.SchemaURI, err)
+		return nil, fmt.Errorf("failed to fetch %q: %w", uri, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("schema URI %q returned HTTP %d", schema.SchemaURI, resp.StatusCode)
+		return nil, fmt.Errorf("%q returned HTTP %d", uri, resp.StatusCode)
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := readLimited(resp.Body, v.maxFetchSize())
 	if err != nil {
-		return nil, fmt.Errorf("failed to read schema body: %w", err)
+		return nil, fmt.Errorf("failed to read body of %q: %w", uri, err)
 	}
 	return body, nil
 }
+
+// isHTTPURI reports whether s is an absolute HTTP or HTTPS URI.
+func isHTTPURI(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// isLogURI reports whether a structured_log refers to content stored
+// elsewhere: an HTTP(S) or DRS URI, or a file:// or s3:// URI written by a
+// LogStore.
+func isLogURI(s string) bool {
+	return isHTTPURI(s) || isDRSURI(s) || strings.HasPrefix(s, "file://") || strings.HasPrefix(s, "s3://")
+}
+
+// dereferences reports whether the Validator fetches the content behind a
+// structured_log URI to validate it: content in its Store, or behind a
+// DRS URI when it has a DRS resolver and is not Offline.
+func (v *Validator) dereferences(uri string) bool {
+	return (v.Store != nil && v.Store.Owns(uri)) || (v.DRS != nil && !v.Offline && isDRSURI(uri))
+}
+
+// readLocalSchema looks up a schema URI inside SchemaDir. URIs come from
+// the documents being validated, so paths that would leave the host's
+// directory, such as "https://host/../../x", are refused.
+func (v *Validator) readLocalSchema(uri string) ([]byte, error) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" || u.Host == "." || u.Host == ".." || strings.ContainsAny(u.Host, `/\`) {
+		return nil, fmt.Errorf("schema URI %q cannot be mapped to a local file", uri)
+	}
+	hostDir := filepath.Join(v.SchemaDir, u.Host)
+	base := filepath.Join(hostDir, filepath.FromSlash(strings.Trim(u.Path, "/")))
+	if rel, err := filepath.Rel(hostDir, base); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("schema URI %q points outside schema directory %q", uri, v.SchemaDir)
+	}
+	for _, candidate := range []string{base, base + ".json", filepath.Join(base, "index.json")} {
+		info, err := os.Stat(candidate)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		return os.ReadFile(candidate)
+	}
+	return nil, fmt.Errorf("schema %q not found in schema directory %q", uri, v.SchemaDir)
+}
@@ -1,6 +1,12 @@
 package logschema_test
 
 import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/animeshs34/wes-logging-schema/internal/logschema"
@@ -237,3 +243,130 @@ func TestValidator_ValidateTaskLog(t *testing.T) {
 		}
 	})
 }
+
+// Validator schema resolution tests (SchemaDir / Offline)
+
+func TestValidator_FetchRemoteSchema_Local(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "w3id.org", "ro", "crate"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "w3id.org", "ro", "crate", "1.1.json"), []byte(`{"ok": true}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	v := &logschema.Validator{SchemaDir: dir, Offline: true}
+
+	t.Run("schema found in schema directory", func(t *testing.T) {
+		body, err := v.FetchRemoteSchema(&logschema.LogSchema{SchemaURI: "https://w3id.org/ro/crate/1.1"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(body) != `{"ok": true}` {
+			t.Errorf("unexpected body %q", body)
+		}
+	})
+
+	t.Run("offline lookup of unknown schema fails", func(t *testing.T) {
+		if _, err := v.FetchRemoteSchema(&logschema.LogSchema{SchemaURI: "https://example.com/missing"}); err == nil {
+			t.Error("expected error for schema missing from schema directory")
+		}
+	})
+
+	t.Run("paths outside the schema directory are refused", func(t *testing.T) {
+		outside := filepath.Join(filepath.Dir(dir), "secret.json")
+		if err := os.WriteFile(outside, []byte(`{"secret": true}`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(outside)
+		for _, uri := range []string{
+			"https://w3id.org/../../secret",
+			"https://w3id.org/%2e%2e/%2e%2e/secret",
+			"https://../secret",
+		} {
+			if body, err := v.FetchRemoteSchema(&logschema.LogSchema{SchemaURI: uri}); err == nil {
+				t.Errorf("FetchRemoteSchema(%q) = %q, want error", uri, body)
+			}
+		}
+	})
+
+	t.Run("ResolveSchemas rejects unresolvable schema_uri", func(t *testing.T) {
+		rv := &logschema.Validator{SchemaDir: dir, Offline: true, ResolveSchemas: true}
+		rl := &logschema.RunLog{
+			StructuredLog: `{"entity": {}}`,
+			LogSchema:     &logschema.LogSchema{SchemaURI: "https://www.w3.org/TR/prov-o/", Format: logschema.FormatOPM},
+		}
+		result, err := rv.ValidateRunLog(rl)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Valid {
+			t.Error("expected invalid result for unresolvable schema")
+		}
+	})
+}
+
+func TestValidator_FetchURI_SizeLimit(t *testing.T) {
+	body := `{"entity": {"ex:a": {}}, "pad": "` + strings.Repeat("x", 1000) + `"}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	if got, err := (&logschema.Validator{}).FetchURI(srv.URL); err != nil || string(got) != body {
+		t.Fatalf("default limit: got %d bytes, %v", len(got), err)
+	}
+	small := &logschema.Validator{MaxDecodedSize: 100}
+	if _, err := small.FetchURI(srv.URL); !errors.Is(err, logschema.ErrContentTooLarge) {
+		t.Errorf("got %v, want ErrContentTooLarge", err)
+	}
+	if _, err := small.FetchRemoteSchema(&logschema.LogSchema{SchemaURI: srv.URL}); !errors.Is(err, logschema.ErrContentTooLarge) {
+		t.Errorf("schema: got %v, want ErrContentTooLarge", err)
+	}
+}
+
+func TestValidationResult_Stage(t *testing.T) {
+	v := &logschema.Validator{}
+	prov := &logschema.LogSchema{SchemaURI: "https://www.w3.org/TR/prov-o/", Format: logschema.FormatOPM}
+
+	tests := []struct {
+		name string
+		rl   logschema.RunLog
+		want string
+	}{
+		{"missing schema", logschema.RunLog{StructuredLog: `{}`}, logschema.StageMissingSchema},
+		{"malformed schema", logschema.RunLog{StructuredLog: `{}`, LogSchema: &logschema.LogSchema{SchemaURI: "x"}}, logschema.StageSchema},
+		{"malformed JSON", logschema.RunLog{StructuredLog: `{`, LogSchema: prov}, logschema.StageMediaType},
+		{"wrong structure", logschema.RunLog{StructuredLog: `{}`, LogSchema: prov}, logschema.StageFormat},
+		{"valid", logschema.RunLog{StructuredLog: `{"used": {}}`, LogSchema: prov}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := v.ValidateRunLog(&tt.rl)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Stage != tt.want {
+				t.Errorf("Stage = %q, want %q", result.Stage, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidator_NDJSONMediaType(t *testing.T) {
+	v := &logschema.Validator{}
+	schema := &logschema.LogSchema{SchemaURI: "https://example.com/events", Format: logschema.FormatCustom, MediaType: "application/x-ndjson"}
+
+	for content, want := range map[string]bool{
+		"{\"a\":1}\n{\"a\":2}\n": true,
+		"{\"a\":1}\nnot json\n":  false,
+	} {
+		result, err := v.ValidateRunLog(&logschema.RunLog{StructuredLog: content, LogSchema: schema})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Valid != want {
+			t.Errorf("%q: valid = %v, want %v (%v)", content, result.Valid, want, result.Errors)
+		}
+	}
+}
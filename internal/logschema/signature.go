@@ -0,0 +1,512 @@
+package logschema
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Signature formats.
+const (
+	SignatureFormatJWS  = "jws"  // JWS compact serialization with a detached payload (RFC 7515, appendix F)
+	SignatureFormatDSSE = "dsse" // DSSE envelope around an in-toto Statement
+)
+
+// In-toto constants used in DSSE envelopes.
+const (
+	InTotoPayloadType   = "application/vnd.in-toto+json"
+	InTotoStatementType = "https://in-toto.io/Statement/v1"
+
+	// StructuredLogSubject names the structured_log in in-toto Statements.
+	StructuredLogSubject = "structured_log"
+)
+
+// Signature is a detached signature over a structured_log, recorded next
+// to it in structured_log_signatures. Exactly one of JWS and DSSE is set.
+//
+// A JWS signs the canonicalised content itself; its protected header names
+// the key ("kid") and the canonicalisation. A DSSE envelope signs an
+// in-toto Statement whose subject is the SHA-256 of the canonicalised
+// content and whose predicate is the log_schema. Either way the content is
+// not repeated inside the signature.
+type Signature struct {
+	JWS  string        `json:"jws,omitempty"`
+	DSSE *DSSEEnvelope `json:"dsse,omitempty"`
+}
+
+// DSSEEnvelope is a Dead Simple Signing Envelope.
+type DSSEEnvelope struct {
+	PayloadType string          `json:"payloadType"`
+	Payload     string          `json:"payload"` // standard base64
+	Signatures  []DSSESignature `json:"signatures"`
+}
+
+// DSSESignature is one signature in a DSSE envelope.
+type DSSESignature struct {
+	KeyID string `json:"keyid,omitempty"`
+	Sig   string `json:"sig"` // standard base64
+}
+
+// Format returns SignatureFormatJWS or SignatureFormatDSSE.
+func (s Signature) Format() string {
+	if s.DSSE != nil {
+		return SignatureFormatDSSE
+	}
+	return SignatureFormatJWS
+}
+
+// KeyIDs returns the IDs of the keys that made the signature.
+func (s Signature) KeyIDs() []string {
+	if s.DSSE != nil {
+		var ids []string
+		for _, sig := range s.DSSE.Signatures {
+			ids = append(ids, sig.KeyID)
+		}
+		return ids
+	}
+	if h, err := parseJWSHeader(s.JWS); err == nil {
+		return []string{h.KeyID}
+	}
+	return nil
+}
+
+// SignatureState is the outcome of checking one signature.
+type SignatureState string
+
+const (
+	SignatureVerified   SignatureState = "verified"
+	SignatureInvalid    SignatureState = "invalid"     // the signature does not match the content
+	SignatureUnknownKey SignatureState = "unknown_key" // no verification key for its key ID
+	SignatureUnchecked  SignatureState = "unchecked"   // the Validator has no KeyProvider
+)
+
+// SignatureStatus reports the check of one signature, reported in
+// ValidationResult.Signatures.
+type SignatureStatus struct {
+	Format string         `json:"format"`
+	KeyID  string         `json:"keyid,omitempty"`
+	State  SignatureState `json:"state"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// jwsHeader is the protected header of a structured_log JWS.
+type jwsHeader struct {
+	Alg              string           `json:"alg"`
+	KeyID            string           `json:"kid"`
+	Canonicalization Canonicalization `json:"canonicalization,omitempty"`
+}
+
+// inTotoStatement is an in-toto v1 Statement about a structured_log.
+type inTotoStatement struct {
+	Type          string          `json:"_type"`
+	Subject       []inTotoSubject `json:"subject"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     logPredicate    `json:"predicate"`
+}
+
+type inTotoSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// logPredicate states the schema of the signed structured_log and how it
+// was canonicalised before hashing.
+type logPredicate struct {
+	LogSchema        *LogSchema       `json:"log_schema"`
+	Canonicalization Canonicalization `json:"canonicalization"`
+}
+
+// LogSigner signs structured logs with a key from a KeyProvider.
+type LogSigner struct {
+	Keys  KeyProvider
+	KeyID string
+
+	// Format is SignatureFormatJWS (the default) or SignatureFormatDSSE.
+	Format string
+
+	// Canonicalization is applied to the content before signing. Defaults
+	// to DefaultCanonicalization of each log's schema.
+	Canonicalization Canonicalization
+
+	// Validator, if set, resolves remote JSON-LD contexts and fetches
+	// structured_log URIs in SignRun.
+	Validator *Validator
+}
+
+// Sign signs content, described by schema, and returns a detached
+// signature.
+func (s *LogSigner) Sign(content []byte, schema *LogSchema) (*Signature, error) {
+	if s.Keys == nil || s.KeyID == "" {
+		return nil, fmt.Errorf("signing requires a key provider and a key ID")
+	}
+	key, err := s.Keys.Signer(s.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	c := s.Canonicalization
+	if c == "" {
+		c = DefaultCanonicalization(schema)
+	}
+	canon, err := Canonicalize(content, c, mediaTypeOf(schema), s.Validator.contextLoader())
+	if err != nil {
+		return nil, fmt.Errorf("%s canonicalization failed: %w", c, err)
+	}
+
+	switch s.Format {
+	case SignatureFormatJWS, "":
+		alg, err := jwsAlgorithm(key.Public())
+		if err != nil {
+			return nil, err
+		}
+		header, err := json.Marshal(jwsHeader{Alg: alg, KeyID: s.KeyID, Canonicalization: c})
+		if err != nil {
+			return nil, err
+		}
+		h := base64.RawURLEncoding.EncodeToString(header)
+		sig, err := signBytes(key, []byte(h+"."+base64.RawURLEncoding.EncodeToString(canon)), true)
+		if err != nil {
+			return nil, err
+		}
+		return &Signature{JWS: h + ".." + base64.RawURLEncoding.EncodeToString(sig)}, nil
+	case SignatureFormatDSSE:
+		if schema == nil {
+			return nil, fmt.Errorf("a log_schema is required for DSSE signatures")
+		}
+		sum := sha256.Sum256(canon)
+		payload, err := json.Marshal(inTotoStatement{
+			Type:          InTotoStatementType,
+			Subject:       []inTotoSubject{{Name: StructuredLogSubject, Digest: map[string]string{"sha256": hex.EncodeToString(sum[:])}}},
+			PredicateType: schema.SchemaURI,
+			Predicate:     logPredicate{LogSchema: decodedSchema(schema), Canonicalization: c},
+		})
+		if err != nil {
+			return nil, err
+		}
+		sig, err := signBytes(key, dssePAE(InTotoPayloadType, payload), false)
+		if err != nil {
+			return nil, err
+		}
+		return &Signature{DSSE: &DSSEEnvelope{
+			PayloadType: InTotoPayloadType,
+			Payload:     base64.StdEncoding.EncodeToString(payload),
+			Signatures:  []DSSESignature{{KeyID: s.KeyID, Sig: base64.StdEncoding.EncodeToString(sig)}},
+		}}, nil
+	}
+	return nil, fmt.Errorf("unknown signature format %q", s.Format)
+}
+
+// SignRun adds a signature to every structured_log in a run that the
+// signer's key has not signed yet, using each log's effective schema.
+// Logs given by URI are fetched with the signer's Validator, or skipped
+// without one. It returns the locations signed and, for the others, why
+// they were skipped.
+func (s *LogSigner) SignRun(rl *RunLog, tasks []TaskLog) (signed, skipped []string) {
+	walkStructuredLogs(rl, tasks, func(ref structuredLogRef) {
+		for _, sig := range *ref.signatures {
+			if contains(sig.KeyIDs(), s.KeyID) {
+				return
+			}
+		}
+		body, err := s.Validator.dereference(ref.content, ref.schema)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: %v", ref.location, err))
+			return
+		}
+		sig, err := s.Sign(body, ref.schema)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: %v", ref.location, err))
+			return
+		}
+		*ref.signatures = append(*ref.signatures, *sig)
+		signed = append(signed, ref.location)
+	})
+	return signed, skipped
+}
+
+// VerifySignatures checks each signature against content (the dereferenced
+// structured_log) with the Validator's Keys.
+func (v *Validator) VerifySignatures(content []byte, schema *LogSchema, sigs []Signature) []SignatureStatus {
+	var out []SignatureStatus
+	for _, sig := range sigs {
+		if sig.DSSE != nil {
+			out = append(out, v.verifyDSSE(content, schema, sig.DSSE)...)
+			continue
+		}
+		out = append(out, v.verifyJWS(content, schema, sig.JWS))
+	}
+	return out
+}
+
+func (v *Validator) verifyJWS(content []byte, schema *LogSchema, jws string) SignatureStatus {
+	st := SignatureStatus{Format: SignatureFormatJWS}
+	h, err := parseJWSHeader(jws)
+	if err != nil {
+		return st.fail(SignatureInvalid, err)
+	}
+	st.KeyID = h.KeyID
+	if v.Keys == nil {
+		return st.fail(SignatureUnchecked, fmt.Errorf("no key provider configured"))
+	}
+	pub, err := v.Keys.PublicKey(h.KeyID)
+	if err != nil {
+		return st.keyError(err)
+	}
+	if alg, err := jwsAlgorithm(pub); err != nil || alg != h.Alg {
+		return st.fail(SignatureInvalid, fmt.Errorf("alg %q does not match key %q", h.Alg, h.KeyID))
+	}
+	canon, err := Canonicalize(content, h.Canonicalization, mediaTypeOf(schema), v.contextLoader())
+	if err != nil {
+		return st.fail(SignatureInvalid, fmt.Errorf("%s canonicalization failed: %w", h.Canonicalization, err))
+	}
+	parts := strings.Split(jws, ".")
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return st.fail(SignatureInvalid, fmt.Errorf("malformed JWS signature: %w", err))
+	}
+	if err := verifyBytes(pub, []byte(parts[0]+"."+base64.RawURLEncoding.EncodeToString(canon)), sig, true); err != nil {
+		return st.fail(SignatureInvalid, err)
+	}
+	st.State = SignatureVerified
+	return st
+}
+
+func (v *Validator) verifyDSSE(content []byte, schema *LogSchema, env *DSSEEnvelope) []SignatureStatus {
+	if len(env.Signatures) == 0 {
+		st := SignatureStatus{Format: SignatureFormatDSSE}
+		return []SignatureStatus{st.fail(SignatureInvalid, fmt.Errorf("DSSE envelope has no signatures"))}
+	}
+	// A broken envelope invalidates every signature in it.
+	fail := func(err error) []SignatureStatus {
+		var out []SignatureStatus
+		for _, s := range env.Signatures {
+			st := SignatureStatus{Format: SignatureFormatDSSE, KeyID: s.KeyID}
+			out = append(out, st.fail(SignatureInvalid, err))
+		}
+		return out
+	}
+	if env.PayloadType != InTotoPayloadType {
+		return fail(fmt.Errorf("unsupported DSSE payloadType %q", env.PayloadType))
+	}
+	payload, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return fail(fmt.Errorf("malformed DSSE payload: %w", err))
+	}
+
+	// The statement is only trusted once a signature over it verifies, but
+	// it is checked against the content up front: a statement about other
+	// content makes every signature on it invalid.
+	var stmt inTotoStatement
+	if err := json.Unmarshal(payload, &stmt); err != nil {
+		return fail(fmt.Errorf("DSSE payload is not an in-toto Statement: %w", err))
+	}
+	if err := stmt.check(content, schema, v.contextLoader()); err != nil {
+		return fail(err)
+	}
+
+	pae := dssePAE(env.PayloadType, payload)
+	var out []SignatureStatus
+	for _, s := range env.Signatures {
+		st := SignatureStatus{Format: SignatureFormatDSSE, KeyID: s.KeyID}
+		switch sig, err := base64.StdEncoding.DecodeString(s.Sig); {
+		case err != nil:
+			st = st.fail(SignatureInvalid, fmt.Errorf("malformed DSSE signature: %w", err))
+		case v.Keys == nil:
+			st = st.fail(SignatureUnchecked, fmt.Errorf("no key provider configured"))
+		default:
+			pub, err := v.Keys.PublicKey(s.KeyID)
+			if err != nil {
+				st = st.keyError(err)
+			} else if err := verifyBytes(pub, pae, sig, false); err != nil {
+				st = st.fail(SignatureInvalid, err)
+			} else {
+				st.State = SignatureVerified
+			}
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+// check verifies that the statement is about content with the given schema.
+func (stmt *inTotoStatement) check(content []byte, schema *LogSchema, load ContextLoader) error {
+	if stmt.Type != InTotoStatementType {
+		return fmt.Errorf("unsupported in-toto Statement type %q", stmt.Type)
+	}
+	if schema != nil && stmt.PredicateType != schema.SchemaURI {
+		return fmt.Errorf("statement is about a %q log, not %q", stmt.PredicateType, schema.SchemaURI)
+	}
+	canon, err := Canonicalize(content, stmt.Predicate.Canonicalization, mediaTypeOf(schema), load)
+	if err != nil {
+		return fmt.Errorf("%s canonicalization failed: %w", stmt.Predicate.Canonicalization, err)
+	}
+	sum := sha256.Sum256(canon)
+	want := hex.EncodeToString(sum[:])
+	for _, sub := range stmt.Subject {
+		if sub.Name == StructuredLogSubject {
+			if !strings.EqualFold(sub.Digest["sha256"], want) {
+				return fmt.Errorf("statement subject digest does not match the structured_log")
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("statement has no %q subject", StructuredLogSubject)
+}
+
+func (st SignatureStatus) fail(state SignatureState, err error) SignatureStatus {
+	st.State = state
+	st.Error = err.Error()
+	return st
+}
+
+func (st SignatureStatus) keyError(err error) SignatureStatus {
+	if errors.Is(err, ErrUnknownKey) {
+		return st.fail(SignatureUnknownKey, err)
+	}
+	return st.fail(SignatureInvalid, err)
+}
+
+// signatureFailure returns why a structured_log with these signature
+// statuses must be rejected, or nil. Invalid signatures always fail; with
+// require set, so does a log without any verified signature.
+func signatureFailure(statuses []SignatureStatus, require bool) error {
+	verified := false
+	for _, st := range statuses {
+		switch st.State {
+		case SignatureInvalid:
+			return fmt.Errorf("%s signature by %q is invalid: %s", st.Format, st.KeyID, st.Error)
+		case SignatureVerified:
+			verified = true
+		}
+	}
+	if require && !verified {
+		return fmt.Errorf("no verified signature")
+	}
+	return nil
+}
+
+func parseJWSHeader(jws string) (*jwsHeader, error) {
+	parts := strings.Split(jws, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed JWS: want 3 dot-separated parts, got %d", len(parts))
+	}
+	if parts[1] != "" {
+		return nil, fmt.Errorf("JWS carries its payload; structured_log signatures must be detached")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed JWS header: %w", err)
+	}
+	var h jwsHeader
+	if err := json.Unmarshal(raw, &h); err != nil {
+		return nil, fmt.Errorf("malformed JWS header: %w", err)
+	}
+	if h.KeyID == "" {
+		return nil, fmt.Errorf("JWS header has no kid")
+	}
+	return &h, nil
+}
+
+// dssePAE is the DSSE pre-authentication encoding of a payload.
+func dssePAE(payloadType string, payload []byte) []byte {
+	return []byte("DSSEv1 " + strconv.Itoa(len(payloadType)) + " " + payloadType + " " +
+		strconv.Itoa(len(payload)) + " " + string(payload))
+}
+
+// jwsAlgorithm returns the JWS "alg" for a public key.
+func jwsAlgorithm(pub crypto.PublicKey) (string, error) {
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		return "EdDSA", nil
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return "ES256", nil
+		case elliptic.P384():
+			return "ES384", nil
+		case elliptic.P521():
+			return "ES512", nil
+		}
+	}
+	return "", fmt.Errorf("unsupported key type %T: want Ed25519 or ECDSA", pub)
+}
+
+// ecdsaHash returns the hash paired with a curve in JWS and DSSE.
+func ecdsaHash(c elliptic.Curve) crypto.Hash {
+	switch c.Params().BitSize {
+	case 384:
+		return crypto.SHA384
+	case 521:
+		return crypto.SHA512
+	}
+	return crypto.SHA256
+}
+
+// signBytes signs data. ECDSA signatures are ASN.1 DER encoded, or the
+// fixed-size r||s concatenation JWS uses when raw is set.
+func signBytes(key crypto.Signer, data []byte, raw bool) ([]byte, error) {
+	switch pub := key.Public().(type) {
+	case ed25519.PublicKey:
+		return key.Sign(rand.Reader, data, crypto.Hash(0))
+	case *ecdsa.PublicKey:
+		h := ecdsaHash(pub.Curve)
+		d := h.New()
+		d.Write(data)
+		der, err := key.Sign(rand.Reader, d.Sum(nil), h)
+		if err != nil || !raw {
+			return der, err
+		}
+		var rs struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(der, &rs); err != nil {
+			return nil, err
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		out := make([]byte, 2*size)
+		rs.R.FillBytes(out[:size])
+		rs.S.FillBytes(out[size:])
+		return out, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T: want Ed25519 or ECDSA", key.Public())
+}
+
+// verifyBytes checks a signature made by signBytes.
+func verifyBytes(pub crypto.PublicKey, data, sig []byte, raw bool) error {
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, data, sig) {
+			return fmt.Errorf("signature verification failed")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		h := ecdsaHash(k.Curve)
+		d := h.New()
+		d.Write(data)
+		digest := d.Sum(nil)
+		ok := false
+		if raw {
+			size := (k.Curve.Params().BitSize + 7) / 8
+			if len(sig) == 2*size {
+				r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+				ok = ecdsa.Verify(k, digest, r, s)
+			}
+		} else {
+			ok = ecdsa.VerifyASN1(k, digest, sig)
+		}
+		if !ok {
+			return fmt.Errorf("signature verification failed")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported key type %T: want Ed25519 or ECDSA", pub)
+}
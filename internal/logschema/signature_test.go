@@ -0,0 +1,164 @@
+package logschema_test
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+func TestLogSigner_SignAndVerify(t *testing.T) {
+	dir := t.TempDir()
+	crate, err := variantCallingCrate().Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	compact, _ := json.Marshal(crate)
+	indented, _ := json.MarshalIndent(crate, "", "\t")
+	tampered := strings.Replace(string(compact), "calls.vcf", "other.vcf", -1)
+	schema := logschema.ROCrateLogSchema()
+	verifier := &logschema.Validator{Keys: &logschema.FileKeyProvider{Dir: dir}}
+
+	for _, alg := range []string{logschema.KeyEd25519, logschema.KeyES256, logschema.KeyES384} {
+		key, err := logschema.GenerateKey(alg)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := logschema.WriteKeyFiles(dir, alg, key); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, format := range []string{logschema.SignatureFormatJWS, logschema.SignatureFormatDSSE} {
+			t.Run(alg+"/"+format, func(t *testing.T) {
+				signer := &logschema.LogSigner{Keys: &logschema.FileKeyProvider{Dir: dir}, KeyID: alg, Format: format}
+				sig, err := signer.Sign(compact, schema)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if sig.Format() != format || strings.Join(sig.KeyIDs(), ",") != alg {
+					t.Fatalf("unexpected signature %+v", sig)
+				}
+
+				for content, want := range map[string]logschema.SignatureState{
+					string(compact):  logschema.SignatureVerified,
+					string(indented): logschema.SignatureVerified,
+					tampered:         logschema.SignatureInvalid,
+				} {
+					st := verifier.VerifySignatures([]byte(content), schema, []logschema.Signature{*sig})
+					if len(st) != 1 || st[0].State != want || st[0].KeyID != alg {
+						t.Errorf("VerifySignatures = %+v, want %s", st, want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestValidator_Signatures(t *testing.T) {
+	var keys logschema.KeyRing
+	key, err := logschema.GenerateKey(logschema.KeyEd25519)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	keys.AddSigner("lab", key)
+	other, _ := logschema.GenerateKey(logschema.KeyEd25519)
+	var publicOnly logschema.KeyRing
+	publicOnly.AddPublicKey("lab", key.Public())
+
+	const content = `{"wasGeneratedBy": {"_:g": {"prov:entity": "ex:calls", "prov:activity": "ex:run"}}}`
+	schema := logschema.ProvLogSchema()
+	sig, err := (&logschema.LogSigner{Keys: &keys, KeyID: "lab"}).Sign([]byte(content), schema)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	forged, _ := (&logschema.LogSigner{Keys: ringWith("lab", other), KeyID: "lab"}).Sign([]byte(content), schema)
+
+	tests := []struct {
+		name  string
+		v     *logschema.Validator
+		sigs  []logschema.Signature
+		stage string
+		state logschema.SignatureState
+	}{
+		{"verified", &logschema.Validator{Keys: &publicOnly}, []logschema.Signature{*sig}, "", logschema.SignatureVerified},
+		{"forged", &logschema.Validator{Keys: &publicOnly}, []logschema.Signature{*forged}, logschema.StageSignature, logschema.SignatureInvalid},
+		{"no key provider", &logschema.Validator{}, []logschema.Signature{*sig}, "", logschema.SignatureUnchecked},
+		{"unknown key", &logschema.Validator{Keys: &logschema.KeyRing{}}, []logschema.Signature{*sig}, "", logschema.SignatureUnknownKey},
+		{"required but unknown key", &logschema.Validator{Keys: &logschema.KeyRing{}, RequireSignatures: true}, []logschema.Signature{*sig}, logschema.StageSignature, logschema.SignatureUnknownKey},
+		{"required and verified", &logschema.Validator{Keys: &publicOnly, RequireSignatures: true}, []logschema.Signature{*sig}, "", logschema.SignatureVerified},
+		{"required but unsigned", &logschema.Validator{Keys: &publicOnly, RequireSignatures: true}, nil, logschema.StageSignature, ""},
+		{"attached JWS", &logschema.Validator{Keys: &publicOnly}, []logschema.Signature{{JWS: "eyJhbGciOiJFZERTQSJ9.e30.c2ln"}}, logschema.StageSignature, logschema.SignatureInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := &logschema.RunLog{StructuredLog: content, LogSchema: schema, StructuredLogSignatures: tt.sigs}
+			result, err := tt.v.ValidateRunLog(rl)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Stage != tt.stage {
+				t.Errorf("Stage = %q, want %q (%v)", result.Stage, tt.stage, result.Errors)
+			}
+			if tt.state != "" && (len(result.Signatures) != 1 || result.Signatures[0].State != tt.state) {
+				t.Errorf("Signatures = %+v, want %s", result.Signatures, tt.state)
+			}
+		})
+	}
+
+	if _, err := (&logschema.LogSigner{Keys: &publicOnly, KeyID: "lab"}).Sign([]byte(content), schema); !errors.Is(err, logschema.ErrUnknownKey) {
+		t.Errorf("signing with a public-only key ring: %v", err)
+	}
+}
+
+func ringWith(keyID string, key crypto.Signer) *logschema.KeyRing {
+	var r logschema.KeyRing
+	r.AddSigner(keyID, key)
+	return &r
+}
+
+func TestLogSigner_SignRun(t *testing.T) {
+	dir := t.TempDir()
+	key, _ := logschema.GenerateKey(logschema.KeyES256)
+	if err := logschema.WriteKeyFiles(dir, "ci", key); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Verifiers only get the public key.
+	if err := os.Remove(filepath.Join(dir, "ci.pem")); err != nil {
+		t.Fatal(err)
+	}
+	signDir := t.TempDir()
+	if err := logschema.WriteKeyFiles(signDir, "ci", key); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rl := &logschema.RunLog{}
+	if err := variantCallingCrate().ApplyTo(rl); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tasks := []logschema.TaskLog{{ID: "bwa", StructuredLog: rl.StructuredLog}, {ID: "gatk", StructuredLog: "https://example.org/gatk.json"}}
+
+	signer := &logschema.LogSigner{Keys: &logschema.FileKeyProvider{Dir: signDir}, KeyID: "ci", Format: logschema.SignatureFormatDSSE}
+	signed, skipped := signer.SignRun(rl, tasks)
+	if strings.Join(signed, ",") != "run,task bwa" || len(skipped) != 1 {
+		t.Fatalf("signed = %q, skipped = %q", signed, skipped)
+	}
+	if signed, _ := signer.SignRun(rl, tasks); len(signed) != 0 {
+		t.Errorf("second SignRun signed again: %q", signed)
+	}
+
+	tasks = tasks[:1]
+	res, err := (&logschema.Validator{Keys: &logschema.FileKeyProvider{Dir: dir}, RequireSignatures: true}).ValidateRun(rl, tasks)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !res.Valid() || res.Tasks[0].Signatures[0].State != logschema.SignatureVerified {
+		t.Errorf("signed run does not verify: %+v %+v", res.Run, res.Tasks[0])
+	}
+	if !strings.Contains(res.Run.String(), "ci verified") {
+		t.Errorf("String() = %q", res.Run.String())
+	}
+}
@@ -0,0 +1,378 @@
+package logschema
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// SnakemakeRecords are the files a Snakemake run leaves behind. Metadata or
+// Report is required.
+type SnakemakeRecords struct {
+	// Metadata holds the records Snakemake keeps in .snakemake/metadata,
+	// one JSON object per output file, keyed by the output path. Read them
+	// with ReadSnakemakeMetadata.
+	Metadata map[string][]byte
+
+	// Report is the report.html written with --report, or a JSON object
+	// holding its data. Its rules fill in the conda environment and
+	// container of jobs, and its timeline gives the jobs when there is no
+	// Metadata.
+	Report []byte
+
+	// Snakefile names the workflow that was run, such as "Snakefile" or a
+	// repository URL, for the run's crate.
+	Snakefile string
+
+	// Location interprets report timestamps, which carry no time zone.
+	// Defaults to UTC.
+	Location *time.Location
+}
+
+// snakemakeRecord is one .snakemake/metadata record. Snakemake writes the
+// same record for each output of a job.
+type snakemakeRecord struct {
+	Version         string            `json:"version"`
+	Rule            string            `json:"rule"`
+	Input           []string          `json:"input"`
+	Log             []string          `json:"log"`
+	Params          []interface{}     `json:"params"`
+	Shellcmd        string            `json:"shellcmd"`
+	Incomplete      bool              `json:"incomplete"`
+	StartTime       *float64          `json:"starttime"`
+	EndTime         *float64          `json:"endtime"`
+	JobHash         *int64            `json:"job_hash"`
+	CondaEnv        string            `json:"conda_env"`
+	ContainerImgURL string            `json:"container_img_url"`
+	InputChecksums  map[string]string `json:"input_checksums"`
+}
+
+// snakemakeRule is a rule in the data of a Snakemake report.
+type snakemakeRule struct {
+	CondaEnv        string `json:"conda_env"`
+	ContainerImgURL string `json:"container_img_url"`
+}
+
+// snakemakeReport is the part of a Snakemake report's data that
+// ImportSnakemake reads.
+type snakemakeReport struct {
+	Rules    map[string]snakemakeRule `json:"rules"`
+	Timeline []struct {
+		Rule      string `json:"rule"`
+		StartTime string `json:"starttime"`
+		EndTime   string `json:"endtime"`
+	} `json:"timeline"`
+}
+
+// snakemakeJob is one job: a rule run to produce one or more outputs.
+type snakemakeJob struct {
+	rec     snakemakeRecord
+	outputs []string
+	start   string
+	end     string
+}
+
+// snakemakeTimeLayouts are the formats of Snakemake report timestamps.
+var snakemakeTimeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05"}
+
+// ReadSnakemakeMetadata reads a .snakemake/metadata directory. Snakemake
+// names each record after the URL-safe base64 encoding of its output path,
+// split across "@"-prefixed directories when it is too long for a file
+// name.
+func ReadSnakemakeMetadata(dir string) (map[string][]byte, error) {
+	out := map[string][]byte{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		var name strings.Builder
+		for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+			name.WriteString(strings.TrimPrefix(part, "@"))
+		}
+		output, err := base64.URLEncoding.DecodeString(name.String())
+		if err != nil || !utf8.Valid(output) {
+			// Not a metadata record, such as a stray lock or backup file.
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		out[string(output)] = data
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading Snakemake metadata: %w", err)
+	}
+	return out, nil
+}
+
+// ImportSnakemake converts the metadata and report of a Snakemake run into
+// a WES run. Each job becomes a TaskLog, numbered in order of start and
+// named after its rule and first output, with its rule, job hash, shell
+// command, logs, params, conda environment and container in Metadata under
+// "snakemake.". Jobs Snakemake marked
+// incomplete fail the run. The run-level structured_log is a Workflow Run
+// Crate linking each job to the files it used and produced, and each task's
+// structured_log is its slice of that crate, in format to: FormatROCrate
+// or, converted, FormatOPM.
+func ImportSnakemake(runID string, rec SnakemakeRecords, to Format) (*Run, error) {
+	if to != FormatROCrate && to != FormatOPM && to != "" {
+		return nil, fmt.Errorf("importing Snakemake run: %w: imported runs can be %s or %s, not %s", ErrUnsupportedConversion, FormatROCrate, FormatOPM, to)
+	}
+	loc := rec.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	var report snakemakeReport
+	if len(rec.Report) > 0 {
+		var err error
+		if report, err = parseSnakemakeReport(rec.Report); err != nil {
+			return nil, fmt.Errorf("importing Snakemake run: %w", err)
+		}
+	}
+	var jobs []*snakemakeJob
+	var err error
+	switch {
+	case len(rec.Metadata) > 0:
+		jobs, err = snakemakeJobs(rec.Metadata)
+	case len(report.Timeline) > 0:
+		for _, e := range report.Timeline {
+			j := &snakemakeJob{rec: snakemakeRecord{Rule: e.Rule}}
+			if j.start, err = snakemakeTime(e.StartTime, loc); err != nil {
+				break
+			}
+			if j.end, err = snakemakeTime(e.EndTime, loc); err != nil {
+				break
+			}
+			jobs = append(jobs, j)
+		}
+	default:
+		return nil, errors.New("importing Snakemake run: metadata or a report with a timeline is required")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("importing Snakemake run: %w", err)
+	}
+	sort.SliceStable(jobs, func(i, j int) bool {
+		a, _ := time.Parse(time.RFC3339Nano, jobs[i].start)
+		b, _ := time.Parse(time.RFC3339Nano, jobs[j].start)
+		return a.Before(b)
+	})
+
+	run := &Run{RunID: runID, State: "COMPLETE", Request: map[string]interface{}{"workflow_type": "SNAKEMAKE"}}
+	rl := &RunLog{Name: "Snakemake run " + runID}
+	b := NewCrateBuilder(runID, rl.Name)
+	if rec.Snakefile != "" {
+		run.Request["workflow_url"] = rec.Snakefile
+		b.Workflow(rec.Snakefile, rec.Snakefile, "snakemake")
+	}
+
+	// Files no job produced are the run's inputs; files no job used are
+	// its results.
+	produced, used := map[string]bool{}, map[string]bool{}
+	for _, j := range jobs {
+		for _, o := range j.outputs {
+			produced[o] = true
+		}
+		for _, in := range j.rec.Input {
+			used[in] = true
+		}
+	}
+	checksums := map[string]string{}
+	var starts, ends []string
+	for i, j := range jobs {
+		tl := TaskLog{ID: strconv.Itoa(i + 1), Name: j.rec.Rule, StartTime: j.start, EndTime: j.end}
+		if len(j.outputs) > 0 {
+			tl.Name = fmt.Sprintf("%s (%s)", j.rec.Rule, j.outputs[0])
+		}
+		tl.Metadata = j.metadata(report.Rules[j.rec.Rule])
+		ct := crateTaskFromLog(&tl, i)
+		ct.Tool = j.rec.Rule
+		ct.Inputs, ct.Outputs = j.rec.Input, j.outputs
+		if j.rec.Incomplete {
+			run.State, rl.ExitCode = "EXECUTOR_ERROR", 1
+			ct.Status = ActionFailed
+		}
+		for f, sum := range j.rec.InputChecksums {
+			checksums[f] = sum
+		}
+		b.Task(ct)
+		starts, ends = append(starts, tl.StartTime), append(ends, tl.EndTime)
+		run.TaskLogs = append(run.TaskLogs, tl)
+	}
+	files := map[string]bool{}
+	for f := range produced {
+		files[f] = true
+	}
+	for f := range used {
+		files[f] = true
+	}
+	for _, f := range sortedKeys(files) {
+		cf := CrateFile{ID: f}
+		if sum := checksums[f]; len(sum) == 64 {
+			cf.SHA256 = sum
+		}
+		switch {
+		case !produced[f]:
+			b.Input(cf)
+		case !used[f]:
+			b.Output(cf)
+		default:
+			b.File(cf)
+		}
+	}
+	rl.StartTime, rl.EndTime = spanTimes(starts, ends)
+	b.Times(rl.StartTime, rl.EndTime)
+	if run.State != "COMPLETE" {
+		b.Status(ActionFailed)
+	}
+	run.RunLog = rl
+
+	crate, err := b.Build()
+	if err != nil {
+		return nil, fmt.Errorf("importing Snakemake run: %w", err)
+	}
+	if err := setImportedLog(rl, crate, FormatROCrate); err != nil {
+		return nil, fmt.Errorf("importing Snakemake run: %w", err)
+	}
+	if _, err := SplitRun(rl, run.TaskLogs, nil); err != nil {
+		return nil, fmt.Errorf("importing Snakemake run: %w", err)
+	}
+	if to == FormatOPM {
+		if _, err := ConvertRun(rl, run.TaskLogs, to); err != nil {
+			return nil, fmt.Errorf("importing Snakemake run: %w", err)
+		}
+	}
+	return run, nil
+}
+
+// snakemakeJobs groups metadata records into jobs: by job_hash or, for
+// Snakemake versions that do not record one, by rule, times and inputs.
+func snakemakeJobs(metadata map[string][]byte) ([]*snakemakeJob, error) {
+	var jobs []*snakemakeJob
+	byKey := map[string]*snakemakeJob{}
+	for _, output := range sortedKeys(metadata) {
+		var rec snakemakeRecord
+		if err := json.Unmarshal(metadata[output], &rec); err != nil {
+			return nil, fmt.Errorf("decoding metadata for %s: %w", output, err)
+		}
+		if rec.Rule == "" {
+			return nil, fmt.Errorf("metadata for %s names no rule", output)
+		}
+		var key string
+		if rec.JobHash != nil {
+			key = strconv.FormatInt(*rec.JobHash, 10)
+		} else {
+			k, _ := json.Marshal([]interface{}{rec.Rule, rec.StartTime, rec.EndTime, rec.Input})
+			key = string(k)
+		}
+		j, ok := byKey[key]
+		if !ok {
+			j = &snakemakeJob{rec: rec, start: snakemakeEpoch(rec.StartTime)}
+			if !rec.Incomplete {
+				j.end = snakemakeEpoch(rec.EndTime)
+			}
+			byKey[key] = j
+			jobs = append(jobs, j)
+		}
+		j.outputs = append(j.outputs, output)
+	}
+	return jobs, nil
+}
+
+// metadata records what a TaskLog has no field for. The report's rule
+// fills in what the job's metadata lacks.
+func (j *snakemakeJob) metadata(rule snakemakeRule) map[string]string {
+	m := map[string]string{"snakemake.rule": j.rec.Rule}
+	set := func(k, v string) {
+		if v != "" {
+			m["snakemake."+k] = v
+		}
+	}
+	set("version", j.rec.Version)
+	if j.rec.JobHash != nil {
+		m["snakemake.job_hash"] = strconv.FormatInt(*j.rec.JobHash, 10)
+	}
+	set("shellcmd", j.rec.Shellcmd)
+	set("output", strings.Join(j.outputs, "\n"))
+	set("log", strings.Join(j.rec.Log, "\n"))
+	if len(j.rec.Params) > 0 {
+		b, _ := json.Marshal(j.rec.Params)
+		set("params", string(b))
+	}
+	if j.rec.CondaEnv == "" {
+		j.rec.CondaEnv = rule.CondaEnv
+	}
+	set("conda_env", j.rec.CondaEnv)
+	if j.rec.ContainerImgURL == "" {
+		j.rec.ContainerImgURL = rule.ContainerImgURL
+	}
+	set("container_img_url", j.rec.ContainerImgURL)
+	if j.rec.Incomplete {
+		m["snakemake.incomplete"] = "true"
+	}
+	return m
+}
+
+// parseSnakemakeReport reads the data of a Snakemake report: the rules and
+// timeline variables embedded in report.html, or a JSON object with the
+// same keys.
+func parseSnakemakeReport(data []byte) (snakemakeReport, error) {
+	var report snakemakeReport
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("{")) {
+		if err := json.Unmarshal(trimmed, &report); err != nil {
+			return report, fmt.Errorf("decoding report data: %w", err)
+		}
+		return report, nil
+	}
+	for name, v := range map[string]interface{}{"rules": &report.Rules, "timeline": &report.Timeline} {
+		i := bytes.Index(data, []byte("var "+name+" ="))
+		if i < 0 {
+			continue
+		}
+		rest := data[i+len("var "+name+" ="):]
+		if err := json.NewDecoder(bytes.NewReader(rest)).Decode(v); err != nil {
+			return report, fmt.Errorf("decoding report %s: %w", name, err)
+		}
+	}
+	if report.Rules == nil && report.Timeline == nil {
+		return report, errors.New("report has no rules or timeline data")
+	}
+	return report, nil
+}
+
+// snakemakeEpoch formats a metadata timestamp, in seconds since the epoch.
+func snakemakeEpoch(secs *float64) string {
+	if secs == nil {
+		return ""
+	}
+	return time.UnixMicro(int64(math.Round(*secs * 1e6))).UTC().Format(time.RFC3339Nano)
+}
+
+// snakemakeTime parses a report timestamp.
+func snakemakeTime(s string, loc *time.Location) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	for _, layout := range snakemakeTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t.Format(time.RFC3339Nano), nil
+		}
+	}
+	return "", fmt.Errorf("unrecognised timestamp %q", s)
+}
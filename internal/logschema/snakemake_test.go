@@ -0,0 +1,159 @@
+package logschema_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+func loadSnakemake(t *testing.T) map[string][]byte {
+	t.Helper()
+	md, err := logschema.ReadSnakemakeMetadata("testdata/snakemake/.snakemake/metadata")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return md
+}
+
+func TestReadSnakemakeMetadata(t *testing.T) {
+	md := loadSnakemake(t)
+	if len(md) != 9 || md["calls/all.vcf"] == nil || md["sorted_reads/A.bam.bai"] == nil {
+		t.Errorf("records: %d", len(md))
+	}
+
+	// Records whose name is too long for one path component are split
+	// across "@"-prefixed directories.
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "@cmVzdWx0cy9h"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"@cmVzdWx0cy9h/LnR4dA==": `{"rule": "a"}`, "LOCK": ""} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	md, err := logschema.ReadSnakemakeMetadata(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(md) != 1 || string(md["results/a.txt"]) != `{"rule": "a"}` {
+		t.Errorf("split record: %q", md)
+	}
+}
+
+func TestImportSnakemake(t *testing.T) {
+	report := readTestdata(t, "snakemake/report.html")
+	run, err := logschema.ImportSnakemake("tutorial", logschema.SnakemakeRecords{Metadata: loadSnakemake(t), Report: report, Snakefile: "Snakefile"}, logschema.FormatROCrate)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkImportedRun(t, run)
+	if run.State != "COMPLETE" || run.Request["workflow_type"] != "SNAKEMAKE" || run.RunLog.LogSchema.Format != logschema.FormatROCrate {
+		t.Errorf("run: %s %v %+v", run.State, run.Request, run.RunLog.LogSchema)
+	}
+	if run.RunLog.StartTime != "2024-05-01T10:00:02.41Z" || run.RunLog.EndTime != "2024-05-01T10:00:36.25Z" {
+		t.Errorf("run times: %s - %s", run.RunLog.StartTime, run.RunLog.EndTime)
+	}
+
+	var names []string
+	for _, tl := range run.TaskLogs {
+		names = append(names, tl.Name)
+		if tl.StructuredLog == "" || tl.LogSchema != nil {
+			t.Errorf("task %s: structured_log %q, log_schema %v", tl.ID, tl.StructuredLog, tl.LogSchema)
+		}
+	}
+	if got := strings.Join(names, ","); got != "bwa_map (mapped_reads/A.bam),bwa_map (mapped_reads/B.bam),"+
+		"samtools_sort (sorted_reads/A.bam),samtools_sort (sorted_reads/B.bam),samtools_index (sorted_reads/A.bam.bai),"+
+		"samtools_index (sorted_reads/B.bam.bai),bcftools_call (calls/all.vcf),plot_quals (plots/quals.svg)" {
+		t.Errorf("task names = %s", got)
+	}
+	call := run.TaskLogs[6]
+	if call.ID != "7" || call.Metadata["snakemake.output"] != "calls/all.vcf\ncalls/all.vcf.stats" ||
+		call.Metadata["snakemake.job_hash"] != "-5560431259075632811" || call.Metadata["snakemake.log"] != "logs/bcftools_call.log" {
+		t.Errorf("bcftools_call: %+v", call)
+	}
+	if sort := run.TaskLogs[2]; sort.Metadata["snakemake.container_img_url"] != "docker://biocontainers/samtools:1.17" {
+		t.Errorf("samtools_sort metadata: %v", sort.Metadata)
+	}
+	if plot := run.TaskLogs[7]; !strings.Contains(plot.Metadata["snakemake.conda_env"], "matplotlib") || plot.Metadata["snakemake.shellcmd"] != "" {
+		t.Errorf("plot_quals metadata: %v", plot.Metadata)
+	}
+
+	crate, err := logschema.ParseCrate(run.RunLog.StructuredLog)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	runAction := crate.Get(logschema.RunEntityID("tutorial"))
+	if got := strings.Join(runAction.Refs("object"), ","); got != "data/genome.fa,data/samples/A.fastq,data/samples/B.fastq" {
+		t.Errorf("run objects = %s", got)
+	}
+	if got := strings.Join(runAction.Refs("result"), ","); got != "calls/all.vcf.stats,plots/quals.svg" {
+		t.Errorf("run results = %s", got)
+	}
+	slice, err := logschema.ParseCrate(call.StructuredLog)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a := slice.Get(logschema.TaskEntityID("7")); a == nil || len(a.Refs("object")) != 5 || len(a.Refs("result")) != 2 {
+		t.Errorf("bcftools_call slice: %s", call.StructuredLog)
+	}
+
+	t.Run("PROV", func(t *testing.T) {
+		run, err := logschema.ImportSnakemake("tutorial", logschema.SnakemakeRecords{Metadata: loadSnakemake(t)}, logschema.FormatOPM)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		checkImportedRun(t, run)
+		if run.RunLog.LogSchema.Format != logschema.FormatOPM {
+			t.Errorf("run log_schema: %+v", run.RunLog.LogSchema)
+		}
+		for _, tl := range run.TaskLogs {
+			if _, err := logschema.ParseProv(tl.StructuredLog); err != nil || tl.LogSchema != nil {
+				t.Errorf("task %s: %v, log_schema %v", tl.ID, err, tl.LogSchema)
+			}
+		}
+	})
+
+	t.Run("report only", func(t *testing.T) {
+		run, err := logschema.ImportSnakemake("tutorial", logschema.SnakemakeRecords{Report: report}, logschema.FormatROCrate)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		checkImportedRun(t, run)
+		if len(run.TaskLogs) != 8 || run.TaskLogs[0].Name != "bwa_map" || run.TaskLogs[0].StartTime != "2024-05-01T10:00:02.41Z" {
+			t.Errorf("tasks: %+v", run.TaskLogs)
+		}
+	})
+
+	t.Run("incomplete job", func(t *testing.T) {
+		md := loadSnakemake(t)
+		md["plots/quals.svg"] = []byte(strings.Replace(string(md["plots/quals.svg"]), `"incomplete": false`, `"incomplete": true`, 1))
+		delete(md, "calls/all.vcf.stats")
+		run, err := logschema.ImportSnakemake("tutorial", logschema.SnakemakeRecords{Metadata: md}, logschema.FormatROCrate)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		checkImportedRun(t, run)
+		plot := run.TaskLogs[len(run.TaskLogs)-1]
+		if run.State != "EXECUTOR_ERROR" || run.RunLog.ExitCode != 1 || plot.EndTime != "" || plot.Metadata["snakemake.incomplete"] != "true" {
+			t.Errorf("incomplete run: %s %+v %+v", run.State, run.RunLog.ExitCode, plot)
+		}
+	})
+
+	for _, bad := range []logschema.SnakemakeRecords{
+		{},
+		{Metadata: map[string][]byte{"a.txt": []byte(`{"input": []}`)}},
+		{Metadata: map[string][]byte{"a.txt": []byte(`not json`)}},
+		{Report: []byte("<html></html>")},
+	} {
+		if _, err := logschema.ImportSnakemake("r", bad, logschema.FormatROCrate); err == nil {
+			t.Errorf("ImportSnakemake(%q, %q) succeeded", bad.Metadata, bad.Report)
+		}
+	}
+	if _, err := logschema.ImportSnakemake("r", logschema.SnakemakeRecords{Metadata: loadSnakemake(t)}, "cwl"); err == nil {
+		t.Error("ImportSnakemake to an unsupported format succeeded")
+	}
+}
@@ -0,0 +1,190 @@
+package logschema
+
+import (
+	"fmt"
+)
+
+// Subgraph returns the entities reachable from seeds by following
+// crate-local references. The descriptor and root dataset are never
+// included. Actions other than the seeds are included only as stubs (@id,
+// @type and name) so that references to them still resolve without pulling
+// in their own inputs and outputs.
+func (c *Crate) Subgraph(seeds ...string) []Entity {
+	root := c.Root()
+	skip := map[string]bool{ROCrateMetadataID: true}
+	if root != nil {
+		skip[root.ID()] = true
+	}
+	isSeed := map[string]bool{}
+	for _, s := range seeds {
+		isSeed[s] = true
+	}
+
+	var out []Entity
+	seen := map[string]bool{}
+	queue := append([]string{}, seeds...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if seen[id] || skip[id] {
+			continue
+		}
+		seen[id] = true
+		e := c.Get(id)
+		if e == nil {
+			continue
+		}
+		if isAction(e) && !isSeed[id] {
+			stub := Entity{"@id": id, "@type": e["@type"]}
+			if name, ok := e["name"]; ok {
+				stub["name"] = name
+			}
+			out = append(out, stub)
+			continue
+		}
+		cp := Entity{}
+		for k, v := range e {
+			cp[k] = v
+		}
+		out = append(out, cp)
+		for _, prop := range sortedKeys(e) {
+			for _, r := range e.Refs(prop) {
+				if isLocalRef(r) {
+					queue = append(queue, r)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// SplitCrate slices a run-level crate into one crate per task. actions maps
+// a task key to the @id of the task's action; each slice holds that action,
+// the entities it references, and a fresh descriptor and root dataset.
+func SplitCrate(c *Crate, actions map[string]string) (map[string]*Crate, error) {
+	var conformsTo interface{} = ref(ProfileProcessRunCrate)
+	if root := c.Root(); root != nil && root["conformsTo"] != nil {
+		conformsTo = root["conformsTo"]
+	}
+	out := map[string]*Crate{}
+	for _, key := range sortedKeys(actions) {
+		id := actions[key]
+		action := c.Get(id)
+		if action == nil || !isAction(action) {
+			return nil, fmt.Errorf("task %s: crate has no action %q", key, id)
+		}
+		entities := c.Subgraph(id)
+		root := Entity{"@id": "./", "@type": "Dataset", "conformsTo": conformsTo, "mentions": ref(id)}
+		if name := action.String("name"); name != "" {
+			root["name"] = name
+		}
+		for _, e := range entities {
+			if isLocalRef(e.ID()) && (e.HasType("File") || e.HasType("Dataset")) {
+				addRef(root, "hasPart", e.ID())
+			}
+		}
+		graph := []Entity{{
+			"@id":        ROCrateMetadataID,
+			"@type":      "CreativeWork",
+			"conformsTo": ref(SchemaURIROCrate),
+			"about":      ref("./"),
+		}, root}
+		slice := &Crate{Context: c.Context, Graph: append(graph, entities...)}
+		if err := slice.CheckReferences(); err != nil {
+			return nil, fmt.Errorf("task %s: %w", key, err)
+		}
+		out[key] = slice
+	}
+	return out, nil
+}
+
+// SplitReport lists the tasks SplitRun populated and those it left alone.
+type SplitReport struct {
+	Split   []string `json:"split,omitempty"`
+	Skipped []string `json:"skipped,omitempty"` // with the reason
+}
+
+// SplitRun fills each task's structured_log with its slice of the run's
+// RO-Crate. mapping maps a TaskLog ID (or index, for tasks without one) to
+// the @id of its action; tasks missing from mapping use TaskEntityID.
+// Tasks that already have a structured_log, or whose action is not in the
+// crate, are skipped. Populated tasks carry no log_schema of their own: they
+// inherit the run's RO-Crate schema, which is declared on the run if it was
+// missing.
+func SplitRun(rl *RunLog, tasks []TaskLog, mapping map[string]string) (*SplitReport, error) {
+	if rl == nil || rl.StructuredLog == "" {
+		return nil, fmt.Errorf("run has no structured_log to split")
+	}
+	schema := rl.LogSchema
+	if schema == nil {
+		if d := DetectSchema([]byte(rl.StructuredLog)); d != nil && d.Schema.Format == FormatROCrate {
+			schema = d.Schema
+		}
+	}
+	if schema == nil || schema.Format != FormatROCrate {
+		return nil, fmt.Errorf("run structured_log is not an RO-Crate")
+	}
+	content, _, err := DecodeStructuredLog(rl.StructuredLog, schema)
+	if err != nil {
+		return nil, err
+	}
+	crate, err := ParseCrate(content)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &SplitReport{}
+	actions := map[string]string{}
+	for i := range tasks {
+		tl := &tasks[i]
+		key := crateTaskFromLog(tl, i).ID
+		location := taskLocation(tl, i)
+		id, ok := mapping[key]
+		if !ok {
+			id = TaskEntityID(key)
+		}
+		switch a := crate.Get(id); {
+		case tl.StructuredLog != "":
+			report.Skipped = append(report.Skipped, location+": already has a structured_log")
+		case a == nil || !isAction(a):
+			report.Skipped = append(report.Skipped, fmt.Sprintf("%s: crate has no action %q", location, id))
+		default:
+			actions[key] = id
+		}
+	}
+	slices, err := SplitCrate(crate, actions)
+	if err != nil {
+		return nil, err
+	}
+
+	rl.LogSchema = schema
+	for i := range tasks {
+		tl := &tasks[i]
+		slice, ok := slices[crateTaskFromLog(tl, i).ID]
+		if !ok {
+			continue
+		}
+		content, err := slice.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		// Tasks inherit the run's schema, including its content_encoding.
+		if isEncoded(schema) {
+			if content, err = EncodeContent([]byte(content), schema.ContentEncoding); err != nil {
+				return nil, err
+			}
+		}
+		if tl.LogSchema != nil && !sameSchema(tl.LogSchema, schema) {
+			// Attempts that relied on the task's schema keep it.
+			for j := range tl.Logs {
+				if a := &tl.Logs[j]; a.StructuredLog != "" && a.LogSchema == nil {
+					a.LogSchema = tl.LogSchema
+				}
+			}
+		}
+		tl.StructuredLog, tl.LogSchema = content, nil
+		tl.StructuredLogDigest, tl.StructuredLogSignatures = nil, nil
+		report.Split = append(report.Split, taskLocation(tl, i))
+	}
+	return report, nil
+}
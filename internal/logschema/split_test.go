@@ -0,0 +1,85 @@
+package logschema_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+func TestSplitRun(t *testing.T) {
+	rl := &logschema.RunLog{}
+	if err := variantCallingCrate().ApplyTo(rl); err != nil {
+		t.Fatal(err)
+	}
+	rl.LogSchema = nil // declared by SplitRun
+	tasks := []logschema.TaskLog{
+		{ID: "bwa", LogSchema: &logschema.LogSchema{SchemaURI: "https://example.com/events", Format: logschema.FormatCustom},
+			Logs: []logschema.Log{{StructuredLog: `{"event": "retry"}`}}},
+		{ID: "caller"},
+		{ID: "qc"},
+		{ID: "notes", StructuredLog: `{"note": "kept"}`},
+	}
+
+	report, err := logschema.SplitRun(rl, tasks, map[string]string{"caller": logschema.TaskEntityID("gatk")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.Join(report.Split, ","); got != "task bwa,task caller" {
+		t.Errorf("Split = %q", got)
+	}
+	if len(report.Skipped) != 2 {
+		t.Errorf("expected qc (no action) and notes (has a log) to be skipped: %v", report.Skipped)
+	}
+	if rl.LogSchema == nil || rl.LogSchema.Format != logschema.FormatROCrate {
+		t.Errorf("run schema not declared: %+v", rl.LogSchema)
+	}
+
+	bwa, err := logschema.ParseCrate(tasks[0].StructuredLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"#task-bwa", "reads.fastq", "aligned.bam", "#tool-bwa-mem2"} {
+		if bwa.Get(id) == nil {
+			t.Errorf("bwa slice is missing %s", id)
+		}
+	}
+	if bwa.Get("calls.vcf") != nil || bwa.Get("#task-gatk") != nil {
+		t.Errorf("bwa slice includes another task's entities: %v", bwa.Graph)
+	}
+	if got := bwa.Root().Refs("mentions"); len(got) != 1 || got[0] != "#task-bwa" {
+		t.Errorf("slice root mentions %v", got)
+	}
+
+	if tasks[0].LogSchema != nil || tasks[1].LogSchema != nil {
+		t.Errorf("split tasks should inherit the run schema")
+	}
+	if tasks[0].Logs[0].LogSchema == nil || tasks[0].Logs[0].LogSchema.Format != logschema.FormatCustom {
+		t.Errorf("attempt should keep the schema it inherited from its task: %+v", tasks[0].Logs[0].LogSchema)
+	}
+	tasks[3].LogSchema = &logschema.LogSchema{SchemaURI: "https://example.com/notes", Format: logschema.FormatCustom}
+	res, err := (&logschema.Validator{}).ValidateRun(rl, tasks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Valid() {
+		t.Errorf("split run does not validate: %+v %+v", res.Tasks, res.Attempts)
+	}
+
+	t.Run("re-aggregating the slices is conflict-free", func(t *testing.T) {
+		_, report, err := logschema.AggregateCrate("run-001", rl, tasks[:2])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Conflicts) > 0 {
+			t.Errorf("unexpected conflicts: %v", report.Conflicts)
+		}
+	})
+}
+
+func TestSplitRun_NotACrate(t *testing.T) {
+	rl := &logschema.RunLog{StructuredLog: `{"used": {}}`, LogSchema: logschema.ProvLogSchema()}
+	if _, err := logschema.SplitRun(rl, nil, nil); err == nil {
+		t.Error("expected error for a PROV run log")
+	}
+}
@@ -0,0 +1,359 @@
+package logschema
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrLogNotFound is returned by a LogStore for content it does not hold.
+var ErrLogNotFound = errors.New("structured log not found")
+
+// LogStore keeps structured logs outside of WES responses, so that
+// structured_log only carries a URI. Keys are slash-separated paths such as
+// those returned by LogKey.
+type LogStore interface {
+	// Put stores content under key and returns the URI to put in
+	// structured_log.
+	Put(key string, content []byte, mediaType string) (uri string, err error)
+
+	// Get returns the content behind a URI returned by Put, or an error
+	// wrapping ErrLogNotFound.
+	Get(uri string) ([]byte, error)
+
+	// Presign returns an HTTP(S) URL that grants read access to uri for
+	// ttl, for clients without credentials for the store.
+	Presign(uri string, ttl time.Duration) (string, error)
+
+	// List returns the logs whose keys start with prefix, sorted by key.
+	// Use LogPrefix to list the logs of a run or task.
+	List(prefix string) ([]StoredLog, error)
+
+	// Owns reports whether uri refers to content in this store.
+	Owns(uri string) bool
+}
+
+// StoredLog describes one log in a LogStore.
+type StoredLog struct {
+	Key      string    `json:"key"`
+	URI      string    `json:"uri"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// LogKey returns the key ExternalizeRun stores a structured_log under:
+//
+//	runs/<run>/structured_log.json
+//	runs/<run>/tasks/<task>/structured_log.json
+//	runs/<run>/tasks/<task>/attempts/<attempt>/structured_log.json
+//
+// task is empty for the run's own log, and attempt is negative for a run
+// or task log. IDs are path-escaped and the extension follows mediaType.
+func LogKey(runID, task string, attempt int, mediaType string) string {
+	key := LogPrefix(runID, task)
+	if task != "" && attempt >= 0 {
+		key += "attempts/" + strconv.Itoa(attempt) + "/"
+	}
+	return key + "structured_log" + logExtension(mediaType)
+}
+
+// LogPrefix returns the prefix that lists every log of a run, including
+// those of its tasks, or only the logs of one task when task is not empty.
+func LogPrefix(runID, task string) string {
+	prefix := "runs/" + url.PathEscape(runID) + "/"
+	if task != "" {
+		prefix += "tasks/" + url.PathEscape(task) + "/"
+	}
+	return prefix
+}
+
+func logExtension(mediaType string) string {
+	switch mediaType {
+	case "application/json", "application/ld+json":
+		return ".json"
+	case mediaTypeNDJSON:
+		return ".ndjson"
+	case mediaTypeJSONL:
+		return ".jsonl"
+	}
+	return ""
+}
+
+// checkKey rejects keys that could escape a store's root.
+func checkKey(key string) error {
+	if key == "" || strings.Contains(key, `\`) {
+		return fmt.Errorf("invalid log store key %q", key)
+	}
+	for _, seg := range strings.Split(key, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return fmt.Errorf("invalid log store key %q", key)
+		}
+	}
+	return nil
+}
+
+// taskKey names a task in LogKey: its ID, else its name, else its index.
+func taskKey(tl *TaskLog, i int) string {
+	switch {
+	case tl.ID != "":
+		return tl.ID
+	case tl.Name != "":
+		return tl.Name
+	}
+	return strconv.Itoa(i)
+}
+
+// ExternalizeRun moves every inline structured_log of at least minSize
+// bytes into store under LogKey and replaces it with the store's URI.
+// Encoded logs are stored decoded, since URIs are fetched as is, and
+// log_schema declarations are adjusted like EncodeStructuredLogs does.
+// Digests and signatures stay valid; a Validator whose Store is store
+// reads the logs back to check them. It returns the locations stored and,
+// for the others, why they were skipped.
+func ExternalizeRun(store LogStore, runID string, rl *RunLog, tasks []TaskLog, minSize int) (stored, skipped []string) {
+	skipped = transcodeRun(rl, tasks, func(pos logPosition, content *string, schema *LogSchema) (string, error) {
+		if len(*content) < minSize {
+			return schemaEncoding(schema), nil
+		}
+		body, _, err := DecodeStructuredLog(*content, schema)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", pos.location, err)
+		}
+		uri, err := store.Put(LogKey(runID, pos.task, pos.attempt, mediaTypeOf(schema)), []byte(body), mediaTypeOf(schema))
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", pos.location, err)
+		}
+		*content = uri
+		stored = append(stored, pos.location)
+		return "", nil
+	})
+	return stored, skipped
+}
+
+// FSLogStore is a LogStore in a local directory, addressed by file://
+// URIs. With BaseURL and Secret set it can also presign URLs, which it
+// serves itself as an http.Handler.
+type FSLogStore struct {
+	// Dir is the root directory of the store.
+	Dir string
+
+	// BaseURL is where the handler is reachable, e.g.
+	// "https://logs.example.org/structured-logs/". Keys are served
+	// relative to the handler's root, so mount it with http.StripPrefix.
+	BaseURL string
+
+	// Secret keys the HMAC of presigned URLs.
+	Secret []byte
+}
+
+func (s *FSLogStore) root() (string, error) {
+	return filepath.Abs(s.Dir)
+}
+
+func (s *FSLogStore) path(root, key string) string {
+	return filepath.Join(root, filepath.FromSlash(key))
+}
+
+// key returns the key a file:// URI refers to.
+func (s *FSLogStore) key(uri string) (string, bool) {
+	root, err := s.root()
+	if err != nil {
+		return "", false
+	}
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" || (u.Host != "" && u.Host != "localhost") {
+		return "", false
+	}
+	key, ok := strings.CutPrefix(u.Path, filepath.ToSlash(root)+"/")
+	if !ok || checkKey(key) != nil {
+		return "", false
+	}
+	return key, true
+}
+
+// Owns implements LogStore.
+func (s *FSLogStore) Owns(uri string) bool {
+	_, ok := s.key(uri)
+	return ok
+}
+
+// Put implements LogStore. The media type is carried by the key's
+// extension only.
+func (s *FSLogStore) Put(key string, content []byte, mediaType string) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	root, err := s.root()
+	if err != nil {
+		return "", err
+	}
+	path := s.path(root, key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String(), nil
+}
+
+// Get implements LogStore.
+func (s *FSLogStore) Get(uri string) ([]byte, error) {
+	key, ok := s.key(uri)
+	if !ok {
+		return nil, fmt.Errorf("%q is not in log store %s", uri, s.Dir)
+	}
+	root, err := s.root()
+	if err != nil {
+		return nil, err
+	}
+	body, err := os.ReadFile(s.path(root, key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrLogNotFound, uri)
+	}
+	return body, err
+}
+
+// List implements LogStore.
+func (s *FSLogStore) List(prefix string) ([]StoredLog, error) {
+	root, err := s.root()
+	if err != nil {
+		return nil, err
+	}
+	var out []StoredLog
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !d.Type().IsRegular() || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		out = append(out, StoredLog{
+			Key:      key,
+			URI:      (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String(),
+			Size:     info.Size(),
+			Modified: info.ModTime().UTC(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+// Presign implements LogStore. It needs BaseURL and Secret.
+func (s *FSLogStore) Presign(uri string, ttl time.Duration) (string, error) {
+	if s.BaseURL == "" || len(s.Secret) == 0 {
+		return "", fmt.Errorf("log store %s cannot presign URLs without a base URL and secret", s.Dir)
+	}
+	if ttl <= 0 {
+		return "", fmt.Errorf("presigned URL lifetime must be positive, got %s", ttl)
+	}
+	key, ok := s.key(uri)
+	if !ok {
+		return "", fmt.Errorf("%q is not in log store %s", uri, s.Dir)
+	}
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	q := url.Values{"expires": {expires}, "signature": {s.sign(key, expires)}}
+	return strings.TrimSuffix(s.BaseURL, "/") + "/" + escapeKey(key) + "?" + q.Encode(), nil
+}
+
+func (s *FSLogStore) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, s.Secret)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ServeHTTP serves logs at the URLs returned by Presign until they expire.
+func (s *FSLogStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	expires := r.URL.Query().Get("expires")
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if len(s.Secret) == 0 || err != nil || checkKey(key) != nil ||
+		!hmac.Equal([]byte(r.URL.Query().Get("signature")), []byte(s.sign(key, expires))) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+	if time.Now().Unix() > exp {
+		http.Error(w, "URL expired", http.StatusForbidden)
+		return
+	}
+	root, err := s.root()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	body, err := os.ReadFile(s.path(root, key))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", mediaTypeOfKey(key))
+	w.Write(body)
+}
+
+// mediaTypeOfKey reverses logExtension.
+func mediaTypeOfKey(key string) string {
+	switch filepath.Ext(key) {
+	case ".json":
+		return "application/json"
+	case ".ndjson":
+		return mediaTypeNDJSON
+	case ".jsonl":
+		return mediaTypeJSONL
+	}
+	return "application/octet-stream"
+}
+
+// escapeKey path-escapes each segment of a key.
+func escapeKey(key string) string {
+	segs := strings.Split(key, "/")
+	for i, seg := range segs {
+		segs[i] = url.PathEscape(seg)
+	}
+	return strings.Join(segs, "/")
+}
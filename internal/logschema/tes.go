@@ -0,0 +1,179 @@
+package logschema
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// TESTask is the part of a GA4GH Task Execution Service tesTask that
+// carries logs, as returned by GET /tasks/{id}?view=FULL.
+type TESTask struct {
+	ID          string            `json:"id,omitempty"`
+	State       string            `json:"state,omitempty"`
+	Name        string            `json:"name,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Executors   []TESExecutor     `json:"executors,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	// Logs holds one entry per attempt at running the task.
+	Logs         []TESTaskLog `json:"logs,omitempty"`
+	CreationTime string       `json:"creation_time,omitempty"`
+}
+
+// TESExecutor is one container a TES task runs, in order.
+type TESExecutor struct {
+	Image   string   `json:"image"`
+	Command []string `json:"command"`
+	Workdir string   `json:"workdir,omitempty"`
+}
+
+// TESTaskLog is the log of one attempt at running a TES task.
+type TESTaskLog struct {
+	Logs       []TESExecutorLog  `json:"logs"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	StartTime  string            `json:"start_time,omitempty"`
+	EndTime    string            `json:"end_time,omitempty"`
+	Outputs    []TESOutputFile   `json:"outputs,omitempty"`
+	SystemLogs []string          `json:"system_logs,omitempty"`
+}
+
+// TESExecutorLog is the log of one executor within a TES attempt. Stdout
+// and Stderr hold (possibly truncated) content, not URLs.
+type TESExecutorLog struct {
+	StartTime string `json:"start_time,omitempty"`
+	EndTime   string `json:"end_time,omitempty"`
+	Stdout    string `json:"stdout,omitempty"`
+	Stderr    string `json:"stderr,omitempty"`
+	ExitCode  int    `json:"exit_code"`
+}
+
+// TESOutputFile is an output file a TES attempt uploaded.
+type TESOutputFile struct {
+	URL       string `json:"url"`
+	Path      string `json:"path"`
+	SizeBytes string `json:"size_bytes"`
+}
+
+// Metadata keys TaskLogFromTES adds to the TaskLog.
+const (
+	TESMetadataState       = "tes.state"        // the TES task state, e.g. COMPLETE
+	TESMetadataAttempts    = "tes.attempts"     // number of TES attempts, when more than one
+	TESMetadataLogAttempts = "tes.log_attempts" // attempt of each Log, comma-separated, when more than one
+	TESMetadataSystemLogs  = "tes.system_logs"  // system logs that are not structured, one per line
+	TESMetadataExecutor    = "tes.executor."    // prefix of <i>.image, <i>.command (a JSON array) and <i>.workdir
+	TESMetadataOutput      = "tes.output."      // prefix of <i>.url, <i>.path and <i>.size_bytes
+)
+
+// TaskLogFromTES converts a TES task into a WES TaskLog.
+//
+// The executor logs of every attempt become the TaskLog's Logs, in order.
+// When there was more than one attempt, TESMetadataLogAttempts records the
+// zero-based attempt each Log belongs to, e.g. "0,0,1,1" for two attempts
+// of two executors.
+// The task's tags, the metadata of its attempts (later attempts winning),
+// its state, its executors and the output files of its last attempt are
+// carried into Metadata, and its times span all attempts.
+// ExitCode is the first non-zero exit code of the last attempt.
+//
+// Structured data is moved out of the plain-text streams: executor stdout
+// (or, failing that, stderr) for which Detect finds a schema_uri with at
+// least minConfidence becomes the Log's structured_log, and system logs
+// that do become the TaskLog's structured_log. Other system logs are kept
+// in Metadata under TESMetadataSystemLogs.
+func TaskLogFromTES(task *TESTask, minConfidence float64) TaskLog {
+	tl := TaskLog{ID: task.ID, Name: task.Name}
+	meta := map[string]string{}
+	for k, v := range task.Tags {
+		meta[k] = v
+	}
+	var systemLogs, logAttempts []string
+	for i, attempt := range task.Logs {
+		for k, v := range attempt.Metadata {
+			meta[k] = v
+		}
+		if tl.StartTime == "" {
+			tl.StartTime = attempt.StartTime
+		}
+		if attempt.EndTime != "" {
+			tl.EndTime = attempt.EndTime
+		}
+		systemLogs = append(systemLogs, attempt.SystemLogs...)
+		last := i == len(task.Logs)-1
+		for _, el := range attempt.Logs {
+			if last && tl.ExitCode == 0 {
+				tl.ExitCode = el.ExitCode
+			}
+			tl.Logs = append(tl.Logs, logFromTES(el, minConfidence))
+			logAttempts = append(logAttempts, strconv.Itoa(i))
+		}
+	}
+	if task.State != "" {
+		meta[TESMetadataState] = task.State
+	}
+	for i, e := range task.Executors {
+		key := TESMetadataExecutor + strconv.Itoa(i) + "."
+		meta[key+"image"] = e.Image
+		if len(e.Command) > 0 {
+			b, _ := json.Marshal(e.Command)
+			meta[key+"command"] = string(b)
+		}
+		if e.Workdir != "" {
+			meta[key+"workdir"] = e.Workdir
+		}
+	}
+	if n := len(task.Logs); n > 0 {
+		for i, o := range task.Logs[n-1].Outputs {
+			key := TESMetadataOutput + strconv.Itoa(i) + "."
+			meta[key+"url"], meta[key+"path"] = o.URL, o.Path
+			if o.SizeBytes != "" {
+				meta[key+"size_bytes"] = o.SizeBytes
+			}
+		}
+	}
+	if len(task.Logs) > 1 {
+		meta[TESMetadataAttempts] = strconv.Itoa(len(task.Logs))
+		meta[TESMetadataLogAttempts] = strings.Join(logAttempts, ",")
+	}
+	if len(systemLogs) > 0 {
+		joined := strings.Join(systemLogs, "\n")
+		if schema := tesStructuredSchema(joined, minConfidence); schema != nil {
+			tl.StructuredLog, tl.LogSchema = joined, schema
+		} else {
+			meta[TESMetadataSystemLogs] = joined
+		}
+	}
+	if len(meta) > 0 {
+		tl.Metadata = meta
+	}
+	return tl
+}
+
+// TaskLogsFromTES converts TES tasks with TaskLogFromTES, so that a run
+// whose tasks ran on TES can be checked with Validator.ValidateRun.
+func TaskLogsFromTES(tasks []TESTask, minConfidence float64) []TaskLog {
+	out := make([]TaskLog, len(tasks))
+	for i := range tasks {
+		out[i] = TaskLogFromTES(&tasks[i], minConfidence)
+	}
+	return out
+}
+
+func logFromTES(el TESExecutorLog, minConfidence float64) Log {
+	l := Log{StartTime: el.StartTime, EndTime: el.EndTime, Stdout: el.Stdout, Stderr: el.Stderr, ExitCode: el.ExitCode}
+	if schema := tesStructuredSchema(l.Stdout, minConfidence); schema != nil {
+		l.StructuredLog, l.LogSchema, l.Stdout = l.Stdout, schema, ""
+	} else if schema := tesStructuredSchema(l.Stderr, minConfidence); schema != nil {
+		l.StructuredLog, l.LogSchema, l.Stderr = l.Stderr, schema, ""
+	}
+	return l
+}
+
+// tesStructuredSchema returns the detected schema of content if it is
+// structured data with a schema_uri detected with at least minConfidence.
+func tesStructuredSchema(content string, minConfidence float64) *LogSchema {
+	d := DetectSchema([]byte(content))
+	if d == nil || d.Confidence < minConfidence || d.Schema.SchemaURI == "" {
+		return nil
+	}
+	return d.Schema
+}
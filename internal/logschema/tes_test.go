@@ -0,0 +1,138 @@
+package logschema_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+const tesTasks = `[
+	{
+		"id": "task-bwa",
+		"state": "COMPLETE",
+		"name": "bwa",
+		"executors": [{"image": "bwa:0.7.17", "command": ["bwa", "mem"]}, {"image": "samtools", "command": ["samtools", "sort"]}],
+		"tags": {"workflow": "variant-calling", "node": "from-tags"},
+		"logs": [
+			{
+				"start_time": "2024-05-01T10:00:00Z",
+				"end_time": "2024-05-01T10:01:00Z",
+				"metadata": {"node": "worker-1"},
+				"system_logs": ["pulling image bwa:0.7.17", "executor 0 was OOM killed"],
+				"logs": [{"stdout": "", "stderr": "Killed", "exit_code": 137}]
+			},
+			{
+				"start_time": "2024-05-01T10:02:00Z",
+				"end_time": "2024-05-01T10:09:00Z",
+				"metadata": {"node": "worker-2"},
+				"outputs": [{"url": "s3://bucket/s1.bam", "path": "/data/s1.bam", "size_bytes": "1024"}],
+				"logs": [
+					{"stdout": "[M::bwa_idx_load] read 0 ALT contigs", "stderr": "{\"@context\": \"https://w3id.org/ro/crate/1.1/context\", \"@graph\": []}", "exit_code": 0},
+					{"stdout": "{\"prefix\": {\"prov\": \"http://www.w3.org/ns/prov#\"}, \"entity\": {\"ex:bam\": {}}, \"activity\": {\"ex:sort\": {}}}", "exit_code": 3}
+				]
+			}
+		]
+	},
+	{
+		"id": "task-otel",
+		"state": "EXECUTOR_ERROR",
+		"executors": [{"image": "gatk", "command": ["gatk"]}],
+		"logs": [{
+			"system_logs": ["{\"resourceLogs\": []}", "{\"resourceLogs\": []}"],
+			"logs": [{"stdout": "{\"@context\": \"https://w3id.org/ro/crate/1.1/context\"}", "exit_code": 1}]
+		}]
+	}
+]`
+
+func TestTaskLogsFromTES(t *testing.T) {
+	var tasks []logschema.TESTask
+	if err := json.Unmarshal([]byte(tesTasks), &tasks); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	logs := logschema.TaskLogsFromTES(tasks, 0.5)
+
+	bwa := logs[0]
+	if bwa.ID != "task-bwa" || bwa.Name != "bwa" || bwa.StartTime != "2024-05-01T10:00:00Z" || bwa.EndTime != "2024-05-01T10:09:00Z" || bwa.ExitCode != 3 {
+		t.Errorf("task fields: %+v", bwa)
+	}
+	wantMeta := map[string]string{
+		"workflow":                       "variant-calling",
+		"node":                           "worker-2",
+		logschema.TESMetadataState:       "COMPLETE",
+		logschema.TESMetadataAttempts:    "2",
+		logschema.TESMetadataLogAttempts: "0,1,1",
+		logschema.TESMetadataSystemLogs:  "pulling image bwa:0.7.17\nexecutor 0 was OOM killed",
+		"tes.executor.0.image":           "bwa:0.7.17",
+		"tes.executor.0.command":         `["bwa","mem"]`,
+		"tes.executor.1.image":           "samtools",
+		"tes.executor.1.command":         `["samtools","sort"]`,
+		"tes.output.0.url":               "s3://bucket/s1.bam",
+		"tes.output.0.path":              "/data/s1.bam",
+		"tes.output.0.size_bytes":        "1024",
+	}
+	if len(bwa.Metadata) != len(wantMeta) {
+		t.Errorf("Metadata = %v", bwa.Metadata)
+	}
+	for k, v := range wantMeta {
+		if bwa.Metadata[k] != v {
+			t.Errorf("Metadata[%q] = %q, want %q", k, bwa.Metadata[k], v)
+		}
+	}
+	if bwa.StructuredLog != "" || len(bwa.Logs) != 3 {
+		t.Fatalf("task structured_log %q, %d logs", bwa.StructuredLog, len(bwa.Logs))
+	}
+	if l := bwa.Logs[0]; l.StructuredLog != "" || l.Stderr != "Killed" || l.ExitCode != 137 {
+		t.Errorf("plain log: %+v", l)
+	}
+	if l := bwa.Logs[1]; l.Stderr != "" || l.Stdout == "" || l.LogSchema == nil || l.LogSchema.Format != logschema.FormatROCrate {
+		t.Errorf("stderr crate not moved: %+v", l)
+	}
+	if l := bwa.Logs[2]; l.Stdout != "" || l.LogSchema == nil || l.LogSchema.SchemaURI != logschema.SchemaURIPROV {
+		t.Errorf("stdout PROV not moved: %+v", l)
+	}
+
+	otel := logs[1]
+	if otel.LogSchema == nil || otel.LogSchema.SchemaURI != logschema.SchemaURIOTLP || otel.Metadata[logschema.TESMetadataSystemLogs] != "" {
+		t.Errorf("OTLP system logs not moved: %+v", otel)
+	}
+	if otel.Metadata[logschema.TESMetadataState] != "EXECUTOR_ERROR" || otel.Metadata[logschema.TESMetadataAttempts] != "" || otel.Metadata[logschema.TESMetadataLogAttempts] != "" {
+		t.Errorf("Metadata = %v", otel.Metadata)
+	}
+
+	res, err := (&logschema.Validator{Offline: true}).ValidateRun(nil, logs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Failures() != 1 || res.Attempts[1][0] == nil || res.Attempts[1][0].Stage != logschema.StageFormat {
+		t.Errorf("want only the crate without @graph to fail: %+v %+v", res.Tasks, res.Attempts)
+	}
+
+	if got := logschema.TaskLogFromTES(&tasks[1], 0.9); got.StructuredLog != "" || got.Logs[0].StructuredLog != "" {
+		t.Errorf("detections below minConfidence were moved: %+v", got)
+	}
+}
+
+func TestTaskLogFromTES_Attempts(t *testing.T) {
+	var task logschema.TESTask
+	if err := json.Unmarshal([]byte(`{
+		"id": "retried",
+		"executors": [{"image": "a"}, {"image": "b"}],
+		"logs": [
+			{"logs": [{"stdout": "a 1", "exit_code": 0}, {"stdout": "b 1", "exit_code": 1}]},
+			{"logs": [{"stdout": "a 2", "exit_code": 0}, {"stdout": "b 2", "exit_code": 0}]}
+		]
+	}`), &task); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tl := logschema.TaskLogFromTES(&task, 0.5)
+	if len(tl.Logs) != 4 || tl.Logs[1].Stdout != "b 1" || tl.Logs[2].Stdout != "a 2" {
+		t.Fatalf("Logs = %+v", tl.Logs)
+	}
+	if got := tl.Metadata[logschema.TESMetadataLogAttempts]; got != "0,0,1,1" {
+		t.Errorf("Metadata[%q] = %q, want 0,0,1,1", logschema.TESMetadataLogAttempts, got)
+	}
+	if tl.ExitCode != 0 {
+		t.Errorf("ExitCode = %d, want the last attempt's 0", tl.ExitCode)
+	}
+}
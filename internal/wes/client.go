@@ -0,0 +1,226 @@
+package wes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+// Client talks to a WES endpoint.
+type Client struct {
+	// BaseURL is the WES API root, e.g. "https://wes.example.com/ga4gh/wes/v1".
+	BaseURL string
+
+	// HTTPClient is used for all requests.
+	// Defaults to a client with a 30s timeout if nil.
+	HTTPClient *http.Client
+
+	// PageSize is sent as page_size when listing runs and tasks.
+	// Zero leaves the choice to the server.
+	PageSize int
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return &http.Client{Timeout: 30 * time.Second}
+}
+
+// ListRuns fetches one page of GET /runs.
+func (c *Client) ListRuns(pageToken string) (*RunListResponse, error) {
+	var out RunListResponse
+	if err := c.get("/runs", c.pageQuery(pageToken), &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AllRuns follows next_page_token until every run has been listed. A
+// server that hands out a token twice would page forever; that is an error.
+func (c *Client) AllRuns() ([]RunStatus, error) {
+	var runs []RunStatus
+	token := ""
+	seen := map[string]bool{}
+	for {
+		page, err := c.ListRuns(token)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, page.Runs...)
+		if page.NextPageToken == "" {
+			return runs, nil
+		}
+		if err := nextPage(seen, page.NextPageToken); err != nil {
+			return nil, err
+		}
+		token = page.NextPageToken
+	}
+}
+
+// GetRun fetches GET /runs/{run_id}.
+func (c *Client) GetRun(runID string) (*logschema.Run, error) {
+	var out logschema.Run
+	if err := c.get("/runs/"+url.PathEscape(runID), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetRunStatus fetches GET /runs/{run_id}/status.
+func (c *Client) GetRunStatus(runID string) (*RunStatus, error) {
+	var out RunStatus
+	if err := c.get("/runs/"+url.PathEscape(runID)+"/status", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListTasks fetches one page of GET /runs/{run_id}/tasks.
+func (c *Client) ListTasks(runID, pageToken string) (*TaskListResponse, error) {
+	var out TaskListResponse
+	if err := c.get("/runs/"+url.PathEscape(runID)+"/tasks", c.pageQuery(pageToken), &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AllTasks follows next_page_token until every task of the run is listed.
+// Like AllRuns, it fails if the server repeats a token.
+func (c *Client) AllTasks(runID string) ([]logschema.TaskLog, error) {
+	var tasks []logschema.TaskLog
+	token := ""
+	seen := map[string]bool{}
+	for {
+		page, err := c.ListTasks(runID, token)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, page.TaskLogs...)
+		if page.NextPageToken == "" {
+			return tasks, nil
+		}
+		if err := nextPage(seen, page.NextPageToken); err != nil {
+			return nil, err
+		}
+		token = page.NextPageToken
+	}
+}
+
+// nextPage records a next_page_token, failing if it was already followed.
+func nextPage(seen map[string]bool, token string) error {
+	if seen[token] {
+		return fmt.Errorf("server repeated next_page_token %q", token)
+	}
+	seen[token] = true
+	return nil
+}
+
+// GetFullRun fetches a run together with all of its task logs. Servers
+// that only advertise task_logs_url are paged through /runs/{run_id}/tasks.
+func (c *Client) GetFullRun(runID string) (*logschema.Run, error) {
+	run, err := c.GetRun(runID)
+	if err != nil {
+		return nil, err
+	}
+	if run.TaskLogs == nil {
+		tasks, err := c.AllTasks(runID)
+		if err != nil {
+			// The tasks endpoint is optional in older WES versions.
+			if e, ok := err.(*ErrorResponse); ok && e.StatusCode == http.StatusNotFound {
+				return run, nil
+			}
+			return nil, err
+		}
+		run.TaskLogs = tasks
+	}
+	return run, nil
+}
+
+// RunReport is the outcome of validating one run fetched from WES.
+type RunReport struct {
+	RunID  string               `json:"run_id"`
+	State  string               `json:"state,omitempty"`
+	Run    *logschema.Run       `json:"-"`
+	Result *logschema.RunResult `json:"result,omitempty"`
+	Err    error                `json:"-"`
+}
+
+// ValidateRuns lists every run on the server, fetches each one in full and
+// pipes it through whole-run validation. fn is called once per run, in
+// listing order; fetch failures are reported through RunReport.Err rather
+// than aborting the walk. Returning an error from fn stops the walk.
+func (c *Client) ValidateRuns(v *logschema.Validator, fn func(*RunReport) error) error {
+	runs, err := c.AllRuns()
+	if err != nil {
+		return err
+	}
+	for _, rs := range runs {
+		if err := fn(c.ValidateRun(v, rs.RunID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateRun fetches a single run in full and validates it.
+func (c *Client) ValidateRun(v *logschema.Validator, runID string) *RunReport {
+	rep := &RunReport{RunID: runID}
+	run, err := c.GetFullRun(runID)
+	if err != nil {
+		rep.Err = err
+		return rep
+	}
+	rep.Run = run
+	rep.State = run.State
+	rep.Result, rep.Err = v.ValidateRun(run.RunLog, run.TaskLogs)
+	return rep
+}
+
+func (c *Client) pageQuery(token string) url.Values {
+	q := url.Values{}
+	if c.PageSize > 0 {
+		q.Set("page_size", strconv.Itoa(c.PageSize))
+	}
+	if token != "" {
+		q.Set("page_token", token)
+	}
+	return q
+}
+
+// get performs a GET against BaseURL+path and decodes the JSON response.
+func (c *Client) get(path string, query url.Values, out interface{}) error {
+	u := strings.TrimRight(c.BaseURL, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	resp, err := c.httpClient().Get(u)
+	if err != nil {
+		return fmt.Errorf("GET %s: %w", u, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("GET %s: reading body: %w", u, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		e := &ErrorResponse{}
+		if json.Unmarshal(body, e) != nil || e.Msg == "" {
+			e.Msg = strings.TrimSpace(string(body))
+		}
+		e.StatusCode = resp.StatusCode
+		return e
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("GET %s: decoding response: %w", u, err)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package wes_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+	"github.com/animeshs34/wes-logging-schema/internal/wes"
+)
+
+var crateSchema = &logschema.LogSchema{
+	SchemaURI: "https://w3id.org/ro/crate/1.1",
+	Format:    logschema.FormatROCrate,
+}
+
+const crate = `{"@context": "https://w3id.org/ro/crate/1.1/context", "@graph": []}`
+
+func testRuns() []*logschema.Run {
+	var tasks []logschema.TaskLog
+	for i := 0; i < 5; i++ {
+		tasks = append(tasks, logschema.TaskLog{ID: fmt.Sprintf("task-%d", i), StructuredLog: crate})
+	}
+	return []*logschema.Run{
+		{
+			RunID:    "run-ok",
+			State:    "COMPLETE",
+			RunLog:   &logschema.RunLog{Name: "ok", StructuredLog: crate, LogSchema: crateSchema},
+			TaskLogs: tasks,
+		},
+		{
+			RunID:  "run-missing-schema",
+			State:  "COMPLETE",
+			RunLog: &logschema.RunLog{StructuredLog: crate},
+		},
+		{
+			RunID:  "run-plain",
+			State:  "RUNNING",
+			RunLog: &logschema.RunLog{Stdout: "https://example.com/stdout"},
+		},
+	}
+}
+
+func TestClient_Paging(t *testing.T) {
+	srv := wes.NewMockServer(testRuns()...)
+	defer srv.Close()
+	c := &wes.Client{BaseURL: srv.BaseURL(), PageSize: 2}
+
+	t.Run("AllRuns follows next_page_token", func(t *testing.T) {
+		runs, err := c.AllRuns()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(runs) != 3 || runs[2].RunID != "run-plain" {
+			t.Errorf("unexpected runs: %+v", runs)
+		}
+	})
+
+	t.Run("first page carries a token", func(t *testing.T) {
+		page, err := c.ListRuns("")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(page.Runs) != 2 || page.NextPageToken == "" {
+			t.Errorf("unexpected page: %+v", page)
+		}
+	})
+
+	t.Run("AllTasks pages through tasks", func(t *testing.T) {
+		tasks, err := c.AllTasks("run-ok")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(tasks) != 5 || tasks[4].ID != "task-4" {
+			t.Errorf("unexpected tasks: %+v", tasks)
+		}
+	})
+
+	t.Run("GetFullRun fills task_logs from the tasks endpoint", func(t *testing.T) {
+		run, err := c.GetFullRun("run-ok")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if run.TaskLogsURL == "" || len(run.TaskLogs) != 5 || run.RunLog.LogSchema == nil {
+			t.Errorf("unexpected run: %+v", run)
+		}
+	})
+
+	t.Run("GetRunStatus", func(t *testing.T) {
+		st, err := c.GetRunStatus("run-plain")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if st.State != "RUNNING" {
+			t.Errorf("state = %q", st.State)
+		}
+	})
+
+	t.Run("unknown run returns ErrorResponse", func(t *testing.T) {
+		_, err := c.GetRun("nope")
+		e, ok := err.(*wes.ErrorResponse)
+		if !ok || e.StatusCode != 404 {
+			t.Errorf("expected 404 ErrorResponse, got %v", err)
+		}
+	})
+}
+
+func TestClient_RepeatedPageToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/tasks") {
+			fmt.Fprint(w, `{"task_logs": [{"id": "t"}], "next_page_token": "again"}`)
+			return
+		}
+		fmt.Fprint(w, `{"runs": [{"run_id": "r"}], "next_page_token": "again"}`)
+	}))
+	defer srv.Close()
+	c := &wes.Client{BaseURL: srv.URL}
+
+	if runs, err := c.AllRuns(); err == nil || !strings.Contains(err.Error(), "again") {
+		t.Errorf("AllRuns = %d runs, %v; want repeated token error", len(runs), err)
+	}
+	if tasks, err := c.AllTasks("r"); err == nil || !strings.Contains(err.Error(), "again") {
+		t.Errorf("AllTasks = %d tasks, %v; want repeated token error", len(tasks), err)
+	}
+}
+
+func TestClient_ValidateRuns(t *testing.T) {
+	srv := wes.NewMockServer(testRuns()...)
+	defer srv.Close()
+	c := &wes.Client{BaseURL: srv.BaseURL(), PageSize: 2}
+
+	valid := map[string]bool{}
+	err := c.ValidateRuns(&logschema.Validator{}, func(rep *wes.RunReport) error {
+		if rep.Err != nil {
+			return rep.Err
+		}
+		valid[rep.RunID] = rep.Result.Valid()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]bool{"run-ok": true, "run-missing-schema": false, "run-plain": true}
+	for id, v := range want {
+		if got, ok := valid[id]; !ok || got != v {
+			t.Errorf("run %s: valid = %v (seen %v), want %v", id, got, ok, v)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package wes
+
+import "github.com/animeshs34/wes-logging-schema/internal/logschema"
+
+// Fixture is a canned run served by the reference server, together with
+// whether a conforming validator should accept it.
+type Fixture struct {
+	Run         *logschema.Run
+	Valid       bool
+	Description string
+}
+
+// roCrateSchema, provSchema and customSchema return new LogSchema values
+// for each fixture, so that changing one fixture never changes another.
+func roCrateSchema() *logschema.LogSchema {
+	return &logschema.LogSchema{
+		SchemaURI:     "https://w3id.org/ro/crate/1.1",
+		Format:        logschema.FormatROCrate,
+		MediaType:     "application/ld+json",
+		SchemaVersion: "1.1",
+	}
+}
+
+func provSchema() *logschema.LogSchema {
+	return &logschema.LogSchema{
+		SchemaURI: "https://www.w3.org/TR/prov-o/",
+		Format:    logschema.FormatOPM,
+	}
+}
+
+func customSchema() *logschema.LogSchema {
+	return &logschema.LogSchema{
+		SchemaURI:     "https://example.org/schemas/engine-events/v2.json",
+		Format:        logschema.FormatCustom,
+		MediaType:     "application/json",
+		SchemaVersion: "2.0.0",
+	}
+}
+
+// Fixtures returns the canned runs served by NewFixtureServer. They cover
+// RO-Crate, PROV and custom structured logs at run, task and attempt level,
+// schema inheritance, and the broken cases from cmd/demo. Each call returns
+// fresh values, so callers may modify them.
+func Fixtures() []Fixture {
+	return []Fixture{
+		{
+			Description: "RO-Crate at run level; tasks and attempts inherit the run schema",
+			Valid:       true,
+			Run: &logschema.Run{
+				RunID: "ro-crate-inherited",
+				State: "COMPLETE",
+				RunLog: &logschema.RunLog{
+					Name:      "variant-calling-pipeline",
+					StartTime: "2024-01-01T10:00:00Z",
+					EndTime:   "2024-01-01T12:00:00Z",
+					Stdout:    "https://storage.example.com/runs/ro-crate-inherited/stdout.txt",
+					StructuredLog: `{
+  "@context": "https://w3id.org/ro/crate/1.1/context",
+  "@graph": [
+    {"@id": "ro-crate-metadata.json", "@type": "CreativeWork", "about": {"@id": "./"}},
+    {"@id": "./", "@type": "Dataset", "name": "variant-calling-pipeline run", "mentions": {"@id": "#run-001"}},
+    {"@id": "#run-001", "@type": "CreateAction", "name": "WES run ro-crate-inherited",
+     "startTime": "2024-01-01T10:00:00Z", "endTime": "2024-01-01T12:00:00Z",
+     "object": [{"@id": "reads.fastq"}], "result": [{"@id": "calls.vcf"}]},
+    {"@id": "reads.fastq", "@type": "File"},
+    {"@id": "calls.vcf", "@type": "File"}
+  ]
+}`,
+					LogSchema: roCrateSchema(),
+				},
+				TaskLogs: []logschema.TaskLog{
+					{
+						ID:        "bwa-mem2",
+						Name:      "align",
+						StartTime: "2024-01-01T10:00:00Z",
+						EndTime:   "2024-01-01T10:30:00Z",
+						StructuredLog: `{
+  "@context": "https://w3id.org/ro/crate/1.1/context",
+  "@graph": [
+    {"@id": "#task-bwa-001", "@type": "CreateAction", "name": "BWA-MEM2 task",
+     "object": [{"@id": "reads.fastq"}], "result": [{"@id": "aligned.bam"}]}
+  ]
+}`,
+						Logs: []logschema.Log{
+							{
+								StartTime: "2024-01-01T10:00:00Z",
+								EndTime:   "2024-01-01T10:05:00Z",
+								ExitCode:  137,
+								Stderr:    "https://storage.example.com/runs/ro-crate-inherited/bwa-1.err",
+								StructuredLog: `{
+  "@context": "https://w3id.org/ro/crate/1.1/context",
+  "@graph": [{"@id": "#task-bwa-001-attempt-1", "@type": "CreateAction", "actionStatus": "http://schema.org/FailedActionStatus"}]
+}`,
+							},
+							{
+								StartTime: "2024-01-01T10:05:00Z",
+								EndTime:   "2024-01-01T10:30:00Z",
+							},
+						},
+					},
+					{
+						ID:        "gatk-haplotypecaller",
+						Name:      "call",
+						StartTime: "2024-01-01T10:30:00Z",
+						EndTime:   "2024-01-01T12:00:00Z",
+						StructuredLog: `{
+  "@context": "https://w3id.org/ro/crate/1.1/context",
+  "@graph": [
+    {"@id": "#task-gatk-001", "@type": "CreateAction", "name": "HaplotypeCaller task",
+     "object": [{"@id": "aligned.bam"}], "result": [{"@id": "calls.vcf"}]}
+  ]
+}`,
+					},
+				},
+			},
+		},
+		{
+			Description: "PROV at run and task level",
+			Valid:       true,
+			Run: &logschema.Run{
+				RunID: "prov",
+				State: "COMPLETE",
+				RunLog: &logschema.RunLog{
+					Name: "genomic-alignment",
+					StructuredLog: `{
+  "prefix": {"ex": "https://example.org/"},
+  "entity": {"ex:sample-reads-001": {}, "ex:alignment-output-001": {}},
+  "activity": {"ex:bwa-mem2-align": {"prov:startTime": "2024-01-01T10:00:00Z", "prov:endTime": "2024-01-01T11:00:00Z"}},
+  "agent": {"ex:researcher-01": {"prov:type": "prov:Person"}},
+  "used": {"_:u1": {"prov:activity": "ex:bwa-mem2-align", "prov:entity": "ex:sample-reads-001"}},
+  "wasGeneratedBy": {"_:g1": {"prov:entity": "ex:alignment-output-001", "prov:activity": "ex:bwa-mem2-align"}},
+  "wasAssociatedWith": {"_:a1": {"prov:activity": "ex:bwa-mem2-align", "prov:agent": "ex:researcher-01"}}
+}`,
+					LogSchema: provSchema(),
+				},
+				TaskLogs: []logschema.TaskLog{
+					{
+						ID:            "bwa-mem2-align",
+						StructuredLog: `{"activity": {"ex:bwa-mem2-align": {}}, "used": {"_:u1": {"prov:activity": "ex:bwa-mem2-align", "prov:entity": "ex:sample-reads-001"}}}`,
+					},
+				},
+			},
+		},
+		{
+			Description: "Custom engine event format with a task-level PROV override",
+			Valid:       true,
+			Run: &logschema.Run{
+				RunID: "custom",
+				State: "COMPLETE",
+				RunLog: &logschema.RunLog{
+					Name:          "qc-pipeline",
+					StructuredLog: `{"events": [{"ts": "2024-01-01T09:00:00Z", "kind": "run_started"}, {"ts": "2024-01-01T09:10:00Z", "kind": "run_finished"}]}`,
+					LogSchema:     customSchema(),
+				},
+				TaskLogs: []logschema.TaskLog{
+					{ID: "fastqc", StructuredLog: `{"events": [{"ts": "2024-01-01T09:01:00Z", "kind": "task_started"}]}`},
+					{ID: "multiqc", StructuredLog: `{"wasGeneratedBy": {"_:g1": {"prov:entity": "report.html"}}}`, LogSchema: provSchema()},
+				},
+			},
+		},
+		{
+			Description: "Plain-text logs only; nothing to validate",
+			Valid:       true,
+			Run: &logschema.Run{
+				RunID: "plain-text",
+				State: "RUNNING",
+				RunLog: &logschema.RunLog{
+					Name:   "legacy-engine-run",
+					Stdout: "https://storage.example.com/runs/plain-text/stdout.txt",
+					Stderr: "https://storage.example.com/runs/plain-text/stderr.txt",
+				},
+			},
+		},
+		{
+			Description: "structured_log without log_schema (demo scenario 3)",
+			Valid:       false,
+			Run: &logschema.Run{
+				RunID:  "broken-missing-schema",
+				State:  "COMPLETE",
+				RunLog: &logschema.RunLog{StructuredLog: `{"wasGeneratedBy": {"id": "run-002"}}`},
+			},
+		},
+		{
+			Description: "Malformed JSON in structured_log (demo scenario 5)",
+			Valid:       false,
+			Run: &logschema.Run{
+				RunID:  "broken-malformed-json",
+				State:  "EXECUTOR_ERROR",
+				RunLog: &logschema.RunLog{StructuredLog: `{this is not valid json`, LogSchema: provSchema()},
+			},
+		},
+		{
+			Description: "Task-level RO-Crate missing @graph",
+			Valid:       false,
+			Run: &logschema.Run{
+				RunID:  "broken-task-crate",
+				State:  "COMPLETE",
+				RunLog: &logschema.RunLog{LogSchema: roCrateSchema()},
+				TaskLogs: []logschema.TaskLog{
+					{ID: "step-1", StructuredLog: `{"@context": "https://w3id.org/ro/crate/1.1/context"}`},
+				},
+			},
+		},
+		{
+			Description: "Task structured_log with no schema to inherit",
+			Valid:       false,
+			Run: &logschema.Run{
+				RunID:    "broken-orphan-task",
+				State:    "COMPLETE",
+				RunLog:   &logschema.RunLog{Name: "no-run-schema"},
+				TaskLogs: []logschema.TaskLog{{ID: "step-1", StructuredLog: `{"entity": {}}`}},
+			},
+		},
+		{
+			Description: "Relative schema_uri on the attempt level",
+			Valid:       false,
+			Run: &logschema.Run{
+				RunID:  "broken-attempt-schema",
+				State:  "COMPLETE",
+				RunLog: &logschema.RunLog{LogSchema: provSchema()},
+				TaskLogs: []logschema.TaskLog{
+					{ID: "step-1", Logs: []logschema.Log{{StructuredLog: `{"entity": {}}`, LogSchema: &logschema.LogSchema{SchemaURI: "schemas/prov.json"}}}},
+				},
+			},
+		},
+	}
+}
+
+// FixtureRuns returns the runs of Fixtures.
+func FixtureRuns() []*logschema.Run {
+	fixtures := Fixtures()
+	runs := make([]*logschema.Run, len(fixtures))
+	for i, f := range fixtures {
+		runs[i] = f.Run
+	}
+	return runs
+}
@@ -0,0 +1,41 @@
+package wes
+
+import (
+	"net/http/httptest"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+// MockServer is a Server running on an httptest listener, for embedding
+// in Go tests.
+type MockServer struct {
+	*httptest.Server
+
+	// WES is the underlying reference server; set WES.PageSize to change
+	// the default page size.
+	WES *Server
+
+	store *MemoryStore
+}
+
+// NewMockServer starts a mock WES server serving runs from memory.
+func NewMockServer(runs ...*logschema.Run) *MockServer {
+	store := NewMemoryStore(runs...)
+	s := &Server{Store: store}
+	return &MockServer{Server: httptest.NewServer(s), WES: s, store: store}
+}
+
+// NewFixtureServer starts a mock WES server serving FixtureRuns.
+func NewFixtureServer() *MockServer {
+	return NewMockServer(FixtureRuns()...)
+}
+
+// BaseURL returns the WES API root to hand to a Client.
+func (m *MockServer) BaseURL() string {
+	return m.URL + BasePath
+}
+
+// AddRun adds or replaces a run on the server.
+func (m *MockServer) AddRun(run *logschema.Run) {
+	m.store.PutRun(run)
+}
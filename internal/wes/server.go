@@ -0,0 +1,203 @@
+package wes
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+// BasePath is the conventional WES API prefix.
+const BasePath = "/ga4gh/wes/v1"
+
+// ServiceInfo is the subset of the WES ServiceInfo served by Server.
+type ServiceInfo struct {
+	ID                   string             `json:"id"`
+	Name                 string             `json:"name"`
+	Type                 map[string]string  `json:"type"`
+	Version              string             `json:"version"`
+	SupportedWESVersions []string           `json:"supported_wes_versions"`
+	SystemStateCounts    map[string]int     `json:"system_state_counts"`
+	SupportedLogFormats  []logschema.Format `json:"supported_log_formats"`
+}
+
+// Server is a read-only reference WES server backed by a Store. It serves
+// GET /service-info, /runs, /runs/{run_id}, /runs/{run_id}/status and
+// /runs/{run_id}/tasks under BasePath. Runs are returned without task_logs;
+// task_logs_url points clients at the paged tasks endpoint, as in WES 1.1.
+type Server struct {
+	// Store holds the runs. Defaults to an empty MemoryStore.
+	Store Store
+
+	// PageSize is the default page size when the client sends none.
+	// Defaults to 10.
+	PageSize int
+
+	once sync.Once
+	mux  *http.ServeMux
+}
+
+func (s *Server) store() Store {
+	if s.Store == nil {
+		return emptyStore
+	}
+	return s.Store
+}
+
+var emptyStore = NewMemoryStore()
+
+func (s *Server) pageSize() int {
+	if s.PageSize > 0 {
+		return s.PageSize
+	}
+	return 10
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.once.Do(func() {
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET "+BasePath+"/service-info", s.serviceInfo)
+		mux.HandleFunc("GET "+BasePath+"/runs", s.listRuns)
+		mux.HandleFunc("GET "+BasePath+"/runs/{run_id}", s.getRun)
+		mux.HandleFunc("GET "+BasePath+"/runs/{run_id}/status", s.getStatus)
+		mux.HandleFunc("GET "+BasePath+"/runs/{run_id}/tasks", s.listTasks)
+		s.mux = mux
+	})
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) serviceInfo(w http.ResponseWriter, r *http.Request) {
+	runs, err := s.store().ListRuns()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	counts := map[string]int{}
+	for _, run := range runs {
+		counts[run.State]++
+	}
+	writeJSON(w, http.StatusOK, ServiceInfo{
+		ID:                   "org.ga4gh.wes-logging-schema.mock",
+		Name:                 "WES structured logging reference server",
+		Type:                 map[string]string{"group": "org.ga4gh", "artifact": "wes", "version": "1.1.0"},
+		Version:              "0.1.0",
+		SupportedWESVersions: []string{"1.1.0"},
+		SystemStateCounts:    counts,
+		SupportedLogFormats:  []logschema.Format{logschema.FormatROCrate, logschema.FormatOPM, logschema.FormatJSONSchema, logschema.FormatCustom},
+	})
+}
+
+func (s *Server) listRuns(w http.ResponseWriter, r *http.Request) {
+	runs, err := s.store().ListRuns()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	start, end, next, ok := s.page(w, r, len(runs))
+	if !ok {
+		return
+	}
+	statuses := make([]RunStatus, 0, end-start)
+	for _, run := range runs[start:end] {
+		statuses = append(statuses, RunStatus{RunID: run.RunID, State: run.State})
+	}
+	writeJSON(w, http.StatusOK, RunListResponse{Runs: statuses, NextPageToken: next})
+}
+
+func (s *Server) getRun(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	out := *run
+	out.TaskLogs = nil
+	out.TaskLogsURL = requestBase(r) + "/runs/" + run.RunID + "/tasks"
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) getStatus(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, RunStatus{RunID: run.RunID, State: run.State})
+}
+
+func (s *Server) listTasks(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	start, end, next, ok := s.page(w, r, len(run.TaskLogs))
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, TaskListResponse{TaskLogs: run.TaskLogs[start:end], NextPageToken: next})
+}
+
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request) (*logschema.Run, bool) {
+	run, err := s.store().GetRun(r.PathValue("run_id"))
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, http.StatusNotFound, "run not found")
+		return nil, false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	return run, true
+}
+
+// page interprets page_size/page_token (an offset) for a list of n items.
+func (s *Server) page(w http.ResponseWriter, r *http.Request, n int) (start, end int, next string, ok bool) {
+	size := s.pageSize()
+	if v := r.URL.Query().Get("page_size"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil || i <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid page_size")
+			return 0, 0, "", false
+		}
+		size = i
+	}
+	if v := r.URL.Query().Get("page_token"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 0 || i > n {
+			writeError(w, http.StatusBadRequest, "invalid page_token")
+			return 0, 0, "", false
+		}
+		start = i
+	}
+	end = start + size
+	if end >= n {
+		end = n
+	} else {
+		next = strconv.Itoa(end)
+	}
+	return start, end, next, true
+}
+
+// requestBase reconstructs the externally visible WES API root.
+func requestBase(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if p := r.Header.Get("X-Forwarded-Proto"); p != "" {
+		scheme = p
+	}
+	return scheme + "://" + r.Host + BasePath
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, ErrorResponse{Msg: msg, StatusCode: status})
+}
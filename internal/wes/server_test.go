@@ -0,0 +1,102 @@
+package wes_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+	"github.com/animeshs34/wes-logging-schema/internal/wes"
+)
+
+func TestFixtures_ValidateAsDeclared(t *testing.T) {
+	srv := wes.NewFixtureServer()
+	defer srv.Close()
+	c := &wes.Client{BaseURL: srv.BaseURL(), PageSize: 3}
+	v := &logschema.Validator{}
+
+	for _, f := range wes.Fixtures() {
+		t.Run(f.Run.RunID, func(t *testing.T) {
+			rep := c.ValidateRun(v, f.Run.RunID)
+			if rep.Err != nil {
+				t.Fatalf("unexpected error: %v", rep.Err)
+			}
+			if got := rep.Result.Valid(); got != f.Valid {
+				t.Errorf("%s: valid = %v, want %v (%+v)", f.Description, got, f.Valid, rep.Result)
+			}
+			if len(rep.Run.TaskLogs) != len(f.Run.TaskLogs) {
+				t.Errorf("got %d task logs, want %d", len(rep.Run.TaskLogs), len(f.Run.TaskLogs))
+			}
+		})
+	}
+}
+
+func TestFixtures_Fresh(t *testing.T) {
+	for _, f := range wes.Fixtures() {
+		if rl := f.Run.RunLog; rl != nil && rl.LogSchema != nil {
+			rl.LogSchema.Format = "mutated"
+		}
+		for i := range f.Run.TaskLogs {
+			if s := f.Run.TaskLogs[i].LogSchema; s != nil {
+				s.Format = "mutated"
+			}
+		}
+	}
+	for _, f := range wes.Fixtures() {
+		if rl := f.Run.RunLog; rl != nil && rl.LogSchema != nil && rl.LogSchema.Format == "mutated" {
+			t.Errorf("%s: run log_schema changed by an earlier caller", f.Run.RunID)
+		}
+	}
+}
+
+func TestDirStore(t *testing.T) {
+	store := &wes.DirStore{Dir: t.TempDir()}
+	for _, run := range wes.FixtureRuns() {
+		if err := store.PutRun(run); err != nil {
+			t.Fatalf("PutRun(%s): %v", run.RunID, err)
+		}
+	}
+
+	srv := httptest.NewServer(&wes.Server{Store: store})
+	defer srv.Close()
+	c := &wes.Client{BaseURL: srv.URL + wes.BasePath}
+
+	runs, err := c.AllRuns()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(runs) != len(wes.Fixtures()) {
+		t.Errorf("listed %d runs, want %d", len(runs), len(wes.Fixtures()))
+	}
+
+	run, err := c.GetFullRun("ro-crate-inherited")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(run.TaskLogs) != 2 || len(run.TaskLogs[0].Logs) != 2 {
+		t.Errorf("task and attempt logs not round-tripped: %+v", run.TaskLogs)
+	}
+
+	if _, err := store.GetRun("../escape"); err != wes.ErrNotFound {
+		t.Errorf("expected ErrNotFound for path traversal, got %v", err)
+	}
+}
+
+func TestServer_ServiceInfo(t *testing.T) {
+	srv := wes.NewFixtureServer()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.BaseURL() + "/service-info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var info wes.ServiceInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.SystemStateCounts["COMPLETE"] == 0 || len(info.SupportedLogFormats) == 0 {
+		t.Errorf("unexpected service info: %+v", info)
+	}
+}
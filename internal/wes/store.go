@@ -0,0 +1,144 @@
+package wes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+// ErrNotFound is returned by a Store for unknown run IDs.
+var ErrNotFound = errors.New("run not found")
+
+// Store holds the runs served by a Server.
+type Store interface {
+	// ListRuns returns every run, in a stable order.
+	ListRuns() ([]*logschema.Run, error)
+	// GetRun returns the run with the given ID, or ErrNotFound.
+	GetRun(runID string) (*logschema.Run, error)
+	// PutRun adds or replaces a run.
+	PutRun(run *logschema.Run) error
+}
+
+// MemoryStore is an in-memory Store that keeps runs in insertion order.
+type MemoryStore struct {
+	mu   sync.Mutex
+	runs []*logschema.Run
+}
+
+// NewMemoryStore returns a MemoryStore holding runs.
+func NewMemoryStore(runs ...*logschema.Run) *MemoryStore {
+	return &MemoryStore{runs: runs}
+}
+
+// ListRuns implements Store.
+func (s *MemoryStore) ListRuns() ([]*logschema.Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*logschema.Run(nil), s.runs...), nil
+}
+
+// GetRun implements Store.
+func (s *MemoryStore) GetRun(runID string) (*logschema.Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.runs {
+		if r.RunID == runID {
+			return r, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// PutRun implements Store.
+func (s *MemoryStore) PutRun(run *logschema.Run) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, r := range s.runs {
+		if r.RunID == run.RunID {
+			s.runs[i] = run
+			return nil
+		}
+	}
+	s.runs = append(s.runs, run)
+	return nil
+}
+
+// DirStore is a filesystem Store. Each run is a JSON document named
+// <run_id>.json in Dir, holding a GET /runs/{run_id} response including
+// its task_logs. Files are read on every request, so edits show up live.
+type DirStore struct {
+	Dir string
+}
+
+// ListRuns implements Store. Runs are ordered by file name.
+func (s *DirStore) ListRuns() ([]*logschema.Run, error) {
+	paths, err := filepath.Glob(filepath.Join(s.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	runs := make([]*logschema.Run, 0, len(paths))
+	for _, p := range paths {
+		run, err := readRunFile(p)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// GetRun implements Store.
+func (s *DirStore) GetRun(runID string) (*logschema.Run, error) {
+	p, err := s.path(runID)
+	if err != nil {
+		return nil, err
+	}
+	run, err := readRunFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return run, err
+}
+
+// PutRun implements Store.
+func (s *DirStore) PutRun(run *logschema.Run) error {
+	p, err := s.path(run.RunID)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, append(b, '\n'), 0o644)
+}
+
+func (s *DirStore) path(runID string) (string, error) {
+	if runID == "" || strings.ContainsAny(runID, `/\`) || runID == "." || runID == ".." {
+		return "", ErrNotFound
+	}
+	return filepath.Join(s.Dir, runID+".json"), nil
+}
+
+func readRunFile(p string) (*logschema.Run, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var run logschema.Run
+	if err := json.Unmarshal(b, &run); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", p, err)
+	}
+	if run.RunID == "" {
+		run.RunID = strings.TrimSuffix(filepath.Base(p), ".json")
+	}
+	return &run, nil
+}
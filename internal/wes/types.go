@@ -0,0 +1,40 @@
+// Package wes is a typed client for the GA4GH Workflow Execution Service API
+// that decodes runs into the logschema types, plus an in-process mock WES
+// server for tests.
+package wes
+
+import (
+	"fmt"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+)
+
+// RunStatus mirrors the WES RunStatus (GET /runs/{run_id}/status).
+type RunStatus struct {
+	RunID string `json:"run_id"`
+	State string `json:"state,omitempty"`
+}
+
+// RunListResponse mirrors the WES RunListResponse (GET /runs).
+type RunListResponse struct {
+	Runs          []RunStatus `json:"runs"`
+	NextPageToken string      `json:"next_page_token,omitempty"`
+}
+
+// TaskListResponse mirrors the WES TaskListResponse
+// (GET /runs/{run_id}/tasks).
+type TaskListResponse struct {
+	TaskLogs      []logschema.TaskLog `json:"task_logs"`
+	NextPageToken string              `json:"next_page_token,omitempty"`
+}
+
+// ErrorResponse mirrors the WES ErrorResponse body.
+type ErrorResponse struct {
+	Msg        string `json:"msg"`
+	StatusCode int    `json:"status_code"`
+}
+
+// Error implements the error interface.
+func (e *ErrorResponse) Error() string {
+	return fmt.Sprintf("WES error %d: %s", e.StatusCode, e.Msg)
+}
@@ -0,0 +1,66 @@
+package wesproxy
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+)
+
+// responseBuffer is an http.ResponseWriter that holds a handler's whole
+// response, so that it can be validated before any of it is sent. Like a
+// server's ResponseWriter it snapshots the header on WriteHeader, ignores
+// informational (1xx) responses and accepts Flush. Since the body is sent
+// at once with a Content-Length, trailers become ordinary header fields.
+type responseBuffer struct {
+	header http.Header
+	sent   http.Header // header as of the final WriteHeader
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseBuffer() *responseBuffer {
+	return &responseBuffer{header: http.Header{}}
+}
+
+func (b *responseBuffer) Header() http.Header {
+	return b.header
+}
+
+func (b *responseBuffer) WriteHeader(code int) {
+	if b.status != 0 || (code >= 100 && code < 200 && code != http.StatusSwitchingProtocols) {
+		return
+	}
+	b.status, b.sent = code, b.header.Clone()
+}
+
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(p)
+}
+
+// Flush implements http.Flusher. Nothing is sent until the handler
+// returns, so it does nothing.
+func (b *responseBuffer) Flush() {}
+
+// finish completes the response once the handler has returned: a handler
+// that wrote nothing sent 200, and declared or prefixed trailers are
+// folded into the header.
+func (b *responseBuffer) finish() {
+	b.WriteHeader(http.StatusOK)
+	for _, decl := range b.sent.Values("Trailer") {
+		for _, k := range strings.Split(decl, ",") {
+			if k = http.CanonicalHeaderKey(strings.TrimSpace(k)); k != "" {
+				if vs := b.header.Values(k); len(vs) > 0 {
+					b.sent[k] = vs
+				}
+			}
+		}
+	}
+	b.sent.Del("Trailer")
+	for k, vs := range b.header {
+		if name, ok := strings.CutPrefix(k, http.TrailerPrefix); ok {
+			b.sent.Del(k)
+			b.sent[http.CanonicalHeaderKey(name)] = vs
+		}
+	}
+}
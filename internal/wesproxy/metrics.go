@@ -0,0 +1,77 @@
+package wesproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Validation outcomes counted by Metrics.
+const (
+	outcomeValid   = "valid"
+	outcomeInvalid = "invalid"
+	outcomeError   = "error"
+)
+
+// RouteMetrics holds the counters for one route.
+type RouteMetrics struct {
+	Route   string        `json:"route"`
+	Total   int64         `json:"total"`
+	Valid   int64         `json:"valid"`
+	Invalid int64         `json:"invalid"`
+	Errors  int64         `json:"errors"`
+	Elapsed time.Duration `json:"elapsed_ns"`
+}
+
+// Metrics counts validation outcomes per route. It is safe for concurrent
+// use, and a nil *Metrics ignores observations.
+type Metrics struct {
+	mu     sync.Mutex
+	routes map[string]*RouteMetrics
+}
+
+func (m *Metrics) observe(route, outcome string, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.routes == nil {
+		m.routes = map[string]*RouteMetrics{}
+	}
+	rm := m.routes[route]
+	if rm == nil {
+		rm = &RouteMetrics{Route: route}
+		m.routes[route] = rm
+	}
+	rm.Total++
+	rm.Elapsed += elapsed
+	switch outcome {
+	case outcomeValid:
+		rm.Valid++
+	case outcomeInvalid:
+		rm.Invalid++
+	case outcomeError:
+		rm.Errors++
+	}
+}
+
+// Snapshot returns a copy of the counters, sorted by route.
+func (m *Metrics) Snapshot() []RouteMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]RouteMetrics, 0, len(m.routes))
+	for _, rm := range m.routes {
+		out = append(out, *rm)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Route < out[j].Route })
+	return out
+}
+
+// ServeHTTP serves the counters as JSON.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m.Snapshot())
+}
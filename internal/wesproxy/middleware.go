@@ -0,0 +1,388 @@
+// Package wesproxy enforces the WES structured-logging contract on server
+// responses. It provides net/http middleware that validates the run and
+// task payloads a WES server returns, and a reverse proxy built on it.
+package wesproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+	"github.com/animeshs34/wes-logging-schema/internal/wes"
+)
+
+// Policy decides what happens to a response once it has been validated.
+type Policy string
+
+const (
+	// PolicyPass only logs and counts validation outcomes.
+	PolicyPass Policy = "pass"
+	// PolicyAnnotate adds the validation outcome as response headers.
+	PolicyAnnotate Policy = "annotate"
+	// PolicyReport adds the headers and embeds the full report in the
+	// JSON body under "log_validation".
+	PolicyReport Policy = "report"
+	// PolicyReject replaces responses with invalid logs by a 502.
+	PolicyReject Policy = "reject"
+)
+
+// ParsePolicy converts a flag value into a Policy.
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(s); p {
+	case PolicyPass, PolicyAnnotate, PolicyReport, PolicyReject:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown policy %q (want pass, annotate, report or reject)", s)
+}
+
+// Headers set by PolicyAnnotate and PolicyReport.
+const (
+	HeaderValidation = "X-WES-Log-Validation"        // "valid" or "invalid"
+	HeaderErrors     = "X-WES-Log-Validation-Errors" // number of failing logs
+	HeaderRedactions = "X-WES-Log-Redactions"        // number of redacted values
+)
+
+// Routes that are validated.
+const (
+	RouteRun   = "run"
+	RouteTasks = "tasks"
+)
+
+// routePattern matches the validated routes below the base path.
+var routePattern = regexp.MustCompile(`^/runs/([^/]+)(/tasks)?/?$`)
+
+// Report is the validation outcome for one intercepted response.
+type Report struct {
+	Route  string               `json:"route"`
+	RunID  string               `json:"run_id"`
+	Valid  bool                 `json:"valid"`
+	Result *logschema.RunResult `json:"result"`
+
+	// Redactions lists what the Middleware's Redactor removed, if any.
+	Redactions *logschema.RedactionReport `json:"redactions,omitempty"`
+}
+
+// errorCount returns how many validated logs failed.
+func (r *Report) errorCount() int {
+	return r.Result.Failures()
+}
+
+// Middleware validates GET /runs/{run_id} and GET /runs/{run_id}/tasks
+// responses produced by the wrapped handler.
+type Middleware struct {
+	// BasePath is the WES API prefix the routes live under. Defaults to
+	// wes.BasePath; use "/" for a server mounted at the root. Requests
+	// outside it pass through unvalidated.
+	BasePath string
+
+	// Validator checks the structured logs. Defaults to a zero Validator.
+	Validator *logschema.Validator
+
+	// Policy selects what to do with validated responses.
+	// Defaults to PolicyPass.
+	Policy Policy
+
+	// Logger receives one record per validated response.
+	// Defaults to slog.Default().
+	Logger *slog.Logger
+
+	// Metrics, if set, collects per-route counters.
+	Metrics *Metrics
+
+	// Redactor, if set, redacts the run and task logs of intercepted
+	// responses before they are validated and served. A response that
+	// cannot be redacted is replaced by a 502 rather than served as is.
+	Redactor *logschema.Redactor
+}
+
+func (m *Middleware) validator() *logschema.Validator {
+	if m.Validator != nil {
+		return m.Validator
+	}
+	return &logschema.Validator{}
+}
+
+// match returns the route and run ID of a request path, or ok false for
+// paths that are not validated.
+func (m *Middleware) match(path string) (route, runID string, ok bool) {
+	base := m.BasePath
+	if base == "" {
+		base = wes.BasePath
+	}
+	rest, ok := strings.CutPrefix(path, strings.TrimSuffix(base, "/"))
+	if !ok {
+		return "", "", false
+	}
+	sub := routePattern.FindStringSubmatch(rest)
+	if sub == nil || sub[1] == "status" {
+		return "", "", false
+	}
+	if sub[2] != "" {
+		return RouteTasks, sub[1], true
+	}
+	return RouteRun, sub[1], true
+}
+
+func (m *Middleware) logger() *slog.Logger {
+	if m.Logger != nil {
+		return m.Logger
+	}
+	return slog.Default()
+}
+
+func (m *Middleware) policy() Policy {
+	if m.Policy == "" {
+		return PolicyPass
+	}
+	return m.Policy
+}
+
+// Wrap returns next with response validation applied.
+func (m *Middleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, runID, ok := m.match(r.URL.Path)
+		if r.Method != http.MethodGet || !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		resp := newResponseBuffer()
+		next.ServeHTTP(resp, r)
+		resp.finish()
+		body := resp.body.Bytes()
+
+		if resp.status != http.StatusOK || !isPlainJSON(resp.sent) {
+			copyResponse(w, resp.sent, resp.status, body)
+			return
+		}
+
+		// A tasks page inherits the log_schema of its run, which is
+		// fetched once for both redaction and validation.
+		var parent *logschema.LogSchema
+		if route == RouteTasks {
+			parent = m.parentSchema(next, r)
+		}
+
+		var redactions *logschema.RedactionReport
+		if m.Redactor != nil {
+			redacted, rrep, err := m.redact(route, body, parent)
+			if err != nil {
+				m.logger().Error("structured log redaction failed",
+					"route", route, "run_id", runID, "path", r.URL.Path, "error", err)
+				writeError(w, http.Header{}, http.StatusBadGateway, fmt.Sprintf("cannot redact the upstream response for run %s", runID))
+				return
+			}
+			body, redactions = redacted, rrep
+		}
+
+		start := time.Now()
+		rep, err := m.validate(route, runID, body, parent)
+		elapsed := time.Since(start)
+		if err != nil {
+			m.Metrics.observe(route, outcomeError, elapsed)
+			m.logger().Warn("structured log validation failed",
+				"route", route, "run_id", runID, "path", r.URL.Path, "error", err)
+			copyResponse(w, resp.sent, resp.status, body)
+			return
+		}
+		rep.Redactions = redactions
+
+		outcome := outcomeValid
+		if !rep.Valid {
+			outcome = outcomeInvalid
+		}
+		m.Metrics.observe(route, outcome, elapsed)
+		m.logger().Info("structured log validation",
+			"route", route, "run_id", rep.RunID, "path", r.URL.Path,
+			"valid", rep.Valid, "failing_logs", rep.errorCount(), "redacted_values", rep.redactionCount(), "elapsed", elapsed)
+
+		m.respond(w, resp.sent, body, rep)
+	})
+}
+
+// validate decodes an intercepted body and runs whole-run validation. For
+// the tasks route parent is the run's log_schema, so that schema
+// inheritance from the run applies.
+func (m *Middleware) validate(route, runID string, body []byte, parent *logschema.LogSchema) (*Report, error) {
+	rep := &Report{Route: route, RunID: runID}
+	var err error
+	switch route {
+	case RouteRun:
+		var run logschema.Run
+		if err := json.Unmarshal(body, &run); err != nil {
+			return nil, fmt.Errorf("decoding run: %w", err)
+		}
+		rep.Result, err = m.validator().ValidateRun(run.RunLog, run.TaskLogs)
+	case RouteTasks:
+		var page wes.TaskListResponse
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("decoding task list: %w", err)
+		}
+		rep.Result, err = m.validator().ValidateRun(&logschema.RunLog{LogSchema: parent}, page.TaskLogs)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rep.Valid = rep.Result.Valid()
+	return rep, nil
+}
+
+// redact applies the Redactor to an intercepted body. Only run_log and
+// task_logs are re-encoded; other members pass through unchanged. For the
+// tasks route the parent log_schema decides how task logs are parsed.
+func (m *Middleware) redact(route string, body []byte, parent *logschema.LogSchema) ([]byte, *logschema.RedactionReport, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, nil, fmt.Errorf("decoding response: %w", err)
+	}
+	var (
+		rl    *logschema.RunLog
+		tasks []logschema.TaskLog
+	)
+	if raw, ok := doc["task_logs"]; ok {
+		if err := json.Unmarshal(raw, &tasks); err != nil {
+			return nil, nil, fmt.Errorf("decoding task_logs: %w", err)
+		}
+	}
+	switch route {
+	case RouteRun:
+		if raw, ok := doc["run_log"]; ok {
+			if err := json.Unmarshal(raw, &rl); err != nil {
+				return nil, nil, fmt.Errorf("decoding run_log: %w", err)
+			}
+		}
+	case RouteTasks:
+		rl = &logschema.RunLog{LogSchema: parent}
+	}
+
+	rep, err := m.Redactor.RedactRun(rl, tasks)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rep.Count() == 0 {
+		return body, rep, nil
+	}
+	if route == RouteRun && rl != nil {
+		if doc["run_log"], err = json.Marshal(rl); err != nil {
+			return nil, nil, err
+		}
+	}
+	if tasks != nil {
+		if doc["task_logs"], err = json.Marshal(tasks); err != nil {
+			return nil, nil, err
+		}
+	}
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, rep, nil
+}
+
+// redactionCount returns how many values were redacted.
+func (r *Report) redactionCount() int {
+	if r.Redactions == nil {
+		return 0
+	}
+	return r.Redactions.Count()
+}
+
+// parentSchema fetches the run that owns a tasks page from next and
+// returns its log_schema, or nil if it cannot be determined.
+func (m *Middleware) parentSchema(next http.Handler, r *http.Request) *logschema.LogSchema {
+	sub := r.Clone(r.Context())
+	sub.URL.Path = strings.TrimSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/tasks")
+	sub.URL.RawPath = ""
+	sub.URL.RawQuery = ""
+	sub.RequestURI = ""
+	sub.Header.Del("Accept-Encoding")
+
+	resp := newResponseBuffer()
+	next.ServeHTTP(resp, sub)
+	resp.finish()
+	if resp.status != http.StatusOK {
+		return nil
+	}
+	var run logschema.Run
+	if json.Unmarshal(resp.body.Bytes(), &run) != nil || run.RunLog == nil {
+		return nil
+	}
+	return run.RunLog.LogSchema
+}
+
+// respond writes the intercepted response according to the policy.
+func (m *Middleware) respond(w http.ResponseWriter, header http.Header, body []byte, rep *Report) {
+	policy := m.policy()
+	if policy == PolicyReject && !rep.Valid {
+		msg := fmt.Sprintf("upstream returned %d invalid structured log(s) for run %s", rep.errorCount(), rep.RunID)
+		h := http.Header{}
+		h.Set(HeaderValidation, "invalid")
+		h.Set(HeaderErrors, strconv.Itoa(rep.errorCount()))
+		writeError(w, h, http.StatusBadGateway, msg)
+		return
+	}
+
+	if policy == PolicyAnnotate || policy == PolicyReport || policy == PolicyReject {
+		state := "valid"
+		if !rep.Valid {
+			state = "invalid"
+		}
+		header.Set(HeaderValidation, state)
+		header.Set(HeaderErrors, strconv.Itoa(rep.errorCount()))
+		if rep.Redactions != nil {
+			header.Set(HeaderRedactions, strconv.Itoa(rep.redactionCount()))
+		}
+	}
+	if policy == PolicyReport {
+		if annotated, err := embedReport(body, rep); err == nil {
+			body = annotated
+		}
+	}
+	copyResponse(w, header, http.StatusOK, body)
+}
+
+// embedReport adds rep to a JSON object body under "log_validation".
+func embedReport(body []byte, rep *Report) ([]byte, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(rep)
+	if err != nil {
+		return nil, err
+	}
+	doc["log_validation"] = raw
+	return json.Marshal(doc)
+}
+
+// isPlainJSON reports whether a response body can be decoded as-is.
+func isPlainJSON(h http.Header) bool {
+	if enc := h.Get("Content-Encoding"); enc != "" && enc != "identity" {
+		return false
+	}
+	ct := h.Get("Content-Type")
+	return ct == "" || strings.Contains(ct, "json")
+}
+
+// writeError writes a WES ErrorResponse.
+func writeError(w http.ResponseWriter, header http.Header, status int, msg string) {
+	b, _ := json.Marshal(wes.ErrorResponse{Msg: msg, StatusCode: status})
+	header.Set("Content-Type", "application/json")
+	copyResponse(w, header, status, b)
+}
+
+func copyResponse(w http.ResponseWriter, header http.Header, status int, body []byte) {
+	for k, vs := range header {
+		w.Header()[k] = vs
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	bytes.NewReader(body).WriteTo(w)
+}
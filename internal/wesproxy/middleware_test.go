@@ -0,0 +1,289 @@
+package wesproxy_test
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/animeshs34/wes-logging-schema/internal/logschema"
+	"github.com/animeshs34/wes-logging-schema/internal/wes"
+	"github.com/animeshs34/wes-logging-schema/internal/wesproxy"
+)
+
+const crate = `{"@context": "https://w3id.org/ro/crate/1.1/context", "@graph": []}`
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func upstream(t *testing.T) *wes.MockServer {
+	t.Helper()
+	schema := &logschema.LogSchema{SchemaURI: "https://w3id.org/ro/crate/1.1", Format: logschema.FormatROCrate}
+	srv := wes.NewMockServer(
+		&logschema.Run{
+			RunID:    "good",
+			RunLog:   &logschema.RunLog{StructuredLog: crate, LogSchema: schema},
+			TaskLogs: []logschema.TaskLog{{ID: "t1", StructuredLog: crate}}, // inherits run schema
+		},
+		&logschema.Run{
+			RunID:    "bad",
+			RunLog:   &logschema.RunLog{StructuredLog: crate},
+			TaskLogs: []logschema.TaskLog{{ID: "t1", StructuredLog: `{"@context": "x"}`}},
+		},
+	)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func proxy(t *testing.T, policy wesproxy.Policy, metrics *wesproxy.Metrics) *httptest.Server {
+	t.Helper()
+	up, err := url.Parse(upstream(t).URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &wesproxy.Middleware{
+		Policy:  policy,
+		Metrics: metrics,
+		Logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	srv := httptest.NewServer(wesproxy.NewReverseProxy(up, m))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func get(t *testing.T, srv *httptest.Server, path string) (*http.Response, []byte) {
+	t.Helper()
+	resp, err := http.Get(srv.URL + wes.BasePath + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+func TestMiddleware_Policies(t *testing.T) {
+	tests := []struct {
+		policy     wesproxy.Policy
+		path       string
+		wantStatus int
+		wantHeader string
+	}{
+		{wesproxy.PolicyPass, "/runs/bad", http.StatusOK, ""},
+		{wesproxy.PolicyAnnotate, "/runs/good", http.StatusOK, "valid"},
+		{wesproxy.PolicyAnnotate, "/runs/bad", http.StatusOK, "invalid"},
+		{wesproxy.PolicyAnnotate, "/runs/good/tasks", http.StatusOK, "valid"},
+		{wesproxy.PolicyAnnotate, "/runs/bad/tasks", http.StatusOK, "invalid"},
+		{wesproxy.PolicyReject, "/runs/good", http.StatusOK, "valid"},
+		{wesproxy.PolicyReject, "/runs/bad", http.StatusBadGateway, "invalid"},
+		{wesproxy.PolicyReject, "/runs/bad/status", http.StatusOK, ""},
+		{wesproxy.PolicyReject, "/runs/missing", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy)+" "+tt.path, func(t *testing.T) {
+			resp, body := get(t, proxy(t, tt.policy, nil), tt.path)
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+			if got := resp.Header.Get(wesproxy.HeaderValidation); got != tt.wantHeader {
+				t.Errorf("%s = %q, want %q", wesproxy.HeaderValidation, got, tt.wantHeader)
+			}
+		})
+	}
+}
+
+func TestMiddleware_BuffersLikeAServer(t *testing.T) {
+	run := `{"run_id": "good", "run_log": {"structured_log": ` + jsonString(crate) +
+		`, "log_schema": {"schema_uri": "https://w3id.org/ro/crate/1.1", "format": "ro-crate"}}}`
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</schema>; rel=preload")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Trailer", "X-Checksum")
+		w.WriteHeader(http.StatusOK)
+		w.Header().Set("X-Late", "ignored")
+		io.WriteString(w, run[:10])
+		w.(http.Flusher).Flush()
+		io.WriteString(w, run[10:])
+		w.Header().Set("X-Checksum", "abc")
+		w.Header().Set(http.TrailerPrefix+"X-Undeclared", "def")
+	})
+	m := &wesproxy.Middleware{Policy: wesproxy.PolicyAnnotate, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	rec := httptest.NewRecorder()
+	m.Wrap(next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, wes.BasePath+"/runs/good", nil))
+
+	resp := rec.Result()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != run {
+		t.Fatalf("got %d %s", resp.StatusCode, body)
+	}
+	if got := resp.Header.Get(wesproxy.HeaderValidation); got != "valid" {
+		t.Errorf("%s = %q", wesproxy.HeaderValidation, got)
+	}
+	if resp.Header.Get("X-Checksum") != "abc" || resp.Header.Get("X-Undeclared") != "def" || resp.Header.Get("X-Late") != "" || resp.Header.Get("Trailer") != "" {
+		t.Errorf("header = %v", resp.Header)
+	}
+}
+
+func TestMiddleware_ReportEmbedsResult(t *testing.T) {
+	_, body := get(t, proxy(t, wesproxy.PolicyReport, nil), "/runs/bad/tasks")
+	var doc struct {
+		TaskLogs      []logschema.TaskLog `json:"task_logs"`
+		LogValidation wesproxy.Report     `json:"log_validation"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	if len(doc.TaskLogs) != 1 || doc.LogValidation.Valid || doc.LogValidation.Route != wesproxy.RouteTasks {
+		t.Errorf("unexpected report: %+v", doc.LogValidation)
+	}
+}
+
+func TestMiddleware_Metrics(t *testing.T) {
+	metrics := &wesproxy.Metrics{}
+	srv := proxy(t, wesproxy.PolicyPass, metrics)
+	get(t, srv, "/runs/good")
+	get(t, srv, "/runs/bad")
+	get(t, srv, "/runs/bad/tasks")
+
+	snap := metrics.Snapshot()
+	if len(snap) != 2 {
+		t.Fatalf("expected run and tasks routes, got %+v", snap)
+	}
+	run, tasks := snap[0], snap[1]
+	if run.Route != wesproxy.RouteRun || run.Total != 2 || run.Valid != 1 || run.Invalid != 1 {
+		t.Errorf("unexpected run metrics: %+v", run)
+	}
+	if tasks.Route != wesproxy.RouteTasks || tasks.Total != 1 || tasks.Invalid != 1 {
+		t.Errorf("unexpected tasks metrics: %+v", tasks)
+	}
+}
+
+func TestMiddleware_Redaction(t *testing.T) {
+	schema := &logschema.LogSchema{SchemaURI: "https://w3id.org/ro/crate/1.1", Format: logschema.FormatROCrate}
+	patient := `{"@context": "https://w3id.org/ro/crate/1.1/context", "@graph": [{"@id": "#s1", "@type": "File", "patientName": "Jane Doe"}]}`
+	up := wes.NewMockServer(&logschema.Run{
+		RunID:    "secret",
+		RunLog:   &logschema.RunLog{Cmd: []string{"run", "--token=hunter2"}, StructuredLog: patient, LogSchema: schema},
+		TaskLogs: []logschema.TaskLog{{ID: "t1", StructuredLog: patient, Metadata: map[string]string{"patientName": "Jane Doe"}}},
+	})
+	t.Cleanup(up.Close)
+	u, err := url.Parse(up.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redactor, err := logschema.NewRedactor([]logschema.RedactionRule{
+		{Pattern: `--token=\S+`, Replacement: "--token=***"},
+		{Property: "patientName"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &wesproxy.Middleware{
+		Policy:   wesproxy.PolicyReport,
+		Logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Redactor: redactor,
+	}
+	srv := httptest.NewServer(wesproxy.NewReverseProxy(u, m))
+	t.Cleanup(srv.Close)
+
+	for _, path := range []string{"/runs/secret", "/runs/secret/tasks"} {
+		t.Run(path, func(t *testing.T) {
+			resp, body := get(t, srv, path)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d: %s", resp.StatusCode, body)
+			}
+			for _, secret := range []string{"hunter2", "Jane Doe"} {
+				if strings.Contains(string(body), secret) {
+					t.Errorf("%q served unredacted: %s", secret, body)
+				}
+			}
+			if resp.Header.Get(wesproxy.HeaderRedactions) == "" || resp.Header.Get(wesproxy.HeaderValidation) != "valid" {
+				t.Errorf("headers = %v", resp.Header)
+			}
+			var doc struct {
+				LogValidation wesproxy.Report `json:"log_validation"`
+			}
+			if err := json.Unmarshal(body, &doc); err != nil {
+				t.Fatalf("body is not JSON: %v", err)
+			}
+			if r := doc.LogValidation.Redactions; r == nil || len(r.Redactions) == 0 {
+				t.Errorf("report has no redactions: %+v", doc.LogValidation)
+			}
+		})
+	}
+}
+
+func TestMiddleware_BasePath(t *testing.T) {
+	up := upstream(t)
+	// next serves the WES API under both wes.BasePath and /api.
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rest, ok := strings.CutPrefix(r.URL.Path, "/api"); ok {
+			r.URL.Path = wes.BasePath + rest
+		}
+		up.WES.ServeHTTP(w, r)
+	})
+	tests := []struct {
+		basePath   string
+		path       string
+		wantHeader string
+	}{
+		{"", wes.BasePath + "/runs/bad", "invalid"},
+		{"", "/runs/bad", ""},
+		{"", "/other" + wes.BasePath + "/runs/bad", ""},
+		{"/api", "/api/runs/bad/tasks", "invalid"},
+		{"/api/", "/api/runs/good", "valid"},
+		{"/api", wes.BasePath + "/runs/bad", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.basePath+" "+tt.path, func(t *testing.T) {
+			m := &wesproxy.Middleware{
+				BasePath: tt.basePath,
+				Policy:   wesproxy.PolicyAnnotate,
+				Logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+			rec := httptest.NewRecorder()
+			m.Wrap(next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if got := rec.Result().Header.Get(wesproxy.HeaderValidation); got != tt.wantHeader {
+				t.Errorf("%s = %q, want %q", wesproxy.HeaderValidation, got, tt.wantHeader)
+			}
+		})
+	}
+}
+
+func TestMiddleware_ParentFetchedOnce(t *testing.T) {
+	up := upstream(t)
+	var runGets int
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == wes.BasePath+"/runs/good" {
+			runGets++
+		}
+		up.WES.ServeHTTP(w, r)
+	})
+	redactor, err := logschema.NewRedactor([]logschema.RedactionRule{{Property: "patientName"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &wesproxy.Middleware{
+		Policy:   wesproxy.PolicyAnnotate,
+		Logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Redactor: redactor,
+	}
+	rec := httptest.NewRecorder()
+	m.Wrap(next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, wes.BasePath+"/runs/good/tasks", nil))
+	if got := rec.Result().Header.Get(wesproxy.HeaderValidation); got != "valid" {
+		t.Errorf("%s = %q, want valid", wesproxy.HeaderValidation, got)
+	}
+	if runGets != 1 {
+		t.Errorf("parent run fetched %d times, want 1", runGets)
+	}
+}
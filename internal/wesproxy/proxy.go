@@ -0,0 +1,21 @@
+package wesproxy
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+)
+
+// NewReverseProxy returns a reverse proxy to upstream whose run and task
+// responses are validated by m. Upstream compression is disabled so that
+// response bodies can be inspected.
+func NewReverseProxy(upstream *url.URL, m *Middleware) http.Handler {
+	rp := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(upstream)
+			pr.SetXForwarded()
+			pr.Out.Header.Del("Accept-Encoding")
+		},
+	}
+	return m.Wrap(rp)
+}